@@ -0,0 +1,126 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AccessDestination is one in-cluster endpoint the gateway forwards to:
+// a Service port, or a host and port.
+// +kubebuilder:validation:XValidation:rule="has(self.service) != has(self.host)",message="exactly one of service and host must be set"
+type AccessDestination struct {
+	// Name is the routing key; the destination is reached as
+	// <name>.<accessTarget>.target through the gateway.
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// Namespace the destination belongs to. Its sessions are recorded
+	// there, and a Service is looked up there.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Namespace string `json:"namespace"`
+
+	// Service is the name of a Service in Namespace, dialed by its cluster
+	// DNS name.
+	// +optional
+	Service string `json:"service,omitempty"`
+
+	// Host is a host name or IP address, for endpoints without a Service.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Port is the TCP port to forward to. A connection must ask for this
+	// port.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+}
+
+// AccessTargetSpec defines the desired state of AccessTarget.
+//
+// Like AccessProfiles, AccessTargets open a way into the cluster that the
+// sandbox model does not bound: the gateway forwards to any endpoint they
+// list. Their creation must be restricted to administrators.
+// +kubebuilder:validation:XValidation:rule="!has(self.notBefore) || !has(self.notAfter) || self.notBefore < self.notAfter",message="notBefore must be before notAfter"
+type AccessTargetSpec struct {
+	// Destinations are the endpoints the gateway forwards to.
+	// +kubebuilder:validation:MinItems=1
+	// +listType=map
+	// +listMapKey=name
+	Destinations []AccessDestination `json:"destinations"`
+
+	// Principals are the identities (certificate principals) that may
+	// connect. Empty means nobody may.
+	// +optional
+	Principals []string `json:"principals,omitempty"`
+
+	// NotBefore refuses connections until this time.
+	// +optional
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+
+	// NotAfter refuses connections from this time on, and closes those
+	// still open.
+	// +optional
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+
+	// MaxSessionDuration closes each connection after this long.
+	// +optional
+	MaxSessionDuration *metav1.Duration `json:"maxSessionDuration,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=at
+// +kubebuilder:printcolumn:name="Not After",type=date,JSONPath=`.spec.notAfter`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// AccessTarget lets the gateway act as a bastion: the listed principals may
+// forward through its SSH jump host to the listed in-cluster endpoints.
+type AccessTarget struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitzero"`
+
+	// spec defines the desired state of AccessTarget
+	// +required
+	Spec AccessTargetSpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// AccessTargetList contains a list of AccessTarget
+type AccessTargetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitzero"`
+	Items           []AccessTarget `json:"items"`
+}
+
+// Destination returns the destination named name, or nil.
+func (t *AccessTarget) Destination(name string) *AccessDestination {
+	for i := range t.Spec.Destinations {
+		if t.Spec.Destinations[i].Name == name {
+			return &t.Spec.Destinations[i]
+		}
+	}
+	return nil
+}
+
+func init() {
+	SchemeBuilder.Register(&AccessTarget{}, &AccessTargetList{})
+}
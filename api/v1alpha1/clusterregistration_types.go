@@ -0,0 +1,83 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultKubeconfigKey is the Secret key a kubeconfig is read from when
+// none is given.
+const DefaultKubeconfigKey = "kubeconfig"
+
+// KubeconfigSecretReference names a Secret in the gateway's namespace
+// that holds a kubeconfig.
+type KubeconfigSecretReference struct {
+	// Name of the Secret.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Key of the kubeconfig in the Secret. Defaults to "kubeconfig".
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// ClusterRegistrationSpec defines the desired state of ClusterRegistration.
+//
+// The kubeconfig's identity is what the gateway acts as in the member
+// cluster: it reads Sandboxes, wakes them, and writes SandboxSessions
+// there, so it needs the gateway's own role in that cluster and no more.
+type ClusterRegistrationSpec struct {
+	// KubeconfigSecretRef names the Secret holding the member cluster's
+	// kubeconfig, in the gateway's namespace.
+	KubeconfigSecretRef KubeconfigSecretReference `json:"kubeconfigSecretRef"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=cr
+// +kubebuilder:printcolumn:name="Secret",type=string,JSONPath=`.spec.kubeconfigSecretRef.name`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:validation:XValidation:rule="self.metadata.name.matches('^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$')",message="name must be a DNS label"
+// +kubebuilder:validation:XValidation:rule="self.metadata.name != 'target'",message="name is reserved for access targets"
+
+// ClusterRegistration joins a member cluster to the gateway. Its Sandboxes
+// are reached as <sandbox>.<namespace>.<name> through the one gateway,
+// which reads them and records their sessions in that cluster.
+type ClusterRegistration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitzero"`
+
+	// spec defines the desired state of ClusterRegistration
+	// +required
+	Spec ClusterRegistrationSpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterRegistrationList contains a list of ClusterRegistration
+type ClusterRegistrationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitzero"`
+	Items           []ClusterRegistration `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterRegistration{}, &ClusterRegistrationList{})
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -46,6 +47,18 @@ const (
 	AuthModeNone AuthMode = "none"
 )
 
+// ExposedPortKind selects how the gateway reaches an exposed port.
+// +kubebuilder:validation:Enum=http;tcp
+type ExposedPortKind string
+
+const (
+	// ExposedPortHTTP is routed by the gateway's HTTP proxy.
+	ExposedPortHTTP ExposedPortKind = "http"
+	// ExposedPortTCP is not routed over HTTP; the owner reaches it through
+	// the SSH jump host, e.g. with ssh -J gw -L 5432:<sandbox>:5432.
+	ExposedPortTCP ExposedPortKind = "tcp"
+)
+
 // RetainPolicy controls what happens to the home volume when the Sandbox is
 // deleted.
 // +kubebuilder:validation:Enum=Retain;Delete
@@ -74,7 +87,10 @@ type OwnerSpec struct {
 }
 
 // ExposedPort declares an HTTP port on the sandbox that the gateway routes
-// to via host-based routing (<port>--<sandbox>--<namespace>.<baseDomain>).
+// to via host-based routing (<port>--<sandbox>--<namespace>.<baseDomain>)
+// or path-based routing (/s/<namespace>/<sandbox>/<port>/), or a TCP port
+// the owner forwards to through the SSH jump host.
+// +kubebuilder:validation:XValidation:rule="(has(self.kind) && self.kind == 'tcp') || has(self.auth)",message="http ports require auth"
 type ExposedPort struct {
 	// Name is the routing key; it becomes the first label segment of the
 	// hostname. Must be a DNS label without consecutive hyphens so the
@@ -89,8 +105,17 @@ type ExposedPort struct {
 	// +kubebuilder:validation:Maximum=65535
 	Port int32 `json:"port"`
 
-	// Auth selects gateway authentication for this port.
-	Auth AuthMode `json:"auth"`
+	// Kind is http (the default) or tcp. Any exposed port, of either kind,
+	// is reachable by the owner through the SSH jump host; tcp ports are
+	// not routed over HTTP.
+	// +kubebuilder:default=http
+	// +optional
+	Kind ExposedPortKind `json:"kind,omitempty"`
+
+	// Auth selects gateway authentication for this port. Required for
+	// http ports; tcp ports are reachable by the owner only.
+	// +optional
+	Auth AuthMode `json:"auth,omitempty"`
 
 	// AllowedUsers optionally grants access to OIDC identities besides the
 	// owner. Only meaningful with auth: oidc.
@@ -101,6 +126,31 @@ type ExposedPort struct {
 	// owner. Only meaningful with auth: oidc.
 	// +optional
 	AllowedGroups []string `json:"allowedGroups,omitempty"`
+
+	// ShareLinks, when set, lets the owner hand out signed, expiring links
+	// to this port with kubepark share, for people without a login. Only
+	// meaningful with auth: oidc.
+	// +optional
+	ShareLinks *ShareLinkPolicy `json:"shareLinks,omitempty"`
+}
+
+// ShareLinkPolicy bounds the share links an owner may create for a port.
+type ShareLinkPolicy struct {
+	// MaxTTL caps how long a share link stays valid. Defaults to 24h.
+	// +optional
+	MaxTTL *metav1.Duration `json:"maxTTL,omitempty"`
+
+	// ReadOnly forces every link to allow only GET, HEAD and OPTIONS
+	// requests, without WebSocket upgrades. Without it, the owner chooses
+	// per link.
+	// +optional
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// RequestsPerMinute rate-limits each link on each gateway replica.
+	// Defaults to 60.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RequestsPerMinute *int32 `json:"requestsPerMinute,omitempty"`
 }
 
 // HomeSpec configures the sandbox home volume.
@@ -126,12 +176,49 @@ type HomeSpec struct {
 	RetainPolicy RetainPolicy `json:"retainPolicy,omitempty"`
 }
 
+// SourceSpec is a git repository cloned into the home when the sandbox is
+// first provisioned.
+type SourceSpec struct {
+	// URL is the repository to clone: https://, ssh:// or scp-like
+	// (git@host:org/repo.git).
+	// +kubebuilder:validation:Pattern=`^(https?://|ssh://|[^@/:]+@[^/:]+:).+`
+	URL string `json:"url"`
+
+	// Ref is the branch, tag or full commit SHA to check out. Empty means
+	// the repository's default branch.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// Dir is where the repository is cloned, relative to the home
+	// directory. Defaults to the repository name.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[^/]`
+	// +kubebuilder:validation:XValidation:rule="!self.split('/').exists(s, s == '..')",message="dir must stay inside the home directory"
+	Dir string `json:"dir,omitempty"`
+
+	// CredentialsSecretRef names a Secret in the sandbox namespace holding
+	// either username and password (a token for https), or
+	// ssh-privatekey with an optional known_hosts (for ssh).
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+
+	// Devcontainer is the path of a devcontainer.json in the repository,
+	// such as .devcontainer/devcontainer.json. It is read on every start
+	// and applied over the template's configuration; the first pod is
+	// recreated once it is known, later changes apply on the next resume.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[^/]`
+	// +kubebuilder:validation:XValidation:rule="!self.split('/').exists(s, s == '..')",message="devcontainer must stay inside the repository"
+	Devcontainer string `json:"devcontainer,omitempty"`
+}
+
 // SandboxSpec defines the desired state of Sandbox.
 type SandboxSpec struct {
 	// Template names the cluster-scoped SandboxTemplate this sandbox is
-	// built from.
-	// +kubebuilder:validation:MinLength=1
-	Template string `json:"template"`
+	// built from. When empty, the controller sets it to the owner's
+	// UserProfile defaultTemplate.
+	// +optional
+	Template string `json:"template,omitempty"`
 
 	// AccessProfile optionally names a cluster-scoped AccessProfile whose
 	// grants are translated into RBAC for this sandbox's ServiceAccount.
@@ -154,7 +241,7 @@ type SandboxSpec struct {
 	// +optional
 	IdleTimeout *metav1.Duration `json:"idleTimeout,omitempty"`
 
-	// ExposedPorts are HTTP ports routed by the gateway.
+	// ExposedPorts are ports routed by the gateway.
 	// +optional
 	// +listType=map
 	// +listMapKey=name
@@ -163,6 +250,11 @@ type SandboxSpec struct {
 	// Home configures the home volume.
 	// +optional
 	Home *HomeSpec `json:"home,omitempty"`
+
+	// Source is cloned into the home when it does not exist there yet,
+	// so a fresh home starts with the repository checked out.
+	// +optional
+	Source *SourceSpec `json:"source,omitempty"`
 }
 
 // SandboxPhase is a coarse, derived summary of the sandbox state. The
@@ -188,6 +280,16 @@ const (
 	ConditionHomeReady        = "HomeReady"
 	ConditionRBACReady        = "RBACReady"
 	ConditionTemplateOutdated = "TemplateOutdated"
+	// ConditionSourceReady reports the clone of spec.source.
+	ConditionSourceReady = "SourceReady"
+	// ConditionDevcontainer reports how a devcontainer.json was applied.
+	ConditionDevcontainer = "Devcontainer"
+	// Lifecycle hook outcomes, set only for hooks the template defines.
+	ConditionPostCreateHook = "PostCreateHook"
+	ConditionPostStartHook  = "PostStartHook"
+	ConditionPreSuspendHook = "PreSuspendHook"
+	// ConditionDotfiles reports the install of the owner's dotfiles.
+	ConditionDotfiles = "Dotfiles"
 )
 
 // Condition reasons.
@@ -201,8 +303,52 @@ const (
 	ReasonRunning             = "Running"
 	ReasonUpToDate            = "UpToDate"
 	ReasonOutdated            = "Outdated"
+	ReasonHookRunning         = "HookRunning"
+	ReasonHookSucceeded       = "HookSucceeded"
+	ReasonHookFailed          = "HookFailed"
+	ReasonHookUnreachable     = "HookUnreachable"
+	ReasonNoTemplate          = "NoTemplate"
+	ReasonCloning             = "Cloning"
+	ReasonCloned              = "Cloned"
+	ReasonCloneFailed         = "CloneFailed"
+	ReasonEgressBlocked       = "EgressBlocked"
+	ReasonApplied             = "Applied"
+	ReasonUnsupported         = "UnsupportedProperties"
+	ReasonInvalidDevcontainer = "InvalidDevcontainer"
+	ReasonPending             = "Pending"
 )
 
+// SandboxActivity records when the agent last saw each kind of activity.
+type SandboxActivity struct {
+	// LastInputTime is the last keystroke on an interactive terminal.
+	// +optional
+	LastInputTime *metav1.Time `json:"lastInputTime,omitempty"`
+
+	// LastCPUTime is the last time container CPU usage exceeded the idle
+	// policy's threshold.
+	// +optional
+	LastCPUTime *metav1.Time `json:"lastCPUTime,omitempty"`
+
+	// LastPortForwardTime is the last traffic through a port forward.
+	// +optional
+	LastPortForwardTime *metav1.Time `json:"lastPortForwardTime,omitempty"`
+}
+
+// DevcontainerStatus is the devcontainer.json configuration in effect.
+type DevcontainerStatus struct {
+	// Report is what the clone step read from spec.source.devcontainer, in
+	// kubepark's normalized form. The next pod is built from it.
+	// +optional
+	Report string `json:"report,omitempty"`
+
+	// ExposedPorts are the devcontainer's forwardPorts, routed by the
+	// gateway like spec.exposedPorts.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	ExposedPorts []ExposedPort `json:"exposedPorts,omitempty"`
+}
+
 // SandboxStatus defines the observed state of Sandbox.
 type SandboxStatus struct {
 	// Phase is a derived one-word summary; conditions are authoritative.
@@ -244,6 +390,16 @@ type SandboxStatus struct {
 	// +optional
 	LastActivityTime *metav1.Time `json:"lastActivityTime,omitempty"`
 
+	// Activity is the latest activity reported by the in-sandbox agent,
+	// polled while the template's idle policy uses agent signals.
+	// +optional
+	Activity *SandboxActivity `json:"activity,omitempty"`
+
+	// Devcontainer is the devcontainer.json configuration in effect, when
+	// the template or source has one.
+	// +optional
+	Devcontainer *DevcontainerStatus `json:"devcontainer,omitempty"`
+
 	// ActiveSessions is display-only; the suspend decision is always
 	// computed from the live SandboxSession list.
 	// +optional
@@ -263,6 +419,7 @@ type SandboxStatus struct {
 // +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 // +kubebuilder:validation:XValidation:rule="!self.metadata.name.contains('--')",message="sandbox name must not contain '--' (reserved as the gateway hostname separator)"
 // +kubebuilder:validation:XValidation:rule="self.metadata.name.size() <= 30",message="sandbox name must be at most 30 characters so gateway hostnames fit in a DNS label"
+// +kubebuilder:validation:XValidation:rule="!self.metadata.name.contains('.')",message="sandbox name must not contain '.' (host certificate principals join sandbox, namespace and cluster with dots)"
 
 // Sandbox is a persistent, declarative workspace. Its pod is a disposable
 // executor: the home volume, permissions and gateway route outlive it.
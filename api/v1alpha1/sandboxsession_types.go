@@ -21,12 +21,15 @@ import (
 )
 
 // SessionKind is the transport of a session.
-// +kubebuilder:validation:Enum=ssh;http
+// +kubebuilder:validation:Enum=ssh;http;bastion
 type SessionKind string
 
 const (
 	SessionKindSSH  SessionKind = "ssh"
 	SessionKindHTTP SessionKind = "http"
+	// SessionKindBastion is a connection forwarded to an AccessTarget
+	// destination rather than a sandbox.
+	SessionKindBastion SessionKind = "bastion"
 )
 
 // SessionState is the lifecycle state of a session.
@@ -43,16 +46,28 @@ const (
 	ExitReasonDisconnected   = "Disconnected"
 	ExitReasonStaleHeartbeat = "StaleHeartbeat"
 	ExitReasonSandboxDeleted = "SandboxDeleted"
+	ExitReasonIdle           = "Idle"
+	ExitReasonExpired        = "Expired"
+	ExitReasonRevoked        = "Revoked"
 )
 
 // SandboxSessionSpec defines the desired state of SandboxSession.
 // Sessions are created by the gateway, one per authenticated connection
-// (ssh) or per (sandbox, user) sliding window (http). They are the audit
-// record of who reached which sandbox from where.
+// (ssh, bastion) or per (sandbox, user) sliding window (http). They are
+// the audit record of who reached which sandbox from where.
+// +kubebuilder:validation:XValidation:rule="self.kind == 'bastion' ? has(self.accessTarget) : has(self.sandboxName)",message="bastion sessions name an accessTarget, others a sandboxName"
 type SandboxSessionSpec struct {
-	// SandboxName is the sandbox this session connects to (same namespace).
-	// +kubebuilder:validation:MinLength=1
-	SandboxName string `json:"sandboxName"`
+	// SandboxName is the sandbox this session connects to (same
+	// namespace). Bastion sessions have none.
+	// +optional
+	SandboxName string `json:"sandboxName,omitempty"`
+
+	// AccessTarget and Destination name the endpoint a bastion session
+	// forwards to; the session lives in the destination's namespace.
+	// +optional
+	AccessTarget string `json:"accessTarget,omitempty"`
+	// +optional
+	Destination string `json:"destination,omitempty"`
 
 	// User is the authenticated identity (SSH certificate principal or OIDC
 	// claim).
@@ -63,7 +78,7 @@ type SandboxSessionSpec struct {
 	// +optional
 	ClientAddr string `json:"clientAddr,omitempty"`
 
-	// Kind is ssh or http.
+	// Kind is ssh, http or bastion.
 	Kind SessionKind `json:"kind"`
 
 	// CertSerial is the serial of the SSH certificate used, for joining
@@ -71,6 +86,11 @@ type SandboxSessionSpec struct {
 	// +optional
 	CertSerial string `json:"certSerial,omitempty"`
 
+	// Port is the sandbox port an ssh session forwards to, when it is an
+	// exposed port rather than the agent.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
 	// HeartbeatInterval is stamped by the gateway at creation so the stale
 	// reaper can compute its threshold without re-deriving the sandbox's
 	// idle timeout.
@@ -91,11 +111,17 @@ type SandboxSessionStatus struct {
 	// +optional
 	LastActivityTime *metav1.Time `json:"lastActivityTime,omitempty"`
 
+	// UpstreamAddr is the gateway's local address on its connection to the
+	// sandbox agent. The agent logs it as the peer of in-sandbox audit
+	// events (such as SFTP transfers), joining them to this session.
+	// +optional
+	UpstreamAddr string `json:"upstreamAddr,omitempty"`
+
 	// +optional
 	EndTime *metav1.Time `json:"endTime,omitempty"`
 
 	// ExitReason records why the session closed (Disconnected,
-	// StaleHeartbeat, SandboxDeleted).
+	// StaleHeartbeat, SandboxDeleted, Idle, Expired, Revoked).
 	// +optional
 	ExitReason string `json:"exitReason,omitempty"`
 }
@@ -104,6 +130,7 @@ type SandboxSessionStatus struct {
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:shortName=sbs
 // +kubebuilder:printcolumn:name="Sandbox",type=string,JSONPath=`.spec.sandboxName`
+// +kubebuilder:printcolumn:name="Target",type=string,JSONPath=`.spec.accessTarget`,priority=1
 // +kubebuilder:printcolumn:name="User",type=string,JSONPath=`.spec.user`
 // +kubebuilder:printcolumn:name="Kind",type=string,JSONPath=`.spec.kind`
 // +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
@@ -50,6 +50,148 @@ type EgressRule struct {
 	Ports []networkingv1.NetworkPolicyPort `json:"ports,omitempty"`
 }
 
+// SFTPMode selects what the SFTP subsystem exposes.
+// +kubebuilder:validation:Enum=home;readOnly;full
+type SFTPMode string
+
+const (
+	// SFTPHome confines SFTP to the home directory, which appears as "/".
+	SFTPHome SFTPMode = "home"
+	// SFTPReadOnly confines SFTP to the home directory and refuses every
+	// modification: files can be downloaded but not uploaded or deleted.
+	SFTPReadOnly SFTPMode = "readOnly"
+	// SFTPFull exposes the whole pod filesystem with the sandbox user's
+	// permissions.
+	SFTPFull SFTPMode = "full"
+)
+
+// SSHPolicy controls which SSH features the in-sandbox agent offers.
+type SSHPolicy struct {
+	// AgentForwarding allows `ssh -A`: the agent exposes the client's SSH
+	// agent inside the sandbox via SSH_AUTH_SOCK. Defaults to true; the
+	// user certificate must also permit it.
+	// +optional
+	// +kubebuilder:default=true
+	AgentForwarding *bool `json:"agentForwarding,omitempty"`
+
+	// AcceptEnv lists the variables a client may send (SendEnv/SetEnv) that
+	// are passed to commands it runs, as shell globs like sshd's AcceptEnv.
+	// Unset means LANG, LC_*, COLORTERM and NO_COLOR; an empty list
+	// accepts none.
+	// +optional
+	AcceptEnv []string `json:"acceptEnv,omitempty"`
+
+	// SFTP selects what the SFTP subsystem (sftp, scp, IDE file sync)
+	// exposes. Defaults to home.
+	// +optional
+	// +kubebuilder:default=home
+	SFTP SFTPMode `json:"sftp,omitempty"`
+}
+
+// LifecycleHook is a command the agent runs at a point in the sandbox's
+// life, as the sandbox user in the home directory.
+type LifecycleHook struct {
+	// Command is executed directly; wrap it in ["sh", "-c", ...] for shell
+	// syntax.
+	// +kubebuilder:validation:MinItems=1
+	Command []string `json:"command"`
+
+	// Timeout bounds the hook, after which its process group is killed.
+	// Defaults to 10m, or 1m for preSuspend, which delays the suspension.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// LifecycleHooks are the template's lifecycle hooks. Outcomes are reported
+// as Sandbox conditions and events.
+type LifecycleHooks struct {
+	// PostCreate runs once per home volume, before postStart, on the first
+	// start after the home is created. It is retried on the next start
+	// until it succeeds.
+	// +optional
+	PostCreate *LifecycleHook `json:"postCreate,omitempty"`
+
+	// PostStart runs every time the sandbox pod starts.
+	// +optional
+	PostStart *LifecycleHook `json:"postStart,omitempty"`
+
+	// PreSuspend runs before the sandbox pod is deleted on suspend. The pod
+	// is deleted once it finishes or times out, whatever its outcome.
+	// +optional
+	PreSuspend *LifecycleHook `json:"preSuspend,omitempty"`
+}
+
+// SandboxUser is the sandbox user's identity inside the container. The
+// agent writes matching passwd and group entries, so images need no entry
+// for runAsUser.
+type SandboxUser struct {
+	// Name is the login name. Defaults to sandbox.
+	// +optional
+	// +kubebuilder:default=sandbox
+	// +kubebuilder:validation:Pattern=`^[a-z_][a-z0-9_-]{0,31}$`
+	Name string `json:"name,omitempty"`
+
+	// Shell is the login shell. Defaults to /bin/bash when the image has
+	// it, else /bin/sh.
+	// +optional
+	Shell string `json:"shell,omitempty"`
+
+	// Groups are supplementary groups: added to the pod's
+	// supplementalGroups and to the sandbox's group file, created if the
+	// image has no group with that GID.
+	// +optional
+	// +listType=map
+	// +listMapKey=gid
+	Groups []SandboxGroup `json:"groups,omitempty"`
+}
+
+// SandboxGroup is a supplementary group of the sandbox user.
+type SandboxGroup struct {
+	// Name is used when the image has no group with this GID.
+	// +kubebuilder:validation:Pattern=`^[a-z_][a-z0-9_-]{0,31}$`
+	Name string `json:"name"`
+
+	// GID is the numeric group ID.
+	// +kubebuilder:validation:Minimum=1
+	GID int64 `json:"gid"`
+}
+
+// IdleSignal is a kind of activity that keeps a sandbox from idling.
+// +kubebuilder:validation:Enum=sessions;input;cpu;portForward
+type IdleSignal string
+
+const (
+	// IdleSignalSessions counts any open SandboxSession as activity.
+	IdleSignalSessions IdleSignal = "sessions"
+	// IdleSignalInput counts keystrokes on an interactive terminal.
+	IdleSignalInput IdleSignal = "input"
+	// IdleSignalCPU counts CPU usage of the sandbox container above
+	// cpuThreshold, so detached jobs keep it running.
+	IdleSignalCPU IdleSignal = "cpu"
+	// IdleSignalPortForward counts traffic through SSH local port
+	// forwards.
+	IdleSignalPortForward IdleSignal = "portForward"
+)
+
+// IdlePolicy selects what counts as activity for idle suspension. A
+// sandbox is idle once none of the selected signals has been seen for the
+// idle timeout.
+type IdlePolicy struct {
+	// Signals are the kinds of activity that keep the sandbox running.
+	// Defaults to sessions: any open session keeps it alive, however
+	// long it has been left untouched.
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:default={sessions}
+	Signals []IdleSignal `json:"signals,omitempty"`
+
+	// CPUThreshold is the container CPU usage above which the cpu signal
+	// counts as activity. Defaults to 100m.
+	// +optional
+	CPUThreshold *resource.Quantity `json:"cpuThreshold,omitempty"`
+}
+
 // SandboxTemplateSpec defines the desired state of SandboxTemplate.
 // +kubebuilder:validation:XValidation:rule="self.isolationLevel != 'strong' || (has(self.runtimeClassName) && size(self.runtimeClassName) > 0)",message="isolationLevel strong requires runtimeClassName"
 type SandboxTemplateSpec struct {
@@ -104,6 +246,47 @@ type SandboxTemplateSpec struct {
 	// +kubebuilder:default=1000
 	// +kubebuilder:validation:Minimum=1
 	RunAsUser *int64 `json:"runAsUser,omitempty"`
+
+	// User names the sandbox user and sets its shell and supplementary
+	// groups.
+	// +optional
+	User *SandboxUser `json:"user,omitempty"`
+
+	// SSH restricts the SSH features offered inside the sandbox.
+	// +optional
+	SSH *SSHPolicy `json:"ssh,omitempty"`
+
+	// IdlePolicy selects what counts as activity for idle suspension.
+	// Unset counts open sessions only.
+	// +optional
+	IdlePolicy *IdlePolicy `json:"idlePolicy,omitempty"`
+
+	// Hooks run commands when the home is created, on every start and
+	// before suspension.
+	// +optional
+	Hooks *LifecycleHooks `json:"hooks,omitempty"`
+
+	// Devcontainer derives configuration from a devcontainer.json, applied
+	// over the fields above.
+	// +optional
+	Devcontainer *DevcontainerSpec `json:"devcontainer,omitempty"`
+}
+
+// DevcontainerSpec embeds a devcontainer.json in a template. Its image,
+// containerEnv, remoteEnv, forwardPorts, postCreateCommand,
+// postStartCommand, remoteUser and hostRequirements are applied; other
+// properties are reported in the sandbox's Devcontainer condition.
+type DevcontainerSpec struct {
+	// Config is the devcontainer.json content. Comments and trailing
+	// commas are allowed.
+	// +kubebuilder:validation:MinLength=1
+	Config string `json:"config"`
+	// AllowHostRequirements lets hostRequirements raise the resource
+	// limits and the home size above the template's. By default requests
+	// are clamped to the limits and the home size is kept; the shortfall
+	// is reported in the sandbox's Devcontainer condition.
+	// +optional
+	AllowHostRequirements bool `json:"allowHostRequirements,omitempty"`
 }
 
 // SandboxTemplateStatus defines the observed state of SandboxTemplate.
@@ -0,0 +1,166 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DotfilesSpec is a personal dotfiles repository installed into every new
+// home of the user.
+type DotfilesSpec struct {
+	// URL is the repository to clone into ~/.dotfiles: https://, ssh:// or
+	// scp-like. It is cloned without credentials.
+	// +kubebuilder:validation:Pattern=`^(https?://|ssh://|[^@/:]+@[^/:]+:).+`
+	URL string `json:"url"`
+
+	// Ref is the branch, tag or full commit SHA to check out. Empty means
+	// the repository's default branch.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// Install is the script, relative to the repository, run once after
+	// cloning. Defaults to the first of install.sh, install, bootstrap.sh,
+	// bootstrap, setup.sh and setup that exists; without any, the
+	// repository's top-level dotfiles are linked into the home.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[^/]`
+	// +kubebuilder:validation:XValidation:rule="!self.split('/').exists(s, s == '..')",message="install must stay inside the repository"
+	Install string `json:"install,omitempty"`
+}
+
+// ProfileEnvVar is a plain environment variable. Values cannot come from
+// Secrets or ConfigMaps, since a profile is not bound to a namespace.
+type ProfileEnvVar struct {
+	// Name of the variable. Names kubepark sets for the agent are refused.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z_][A-Za-z0-9_]*$`
+	// +kubebuilder:validation:XValidation:rule="!self.startsWith('KUBEPARK_') && !(self in ['HOME', 'USER', 'LOGNAME'])",message="name is reserved by kubepark"
+	Name string `json:"name"`
+
+	// Value of the variable.
+	// +optional
+	Value string `json:"value,omitempty"`
+}
+
+// UserProfileSpec defines the desired state of UserProfile.
+//
+// A profile changes what its user's sandboxes run and who can reach them
+// (authorizedKeys), so only the user and administrators should be able to
+// edit it.
+// +kubebuilder:validation:XValidation:rule="self.principal == oldSelf.principal",message="principal is immutable"
+type UserProfileSpec struct {
+	// Principal is the OIDC identity (certificate principal) the profile
+	// belongs to. It applies to every sandbox whose spec.owner.name
+	// matches. When several profiles name the same principal, the oldest
+	// applies.
+	// +kubebuilder:validation:MinLength=1
+	Principal string `json:"principal"`
+
+	// DefaultTemplate is the SandboxTemplate a new sandbox of this user
+	// gets when it names none.
+	// +optional
+	DefaultTemplate string `json:"defaultTemplate,omitempty"`
+
+	// DefaultNamespace is the namespace the gateway assumes when the user
+	// connects to a sandbox by name alone.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	DefaultNamespace string `json:"defaultNamespace,omitempty"`
+
+	// Shell is the login shell, overriding the template's.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^/`
+	Shell string `json:"shell,omitempty"`
+
+	// Dotfiles is installed once into every new home.
+	// +optional
+	Dotfiles *DotfilesSpec `json:"dotfiles,omitempty"`
+
+	// Env is added to the sandbox's environment, overriding the template's
+	// variables of the same name.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Env []ProfileEnvVar `json:"env,omitempty"`
+
+	// Timezone sets TZ, e.g. Europe/Berlin.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9_+/-]+$`
+	Timezone string `json:"timezone,omitempty"`
+
+	// Locale sets LANG, e.g. en_US.UTF-8. The image must provide it.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9_.@-]+$`
+	Locale string `json:"locale,omitempty"`
+
+	// AuthorizedKeys are public keys (authorized_keys lines) that
+	// authenticate as the user at the gateway and in the user's sandboxes,
+	// for tooling that cannot run kubepark login. Unlike certificates they
+	// do not expire; remove a key to revoke it.
+	// +optional
+	AuthorizedKeys []string `json:"authorizedKeys,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=up
+// +kubebuilder:printcolumn:name="Principal",type=string,JSONPath=`.spec.principal`
+// +kubebuilder:printcolumn:name="Template",type=string,JSONPath=`.spec.defaultTemplate`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// UserProfile holds one person's defaults and personalization, applied to
+// every sandbox they own.
+type UserProfile struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitzero"`
+
+	// spec defines the desired state of UserProfile
+	// +required
+	Spec UserProfileSpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// UserProfileList contains a list of UserProfile
+type UserProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitzero"`
+	Items           []UserProfile `json:"items"`
+}
+
+// ForPrincipal returns the profile of principal, or nil. When several name
+// it, the oldest wins, so adding a duplicate never changes who is affected.
+func (l *UserProfileList) ForPrincipal(principal string) *UserProfile {
+	var found *UserProfile
+	for i := range l.Items {
+		p := &l.Items[i]
+		if p.Spec.Principal != principal {
+			continue
+		}
+		if found == nil || p.CreationTimestamp.Before(&found.CreationTimestamp) ||
+			(p.CreationTimestamp.Equal(&found.CreationTimestamp) && p.Name < found.Name) {
+			found = p
+		}
+	}
+	return found
+}
+
+func init() {
+	SchemeBuilder.Register(&UserProfile{}, &UserProfileList{})
+}
@@ -28,6 +28,21 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessDestination) DeepCopyInto(out *AccessDestination) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessDestination.
+func (in *AccessDestination) DeepCopy() *AccessDestination {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessDestination)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AccessProfile) DeepCopyInto(out *AccessProfile) {
 	*out = *in
@@ -136,6 +151,228 @@ func (in *AccessProfileStatus) DeepCopy() *AccessProfileStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessTarget) DeepCopyInto(out *AccessTarget) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessTarget.
+func (in *AccessTarget) DeepCopy() *AccessTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AccessTarget) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessTargetList) DeepCopyInto(out *AccessTargetList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]AccessTarget, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessTargetList.
+func (in *AccessTargetList) DeepCopy() *AccessTargetList {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessTargetList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AccessTargetList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessTargetSpec) DeepCopyInto(out *AccessTargetSpec) {
+	*out = *in
+	if in.Destinations != nil {
+		in, out := &in.Destinations, &out.Destinations
+		*out = make([]AccessDestination, len(*in))
+		copy(*out, *in)
+	}
+	if in.Principals != nil {
+		in, out := &in.Principals, &out.Principals
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NotBefore != nil {
+		in, out := &in.NotBefore, &out.NotBefore
+		*out = (*in).DeepCopy()
+	}
+	if in.NotAfter != nil {
+		in, out := &in.NotAfter, &out.NotAfter
+		*out = (*in).DeepCopy()
+	}
+	if in.MaxSessionDuration != nil {
+		in, out := &in.MaxSessionDuration, &out.MaxSessionDuration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessTargetSpec.
+func (in *AccessTargetSpec) DeepCopy() *AccessTargetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessTargetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterRegistration) DeepCopyInto(out *ClusterRegistration) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterRegistration.
+func (in *ClusterRegistration) DeepCopy() *ClusterRegistration {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterRegistration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterRegistration) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterRegistrationList) DeepCopyInto(out *ClusterRegistrationList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterRegistration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterRegistrationList.
+func (in *ClusterRegistrationList) DeepCopy() *ClusterRegistrationList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterRegistrationList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterRegistrationList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterRegistrationSpec) DeepCopyInto(out *ClusterRegistrationSpec) {
+	*out = *in
+	out.KubeconfigSecretRef = in.KubeconfigSecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterRegistrationSpec.
+func (in *ClusterRegistrationSpec) DeepCopy() *ClusterRegistrationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterRegistrationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DevcontainerSpec) DeepCopyInto(out *DevcontainerSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DevcontainerSpec.
+func (in *DevcontainerSpec) DeepCopy() *DevcontainerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DevcontainerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DevcontainerStatus) DeepCopyInto(out *DevcontainerStatus) {
+	*out = *in
+	if in.ExposedPorts != nil {
+		in, out := &in.ExposedPorts, &out.ExposedPorts
+		*out = make([]ExposedPort, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DevcontainerStatus.
+func (in *DevcontainerStatus) DeepCopy() *DevcontainerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DevcontainerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DotfilesSpec) DeepCopyInto(out *DotfilesSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DotfilesSpec.
+func (in *DotfilesSpec) DeepCopy() *DotfilesSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DotfilesSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EgressRule) DeepCopyInto(out *EgressRule) {
 	*out = *in
@@ -178,6 +415,11 @@ func (in *ExposedPort) DeepCopyInto(out *ExposedPort) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.ShareLinks != nil {
+		in, out := &in.ShareLinks, &out.ShareLinks
+		*out = new(ShareLinkPolicy)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExposedPort.
@@ -215,6 +457,101 @@ func (in *HomeSpec) DeepCopy() *HomeSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IdlePolicy) DeepCopyInto(out *IdlePolicy) {
+	*out = *in
+	if in.Signals != nil {
+		in, out := &in.Signals, &out.Signals
+		*out = make([]IdleSignal, len(*in))
+		copy(*out, *in)
+	}
+	if in.CPUThreshold != nil {
+		in, out := &in.CPUThreshold, &out.CPUThreshold
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdlePolicy.
+func (in *IdlePolicy) DeepCopy() *IdlePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(IdlePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeconfigSecretReference) DeepCopyInto(out *KubeconfigSecretReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeconfigSecretReference.
+func (in *KubeconfigSecretReference) DeepCopy() *KubeconfigSecretReference {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeconfigSecretReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LifecycleHook) DeepCopyInto(out *LifecycleHook) {
+	*out = *in
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LifecycleHook.
+func (in *LifecycleHook) DeepCopy() *LifecycleHook {
+	if in == nil {
+		return nil
+	}
+	out := new(LifecycleHook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LifecycleHooks) DeepCopyInto(out *LifecycleHooks) {
+	*out = *in
+	if in.PostCreate != nil {
+		in, out := &in.PostCreate, &out.PostCreate
+		*out = new(LifecycleHook)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PostStart != nil {
+		in, out := &in.PostStart, &out.PostStart
+		*out = new(LifecycleHook)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PreSuspend != nil {
+		in, out := &in.PreSuspend, &out.PreSuspend
+		*out = new(LifecycleHook)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LifecycleHooks.
+func (in *LifecycleHooks) DeepCopy() *LifecycleHooks {
+	if in == nil {
+		return nil
+	}
+	out := new(LifecycleHooks)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NamespacedGrant) DeepCopyInto(out *NamespacedGrant) {
 	*out = *in
@@ -262,6 +599,46 @@ func (in *OwnerSpec) DeepCopy() *OwnerSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProfileEnvVar) DeepCopyInto(out *ProfileEnvVar) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProfileEnvVar.
+func (in *ProfileEnvVar) DeepCopy() *ProfileEnvVar {
+	if in == nil {
+		return nil
+	}
+	out := new(ProfileEnvVar)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSHPolicy) DeepCopyInto(out *SSHPolicy) {
+	*out = *in
+	if in.AgentForwarding != nil {
+		in, out := &in.AgentForwarding, &out.AgentForwarding
+		*out = new(bool)
+		**out = **in
+	}
+	if in.AcceptEnv != nil {
+		in, out := &in.AcceptEnv, &out.AcceptEnv
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSHPolicy.
+func (in *SSHPolicy) DeepCopy() *SSHPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(SSHPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Sandbox) DeepCopyInto(out *Sandbox) {
 	*out = *in
@@ -289,6 +666,48 @@ func (in *Sandbox) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SandboxActivity) DeepCopyInto(out *SandboxActivity) {
+	*out = *in
+	if in.LastInputTime != nil {
+		in, out := &in.LastInputTime, &out.LastInputTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastCPUTime != nil {
+		in, out := &in.LastCPUTime, &out.LastCPUTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastPortForwardTime != nil {
+		in, out := &in.LastPortForwardTime, &out.LastPortForwardTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SandboxActivity.
+func (in *SandboxActivity) DeepCopy() *SandboxActivity {
+	if in == nil {
+		return nil
+	}
+	out := new(SandboxActivity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SandboxGroup) DeepCopyInto(out *SandboxGroup) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SandboxGroup.
+func (in *SandboxGroup) DeepCopy() *SandboxGroup {
+	if in == nil {
+		return nil
+	}
+	out := new(SandboxGroup)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SandboxList) DeepCopyInto(out *SandboxList) {
 	*out = *in
@@ -448,6 +867,11 @@ func (in *SandboxSpec) DeepCopyInto(out *SandboxSpec) {
 		*out = new(HomeSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Source != nil {
+		in, out := &in.Source, &out.Source
+		*out = new(SourceSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SandboxSpec.
@@ -474,6 +898,16 @@ func (in *SandboxStatus) DeepCopyInto(out *SandboxStatus) {
 		in, out := &in.LastActivityTime, &out.LastActivityTime
 		*out = (*in).DeepCopy()
 	}
+	if in.Activity != nil {
+		in, out := &in.Activity, &out.Activity
+		*out = new(SandboxActivity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Devcontainer != nil {
+		in, out := &in.Devcontainer, &out.Devcontainer
+		*out = new(DevcontainerStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SandboxStatus.
@@ -589,6 +1023,31 @@ func (in *SandboxTemplateSpec) DeepCopyInto(out *SandboxTemplateSpec) {
 		*out = new(int64)
 		**out = **in
 	}
+	if in.User != nil {
+		in, out := &in.User, &out.User
+		*out = new(SandboxUser)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SSH != nil {
+		in, out := &in.SSH, &out.SSH
+		*out = new(SSHPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IdlePolicy != nil {
+		in, out := &in.IdlePolicy, &out.IdlePolicy
+		*out = new(IdlePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = new(LifecycleHooks)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Devcontainer != nil {
+		in, out := &in.Devcontainer, &out.Devcontainer
+		*out = new(DevcontainerSpec)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SandboxTemplateSpec.
@@ -622,3 +1081,156 @@ func (in *SandboxTemplateStatus) DeepCopy() *SandboxTemplateStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SandboxUser) DeepCopyInto(out *SandboxUser) {
+	*out = *in
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]SandboxGroup, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SandboxUser.
+func (in *SandboxUser) DeepCopy() *SandboxUser {
+	if in == nil {
+		return nil
+	}
+	out := new(SandboxUser)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ShareLinkPolicy) DeepCopyInto(out *ShareLinkPolicy) {
+	*out = *in
+	if in.MaxTTL != nil {
+		in, out := &in.MaxTTL, &out.MaxTTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.RequestsPerMinute != nil {
+		in, out := &in.RequestsPerMinute, &out.RequestsPerMinute
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ShareLinkPolicy.
+func (in *ShareLinkPolicy) DeepCopy() *ShareLinkPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ShareLinkPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourceSpec) DeepCopyInto(out *SourceSpec) {
+	*out = *in
+	if in.CredentialsSecretRef != nil {
+		in, out := &in.CredentialsSecretRef, &out.CredentialsSecretRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceSpec.
+func (in *SourceSpec) DeepCopy() *SourceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UserProfile) DeepCopyInto(out *UserProfile) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UserProfile.
+func (in *UserProfile) DeepCopy() *UserProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(UserProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *UserProfile) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UserProfileList) DeepCopyInto(out *UserProfileList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]UserProfile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UserProfileList.
+func (in *UserProfileList) DeepCopy() *UserProfileList {
+	if in == nil {
+		return nil
+	}
+	out := new(UserProfileList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *UserProfileList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UserProfileSpec) DeepCopyInto(out *UserProfileSpec) {
+	*out = *in
+	if in.Dotfiles != nil {
+		in, out := &in.Dotfiles, &out.Dotfiles
+		*out = new(DotfilesSpec)
+		**out = **in
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]ProfileEnvVar, len(*in))
+		copy(*out, *in)
+	}
+	if in.AuthorizedKeys != nil {
+		in, out := &in.AuthorizedKeys, &out.AuthorizedKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UserProfileSpec.
+func (in *UserProfileSpec) DeepCopy() *UserProfileSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(UserProfileSpec)
+	in.DeepCopyInto(out)
+	return out
+}
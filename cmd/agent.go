@@ -17,22 +17,37 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+
+	gliderssh "github.com/gliderlabs/ssh"
 
 	"github.com/spf13/cobra"
 
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
 	"github.com/frauniki/kubepark/internal/agent"
+	"github.com/frauniki/kubepark/internal/agentapi"
 )
 
+// terminationLog is the kubelet's default terminationMessagePath.
+const terminationLog = "/dev/termination-log"
+
 // newAgentCommand runs the in-sandbox SSH agent. The "install" subcommand is
 // used by the sandbox init container to copy this binary into a volume
 // shared with the user container (the image is distroless, so there is no
 // cp). The copy is named "agent" so that executing it directly re-enters
-// agent mode via the argv[0] dispatch in main. Everything after "--" is the
-// template's long-running command.
+// agent mode via the argv[0] dispatch in main. The "identity" subcommand
+// runs that copy in a second init container, on the template image, to add
+// the sandbox user to the image's passwd and group files, and "clone" runs
+// it there to check out the sandbox's source repository into the home.
+// Everything after "--" is the template's long-running command.
 func newAgentCommand() *cobra.Command {
 	agentCmd := &cobra.Command{
 		Use:   agentBinaryName,
@@ -42,12 +57,15 @@ func newAgentCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			// Audit events go to the container log as JSON, where they
+			// are collected with the pod's other logs.
+			cfg.Log = zap.New().WithName("kubepark-agent")
 			server, err := agent.NewServer(cfg)
 			if err != nil {
 				return err
 			}
 			fmt.Fprintf(os.Stderr, "kubepark-agent listening on %s for owner %s\n", cfg.Addr, cfg.Owner)
-			return server.ListenAndServe()
+			return serveUntilSignal(server)
 		},
 	}
 	// Pass the template command through verbatim after "--".
@@ -60,9 +78,88 @@ func newAgentCommand() *cobra.Command {
 			return installSelf(args[0])
 		},
 	})
+	agentCmd.AddCommand(&cobra.Command{
+		Use:   "identity <dir>",
+		Short: "Write passwd/group files for the sandbox user into <dir> (init container helper)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			id, err := agent.IdentityFromEnv()
+			if err != nil {
+				return err
+			}
+			return agent.WriteIdentity(args[0], id)
+		},
+	})
+	agentCmd.AddCommand(&cobra.Command{
+		Use:   "clone",
+		Short: "Clone the sandbox source into the home (init container helper)",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			src, err := agent.SourceFromEnv()
+			msg := ""
+			if err == nil {
+				msg, err = agent.Clone(src)
+			}
+			if err != nil {
+				// The operator reads the outcome from the termination
+				// message. Exiting 0 lets the sandbox start without the
+				// clone instead of crash-looping; the next start retries.
+				prefix := agentapi.CloneFailedPrefix
+				if errors.Is(err, agent.ErrSourceUnreachable) {
+					prefix = agentapi.CloneUnreachablePrefix
+				}
+				writeTerminationMessage(prefix + err.Error())
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return nil
+			}
+			writeTerminationMessage(msg)
+			fmt.Fprintln(os.Stderr, msg)
+			return nil
+		},
+	})
 	return agentCmd
 }
 
+// serveUntilSignal runs the agent until SIGTERM (suspend or pod deletion)
+// or SIGINT, then shuts it down gracefully within the pod's grace period.
+func serveUntilSignal(server *agent.Server) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(sigs)
+
+	errCh := make(chan error, 2)
+	go func() { errCh <- server.ListenAndServe() }()
+	go func() {
+		if err := server.ListenAndServeActivity(); err != nil {
+			errCh <- fmt.Errorf("activity endpoint: %w", err)
+		}
+	}()
+	// The reverse tunnel reconnects on its own; it only ends on Shutdown.
+	go func() { _ = server.ServeTunnel() }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case sig := <-sigs:
+		fmt.Fprintf(os.Stderr, "kubepark-agent received %s, shutting down\n", sig)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), server.ShutdownTimeout())
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return err
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, gliderssh.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// writeTerminationMessage records msg as the container's termination
+// message; outside a pod there is no termination log and it is dropped.
+func writeTerminationMessage(msg string) {
+	_ = os.WriteFile(terminationLog, []byte(msg), 0o644)
+}
+
 // argsAfterDashDash returns the positional args that followed "--" on the
 // command line (the template command), or all args if no "--" was present.
 func argsAfterDashDash(cmd *cobra.Command, args []string) []string {
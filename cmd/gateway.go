@@ -17,10 +17,20 @@ limitations under the License.
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -33,6 +43,7 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
@@ -54,7 +65,24 @@ type gatewayOptions struct {
 	oidcClientSecret string
 	principalClaim   string
 	baseDomain       string
+	authHost         string
+	httpRouting      string
 	certTTL          time.Duration
+	maxTokenTTL      time.Duration
+	createProfiles   bool
+	tlsSecrets       []string
+	acmeDirectoryURL string
+	acmeEmail        string
+	acmeCAFile       string
+	tunnelAddr       string
+	tunnelAdvertise  string
+	tunnelFallback   bool
+	multiCluster     bool
+	dialMode         string
+	webTerminal      bool
+	terminalAssets   string
+	terminalSRI      map[string]string
+	sshWebSocket     bool
 }
 
 func newGatewayCommand() *cobra.Command {
@@ -75,7 +103,42 @@ func newGatewayCommand() *cobra.Command {
 		"OIDC client secret for the browser cookie flow (confidential client).")
 	cmd.Flags().StringVar(&opts.principalClaim, "principal-claim", "email", "ID-token claim mapped to the cert principal.")
 	cmd.Flags().StringVar(&opts.baseDomain, "base-domain", "", "Base domain advertised for HTTP routing.")
+	cmd.Flags().StringVar(&opts.authHost, "auth-host", "",
+		"Host that keeps the browser login and receives the OIDC callback (default: the base domain).")
+	cmd.Flags().StringVar(&opts.httpRouting, "http-routing", string(gateway.RoutingHost),
+		"HTTP routing: host (<port>--<sandbox>--<ns>.<base-domain>), path (/s/<ns>/<sandbox>/<port>/) or both.")
 	cmd.Flags().DurationVar(&opts.certTTL, "cert-ttl", 8*time.Hour, "Issued certificate validity.")
+	cmd.Flags().DurationVar(&opts.maxTokenTTL, "max-token-ttl", 30*24*time.Hour,
+		"Longest validity a personal access token can be issued for.")
+	cmd.Flags().BoolVar(&opts.createProfiles, "create-user-profiles", true,
+		"Create an empty UserProfile for each user on first kubepark login.")
+	cmd.Flags().StringSliceVar(&opts.tlsSecrets, "tls-secret", nil,
+		"kubernetes.io/tls Secret in the gateway namespace to serve HTTPS with; repeat for several, chosen by SNI.")
+	cmd.Flags().StringVar(&opts.acmeDirectoryURL, "acme-directory-url", "",
+		"ACME directory to obtain certificates from for names no --tls-secret covers (enables HTTPS).")
+	cmd.Flags().StringVar(&opts.acmeEmail, "acme-email", "", "ACME account contact email.")
+	cmd.Flags().StringVar(&opts.acmeCAFile, "acme-ca-file", "",
+		"PEM CA bundle trusted for the ACME directory, e.g. a local Pebble's.")
+	cmd.Flags().StringVar(&opts.tunnelAddr, "tunnel-address", "",
+		"Listen address for sandbox agents' reverse tunnels (empty disables them).")
+	cmd.Flags().StringVar(&opts.tunnelAdvertise, "tunnel-advertise-address", "",
+		"Address other replicas reach this one's tunnel listener at (default: $POD_IP and the tunnel port).")
+	cmd.Flags().BoolVar(&opts.tunnelFallback, "tunnel-fallback-direct", true,
+		"Dial a sandbox whose agent has no tunnel as --dial-mode selects, instead of waiting for one.")
+	cmd.Flags().BoolVar(&opts.multiCluster, "multi-cluster", false,
+		"Also route to the sandboxes of member clusters joined by ClusterRegistrations.")
+	cmd.Flags().StringVar(&opts.dialMode, "dial-mode", dialDirect,
+		"How sandbox pods are reached: direct (pod IP), portforward (through the API server), "+
+			"or auto (direct, falling back to portforward).")
+	cmd.Flags().BoolVar(&opts.webTerminal, "web-terminal", false,
+		"Serve a browser terminal on sandboxes at /kubepark/terminal/<ns>/<sandbox> on the auth host.")
+	cmd.Flags().StringVar(&opts.terminalAssets, "web-terminal-assets", gateway.DefaultTerminalAssets,
+		"npm CDN base URL the web terminal loads xterm.js from.")
+	cmd.Flags().StringToStringVar(&opts.terminalSRI, "web-terminal-assets-integrity", nil,
+		"Subresource Integrity hash of each xterm.js file, as <file>=sha384-... (see hack/xterm-integrity.sh).")
+	cmd.Flags().BoolVar(&opts.sshWebSocket, "ssh-websocket", false,
+		"Also serve the SSH jump host over WebSocket at "+gateway.SSHWebSocketPath+
+			" on the HTTP listener (on the auth host, with --base-domain).")
 	return cmd
 }
 
@@ -87,9 +150,14 @@ func runGateway(ctx context.Context, opts gatewayOptions) error {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(kubeparkv1alpha1.AddToScheme(scheme))
 
+	ns := controller.OperatorNamespace()
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:  scheme,
 		Metrics: metricsserver.Options{BindAddress: "0"},
+		// The gateway only reads its own certificate Secrets.
+		Cache: cache.Options{ByObject: map[client.Object]cache.ByObject{
+			&corev1.Secret{}: {Namespaces: map[string]cache.Config{ns: {}}},
+		}},
 	})
 	if err != nil {
 		return fmt.Errorf("build manager: %w", err)
@@ -100,7 +168,6 @@ func runGateway(ctx context.Context, opts gatewayOptions) error {
 	if err != nil {
 		return err
 	}
-	ns := controller.OperatorNamespace()
 	caSecret, err := controller.EnsureCASecret(ctx, direct, ns)
 	if err != nil {
 		return fmt.Errorf("load CA secret: %w", err)
@@ -110,13 +177,35 @@ func runGateway(ctx context.Context, opts gatewayOptions) error {
 		return err
 	}
 
+	// Member clusters' clients, kept current on every replica.
+	var clusters *gateway.Clusters
+	if opts.multiCluster {
+		clusters = gateway.NewClusters(mgr.GetClient(), ns, scheme)
+		if err := clusters.SetupWithManager(mgr); err != nil {
+			return err
+		}
+		// Members hold no CA private key; the hub signs their host keys.
+		memberCerts, err := gateway.NewMemberHostCerts(clusters, caSecret.Data[controller.KeyHostCAPrivate])
+		if err != nil {
+			return err
+		}
+		if err := mgr.Add(memberCerts); err != nil {
+			return err
+		}
+	}
+	store := gateway.NewClusterStore(mgr.GetClient(), clusters)
+
+	dialer, err := buildDialer(opts, caSecret, hostKey, mgr, clusters)
+	if err != nil {
+		return err
+	}
 	server, err := gateway.NewSSHServer(gateway.SSHConfig{
 		Addr:             opts.sshAddr,
 		HostKeyPEM:       hostKey,
 		UserCAAuthorized: caSecret.Data[controller.KeyUserCAPublic],
 		DefaultNamespace: opts.defaultNamespace,
-		Store:            gateway.NewStore(mgr.GetClient()),
-		Dialer:           gateway.NewDirectDialer(),
+		Store:            store,
+		Dialer:           dialer,
 	})
 	if err != nil {
 		return err
@@ -127,17 +216,29 @@ func runGateway(ctx context.Context, opts gatewayOptions) error {
 		return err
 	}
 
-	// HTTP plane: the CLI sign endpoints, the browser OIDC cookie flow, and
-	// the exposed-port reverse proxy, all on one listener.
-	httpHandler, err := buildHTTPHandler(ctx, opts, caSecret, mgr.GetClient())
+	// HTTP plane: the CLI sign endpoints, the browser OIDC cookie flow, the
+	// exposed-port reverse proxy and SSH over WebSocket, all on one listener.
+	var sshWS http.Handler
+	if opts.sshWebSocket {
+		sshWS = gateway.NewSSHWebSocketHandler(server)
+	}
+	httpHandler, err := buildHTTPHandler(ctx, opts, caSecret, mgr, direct, store, dialer, sshWS)
 	if err != nil {
 		return err
 	}
 	if httpHandler != nil {
-		if err := mgr.Add(&httpRunnable{addr: opts.httpAddr, handler: httpHandler}); err != nil {
+		tlsConfig, err := buildTLSConfig(opts, ns, mgr, direct, store)
+		if err != nil {
 			return err
 		}
-		fmt.Fprintf(os.Stderr, "kubepark gateway HTTP listening on %s\n", opts.httpAddr)
+		if err := mgr.Add(&httpRunnable{addr: opts.httpAddr, handler: httpHandler, tls: tlsConfig}); err != nil {
+			return err
+		}
+		proto := "HTTP"
+		if tlsConfig != nil {
+			proto = "HTTPS"
+		}
+		fmt.Fprintf(os.Stderr, "kubepark gateway %s listening on %s\n", proto, opts.httpAddr)
 	}
 
 	fmt.Fprintf(os.Stderr, "kubepark gateway SSH jump host listening on %s\n", opts.sshAddr)
@@ -146,11 +247,47 @@ func runGateway(ctx context.Context, opts gatewayOptions) error {
 
 // buildHTTPHandler assembles the gateway HTTP handler. The sign endpoints
 // and OIDC cookie auth require an issuer; the reverse proxy requires a base
-// domain. Returns nil when neither is configured.
+// domain, joins the manager to maintain its HTTP sessions, and signs identity
+// assertions with a key kept in a Secret; sshWS, when set, serves SSH over
+// WebSocket. Returns nil when none is configured.
 func buildHTTPHandler(
-	ctx context.Context, opts gatewayOptions, caSecret *corev1.Secret, c client.Client,
+	ctx context.Context, opts gatewayOptions, caSecret *corev1.Secret, mgr ctrl.Manager, direct client.Client,
+	store gateway.Store, dialer gateway.Dialer, sshWS http.Handler,
 ) (http.Handler, error) {
-	store := gateway.NewStore(c)
+	// Logouts, revoked tokens and revoked share links, shared by every replica.
+	revocations := &gateway.SecretRevocations{
+		Reader:    mgr.GetClient(),
+		Client:    direct,
+		Namespace: controller.OperatorNamespace(),
+		Name:      "kubepark-gateway-sessions",
+	}
+	tokens := gateway.NewTokens(caSecret.Data[controller.KeyCookieHMAC], revocations, opts.maxTokenTTL)
+	if opts.webTerminal && opts.baseDomain == "" {
+		return nil, fmt.Errorf("--web-terminal requires --base-domain")
+	}
+	routing, err := gateway.ParseRoutingMode(opts.httpRouting)
+	if err != nil {
+		return nil, err
+	}
+	// Path-routed sandboxes are served from the base domain: the login,
+	// its session cookie and the sign endpoints must live on another
+	// origin, which no sandbox's page can script.
+	if opts.baseDomain != "" && routing != gateway.RoutingHost &&
+		strings.EqualFold(cmp.Or(opts.authHost, opts.baseDomain), opts.baseDomain) {
+		return nil, fmt.Errorf("--http-routing=%s requires an --auth-host other than the base domain, "+
+			"where path-routed sandboxes are served", routing)
+	}
+	var shares *gateway.ShareLinks
+	if opts.baseDomain != "" {
+		shares = gateway.NewShareLinks(gateway.ShareLinksConfig{
+			BaseDomain:  opts.baseDomain,
+			Routing:     routing,
+			Secure:      true,
+			HMACKey:     caSecret.Data[controller.KeyCookieHMAC],
+			Revocations: revocations,
+			Store:       store,
+		})
+	}
 
 	var signHandler http.Handler
 	var auth gateway.Authenticator
@@ -159,22 +296,38 @@ func buildHTTPHandler(
 		if err != nil {
 			return nil, err
 		}
-		signServer, err := gateway.NewSignServer(ctx, signer, gateway.OIDCConfig{
+		oidcCfg := gateway.OIDCConfig{
 			Issuer:         opts.oidcIssuer,
 			ClientID:       opts.oidcClientID,
 			PrincipalClaim: opts.principalClaim,
 			BaseDomain:     opts.baseDomain,
 			GatewaySSHAddr: opts.sshAddr,
-		})
+			Tokens:         tokens,
+			Shares:         shares,
+		}
+		if opts.createProfiles {
+			oidcCfg.Profiles = store
+		}
+		signServer, err := gateway.NewSignServer(ctx, signer, oidcCfg)
 		if err != nil {
 			return nil, err
 		}
 		signHandler = signServer.Handler()
 
 		if opts.baseDomain != "" {
-			cookieAuth, err := gateway.NewCookieAuthenticator(ctx, opts.oidcIssuer, opts.oidcClientID,
-				opts.oidcClientSecret, "https://"+opts.baseDomain, opts.principalClaim,
-				caSecret.Data[controller.KeyCookieHMAC], opts.certTTL, true)
+			cookieAuth, err := gateway.NewCookieAuthenticator(ctx, gateway.CookieAuthConfig{
+				Issuer:         opts.oidcIssuer,
+				ClientID:       opts.oidcClientID,
+				ClientSecret:   opts.oidcClientSecret,
+				PrincipalClaim: opts.principalClaim,
+				AuthHost:       opts.authHost,
+				BaseDomain:     opts.baseDomain,
+				HMACKey:        caSecret.Data[controller.KeyCookieHMAC],
+				TTL:            opts.certTTL,
+				Secure:         true,
+				Revocations:    revocations,
+				Tokens:         tokens,
+			})
 			if err != nil {
 				return nil, err
 			}
@@ -184,21 +337,59 @@ func buildHTTPHandler(
 
 	var proxy http.Handler
 	if opts.baseDomain != "" {
-		proxy = gateway.NewHTTPProxy(gateway.HTTPProxyConfig{
+		identityKey, err := gatewayIdentityKey(ctx, direct, controller.OperatorNamespace())
+		if err != nil {
+			return nil, err
+		}
+		identity, err := gateway.NewIdentitySigner(identityKey, "https://"+opts.baseDomain)
+		if err != nil {
+			return nil, err
+		}
+		proxyCfg := gateway.HTTPProxyConfig{
 			BaseDomain: opts.baseDomain,
+			Routing:    routing,
 			Store:      store,
 			Auth:       auth,
-		})
+			Shares:     shares,
+			Identity:   identity,
+		}
+		// Pod IPs are dialed through the default transport; tunnels and
+		// port-forwards need the Dialer.
+		if opts.tunnelAddr != "" || opts.dialMode != dialDirect {
+			proxyCfg.Dialer = dialer
+		}
+		if opts.webTerminal {
+			if proxyCfg.Terminal, err = buildWebTerminal(opts, caSecret, auth, store, dialer); err != nil {
+				return nil, err
+			}
+		}
+		httpProxy := gateway.NewHTTPProxy(proxyCfg)
+		if err := mgr.Add(httpProxy); err != nil {
+			return nil, err
+		}
+		proxy = httpProxy
 	}
 
-	if signHandler == nil && proxy == nil {
+	if signHandler == nil && proxy == nil && sshWS == nil {
 		return nil, nil
 	}
 
-	// Route the CLI sign endpoints by path prefix; everything else (browser
-	// traffic on a sandbox host) goes to the proxy.
+	// Route the CLI sign endpoints and SSH over WebSocket by path; everything
+	// else (browser and API traffic on a sandbox host) goes to the proxy.
+	// With a base domain, SSH over WebSocket and the token and share
+	// endpoints answer on the auth host only: a sandbox host's paths, /v1/ssh
+	// among them, are the sandbox's.
+	authHost := cmp.Or(opts.authHost, opts.baseDomain)
+	onAuthHost := func(r *http.Request) bool {
+		return authHost == "" || strings.EqualFold(r.Host, authHost)
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if signHandler != nil && (r.URL.Path == "/v1/sign" || r.URL.Path == "/v1/config") {
+		if sshWS != nil && r.URL.Path == gateway.SSHWebSocketPath && onAuthHost(r) {
+			sshWS.ServeHTTP(w, r)
+			return
+		}
+		if signHandler != nil && (slices.Contains(signPaths, r.URL.Path) ||
+			slices.Contains(authHostSignPaths, r.URL.Path) && onAuthHost(r)) {
 			signHandler.ServeHTTP(w, r)
 			return
 		}
@@ -210,40 +401,213 @@ func buildHTTPHandler(
 	}), nil
 }
 
+// buildWebTerminal builds the browser terminal. It lives on the auth host,
+// which buildHTTPHandler has checked no sandbox is served from.
+func buildWebTerminal(
+	opts gatewayOptions, caSecret *corev1.Secret, auth gateway.Authenticator,
+	store gateway.Store, dialer gateway.Dialer,
+) (*gateway.WebTerminal, error) {
+	if auth == nil {
+		return nil, fmt.Errorf("--web-terminal requires --oidc-issuer")
+	}
+	authHost := cmp.Or(opts.authHost, opts.baseDomain)
+	return gateway.NewWebTerminal(gateway.WebTerminalConfig{
+		AuthHost:         authHost,
+		Auth:             auth,
+		UserCAPEM:        caSecret.Data[controller.KeyUserCAPrivate],
+		HostCAAuthorized: caSecret.Data[controller.KeyHostCAPublic],
+		AssetsURL:        opts.terminalAssets,
+		AssetsIntegrity:  opts.terminalSRI,
+		Store:            store,
+		Dialer:           dialer,
+	})
+}
+
+// signPaths are the CLI endpoints of the sign server.
+var signPaths = []string{"/v1/config", "/v1/sign"}
+
+// authHostSignPaths are the sign server's endpoints served on the auth
+// host only, once there is one.
+var authHostSignPaths = []string{"/v1/token", "/v1/token/revoke", "/v1/share", "/v1/share/revoke"}
+
+// Values of --dial-mode.
+const (
+	dialDirect      = "direct"
+	dialPortForward = "portforward"
+	dialAuto        = "auto"
+)
+
+// buildPodDialer returns the Dialer --dial-mode selects for reaching pods:
+// their IPs, the API server's port-forward, or the first falling back to
+// the second.
+func buildPodDialer(mode string, mgr ctrl.Manager, clusters *gateway.Clusters) (gateway.Dialer, error) {
+	switch mode {
+	case dialDirect:
+		return gateway.NewDirectDialer(), nil
+	case dialPortForward:
+		return gateway.NewPortForwardDialer(mgr.GetConfig(), clusters), nil
+	case dialAuto:
+		portForward := gateway.NewPortForwardDialer(mgr.GetConfig(), clusters)
+		return gateway.NewFallbackDialer(gateway.NewDirectDialer(), portForward), nil
+	}
+	return nil, fmt.Errorf("unknown --dial-mode %q (want %s, %s or %s)", mode, dialDirect, dialPortForward, dialAuto)
+}
+
+// buildDialer returns how the gateway reaches sandbox pods: as --dial-mode
+// selects, or through agents' reverse tunnels when a tunnel listener is
+// configured, which is how member clusters' agents are normally reached.
+// The listener joins the manager.
+func buildDialer(
+	opts gatewayOptions, caSecret *corev1.Secret, hostKey []byte, mgr ctrl.Manager, clusters *gateway.Clusters,
+) (gateway.Dialer, error) {
+	pods, err := buildPodDialer(opts.dialMode, mgr, clusters)
+	if err != nil {
+		return nil, err
+	}
+	if opts.tunnelAddr == "" {
+		return pods, nil
+	}
+	advertise := opts.tunnelAdvertise
+	if advertise == "" {
+		_, port, err := net.SplitHostPort(opts.tunnelAddr)
+		if err != nil {
+			return nil, fmt.Errorf("parse --tunnel-address: %w", err)
+		}
+		if os.Getenv("POD_IP") == "" {
+			return nil, fmt.Errorf("--tunnel-address requires --tunnel-advertise-address or $POD_IP")
+		}
+		advertise = net.JoinHostPort(os.Getenv("POD_IP"), port)
+	}
+	cfg := gateway.TunnelConfig{
+		Addr:          opts.tunnelAddr,
+		AdvertiseAddr: advertise,
+		HostKeyPEM:    hostKey,
+		HostCAPEM:     caSecret.Data[controller.KeyHostCAPrivate],
+		Registry:      gateway.NewSandboxTunnelRegistry(mgr.GetClient(), clusters),
+	}
+	if opts.tunnelFallback {
+		cfg.Fallback = pods
+	}
+	tunnels, err := gateway.NewTunnels(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := mgr.Add(tunnels); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "kubepark gateway tunnel listener on %s (advertised as %s)\n", opts.tunnelAddr, advertise)
+	return tunnels, nil
+}
+
+// buildTLSConfig assembles TLS termination for the HTTP listener from the
+// certificate Secrets and ACME flags. Returns nil, serving plain HTTP, when
+// neither is set.
+func buildTLSConfig(
+	opts gatewayOptions, namespace string, mgr ctrl.Manager, direct client.Client, store gateway.Store,
+) (*tls.Config, error) {
+	if len(opts.tlsSecrets) == 0 && opts.acmeDirectoryURL == "" {
+		return nil, nil
+	}
+	cfg := gateway.TLSConfig{Client: mgr.GetClient(), Namespace: namespace, Secrets: opts.tlsSecrets}
+	if opts.acmeDirectoryURL != "" {
+		if opts.baseDomain == "" {
+			return nil, fmt.Errorf("--acme-directory-url requires --base-domain")
+		}
+		var roots *x509.CertPool
+		if opts.acmeCAFile != "" {
+			bundle, err := os.ReadFile(opts.acmeCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("read ACME CA file: %w", err)
+			}
+			roots = x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(bundle) {
+				return nil, fmt.Errorf("no certificates in %s", opts.acmeCAFile)
+			}
+		}
+		cfg.ACME = gateway.NewACMEManager(gateway.ACMEConfig{
+			DirectoryURL: opts.acmeDirectoryURL,
+			Email:        opts.acmeEmail,
+			RootCAs:      roots,
+			BaseDomain:   opts.baseDomain,
+			AuthHost:     opts.authHost,
+			Store:        store,
+			// Uncached, so an entry written by another replica is seen.
+			Cache: &gateway.SecretCache{Client: direct, Namespace: namespace},
+		})
+	}
+	return gateway.NewTLSConfig(cfg)
+}
+
 // gatewayHostKey loads the gateway's own SSH host key Secret, generating it
 // on first use so a fresh install needs no manual bootstrap.
 func gatewayHostKey(ctx context.Context, c client.Client, namespace string) ([]byte, error) {
-	const name = "kubepark-gateway-hostkey"
+	return ensureGatewayKey(ctx, c, namespace, "kubepark-gateway-hostkey", "ssh_host_ed25519_key",
+		func() (map[string][]byte, error) {
+			kp, err := sshca.GenerateKeyPair("kubepark-gateway")
+			if err != nil {
+				return nil, err
+			}
+			return map[string][]byte{
+				"ssh_host_ed25519_key":     kp.PrivatePEM,
+				"ssh_host_ed25519_key.pub": kp.PublicAuthorized,
+			}, nil
+		})
+}
+
+// gatewayIdentityKey loads the key that signs identity assertions for
+// sandbox apps, generating it on first use like the host key.
+func gatewayIdentityKey(ctx context.Context, c client.Client, namespace string) ([]byte, error) {
+	return ensureGatewayKey(ctx, c, namespace, "kubepark-gateway-identity", "identity.key",
+		func() (map[string][]byte, error) {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				return nil, err
+			}
+			der, err := x509.MarshalECPrivateKey(key)
+			if err != nil {
+				return nil, err
+			}
+			return map[string][]byte{
+				"identity.key": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}),
+			}, nil
+		})
+}
+
+// ensureGatewayKey returns field of the Secret name, creating the Secret
+// from generate when it does not exist. Replicas racing to create it all
+// end up with the winner's key.
+func ensureGatewayKey(
+	ctx context.Context, c client.Client, namespace, name, field string,
+	generate func() (map[string][]byte, error),
+) ([]byte, error) {
+	key := types.NamespacedName{Namespace: namespace, Name: name}
 	var secret corev1.Secret
-	err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &secret)
+	err := c.Get(ctx, key, &secret)
 	if err == nil {
-		return secret.Data["ssh_host_ed25519_key"], nil
+		return secret.Data[field], nil
 	}
 	if !apierrors.IsNotFound(err) {
 		return nil, err
 	}
 
-	kp, err := sshca.GenerateKeyPair("kubepark-gateway")
+	data, err := generate()
 	if err != nil {
 		return nil, err
 	}
 	secret = corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
-		Data: map[string][]byte{
-			"ssh_host_ed25519_key":     kp.PrivatePEM,
-			"ssh_host_ed25519_key.pub": kp.PublicAuthorized,
-		},
+		Data:       data,
 	}
 	if err := c.Create(ctx, &secret); err != nil {
 		if apierrors.IsAlreadyExists(err) {
 			var existing corev1.Secret
-			if getErr := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &existing); getErr == nil {
-				return existing.Data["ssh_host_ed25519_key"], nil
+			if getErr := c.Get(ctx, key, &existing); getErr == nil {
+				return existing.Data[field], nil
 			}
 		}
 		return nil, err
 	}
-	return kp.PrivatePEM, nil
+	return data[field], nil
 }
 
 // sshRunnable adapts the SSH server to a manager Runnable so it shares the
@@ -267,19 +631,27 @@ func (s *sshRunnable) Start(ctx context.Context) error {
 }
 
 // httpRunnable adapts an HTTP server (the sign endpoint) to the manager
-// lifecycle.
+// lifecycle. It serves HTTPS when tls is set.
 type httpRunnable struct {
 	addr    string
 	handler http.Handler
+	tls     *tls.Config
 }
 
 func (h *httpRunnable) Start(ctx context.Context) error {
-	srv := &http.Server{Addr: h.addr, Handler: h.handler, ReadHeaderTimeout: 10 * time.Second}
+	srv := &http.Server{Addr: h.addr, Handler: h.handler, TLSConfig: h.tls, ReadHeaderTimeout: 10 * time.Second}
 	go func() {
 		<-ctx.Done()
 		_ = srv.Close()
 	}()
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	var err error
+	if h.tls != nil {
+		// The certificates come from TLSConfig.GetCertificate.
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		return err
 	}
 	return nil
@@ -34,9 +34,11 @@ import (
 )
 
 // newLoginCommand runs the OIDC auth-code + PKCE flow against the IdP, then
-// exchanges the ID token at the gateway for a short-lived SSH certificate.
+// exchanges the ID token at the gateway for a short-lived SSH certificate
+// and, when asked, a personal access token for exposed ports.
 func newLoginCommand() *cobra.Command {
 	var gatewayURL string
+	var token tokenOptions
 	cmd := &cobra.Command{
 		Use:   "login",
 		Short: "Obtain a short-lived SSH certificate via OIDC",
@@ -44,11 +46,14 @@ func newLoginCommand() *cobra.Command {
 			if gatewayURL == "" {
 				return fmt.Errorf("--gateway-url is required (e.g. https://gateway.example.com:8080)")
 			}
-			return runLogin(cmd.Context(), gatewayURL)
+			return runLogin(cmd.Context(), gatewayURL, token)
 		},
 	}
 	cmd.Flags().StringVar(&gatewayURL, "gateway-url",
 		envOr("KUBEPARK_GATEWAY_URL", ""), "Base URL of the gateway sign endpoint.")
+	cmd.Flags().StringArrayVar(&token.scopes, "token-scope", nil,
+		"Also mint a personal access token for <namespace>/<sandbox>[:<port>], printed to stdout; repeatable.")
+	cmd.Flags().DurationVar(&token.ttl, "token-ttl", 24*time.Hour, "Personal access token validity.")
 	return cmd
 }
 
@@ -58,24 +63,11 @@ type gatewayConfig struct {
 	PrincipalClaim string `json:"principalClaim"`
 }
 
-func runLogin(ctx context.Context, gatewayURL string) error {
+func runLogin(ctx context.Context, gatewayURL string, token tokenOptions) error {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	cfg, err := fetchGatewayConfig(ctx, gatewayURL)
-	if err != nil {
-		return err
-	}
-	if cfg.Issuer == "" {
-		return fmt.Errorf("gateway has no OIDC issuer configured")
-	}
-
-	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
-	if err != nil {
-		return fmt.Errorf("discover OIDC provider: %w", err)
-	}
-
-	idToken, err := oidcAuthCodeFlow(ctx, provider, cfg.ClientID)
+	idToken, err := loginIDToken(ctx, gatewayURL)
 	if err != nil {
 		return err
 	}
@@ -102,9 +94,29 @@ func runLogin(ctx context.Context, gatewayURL string) error {
 		return err
 	}
 	fmt.Fprintf(os.Stderr, "logged in as %q; certificate written to %s\n", principal, out)
+	if len(token.scopes) > 0 {
+		return mintToken(ctx, gatewayURL, idToken, token)
+	}
 	return nil
 }
 
+// loginIDToken logs in with the IdP the gateway trusts and returns the ID
+// token.
+func loginIDToken(ctx context.Context, gatewayURL string) (string, error) {
+	cfg, err := fetchGatewayConfig(ctx, gatewayURL)
+	if err != nil {
+		return "", err
+	}
+	if cfg.Issuer == "" {
+		return "", fmt.Errorf("gateway has no OIDC issuer configured")
+	}
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return "", fmt.Errorf("discover OIDC provider: %w", err)
+	}
+	return oidcAuthCodeFlow(ctx, provider, cfg.ClientID)
+}
+
 func fetchGatewayConfig(ctx context.Context, gatewayURL string) (gatewayConfig, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gatewayURL+"/v1/config", nil)
 	if err != nil {
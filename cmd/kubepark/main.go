@@ -37,6 +37,9 @@ func main() {
 	root.AddCommand(
 		newLoginCommand(),
 		newSSHCommand(),
+		newTunnelCommand(),
+		newTokenCommand(),
+		newShareCommand(),
 		newAdminCommand(),
 	)
 
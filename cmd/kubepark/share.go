@@ -0,0 +1,146 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frauniki/kubepark/internal/gateway"
+)
+
+// newShareCommand groups share link helpers. Both subcommands log in with
+// the IdP, as only the sandbox owner may create or revoke a link.
+func newShareCommand() *cobra.Command {
+	share := &cobra.Command{
+		Use:   "share",
+		Short: "Share an exposed port through an expiring link",
+	}
+	share.AddCommand(newShareCreateCommand(), newShareRevokeCommand())
+	return share
+}
+
+func newShareCreateCommand() *cobra.Command {
+	var gatewayURL string
+	var readOnly bool
+	var ttl time.Duration
+	cmd := &cobra.Command{
+		Use:   "create NAMESPACE/SANDBOX:PORT",
+		Short: "Create a share link to an exposed port, printed to stdout",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if gatewayURL == "" {
+				return fmt.Errorf("--gateway-url is required (e.g. https://gateway.example.com:8080)")
+			}
+			target, err := gateway.ParseTokenScope(args[0])
+			if err != nil {
+				return err
+			}
+			if target.Port == "" {
+				return fmt.Errorf("share a port: %s:<port>", args[0])
+			}
+			ctx := cmd.Context()
+			idToken, err := loginIDToken(ctx, gatewayURL)
+			if err != nil {
+				return err
+			}
+			var issued gateway.IssuedShareLink
+			if err := postShare(ctx, gatewayURL+"/v1/share", map[string]any{
+				"idToken": idToken, "target": target, "readOnly": readOnly, "ttlSeconds": int64(ttl.Seconds()),
+			}, &issued); err != nil {
+				return err
+			}
+			mode := "read-write"
+			if issued.ReadOnly {
+				mode = "read-only"
+			}
+			fmt.Fprintf(os.Stderr, "%s share link %s expires %s; revoke it with kubepark share revoke\n",
+				mode, issued.ID, issued.ExpiresAt.Local().Format(time.RFC3339))
+			fmt.Println(issued.URL)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&gatewayURL, "gateway-url",
+		envOr("KUBEPARK_GATEWAY_URL", ""), "Base URL of the gateway sign endpoint.")
+	cmd.Flags().BoolVar(&readOnly, "read-only", false, "Allow only GET, HEAD and OPTIONS requests.")
+	cmd.Flags().DurationVar(&ttl, "ttl", time.Hour, "Share link validity.")
+	return cmd
+}
+
+func newShareRevokeCommand() *cobra.Command {
+	var gatewayURL string
+	cmd := &cobra.Command{
+		Use:   "revoke URL",
+		Short: "Revoke a share link on every gateway replica",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if gatewayURL == "" {
+				return fmt.Errorf("--gateway-url is required (e.g. https://gateway.example.com:8080)")
+			}
+			ctx := cmd.Context()
+			idToken, err := loginIDToken(ctx, gatewayURL)
+			if err != nil {
+				return err
+			}
+			if err := postShare(ctx, gatewayURL+"/v1/share/revoke",
+				map[string]string{"idToken": idToken, "url": args[0]}, nil); err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stderr, "share link revoked")
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&gatewayURL, "gateway-url",
+		envOr("KUBEPARK_GATEWAY_URL", ""), "Base URL of the gateway sign endpoint.")
+	return cmd
+}
+
+// postShare posts a share request and decodes the response into out,
+// when set. The gateway's reason is included in an error.
+func postShare(ctx context.Context, endpoint string, request, out any) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	body, _ := json.Marshal(request)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("share request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("share request failed: %s: %s", resp.Status, strings.TrimSpace(string(reason)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -21,6 +21,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"syscall"
 
 	"github.com/spf13/cobra"
@@ -30,7 +31,10 @@ import (
 // works for terminals, scp/rsync, VS Code Remote-SSH and JetBrains Gateway.
 func newSSHCommand() *cobra.Command {
 	var namespace string
+	var cluster string
 	var gatewayAddr string
+	var gatewayURL string
+	var transport string
 	var gatewayUser string
 	var hostCAPath string
 	var printConfig bool
@@ -43,7 +47,17 @@ func newSSHCommand() *cobra.Command {
 			if namespace != "" {
 				target = args[0] + "." + namespace
 			}
-			cfgPath, err := writeSSHConfig(gatewayAddr, gatewayUser, hostCAPath)
+			if cluster != "" {
+				if namespace == "" {
+					return fmt.Errorf("--cluster requires --namespace")
+				}
+				target += "." + cluster
+			}
+			proxyCommand, err := gatewayProxyCommand(transport, gatewayURL)
+			if err != nil {
+				return err
+			}
+			cfgPath, err := writeSSHConfig(gatewayAddr, gatewayUser, hostCAPath, proxyCommand)
 			if err != nil {
 				return err
 			}
@@ -56,8 +70,15 @@ func newSSHCommand() *cobra.Command {
 	}
 	cmd.Flags().StringVarP(&namespace, "namespace", "n", "",
 		"Sandbox namespace (appended as <sandbox>.<namespace>).")
+	cmd.Flags().StringVar(&cluster, "cluster", "",
+		"Member cluster of the sandbox (appended as <sandbox>.<namespace>.<cluster>).")
 	cmd.Flags().StringVar(&gatewayAddr, "gateway",
 		envOr("KUBEPARK_GATEWAY", "localhost:2222"), "Gateway host:port.")
+	cmd.Flags().StringVar(&transport, "transport", envOr("KUBEPARK_TRANSPORT", transportTCP),
+		"How to reach the gateway: tcp (its SSH port), or wss (SSH over WebSocket at --gateway-url, "+
+			"for networks that block SSH).")
+	cmd.Flags().StringVar(&gatewayURL, "gateway-url",
+		envOr("KUBEPARK_GATEWAY_URL", ""), "Base URL of the gateway sign endpoint, for --transport=wss.")
 	cmd.Flags().StringVar(&gatewayUser, "gateway-user",
 		envOr("KUBEPARK_GATEWAY_USER", "jump"), "Gateway SSH user.")
 	cmd.Flags().StringVar(&hostCAPath, "host-ca", "",
@@ -67,10 +88,44 @@ func newSSHCommand() *cobra.Command {
 	return cmd
 }
 
-// writeSSHConfig renders ~/.kubepark/ssh_config. The gateway is a ProxyJump;
-// the final hop uses the CLI certificate and (optionally) trusts the host
-// CA so there is no host-key TOFU prompt.
-func writeSSHConfig(gatewayAddr, gatewayUser, hostCAPath string) (string, error) {
+// Values of --transport.
+const (
+	transportTCP = "tcp"
+	transportWSS = "wss"
+)
+
+// gatewayProxyCommand is the ProxyCommand that reaches the gateway over
+// transport, or "" for a direct TCP connection.
+func gatewayProxyCommand(transport, gatewayURL string) (string, error) {
+	switch transport {
+	case transportTCP:
+		return "", nil
+	case transportWSS:
+	default:
+		return "", fmt.Errorf("unknown --transport %q: want %s or %s", transport, transportTCP, transportWSS)
+	}
+	if gatewayURL == "" {
+		return "", fmt.Errorf("--transport=wss requires --gateway-url")
+	}
+	if _, err := sshWebSocketURL(gatewayURL); err != nil {
+		return "", err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("locate the kubepark binary: %w", err)
+	}
+	if strings.ContainsAny(self, " \t") {
+		self = `"` + self + `"`
+	}
+	// ssh expands %-tokens in a ProxyCommand.
+	return strings.ReplaceAll(self+" tunnel "+gatewayURL, "%", "%%"), nil
+}
+
+// writeSSHConfig renders ~/.kubepark/ssh_config. The gateway is a ProxyJump,
+// reached directly or through proxyCommand when set; the final hop uses the
+// CLI certificate and (optionally) trusts the host CA so there is no
+// host-key TOFU prompt.
+func writeSSHConfig(gatewayAddr, gatewayUser, hostCAPath, proxyCommand string) (string, error) {
 	dir, err := configDir()
 	if err != nil {
 		return "", err
@@ -85,6 +140,11 @@ func writeSSHConfig(gatewayAddr, gatewayUser, hostCAPath string) (string, error)
 	}
 
 	gwHost, gwPort := splitHostPort(gatewayAddr)
+	gwRoute := fmt.Sprintf("    HostName %s\n    Port %s\n", gwHost, gwPort)
+	if proxyCommand != "" {
+		// Proxies in the way drop connections that look idle.
+		gwRoute = "    ProxyCommand " + proxyCommand + "\n    ServerAliveInterval 30\n"
+	}
 	knownHosts := ""
 	if hostCAPath != "" {
 		khPath := filepath.Join(dir, "known_hosts")
@@ -108,9 +168,7 @@ func writeSSHConfig(gatewayAddr, gatewayUser, hostCAPath string) (string, error)
 	// for it; sandbox host keys are always CA-verified.
 	cfg := fmt.Sprintf(`# Generated by kubepark; do not edit.
 Host kubepark-gateway
-    HostName %s
-    Port %s
-    User %s
+%s    User %s
     IdentityFile %s
     IdentitiesOnly yes
     UserKnownHostsFile %s
@@ -122,7 +180,7 @@ Host * !kubepark-gateway
     CertificateFile %s
     IdentitiesOnly yes
     ConnectTimeout 180
-%s`, gwHost, gwPort, gatewayUser, priv, gwKnownHosts, priv, cert, knownHosts)
+%s`, gwRoute, gatewayUser, priv, gwKnownHosts, priv, cert, knownHosts)
 
 	cfgPath := filepath.Join(dir, "ssh_config")
 	if err := os.WriteFile(cfgPath, []byte(cfg), 0o600); err != nil {
@@ -0,0 +1,124 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frauniki/kubepark/internal/gateway"
+)
+
+// tokenOptions asks kubepark login for a personal access token.
+type tokenOptions struct {
+	scopes []string
+	ttl    time.Duration
+}
+
+// mintToken exchanges the login's ID token for a personal access token and
+// prints it to stdout, so it can be captured by a script.
+func mintToken(ctx context.Context, gatewayURL, idToken string, opts tokenOptions) error {
+	scopes := make([]gateway.TokenScope, 0, len(opts.scopes))
+	for _, s := range opts.scopes {
+		scope, err := gateway.ParseTokenScope(s)
+		if err != nil {
+			return err
+		}
+		scopes = append(scopes, scope)
+	}
+	body, _ := json.Marshal(map[string]any{
+		"idToken": idToken, "scopes": scopes, "ttlSeconds": int64(opts.ttl.Seconds()),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, gatewayURL+"/v1/token", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("token request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token request failed: %s", resp.Status)
+	}
+	var issued gateway.IssuedToken
+	if err := json.NewDecoder(resp.Body).Decode(&issued); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "personal access token %s expires %s; revoke it with kubepark token revoke\n",
+		issued.ID, issued.ExpiresAt.Local().Format(time.RFC3339))
+	fmt.Println(issued.Token)
+	return nil
+}
+
+// newTokenCommand groups personal access token helpers. Tokens are minted
+// by kubepark login --token-scope.
+func newTokenCommand() *cobra.Command {
+	token := &cobra.Command{
+		Use:   "token",
+		Short: "Manage personal access tokens for exposed ports",
+	}
+	token.AddCommand(newTokenRevokeCommand())
+	return token
+}
+
+func newTokenRevokeCommand() *cobra.Command {
+	var gatewayURL string
+	cmd := &cobra.Command{
+		Use:   "revoke TOKEN",
+		Short: "Revoke a personal access token on every gateway replica",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if gatewayURL == "" {
+				return fmt.Errorf("--gateway-url is required (e.g. https://gateway.example.com:8080)")
+			}
+			return revokeToken(cmd.Context(), gatewayURL, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&gatewayURL, "gateway-url",
+		envOr("KUBEPARK_GATEWAY_URL", ""), "Base URL of the gateway sign endpoint.")
+	return cmd
+}
+
+func revokeToken(ctx context.Context, gatewayURL, token string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, gatewayURL+"/v1/token/revoke", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("revoke request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("revoke request failed: %s", resp.Status)
+	}
+	fmt.Fprintln(os.Stderr, "token revoked")
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/spf13/cobra"
+
+	"github.com/frauniki/kubepark/internal/gateway"
+)
+
+// newTunnelCommand carries an SSH connection to the gateway over WebSocket,
+// on stdin and stdout. It is the ProxyCommand kubepark ssh --transport=wss
+// writes, for networks that block outbound SSH but let HTTPS through.
+func newTunnelCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "tunnel <gateway-url>",
+		Short: "Carry SSH to the gateway over WebSocket (an ssh ProxyCommand)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTunnel(cmd.Context(), args[0], os.Stdin, os.Stdout)
+		},
+	}
+}
+
+func runTunnel(ctx context.Context, gatewayURL string, in io.Reader, out io.Writer) error {
+	wsURL, err := sshWebSocketURL(gatewayURL)
+	if err != nil {
+		return err
+	}
+	// The default dialer honors HTTPS_PROXY, as corporate networks need.
+	ws, resp, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("connect to %s: %s", wsURL, resp.Status)
+		}
+		return fmt.Errorf("connect to %s: %w", wsURL, err)
+	}
+	conn := gateway.NewWebSocketConn(ws)
+	defer func() { _ = conn.Close() }()
+
+	// ssh closing our stdin ends the connection; so does the gateway.
+	go func() {
+		_, _ = io.Copy(conn, in)
+		_ = conn.Close()
+	}()
+	if _, err := io.Copy(out, conn); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// sshWebSocketURL is the gateway's SSH over WebSocket endpoint under the
+// base URL of its sign endpoint.
+func sshWebSocketURL(gatewayURL string) (string, error) {
+	u, err := url.Parse(gatewayURL)
+	if err != nil {
+		return "", fmt.Errorf("parse gateway URL: %w", err)
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	case "wss", "ws":
+	default:
+		return "", fmt.Errorf("gateway URL %q is not http(s)", gatewayURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + gateway.SSHWebSocketPath
+	return u.String(), nil
+}
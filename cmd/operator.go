@@ -19,7 +19,9 @@ package main
 import (
 	"crypto/tls"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -39,6 +41,7 @@ import (
 
 	kubeparkdevv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
 	"github.com/frauniki/kubepark/internal/controller"
+	"github.com/frauniki/kubepark/internal/controller/podspec"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -81,6 +84,11 @@ func runOperator(args []string) {
 	var agentImage string
 	var priorityClassName string
 	var gatewayNamespace string
+	var exposeMode, httpRouteParent string
+	var expose podspec.ExposeOptions
+	var ingressNamespace string
+	var tunnelAddress string
+	var clusterName string
 	var tlsOpts []func(*tls.Config)
 	fs := flag.NewFlagSet("operator", flag.ExitOnError)
 	fs.StringVar(&agentImage, "agent-image", os.Getenv("AGENT_IMAGE"),
@@ -89,6 +97,32 @@ func runOperator(args []string) {
 		"PriorityClass set on sandbox pods, if any.")
 	fs.StringVar(&gatewayNamespace, "gateway-namespace", "",
 		"Namespace of the kubepark gateway (for sandbox ingress rules). Defaults to the operator namespace.")
+	fs.StringVar(&exposeMode, "expose-mode", string(podspec.ExposeGateway),
+		"How exposed ports with auth none are published besides the gateway: gateway (not at all), "+
+			"ingress (a Service and an Ingress per sandbox) or httproute (a Service and Gateway API HTTPRoutes).")
+	fs.StringVar(&expose.BaseDomain, "expose-base-domain", "",
+		"Parent domain of the <port>--<sandbox>--<namespace> hosts of Ingresses and HTTPRoutes.")
+	fs.StringVar(&expose.IngressClassName, "ingress-class", "", "IngressClass of sandbox Ingresses, if any.")
+	fs.Func("expose-annotation", "Annotation key=value set on every sandbox Ingress or HTTPRoute; repeatable.",
+		func(kv string) error {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok || k == "" {
+				return fmt.Errorf("want key=value, got %q", kv)
+			}
+			if expose.Annotations == nil {
+				expose.Annotations = map[string]string{}
+			}
+			expose.Annotations[k] = v
+			return nil
+		})
+	fs.StringVar(&httpRouteParent, "httproute-parent", "",
+		"Gateway that sandbox HTTPRoutes attach to, as <namespace>/<name>[/<listener>].")
+	fs.StringVar(&ingressNamespace, "ingress-namespace", "",
+		"Namespace of the ingress controller or Gateway API data plane, allowed to reach exposed ports.")
+	fs.StringVar(&tunnelAddress, "tunnel-address", "",
+		"Gateway reverse-tunnel listener (host:port) sandbox agents connect out to; empty leaves the tunnel off.")
+	fs.StringVar(&clusterName, "cluster-name", "",
+		"This cluster's ClusterRegistration name when a gateway in another cluster serves its sandboxes.")
 	fs.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
 	fs.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -116,6 +150,26 @@ func runOperator(args []string) {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	mode, err := podspec.ParseExposeMode(exposeMode)
+	if err == nil && mode != podspec.ExposeGateway && expose.BaseDomain == "" {
+		err = fmt.Errorf("--expose-mode=%s requires --expose-base-domain", mode)
+	}
+	if err == nil && mode == podspec.ExposeHTTPRoute {
+		parts := strings.Split(httpRouteParent, "/")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			err = fmt.Errorf("--expose-mode=httproute requires --httproute-parent=<namespace>/<name>[/<listener>]")
+		} else {
+			expose.ParentNamespace, expose.ParentName = parts[0], parts[1]
+			if len(parts) == 3 {
+				expose.ParentSection = parts[2]
+			}
+		}
+	}
+	if err != nil {
+		setupLog.Error(err, "Invalid exposure flags")
+		os.Exit(1)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -213,6 +267,12 @@ func runOperator(args []string) {
 		AgentImage:        agentImage,
 		PriorityClassName: priorityClassName,
 		GatewayNamespace:  gatewayNamespace,
+		ExposeMode:        mode,
+		Expose:            expose,
+		IngressNamespace:  ingressNamespace,
+		TunnelAddress:     tunnelAddress,
+		ClusterName:       clusterName,
+		Recorder:          mgr.GetEventRecorder("sandbox-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "Failed to create controller", "controller", "sandbox")
 		os.Exit(1)
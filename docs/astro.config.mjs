@@ -55,6 +55,10 @@ export default defineConfig({
 					items: [
 						{ slug: 'guides/templates' },
 						{ slug: 'guides/access-profiles' },
+						{ slug: 'guides/access-targets' },
+						{ slug: 'guides/multi-cluster' },
+						{ slug: 'guides/web-terminal' },
+						{ slug: 'guides/user-profiles' },
 						{ slug: 'guides/storage' },
 					],
 				},
@@ -0,0 +1,19 @@
+#!/usr/bin/env bash
+# Prints the Subresource Integrity hashes of the xterm.js files the web
+# terminal loads, as gateway.webTerminal.assetsIntegrity values. Run it
+# against the CDN (or mirror) in assetsURL and review the output before
+# pinning it.
+set -euo pipefail
+
+assets_url="${1:-https://cdn.jsdelivr.net/npm}"
+xterm_version=5.5.0
+fit_version=0.10.0
+
+echo "assetsIntegrity:"
+for file in \
+  "@xterm/xterm@${xterm_version}/css/xterm.css" \
+  "@xterm/xterm@${xterm_version}/lib/xterm.js" \
+  "@xterm/addon-fit@${fit_version}/lib/addon-fit.js"; do
+  hash="$(curl -fsSL "${assets_url%/}/${file}" | openssl dgst -sha384 -binary | openssl base64 -A)"
+  echo "  $(basename "${file}"): sha384-${hash}"
+done
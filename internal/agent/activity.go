@@ -0,0 +1,208 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	gliderssh "github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/frauniki/kubepark/internal/agentapi"
+)
+
+const (
+	// cpuSampleInterval is how often container CPU usage is sampled.
+	cpuSampleInterval = 15 * time.Second
+	// defaultCPUThreshold is the usage, in millicores, above which the
+	// sandbox counts as busy.
+	defaultCPUThreshold = 100
+)
+
+// activityTracker records activity timestamps (unix nanoseconds; zero is
+// never) from the session paths and the CPU sampler.
+type activityTracker struct {
+	now          func() time.Time
+	cpuThreshold int64
+
+	lastInput       atomic.Int64
+	lastCPU         atomic.Int64
+	lastPortForward atomic.Int64
+}
+
+func newActivityTracker(cfg Config) *activityTracker {
+	threshold := cfg.CPUThreshold
+	if threshold == 0 {
+		threshold = defaultCPUThreshold
+	}
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+	return &activityTracker{now: now, cpuThreshold: threshold}
+}
+
+func (a *activityTracker) mark(ts *atomic.Int64) {
+	ts.Store(a.now().UnixNano())
+}
+
+func (a *activityTracker) snapshot() agentapi.Activity {
+	at := func(ts *atomic.Int64) *time.Time {
+		n := ts.Load()
+		if n == 0 {
+			return nil
+		}
+		t := time.Unix(0, n).UTC()
+		return &t
+	}
+	return agentapi.Activity{
+		LastInput:       at(&a.lastInput),
+		LastCPU:         at(&a.lastCPU),
+		LastPortForward: at(&a.lastPortForward),
+	}
+}
+
+// ServeHTTP reports the current snapshot as JSON.
+func (a *activityTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != agentapi.ActivityPath || r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(a.snapshot())
+}
+
+// sampleCPU marks CPU activity whenever usage over a sample interval
+// exceeds the threshold, until done is closed. Usage comes from the
+// container's cgroup, which covers the agent's whole process tree
+// including detached jobs.
+func (a *activityTracker) sampleCPU(done <-chan struct{}) {
+	prev, err := cgroupCPUUsage()
+	if err != nil {
+		return
+	}
+	ticker := time.NewTicker(cpuSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		cur, err := cgroupCPUUsage()
+		if err != nil {
+			continue
+		}
+		if millicores(cur-prev, cpuSampleInterval) > a.cpuThreshold {
+			a.mark(&a.lastCPU)
+		}
+		prev = cur
+	}
+}
+
+// millicores converts CPU time used over an interval to average usage.
+func millicores(used, interval time.Duration) int64 {
+	return int64(used) * 1000 / int64(interval)
+}
+
+// cgroupCPUUsage returns the container's cumulative CPU time, from cgroup
+// v2 cpu.stat or, failing that, the cgroup v1 cpuacct controller.
+func cgroupCPUUsage() (time.Duration, error) {
+	if f, err := os.Open("/sys/fs/cgroup/cpu.stat"); err == nil {
+		defer func() { _ = f.Close() }()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if v, ok := strings.CutPrefix(scanner.Text(), "usage_usec "); ok {
+				usec, err := strconv.ParseInt(v, 10, 64)
+				return time.Duration(usec) * time.Microsecond, err
+			}
+		}
+		return 0, errors.New("cpu.stat has no usage_usec")
+	}
+	raw, err := os.ReadFile("/sys/fs/cgroup/cpuacct/cpuacct.usage")
+	if err != nil {
+		return 0, err
+	}
+	ns, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+	return time.Duration(ns), err
+}
+
+// inputReader marks input activity for every keystroke read from a PTY
+// client.
+type inputReader struct {
+	io.Reader
+	act *activityTracker
+}
+
+func (r inputReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.act.mark(&r.act.lastInput)
+	}
+	return n, err
+}
+
+// forwardHandler wraps the direct-tcpip (ssh -L) handler so traffic in
+// either direction marks port-forward activity.
+func forwardHandler(act *activityTracker) gliderssh.ChannelHandler {
+	return func(srv *gliderssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx gliderssh.Context) {
+		gliderssh.DirectTCPIPHandler(srv, conn, activeNewChannel{NewChannel: newChan, act: act}, ctx)
+	}
+}
+
+type activeNewChannel struct {
+	gossh.NewChannel
+	act *activityTracker
+}
+
+func (c activeNewChannel) Accept() (gossh.Channel, <-chan *gossh.Request, error) {
+	ch, reqs, err := c.NewChannel.Accept()
+	if err != nil {
+		return nil, nil, err
+	}
+	return activeChannel{Channel: ch, act: c.act}, reqs, nil
+}
+
+type activeChannel struct {
+	gossh.Channel
+	act *activityTracker
+}
+
+func (c activeChannel) Read(p []byte) (int, error) {
+	n, err := c.Channel.Read(p)
+	if n > 0 {
+		c.act.mark(&c.act.lastPortForward)
+	}
+	return n, err
+}
+
+func (c activeChannel) Write(p []byte) (int, error) {
+	n, err := c.Channel.Write(p)
+	if n > 0 {
+		c.act.mark(&c.act.lastPortForward)
+	}
+	return n, err
+}
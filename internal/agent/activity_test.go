@@ -0,0 +1,130 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/frauniki/kubepark/internal/agentapi"
+)
+
+func TestMillicores(t *testing.T) {
+	if got := millicores(1500*time.Millisecond, 15*time.Second); got != 100 {
+		t.Errorf("expected 100m, got %dm", got)
+	}
+	if got := millicores(30*time.Second, 15*time.Second); got != 2000 {
+		t.Errorf("expected 2000m, got %dm", got)
+	}
+}
+
+// activityOf fetches the server's activity report over HTTP.
+func activityOf(t *testing.T, s *Server) agentapi.Activity {
+	t.Helper()
+	srv := httptest.NewServer(s.activity)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + agentapi.ActivityPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var act agentapi.Activity
+	if err := json.NewDecoder(resp.Body).Decode(&act); err != nil {
+		t.Fatal(err)
+	}
+	return act
+}
+
+// TestActivityInput checks that typing into the persistent shell is
+// reported as input, and that merely attaching is not.
+func TestActivityInput(t *testing.T) {
+	server, addr, owner := startTestAgent(t, Config{})
+	sess, err := dialTestServer(t, addr, owner).NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.RequestPty("xterm", 24, 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	stdin, _ := sess.StdinPipe()
+	if err := sess.Shell(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if act := activityOf(t, server); act.LastInput != nil {
+		t.Fatalf("expected no input before typing, got %v", act.LastInput)
+	}
+	if _, err := io.WriteString(stdin, "true\n"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for activityOf(t, server).LastInput == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("typing was not reported as input")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// The persistent shell outlives the session; exit it so it does not
+	// linger in the process-wide reaper.
+	_, _ = io.WriteString(stdin, "exit\n")
+	_ = sess.Wait()
+}
+
+// TestActivityPortForward checks that traffic through `ssh -L` is reported.
+func TestActivityPortForward(t *testing.T) {
+	server, addr, owner := startTestAgent(t, Config{})
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = target.Close() }()
+	go func() {
+		conn, err := target.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(conn, conn)
+		_ = conn.Close()
+	}()
+
+	conn, err := dialTestServer(t, addr, owner).Dial("tcp", target.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if act := activityOf(t, server); act.LastPortForward != nil {
+		t.Fatalf("expected no forward activity before traffic, got %v", act.LastPortForward)
+	}
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	act := activityOf(t, server)
+	if act.LastPortForward == nil {
+		t.Fatal("forwarded traffic was not reported")
+	}
+	if act.LastInput != nil || act.LastCPU != nil {
+		t.Errorf("expected only port-forward activity, got %+v", act)
+	}
+}
@@ -16,18 +16,27 @@ limitations under the License.
 
 // Package agent is the in-sandbox SSH server. It authenticates the single
 // owner via a CA-signed user certificate, presents a CA-signed host
-// certificate, and serves persistent (tmux-style) PTY sessions, exec, SFTP
-// and TCP port forwarding.
+// certificate, and serves persistent (tmux-style) PTY sessions, exec, SFTP,
+// TCP port forwarding and SSH agent forwarding.
 package agent
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	gliderssh "github.com/gliderlabs/ssh"
+	"github.com/go-logr/logr"
 	gossh "golang.org/x/crypto/ssh"
 
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/agentapi"
 	"github.com/frauniki/kubepark/internal/sshca"
 )
 
@@ -49,10 +58,61 @@ type Config struct {
 	Command []string
 	// HomeDir is the SFTP/shell root.
 	HomeDir string
+	// AgentForwarding allows `ssh -A` clients (whose certificate permits
+	// it) to expose their SSH agent inside the sandbox.
+	AgentForwarding bool
+	// AcceptEnv lists the client-sent variables (shell globs, as in sshd's
+	// AcceptEnv) passed to exec children. Nil means DefaultAcceptEnv.
+	AcceptEnv []string
+	// SFTP selects what the SFTP subsystem exposes. Defaults to
+	// kubeparkv1alpha1.SFTPHome.
+	SFTP kubeparkv1alpha1.SFTPMode
+	// Log receives audit events (SFTP transfers and modifications). The
+	// zero value discards them.
+	Log logr.Logger
+	// ActivityAddr is where the operator polls for activity (see
+	// agentapi.ActivityPath) and drives lifecycle hooks (see
+	// agentapi.HooksPath). Empty disables the endpoint.
+	ActivityAddr string
+	// CPUThreshold is the CPU usage, in millicores, above which the
+	// sandbox counts as active. Defaults to 100.
+	CPUThreshold int64
+	// Hooks are the template's lifecycle hooks.
+	Hooks Hooks
+	// Dotfiles is the owner's dotfiles repository, installed once per
+	// home before postCreate.
+	Dotfiles *Dotfiles
+	// AuthorizedKeys are plain public keys accepted for the owner besides
+	// certificates, from the owner's UserProfile.
+	AuthorizedKeys []gossh.PublicKey
+	// TunnelAddr is the gateway's reverse-tunnel listener. When set, the
+	// agent keeps a connection open to it, authenticated with its host
+	// certificate, and serves the gateway's connections over it.
+	TunnelAddr string
+	// HostCAAuthorized is the host CA public key (authorized_keys form)
+	// that must have signed the gateway's tunnel certificate.
+	HostCAAuthorized []byte
+	// Sandbox and Namespace name the sandbox the agent serves, which it
+	// claims on the tunnel, and Cluster its cluster when that is a member
+	// of a gateway in another.
+	Sandbox   string
+	Namespace string
+	Cluster   string
+	// GracePeriod is the pod's termination grace period. On SIGTERM the
+	// agent waits this long (less a small margin) for its children to exit
+	// before killing them. Defaults to 30s.
+	GracePeriod time.Duration
 	// Now is injected for tests; defaults to time.Now.
 	Now func() time.Time
 }
 
+const (
+	defaultGracePeriod = 30 * time.Second
+	// shutdownMargin is kept back from the grace period so the agent's own
+	// SIGKILL sweep and exit happen before the kubelet's.
+	shutdownMargin = 2 * time.Second
+)
+
 // ConfigFromEnv builds a Config from the mounted host-key secret and env.
 func ConfigFromEnv(command []string) (Config, error) {
 	dir := os.Getenv("KUBEPARK_HOST_DIR")
@@ -75,6 +135,57 @@ func ConfigFromEnv(command []string) (Config, error) {
 	if home == "" {
 		home = "/home/sandbox"
 	}
+	grace := defaultGracePeriod
+	if v := os.Getenv("KUBEPARK_GRACE_PERIOD_SECONDS"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("parse KUBEPARK_GRACE_PERIOD_SECONDS: %w", err)
+		}
+		grace = time.Duration(secs) * time.Second
+	}
+	agentForwarding := true
+	if v := os.Getenv("KUBEPARK_AGENT_FORWARDING"); v != "" {
+		agentForwarding, err = strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("parse KUBEPARK_AGENT_FORWARDING: %w", err)
+		}
+	}
+	var acceptEnv []string
+	if v, ok := os.LookupEnv("KUBEPARK_ACCEPT_ENV"); ok {
+		// Set but empty means the template accepts no client variables.
+		acceptEnv = []string{}
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				acceptEnv = append(acceptEnv, p)
+			}
+		}
+	}
+	var cpuThreshold int64
+	if v := os.Getenv("KUBEPARK_CPU_THRESHOLD_MILLICORES"); v != "" {
+		cpuThreshold, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("parse KUBEPARK_CPU_THRESHOLD_MILLICORES: %w", err)
+		}
+	}
+	hooks, err := parseHooks(os.Getenv("KUBEPARK_HOOKS"))
+	if err != nil {
+		return Config{}, err
+	}
+	dotfiles, err := parseDotfiles(os.Getenv("KUBEPARK_DOTFILES"))
+	if err != nil {
+		return Config{}, err
+	}
+	sftpMode := kubeparkv1alpha1.SFTPHome
+	if v := os.Getenv("KUBEPARK_SFTP"); v != "" {
+		sftpMode = kubeparkv1alpha1.SFTPMode(v)
+	}
+	tunnelAddr := os.Getenv("KUBEPARK_TUNNEL_ADDR")
+	var hostCA []byte
+	if tunnelAddr != "" {
+		if hostCA, err = os.ReadFile(dir + "/host-ca.pub"); err != nil {
+			return Config{}, fmt.Errorf("read host CA: %w", err)
+		}
+	}
 	return Config{
 		Addr:               ":2222",
 		Owner:              os.Getenv("KUBEPARK_OWNER"),
@@ -83,17 +194,92 @@ func ConfigFromEnv(command []string) (Config, error) {
 		UserCAAuthorized:   userCA,
 		Command:            command,
 		HomeDir:            home,
+		AgentForwarding:    agentForwarding,
+		AcceptEnv:          acceptEnv,
+		SFTP:               sftpMode,
+		ActivityAddr:       ":2223",
+		CPUThreshold:       cpuThreshold,
+		Hooks:              hooks,
+		Dotfiles:           dotfiles,
+		AuthorizedKeys:     parseAuthorizedKeys(os.Getenv("KUBEPARK_AUTHORIZED_KEYS")),
+		TunnelAddr:         tunnelAddr,
+		HostCAAuthorized:   hostCA,
+		Sandbox:            os.Getenv("KUBEPARK_SANDBOX"),
+		Namespace:          os.Getenv("KUBEPARK_NAMESPACE"),
+		Cluster:            os.Getenv("KUBEPARK_CLUSTER"),
+		GracePeriod:        grace,
 	}, nil
 }
 
+// Server is the agent's SSH server together with the process supervision
+// it fronts (the persistent shell, exec children and the main process).
+type Server struct {
+	*gliderssh.Server
+	sessions *sessionManager
+	activity *activityTracker
+	hooks    *hookRunner
+	// activitySrv serves the activity endpoint; closing activityDone ends
+	// the CPU sampler.
+	activitySrv  *http.Server
+	activityDone chan struct{}
+	// tunnel is the reverse tunnel to the gateway, if configured.
+	tunnel *tunnelClient
+}
+
+// ListenAndServeActivity samples CPU usage and serves the activity and hook
+// endpoints on ActivityAddr until Shutdown. It returns nil once shut down.
+func (s *Server) ListenAndServeActivity() error {
+	if s.activitySrv == nil {
+		return nil
+	}
+	go s.activity.sampleCPU(s.activityDone)
+	if err := s.activitySrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// ShutdownTimeout is how long Shutdown should be given: the configured
+// grace period less a margin to exit before the kubelet kills the pod.
+func (s *Server) ShutdownTimeout() time.Duration {
+	return max(s.sessions.cfg.GracePeriod-shutdownMargin, time.Second)
+}
+
+// Shutdown handles SIGTERM as an init should: attached sessions are told
+// the sandbox is suspending, SIGTERM is forwarded to the main process and
+// all shells, and it waits for them until ctx is done before killing the
+// rest. The SSH listener and connections are closed last so clients see
+// the message and their processes' final output.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.sessions.shutdown(ctx)
+	if s.activitySrv != nil {
+		close(s.activityDone)
+		_ = s.activitySrv.Close()
+	}
+	if s.tunnel != nil {
+		close(s.tunnel.done)
+	}
+	return s.Close()
+}
+
 // NewServer builds the gliderlabs SSH server for the sandbox agent.
-func NewServer(cfg Config) (*gliderssh.Server, error) {
+func NewServer(cfg Config) (*Server, error) {
 	if cfg.Owner == "" {
 		return nil, fmt.Errorf("agent requires an owner principal")
 	}
 	if cfg.Now == nil {
 		cfg.Now = time.Now
 	}
+	if cfg.GracePeriod == 0 {
+		cfg.GracePeriod = defaultGracePeriod
+	}
+	switch cfg.SFTP {
+	case "":
+		cfg.SFTP = kubeparkv1alpha1.SFTPHome
+	case kubeparkv1alpha1.SFTPHome, kubeparkv1alpha1.SFTPReadOnly, kubeparkv1alpha1.SFTPFull:
+	default:
+		return nil, fmt.Errorf("unknown SFTP mode %q", cfg.SFTP)
+	}
 
 	hostSigner, err := signerWithCert(cfg.HostKeyPEM, cfg.HostCertAuthorized)
 	if err != nil {
@@ -105,23 +291,41 @@ func NewServer(cfg Config) (*gliderssh.Server, error) {
 	}
 
 	sessions := newSessionManager(cfg)
+	activity := sessions.activity
+	if cfg.AgentForwarding {
+		if sessions.agents, err = newAgentForwarder(); err != nil {
+			return nil, err
+		}
+	}
 	// Launch the template's main workload (if any) as a supervised
-	// background process, independent of SSH sessions.
+	// background process, independent of SSH sessions, and run the start
+	// hooks alongside it.
 	sessions.startMainProcess()
+	hooks := newHookRunner(sessions, cfg.Hooks)
+	go hooks.runStartHooks()
 
 	srv := &gliderssh.Server{
 		Addr:        cfg.Addr,
 		Handler:     sessions.handle,
 		HostSigners: []gliderssh.Signer{hostSigner},
+		// A gateway port-forwarding to the agent names its origin.
+		ConnCallback: readOrigin,
 		// Defense in depth: the gateway already verified the principal, but
 		// the agent independently checks that the client presents a user
-		// certificate signed by the user CA for exactly the owner.
-		PublicKeyHandler: func(_ gliderssh.Context, key gliderssh.PublicKey) bool {
+		// certificate signed by the user CA for exactly the owner, or one
+		// of the owner's authorized keys.
+		PublicKeyHandler: func(ctx gliderssh.Context, key gliderssh.PublicKey) bool {
 			cert, ok := key.(*gossh.Certificate)
 			if !ok {
+				return slices.ContainsFunc(cfg.AuthorizedKeys, func(k gossh.PublicKey) bool {
+					return gliderssh.KeysEqual(k, key)
+				})
+			}
+			if sshca.CheckUserCert(cert, userCA, cfg.Owner, cfg.Now()) != nil {
 				return false
 			}
-			return sshca.CheckUserCert(cert, userCA, cfg.Owner, cfg.Now()) == nil
+			recordCert(ctx, cert)
+			return true
 		},
 		// Allow local (-L) and remote (-R) port forwarding through the
 		// sandbox.
@@ -129,19 +333,56 @@ func NewServer(cfg Config) (*gliderssh.Server, error) {
 		ReversePortForwardingCallback: func(gliderssh.Context, string, uint32) bool { return true },
 	}
 
-	forwardHandler := &gliderssh.ForwardedTCPHandler{}
+	reverseHandler := &gliderssh.ForwardedTCPHandler{}
 	srv.ChannelHandlers = map[string]gliderssh.ChannelHandler{
 		"session":      gliderssh.DefaultSessionHandler,
-		"direct-tcpip": gliderssh.DirectTCPIPHandler,
+		"direct-tcpip": forwardHandler(activity),
 	}
 	srv.RequestHandlers = map[string]gliderssh.RequestHandler{
-		"tcpip-forward":        forwardHandler.HandleSSHRequest,
-		"cancel-tcpip-forward": forwardHandler.HandleSSHRequest,
+		"tcpip-forward":        reverseHandler.HandleSSHRequest,
+		"cancel-tcpip-forward": reverseHandler.HandleSSHRequest,
 	}
 	srv.SubsystemHandlers = map[string]gliderssh.SubsystemHandler{
-		"sftp": sftpHandler(cfg.HomeDir),
+		"sftp": sftpHandler(cfg.HomeDir, cfg.SFTP, cfg.Log.WithValues("user", cfg.Owner)),
+	}
+	server := &Server{Server: srv, sessions: sessions, activity: activity, hooks: hooks}
+	if cfg.ActivityAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle(agentapi.ActivityPath, activity)
+		mux.HandleFunc("GET "+agentapi.HooksPath, hooks.serveReport)
+		mux.HandleFunc("POST "+agentapi.HooksPath+"/"+string(agentapi.HookPreSuspend), hooks.servePreSuspend)
+		server.activitySrv = &http.Server{
+			Addr:              cfg.ActivityAddr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		server.activityDone = make(chan struct{})
 	}
-	return srv, nil
+	if cfg.TunnelAddr != "" {
+		if server.tunnel, err = newTunnelClient(cfg, hostSigner, srv); err != nil {
+			return nil, err
+		}
+	}
+	return server, nil
+}
+
+// ctxKeyCertSerial holds the serial of the certificate a connection
+// authenticated with.
+var ctxKeyCertSerial = &struct{ name string }{"kubepark-cert-serial"}
+
+// recordCert stores what later handlers need from the client certificate
+// on the connection context.
+func recordCert(ctx gliderssh.Context, cert *gossh.Certificate) {
+	ctx.SetValue(ctxKeyCertSerial, strconv.FormatUint(cert.Serial, 10))
+	agentPermitted(ctx, cert)
+}
+
+// sessionLogger annotates log with what joins an agent event to the
+// gateway's SandboxSession: the peer is the gateway's upstream address
+// recorded on the session, and the certificate serial its CertSerial.
+func sessionLogger(log logr.Logger, s gliderssh.Session) logr.Logger {
+	serial, _ := s.Context().Value(ctxKeyCertSerial).(string)
+	return log.WithValues("peer", s.RemoteAddr().String(), "certSerial", serial)
 }
 
 // signerWithCert builds a host signer that presents a certificate so
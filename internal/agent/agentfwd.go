@@ -0,0 +1,122 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	gliderssh "github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// permitAgentForwarding is the user-certificate extension that must be
+// present for a client's agent to be forwarded.
+const permitAgentForwarding = "permit-agent-forwarding"
+
+// ctxKeyAgentPermitted marks a connection whose certificate permits agent
+// forwarding (set by the public key handler).
+var ctxKeyAgentPermitted = &struct{ name string }{"kubepark-agent-permitted"}
+
+// agentForwarder exposes `ssh -A` agents inside the sandbox. Each
+// forwarding session gets its own unix socket, handed to exec children
+// directly. The persistent shell outlives any one client, so it is started
+// with a stable SSH_AUTH_SOCK (link) that is re-pointed at the most
+// recently attached forwarding session and removed when none is left.
+type agentForwarder struct {
+	dir string
+
+	mu    sync.Mutex
+	next  int
+	socks []string // live per-session sockets, most recent last
+}
+
+// newAgentForwarder creates the private socket directory.
+func newAgentForwarder() (*agentForwarder, error) {
+	dir, err := os.MkdirTemp("", "kubepark-agent-")
+	if err != nil {
+		return nil, fmt.Errorf("create agent socket dir: %w", err)
+	}
+	return &agentForwarder{dir: dir}, nil
+}
+
+// link is the stable SSH_AUTH_SOCK for the persistent shell.
+func (f *agentForwarder) link() string {
+	return filepath.Join(f.dir, "agent.sock")
+}
+
+// forward listens on a fresh socket and relays each connection to the
+// client's agent over an auth-agent@openssh.com channel. The returned stop
+// func closes the socket and re-points the link; call it when the session
+// ends.
+func (f *agentForwarder) forward(s gliderssh.Session) (string, func(), error) {
+	f.mu.Lock()
+	f.next++
+	sock := filepath.Join(f.dir, fmt.Sprintf("agent.%d", f.next))
+	f.mu.Unlock()
+
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		return "", nil, fmt.Errorf("listen agent socket: %w", err)
+	}
+	go gliderssh.ForwardAgentConnections(l, s)
+
+	f.mu.Lock()
+	f.socks = append(f.socks, sock)
+	f.relinkLocked()
+	f.mu.Unlock()
+
+	stop := func() {
+		_ = l.Close()
+		f.mu.Lock()
+		f.socks = slices.DeleteFunc(f.socks, func(s string) bool { return s == sock })
+		f.relinkLocked()
+		f.mu.Unlock()
+	}
+	return sock, stop, nil
+}
+
+// relinkLocked points the link at the newest live socket, or removes it.
+// The swap is a rename so a shell never sees a missing link mid-update.
+func (f *agentForwarder) relinkLocked() {
+	if len(f.socks) == 0 {
+		_ = os.Remove(f.link())
+		return
+	}
+	tmp := f.link() + ".tmp"
+	_ = os.Remove(tmp)
+	if err := os.Symlink(f.socks[len(f.socks)-1], tmp); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, f.link())
+}
+
+// agentPermitted records whether cert allows agent forwarding on the
+// connection's context.
+func agentPermitted(ctx gliderssh.Context, cert *gossh.Certificate) {
+	_, ok := cert.Extensions[permitAgentForwarding]
+	ctx.SetValue(ctxKeyAgentPermitted, ok)
+}
+
+// wantsAgent reports whether s requested forwarding and may have it.
+func wantsAgent(s gliderssh.Session) bool {
+	return gliderssh.AgentRequested(s) && s.Context().Value(ctxKeyAgentPermitted) == true
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+	sshagent "golang.org/x/crypto/ssh/agent"
+
+	"github.com/frauniki/kubepark/internal/sshca"
+)
+
+const testOwner = "alice@example.com"
+
+// testClient is the owner's identity: a key and its user certificate.
+type testClient struct {
+	gossh.Signer
+	keyPEM []byte
+	cert   *gossh.Certificate
+}
+
+// startTestServer runs an in-process agent for testOwner and returns its
+// address and a client identity for the owner.
+func startTestServer(t *testing.T, cfg Config) (string, testClient) {
+	t.Helper()
+	_, addr, client := startTestAgent(t, cfg)
+	return addr, client
+}
+
+// startTestAgent is startTestServer also returning the server itself.
+func startTestAgent(t *testing.T, cfg Config) (*Server, string, testClient) {
+	t.Helper()
+	newSigner := func(comment string) (gossh.Signer, []byte) {
+		kp, err := sshca.GenerateKeyPair(comment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := sshca.ParseSigner(kp.PrivatePEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signer, kp.PublicAuthorized
+	}
+	userCA, userCAPub := newSigner("user-ca")
+	hostCA, _ := newSigner("host-ca")
+
+	hostKP, err := sshca.GenerateKeyPair("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostPub, _ := sshca.ParsePublicKey(hostKP.PublicAuthorized)
+	hostCert, err := sshca.SignHostCert(hostCA, hostPub, []string{testOwner}, time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Owner = testOwner
+	cfg.HostKeyPEM = hostKP.PrivatePEM
+	cfg.HostCertAuthorized = gossh.MarshalAuthorizedKey(hostCert)
+	cfg.UserCAAuthorized = userCAPub
+	if cfg.HomeDir == "" {
+		cfg.HomeDir = t.TempDir()
+	}
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.Serve(ln) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	clientKP, err := sshca.GenerateKeyPair("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, _ := sshca.ParseSigner(clientKP.PrivatePEM)
+	pub, _ := sshca.ParsePublicKey(clientKP.PublicAuthorized)
+	cert, err := sshca.SignUserCert(userCA, pub, testOwner, time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	certSigner, err := gossh.NewCertSigner(cert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, ln.Addr().String(), testClient{Signer: certSigner, keyPEM: clientKP.PrivatePEM, cert: cert}
+}
+
+// dialTestServer connects to the agent as the owner.
+func dialTestServer(t *testing.T, addr string, client testClient) *gossh.Client {
+	t.Helper()
+	c, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+		User:            "sandbox",
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(client)},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+// dialForwarding connects as the owner with a local keyring agent offered
+// for forwarding, returning the client and the keyring's only key.
+func dialForwarding(t *testing.T, addr string, owner testClient) (*gossh.Client, gossh.PublicKey) {
+	t.Helper()
+	client := dialTestServer(t, addr, owner)
+
+	kp, err := sshca.GenerateKeyPair("laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := gossh.ParseRawPrivateKey(kp.PrivatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := sshagent.NewKeyring()
+	if err := keyring.Add(sshagent.AddedKey{PrivateKey: raw}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sshagent.ForwardToAgent(client, keyring); err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := sshca.ParsePublicKey(kp.PublicAuthorized)
+	return client, pub
+}
+
+// listVia asks the agent behind the unix socket at path for its keys.
+func listVia(t *testing.T, path string) []*sshagent.Key {
+	t.Helper()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial agent socket %q: %v", path, err)
+	}
+	defer func() { _ = conn.Close() }()
+	keys, err := sshagent.NewClient(conn).List()
+	if err != nil {
+		t.Fatalf("list keys via %q: %v", path, err)
+	}
+	return keys
+}
+
+// TestAgentForwardingExec checks that `ssh -A host cmd` sees an
+// SSH_AUTH_SOCK reaching the client's agent, and that the stable link for
+// the persistent shell follows it while the session lasts.
+func TestAgentForwardingExec(t *testing.T) {
+	addr, owner := startTestServer(t, Config{AgentForwarding: true})
+	client, want := dialForwarding(t, addr, owner)
+
+	sess, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sshagent.RequestAgentForwarding(sess); err != nil {
+		t.Fatal(err)
+	}
+	stdin, _ := sess.StdinPipe()
+	stdout, _ := sess.StdoutPipe()
+	if err := sess.Start(`echo "$SSH_AUTH_SOCK"; read _`); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	sock := strings.TrimSpace(line)
+	if sock == "" {
+		t.Fatal("expected SSH_AUTH_SOCK in the exec environment")
+	}
+	for _, path := range []string{sock, sock[:strings.LastIndexByte(sock, '/')] + "/agent.sock"} {
+		keys := listVia(t, path)
+		if len(keys) != 1 || string(keys[0].Marshal()) != string(want.Marshal()) {
+			t.Errorf("expected the forwarded laptop key via %s, got %v", path, keys)
+		}
+	}
+	_ = stdin.Close()
+	_ = sess.Wait()
+}
+
+// TestAgentForwardingDisabled checks the template policy: a client asking
+// for forwarding gets no SSH_AUTH_SOCK.
+func TestAgentForwardingDisabled(t *testing.T) {
+	addr, owner := startTestServer(t, Config{AgentForwarding: false})
+	client, _ := dialForwarding(t, addr, owner)
+
+	sess, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sess.Close() }()
+	_ = sshagent.RequestAgentForwarding(sess)
+	out, err := sess.Output(`echo "sock=$SSH_AUTH_SOCK"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "sock=" {
+		t.Errorf("expected no agent socket when forwarding is disabled, got %q", got)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/frauniki/kubepark/internal/agentapi"
+)
+
+const (
+	// dotfilesDir, relative to the home directory, is where the dotfiles
+	// repository is cloned.
+	dotfilesDir = ".dotfiles"
+	// dotfilesMarker, relative to the home directory, records that the
+	// dotfiles were installed for this home.
+	dotfilesMarker = ".kubepark/dotfiles.done"
+)
+
+// installScripts are tried in order when the profile names no script.
+var installScripts = []string{"install.sh", "install", "bootstrap.sh", "bootstrap", "setup.sh", "setup"}
+
+// Dotfiles is the owner's dotfiles repository as passed in
+// KUBEPARK_DOTFILES.
+type Dotfiles struct {
+	URL string `json:"url"`
+	Ref string `json:"ref,omitempty"`
+	// Install is the script to run, relative to the repository.
+	Install string `json:"install,omitempty"`
+}
+
+// parseDotfiles decodes KUBEPARK_DOTFILES.
+func parseDotfiles(raw string) (*Dotfiles, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var d Dotfiles
+	if err := json.Unmarshal([]byte(raw), &d); err != nil || d.URL == "" {
+		return nil, errors.New("KUBEPARK_DOTFILES is not valid")
+	}
+	return &d, nil
+}
+
+// parseAuthorizedKeys decodes KUBEPARK_AUTHORIZED_KEYS, one
+// authorized_keys line per line. Lines that do not parse are skipped, so a
+// bad key never keeps the owner's certificate out.
+func parseAuthorizedKeys(raw string) []gossh.PublicKey {
+	var keys []gossh.PublicKey
+	sc := bufio.NewScanner(strings.NewReader(raw))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, _, _, _, err := gossh.ParseAuthorizedKey([]byte(line)); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// installDotfiles clones the dotfiles into the home and runs their install
+// script, or links their top-level dotfiles into the home when there is
+// none. Like postCreate it runs once per home; a failure is retried on the
+// next start.
+func (h *hookRunner) installDotfiles(d *Dotfiles) {
+	home := h.m.cfg.HomeDir
+	marker := filepath.Join(home, dotfilesMarker)
+	start := h.m.cfg.Now()
+	if _, err := os.Stat(marker); err == nil {
+		h.set(agentapi.HookDotfiles, agentapi.HookStatus{State: agentapi.HookSucceeded, Message: "already installed for this home", StartTime: start})
+		return
+	}
+	h.set(agentapi.HookDotfiles, agentapi.HookStatus{State: agentapi.HookRunning, StartTime: start})
+	finish := func(state agentapi.HookState, msg string) {
+		end := h.m.cfg.Now()
+		h.set(agentapi.HookDotfiles, agentapi.HookStatus{State: state, Message: msg, StartTime: start, EndTime: &end})
+	}
+
+	// A clone left by a failed install is reused rather than cloned again.
+	dir := filepath.Join(home, dotfilesDir)
+	if _, err := clone(h.m.reaper, Source{URL: d.URL, Ref: d.Ref, Home: home}, dotfilesDir, dir); err != nil {
+		finish(agentapi.HookFailed, err.Error())
+		return
+	}
+
+	script := d.Install
+	if script == "" {
+		for _, name := range installScripts {
+			if fi, err := os.Stat(filepath.Join(dir, name)); err == nil && fi.Mode().IsRegular() {
+				script = name
+				break
+			}
+		}
+	}
+	if script == "" {
+		n, err := linkDotfiles(dir, home)
+		if err != nil {
+			finish(agentapi.HookFailed, err.Error())
+			return
+		}
+		finish(agentapi.HookSucceeded, fmt.Sprintf("no install script; linked %d dotfiles into the home", n))
+	} else {
+		path := filepath.Join(dir, script)
+		fi, err := os.Stat(path)
+		if err != nil {
+			finish(agentapi.HookFailed, fmt.Sprintf("install script %s not found", script))
+			return
+		}
+		argv := []string{path}
+		if fi.Mode().Perm()&0o111 == 0 {
+			argv = []string{"/bin/sh", path}
+		}
+		// The script runs in the repository, as install scripts expect.
+		cmd := append([]string{"/bin/sh", "-c", `cd "$0" && exec "$@"`, dir}, argv...)
+		if !h.run(agentapi.HookDotfiles, &Hook{Command: cmd}, agentapi.DefaultHookTimeout) {
+			return
+		}
+	}
+	_ = os.MkdirAll(filepath.Dir(marker), 0o755)
+	_ = os.WriteFile(marker, nil, 0o644)
+}
+
+// linkDotfiles links each top-level dotfile of dir into home, keeping any
+// file already there, and returns how many it linked.
+func linkDotfiles(dir, home string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, ".") || name == ".git" {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(home, name)); err == nil {
+			continue
+		}
+		if err := os.Symlink(filepath.Join(dotfilesDir, name), filepath.Join(home, name)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frauniki/kubepark/internal/agentapi"
+)
+
+// dotfilesRepo creates a dotfiles repository with the given files and
+// returns its file:// URL.
+func dotfilesRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := filepath.Join(t.TempDir(), "dotfiles")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main", dir},
+		{"-C", dir, "add", "."},
+		{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "-m", "init"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	return "file://" + dir
+}
+
+func newDotfilesRunner(t *testing.T, d *Dotfiles) (*hookRunner, string) {
+	t.Helper()
+	home := t.TempDir()
+	return newHookRunner(newSessionManager(Config{HomeDir: home, Now: time.Now, Dotfiles: d}), Hooks{}), home
+}
+
+func TestDotfilesInstallScript(t *testing.T) {
+	url := dotfilesRepo(t, map[string]string{"install.sh": `echo "$PWD" > "$HOME/installed"`})
+	h, home := newDotfilesRunner(t, &Dotfiles{URL: url})
+	h.runStartHooks()
+	if st := h.snapshot()[agentapi.HookDotfiles]; st.State != agentapi.HookSucceeded {
+		t.Fatalf("expected the dotfiles to install, got %+v", st)
+	}
+	raw, _ := os.ReadFile(filepath.Join(home, "installed"))
+	if strings.TrimSpace(string(raw)) != filepath.Join(home, dotfilesDir) {
+		t.Errorf("expected the script to run in the clone, got %q", raw)
+	}
+
+	// Once per home.
+	h = newHookRunner(h.m, h.hooks)
+	h.runStartHooks()
+	if st := h.snapshot()[agentapi.HookDotfiles]; !strings.Contains(st.Message, "already") {
+		t.Errorf("expected the install to be skipped, got %+v", st)
+	}
+}
+
+func TestDotfilesLinkedWithoutScript(t *testing.T) {
+	url := dotfilesRepo(t, map[string]string{".zshrc": "mine", ".gitconfig": "mine", "README.md": "docs"})
+	h, home := newDotfilesRunner(t, &Dotfiles{URL: url})
+	if err := os.WriteFile(filepath.Join(home, ".gitconfig"), []byte("kept"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h.runStartHooks()
+	if st := h.snapshot()[agentapi.HookDotfiles]; st.State != agentapi.HookSucceeded || !strings.Contains(st.Message, "linked 1 dotfiles") {
+		t.Fatalf("expected one dotfile linked, got %+v", st)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(home, ".zshrc")); string(raw) != "mine" {
+		t.Errorf("expected .zshrc linked, got %q", raw)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(home, ".gitconfig")); string(raw) != "kept" {
+		t.Errorf("expected the existing .gitconfig kept, got %q", raw)
+	}
+	if _, err := os.Lstat(filepath.Join(home, ".git")); err == nil {
+		t.Error(".git must not be linked")
+	}
+}
+
+func TestParseAuthorizedKeys(t *testing.T) {
+	raw := "# tooling\nssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl ci\n\nnot a key\n"
+	if keys := parseAuthorizedKeys(raw); len(keys) != 1 || keys[0].Type() != "ssh-ed25519" {
+		t.Errorf("expected one key, got %v", keys)
+	}
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	gliderssh "github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/frauniki/kubepark/internal/tunnel"
+)
+
+// DefaultAcceptEnv is the client environment passed to exec children when
+// the template does not set its own allowlist, matching the sshd_config
+// AcceptEnv most distributions ship.
+var DefaultAcceptEnv = []string{"LANG", "LC_*", "COLORTERM", "NO_COLOR"}
+
+const (
+	// hangupGrace is how long an exec child gets to exit after its client
+	// disconnects before its process group is killed.
+	hangupGrace = 5 * time.Second
+	// hangupProbeInterval is how often a session whose stdin has ended is
+	// checked for a closed channel, with the keepalive request sshd sends.
+	hangupProbeInterval = time.Second
+)
+
+// sshSignals maps RFC 4254 signal names to their POSIX signals.
+var sshSignals = map[gliderssh.Signal]syscall.Signal{
+	gliderssh.SIGABRT: syscall.SIGABRT,
+	gliderssh.SIGALRM: syscall.SIGALRM,
+	gliderssh.SIGFPE:  syscall.SIGFPE,
+	gliderssh.SIGHUP:  syscall.SIGHUP,
+	gliderssh.SIGILL:  syscall.SIGILL,
+	gliderssh.SIGINT:  syscall.SIGINT,
+	gliderssh.SIGKILL: syscall.SIGKILL,
+	gliderssh.SIGPIPE: syscall.SIGPIPE,
+	gliderssh.SIGQUIT: syscall.SIGQUIT,
+	gliderssh.SIGSEGV: syscall.SIGSEGV,
+	gliderssh.SIGTERM: syscall.SIGTERM,
+	gliderssh.SIGUSR1: syscall.SIGUSR1,
+	gliderssh.SIGUSR2: syscall.SIGUSR2,
+}
+
+// runExec runs a one-off command (or a non-interactive shell) as a child
+// process, wiring stdio directly. This is the scp/rsync/`ssh host cmd`
+// path. agentSock, when set, is the session's forwarded SSH agent.
+//
+// It follows sshd's semantics: accepted client environment is applied, the
+// child leads its own process group so `signal` requests and a disconnect
+// reach everything it started (a closed channel hangs it up even while
+// the connection lives on), and death by signal is reported as
+// exit-signal rather than a made-up exit status.
+func (m *sessionManager) runExec(s gliderssh.Session, agentSock string) {
+	name, args := m.shellInvocation(s.RawCommand())
+	cmd := exec.Command(name, args...)
+	cmd.Dir = m.cfg.HomeDir
+	cmd.Env = append(os.Environ(), acceptedEnv(s.Environ(), m.cfg.AcceptEnv)...)
+	cmd.Env = append(cmd.Env, "HOME="+m.cfg.HomeDir)
+	if agentSock != "" {
+		cmd.Env = append(cmd.Env, "SSH_AUTH_SOCK="+agentSock)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		_ = s.Exit(1)
+		return
+	}
+	cmd.Stdout = s
+	cmd.Stderr = s.Stderr()
+	exited, err := m.reaper.start(cmd, cmd.Start)
+	if err != nil {
+		_ = s.Exit(127)
+		return
+	}
+	done := make(chan struct{})
+	hangup := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(stdin, s)
+		_ = stdin.Close()
+		// Stdin ends on EOF and when the channel closes. Only the latter
+		// is a hangup, and the connection may well outlive it, with other
+		// sessions on it: probe until a request can no longer be sent.
+		ticker := time.NewTicker(hangupProbeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := s.SendRequest(tunnel.KeepaliveRequest, true, nil); err != nil {
+					close(hangup)
+					return
+				}
+			}
+		}
+	}()
+
+	pid := cmd.Process.Pid
+	sigs := make(chan gliderssh.Signal, 1)
+	s.Signals(sigs)
+	go func() {
+		// The client is gone: hang up the job like a closed terminal
+		// would, then make sure nothing outlives it.
+		hangUp := func() {
+			_ = syscall.Kill(-pid, syscall.SIGHUP)
+			select {
+			case <-done:
+			case <-time.After(hangupGrace):
+				_ = syscall.Kill(-pid, syscall.SIGKILL)
+			}
+		}
+		for {
+			select {
+			case sig := <-sigs:
+				if posix, ok := sshSignals[sig]; ok {
+					_ = syscall.Kill(-pid, posix)
+				}
+			case <-s.Context().Done():
+				hangUp()
+				return
+			case <-hangup:
+				hangUp()
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ws := m.reaper.wait(cmd, exited)
+	// Unregister before stopping the forwarder, so a signal request racing
+	// the exit is buffered by the session rather than blocking it.
+	s.Signals(nil)
+	close(done)
+	reportExit(s, ws)
+}
+
+// reportExit sends exit-signal for a child killed by a signal sshd knows
+// by name, and exit-status otherwise.
+func reportExit(s gliderssh.Session, ws syscall.WaitStatus) {
+	if ws.Signaled() {
+		for name, sig := range sshSignals {
+			if sig != ws.Signal() {
+				continue
+			}
+			msg := struct {
+				Signal     string
+				CoreDumped bool
+				Error      string
+				Lang       string
+			}{Signal: string(name), CoreDumped: ws.CoreDump()}
+			if _, err := s.SendRequest("exit-signal", false, gossh.Marshal(&msg)); err == nil {
+				_ = s.Close()
+				return
+			}
+		}
+	}
+	_ = s.Exit(exitCode(ws))
+}
+
+// acceptedEnv returns the client-sent variables whose names match one of
+// the patterns (shell globs, as in sshd's AcceptEnv). A nil pattern list
+// means DefaultAcceptEnv.
+func acceptedEnv(env, patterns []string) []string {
+	if patterns == nil {
+		patterns = DefaultAcceptEnv
+	}
+	var out []string
+	for _, kv := range env {
+		name, _, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			continue
+		}
+		for _, p := range patterns {
+			if matched, _ := path.Match(p, name); matched {
+				out = append(out, kv)
+				break
+			}
+		}
+	}
+	return out
+}
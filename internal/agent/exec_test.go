@@ -0,0 +1,203 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestAcceptedEnv(t *testing.T) {
+	env := []string{"LANG=C.UTF-8", "LC_ALL=C", "SECRET=x", "LD_PRELOAD=/evil.so", "MALFORMED"}
+	got := strings.Join(acceptedEnv(env, nil), " ")
+	if got != "LANG=C.UTF-8 LC_ALL=C" {
+		t.Errorf("default allowlist: got %q", got)
+	}
+	got = strings.Join(acceptedEnv(env, []string{"SECRET"}), " ")
+	if got != "SECRET=x" {
+		t.Errorf("template allowlist: got %q", got)
+	}
+	if got := acceptedEnv(env, []string{}); len(got) != 0 {
+		t.Errorf("empty allowlist must accept nothing, got %v", got)
+	}
+}
+
+// TestExecSignalForwarding sends an SSH signal request and checks it
+// reaches the command's process group.
+func TestExecSignalForwarding(t *testing.T) {
+	addr, owner := startTestServer(t, Config{})
+	sess, err := dialTestServer(t, addr, owner).NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, _ := sess.StdoutPipe()
+	if err := sess.Start(`trap 'exit 7' INT; echo ready; while :; do sleep 0.05; done`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bufio.NewReader(stdout).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.Signal(gossh.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	var exitErr *gossh.ExitError
+	if err := sess.Wait(); !errors.As(err, &exitErr) || exitErr.ExitStatus() != 7 {
+		t.Fatalf("expected the trap to exit 7, got %v", err)
+	}
+}
+
+// TestExecReportsExitSignal checks that death by signal is reported as
+// exit-signal, as sshd does, rather than a synthesized exit status.
+func TestExecReportsExitSignal(t *testing.T) {
+	addr, owner := startTestServer(t, Config{})
+	sess, err := dialTestServer(t, addr, owner).NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exitErr *gossh.ExitError
+	if err := sess.Run(`kill -TERM $$`); !errors.As(err, &exitErr) || exitErr.Signal() != "TERM" {
+		t.Fatalf("expected exit-signal TERM, got %v", err)
+	}
+}
+
+// TestExecDisconnectKillsProcessGroup drops the connection under a running
+// command and checks that a job it backgrounded does not outlive it.
+func TestExecDisconnectKillsProcessGroup(t *testing.T) {
+	addr, owner := startTestServer(t, Config{})
+	client := dialTestServer(t, addr, owner)
+	sess, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, _ := sess.StdoutPipe()
+	if err := sess.Start(`sleep 60 & echo $!; wait`); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatalf("parse job pid from %q: %v", line, err)
+	}
+	_ = client.Close()
+
+	deadline := time.Now().Add(hangupGrace + 5*time.Second)
+	for {
+		if _, alive := procParent(job); !alive {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background job %d survived the disconnect", job)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// TestExecChannelCloseKillsProcessGroup closes one session's channel while
+// another keeps the connection up: the closed session's job is hung up
+// all the same, and the other one is left alone.
+func TestExecChannelCloseKillsProcessGroup(t *testing.T) {
+	addr, owner := startTestServer(t, Config{})
+	client := dialTestServer(t, addr, owner)
+	start := func() (*gossh.Session, int) {
+		sess, err := client.NewSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout, _ := sess.StdoutPipe()
+		if err := sess.Start(`sleep 60 & echo $!; wait`); err != nil {
+			t.Fatal(err)
+		}
+		line, err := bufio.NewReader(stdout).ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		job, err := strconv.Atoi(strings.TrimSpace(line))
+		if err != nil {
+			t.Fatalf("parse job pid from %q: %v", line, err)
+		}
+		return sess, job
+	}
+	closed, closedJob := start()
+	kept, keptJob := start()
+	defer func() { _ = kept.Close() }()
+	_ = closed.Close()
+
+	deadline := time.Now().Add(hangupProbeInterval + hangupGrace + 5*time.Second)
+	for {
+		if _, alive := procParent(closedJob); !alive {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background job %d survived its channel closing", closedJob)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if _, alive := procParent(keptJob); !alive {
+		t.Errorf("job %d of the open session was killed", keptJob)
+	}
+}
+
+// TestExecWithOpenSSHClient runs the real ssh(1) client against the agent:
+// SetEnv is filtered through the allowlist, and a command killed by a
+// signal makes ssh exit 255 as it does against sshd.
+func TestExecWithOpenSSHClient(t *testing.T) {
+	sshBin, err := exec.LookPath("ssh")
+	if err != nil {
+		t.Skip("ssh client not installed")
+	}
+	addr, owner := startTestServer(t, Config{})
+	host, port, _ := net.SplitHostPort(addr)
+
+	dir := t.TempDir()
+	key := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(key, owner.keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(key+"-cert.pub", gossh.MarshalAuthorizedKey(owner.cert), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	run := func(command string) (string, int) {
+		cmd := exec.Command(sshBin, "-F", "/dev/null",
+			"-o", "BatchMode=yes", "-o", "IdentitiesOnly=yes", "-o", "LogLevel=ERROR",
+			"-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null",
+			"-o", "SetEnv=LANG=C.kubepark SECRET=leak",
+			"-i", key, "-o", "CertificateFile="+key+"-cert.pub",
+			"-p", port, "sandbox@"+host, command)
+		out, _ := cmd.Output()
+		return string(out), cmd.ProcessState.ExitCode()
+	}
+
+	if out, code := run(`echo "$LANG/$SECRET"`); code != 0 || out != "C.kubepark/\n" {
+		t.Errorf("expected only LANG to be accepted, got %q (exit %d)", out, code)
+	}
+	if out, code := run(`echo up; kill -KILL $$`); out != "up\n" || code != 255 {
+		t.Errorf("expected ssh to exit 255 for a signalled command, got %q (exit %d)", out, code)
+	}
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/frauniki/kubepark/internal/agentapi"
+)
+
+const (
+	// postCreateMarker, relative to the home directory, records that
+	// postCreate succeeded for this home.
+	postCreateMarker = ".kubepark/post-create.done"
+	// hookOutputTail is how much trailing output a failed hook reports.
+	hookOutputTail = 512
+)
+
+// Hook is one lifecycle hook as passed in KUBEPARK_HOOKS, which carries the
+// template's hooks as JSON.
+type Hook struct {
+	Command []string `json:"command"`
+	// Timeout is a Go duration string; empty means the hook's default.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Hooks are the template's lifecycle hooks.
+type Hooks struct {
+	PostCreate *Hook `json:"postCreate,omitempty"`
+	PostStart  *Hook `json:"postStart,omitempty"`
+	PreSuspend *Hook `json:"preSuspend,omitempty"`
+}
+
+// hookRunner runs the lifecycle hooks as supervised children and keeps
+// their outcomes for the operator.
+type hookRunner struct {
+	m     *sessionManager
+	hooks Hooks
+
+	mu     sync.Mutex
+	report agentapi.HookReport
+}
+
+func newHookRunner(m *sessionManager, hooks Hooks) *hookRunner {
+	return &hookRunner{m: m, hooks: hooks, report: agentapi.HookReport{}}
+}
+
+// runStartHooks installs the owner's dotfiles and runs postCreate (unless
+// either already succeeded for this home), then runs postStart.
+func (h *hookRunner) runStartHooks() {
+	if d := h.m.cfg.Dotfiles; d != nil {
+		h.installDotfiles(d)
+	}
+	if h.hooks.PostCreate != nil {
+		marker := filepath.Join(h.m.cfg.HomeDir, postCreateMarker)
+		if _, err := os.Stat(marker); err == nil {
+			h.set(agentapi.HookPostCreate, agentapi.HookStatus{
+				State:     agentapi.HookSucceeded,
+				Message:   "already completed for this home",
+				StartTime: h.m.cfg.Now(),
+			})
+		} else if h.run(agentapi.HookPostCreate, h.hooks.PostCreate, agentapi.DefaultHookTimeout) {
+			// A failure leaves no marker, so the next start retries.
+			_ = os.MkdirAll(filepath.Dir(marker), 0o755)
+			_ = os.WriteFile(marker, nil, 0o644)
+		}
+	}
+	if h.hooks.PostStart != nil {
+		h.run(agentapi.HookPostStart, h.hooks.PostStart, agentapi.DefaultHookTimeout)
+	}
+}
+
+// startPreSuspend starts the preSuspend hook in the background, once.
+func (h *hookRunner) startPreSuspend() {
+	if h.hooks.PreSuspend == nil {
+		return
+	}
+	h.mu.Lock()
+	_, started := h.report[agentapi.HookPreSuspend]
+	if !started {
+		h.report[agentapi.HookPreSuspend] = agentapi.HookStatus{State: agentapi.HookRunning, StartTime: h.m.cfg.Now()}
+	}
+	h.mu.Unlock()
+	if !started {
+		go h.run(agentapi.HookPreSuspend, h.hooks.PreSuspend, agentapi.DefaultPreSuspendTimeout)
+	}
+}
+
+// run executes a hook to completion, recording its outcome, and reports
+// whether it succeeded.
+func (h *hookRunner) run(name agentapi.HookName, hook *Hook, defaultTimeout time.Duration) bool {
+	start := h.m.cfg.Now()
+	h.set(name, agentapi.HookStatus{State: agentapi.HookRunning, StartTime: start})
+	finish := func(state agentapi.HookState, msg string) bool {
+		end := h.m.cfg.Now()
+		if state == agentapi.HookSucceeded {
+			msg = fmt.Sprintf("completed in %s", end.Sub(start).Round(time.Second))
+		}
+		h.set(name, agentapi.HookStatus{State: state, Message: msg, StartTime: start, EndTime: &end})
+		return state == agentapi.HookSucceeded
+	}
+
+	timeout := defaultTimeout
+	if hook.Timeout != "" {
+		d, err := time.ParseDuration(hook.Timeout)
+		if err != nil {
+			return finish(agentapi.HookFailed, fmt.Sprintf("invalid timeout %q", hook.Timeout))
+		}
+		timeout = d
+	}
+	if len(hook.Command) == 0 {
+		return finish(agentapi.HookFailed, "no command")
+	}
+
+	cmd := exec.Command(hook.Command[0], hook.Command[1:]...)
+	cmd.Dir = h.m.cfg.HomeDir
+	cmd.Env = append(os.Environ(), "HOME="+h.m.cfg.HomeDir)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// Output goes to the container log; the tail explains a failure.
+	tail := &tailBuffer{max: hookOutputTail}
+	out := io.MultiWriter(os.Stderr, tail)
+	cmd.Stdout, cmd.Stderr = out, out
+	exited, err := h.m.reaper.start(cmd, cmd.Start)
+	if err != nil {
+		return finish(agentapi.HookFailed, err.Error())
+	}
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(timeout, func() {
+		timedOut.Store(true)
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	})
+	ws := h.m.reaper.wait(cmd, exited)
+	timer.Stop()
+
+	switch {
+	case timedOut.Load():
+		return finish(agentapi.HookFailed, fmt.Sprintf("timed out after %s%s", timeout, tail.suffix()))
+	case ws.Signaled():
+		return finish(agentapi.HookFailed, fmt.Sprintf("killed by %s%s", ws.Signal(), tail.suffix()))
+	case ws.ExitStatus() != 0:
+		return finish(agentapi.HookFailed, fmt.Sprintf("exit status %d%s", ws.ExitStatus(), tail.suffix()))
+	}
+	return finish(agentapi.HookSucceeded, "")
+}
+
+func (h *hookRunner) set(name agentapi.HookName, st agentapi.HookStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.report[name] = st
+}
+
+func (h *hookRunner) snapshot() agentapi.HookReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make(agentapi.HookReport, len(h.report))
+	for k, v := range h.report {
+		out[k] = v
+	}
+	return out
+}
+
+// serveReport reports hook outcomes as JSON.
+func (h *hookRunner) serveReport(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.snapshot())
+}
+
+// servePreSuspend starts the preSuspend hook; the operator polls the
+// report for its outcome.
+func (h *hookRunner) servePreSuspend(w http.ResponseWriter, _ *http.Request) {
+	if h.hooks.PreSuspend == nil {
+		http.Error(w, "no preSuspend hook", http.StatusNotFound)
+		return
+	}
+	h.startPreSuspend()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// parseHooks decodes KUBEPARK_HOOKS.
+func parseHooks(raw string) (Hooks, error) {
+	var hooks Hooks
+	if raw == "" {
+		return hooks, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &hooks); err != nil {
+		return Hooks{}, errors.New("KUBEPARK_HOOKS is not valid JSON")
+	}
+	return hooks, nil
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = t.buf[len(t.buf)-t.max:]
+	}
+	return len(p), nil
+}
+
+// suffix formats the tail for appending to a message.
+func (t *tailBuffer) suffix() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s := strings.TrimSpace(string(t.buf)); s != "" {
+		return ": " + s
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frauniki/kubepark/internal/agentapi"
+)
+
+func newTestHookRunner(t *testing.T, hooks Hooks) (*hookRunner, string) {
+	t.Helper()
+	home := t.TempDir()
+	return newHookRunner(newSessionManager(Config{HomeDir: home, Now: time.Now}), hooks), home
+}
+
+func TestPostCreateRunsOncePerHome(t *testing.T) {
+	h, home := newTestHookRunner(t, Hooks{
+		PostCreate: &Hook{Command: []string{"/bin/sh", "-c", "echo run >> created"}},
+		PostStart:  &Hook{Command: []string{"/bin/sh", "-c", "echo run >> started"}},
+	})
+	h.runStartHooks()
+	if st := h.snapshot()[agentapi.HookPostCreate]; st.State != agentapi.HookSucceeded || st.EndTime == nil {
+		t.Fatalf("expected postCreate to succeed, got %+v", st)
+	}
+
+	// A restarted agent on the same home skips postCreate only.
+	h = newHookRunner(h.m, h.hooks)
+	h.runStartHooks()
+	if st := h.snapshot()[agentapi.HookPostCreate]; st.State != agentapi.HookSucceeded || !strings.Contains(st.Message, "already") {
+		t.Errorf("expected postCreate to be skipped, got %+v", st)
+	}
+	for file, want := range map[string]string{"created": "run\n", "started": "run\nrun\n"} {
+		raw, _ := os.ReadFile(filepath.Join(home, file))
+		if string(raw) != want {
+			t.Errorf("%s: expected %q, got %q", file, want, raw)
+		}
+	}
+}
+
+func TestFailedPostCreateIsRetried(t *testing.T) {
+	h, home := newTestHookRunner(t, Hooks{
+		PostCreate: &Hook{Command: []string{"/bin/sh", "-c", "echo missing Makefile >&2; exit 2"}},
+	})
+	h.runStartHooks()
+	st := h.snapshot()[agentapi.HookPostCreate]
+	if st.State != agentapi.HookFailed || st.Message != "exit status 2: missing Makefile" {
+		t.Errorf("expected the exit status and output tail, got %+v", st)
+	}
+	if _, err := os.Stat(filepath.Join(home, postCreateMarker)); err == nil {
+		t.Error("a failed postCreate must not be marked done")
+	}
+}
+
+func TestHookTimeoutKillsProcessGroup(t *testing.T) {
+	h, _ := newTestHookRunner(t, Hooks{
+		PostStart: &Hook{Command: []string{"/bin/sh", "-c", "sleep 30 & wait"}, Timeout: "200ms"},
+	})
+	start := time.Now()
+	h.runStartHooks()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("hook ran for %v past its timeout", elapsed)
+	}
+	if st := h.snapshot()[agentapi.HookPostStart]; st.State != agentapi.HookFailed || !strings.HasPrefix(st.Message, "timed out after 200ms") {
+		t.Errorf("expected a timeout, got %+v", st)
+	}
+}
+
+func TestPreSuspendEndpoint(t *testing.T) {
+	h, home := newTestHookRunner(t, Hooks{
+		PreSuspend: &Hook{Command: []string{"/bin/sh", "-c", "echo saved >> state"}},
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+agentapi.HooksPath, h.serveReport)
+	mux.HandleFunc("POST "+agentapi.HooksPath+"/"+string(agentapi.HookPreSuspend), h.servePreSuspend)
+
+	for range 2 {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, agentapi.HooksPath+"/preSuspend", nil))
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d", rec.Code)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, agentapi.HooksPath, nil))
+		var report agentapi.HookReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		if report[agentapi.HookPreSuspend].State == agentapi.HookSucceeded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("preSuspend did not finish, report %+v", report)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// Starting it twice runs it once.
+	if raw, _ := os.ReadFile(filepath.Join(home, "state")); string(raw) != "saved\n" {
+		t.Errorf("expected one run, got %q", raw)
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultUserName is the sandbox user's login name when the template does
+// not set one.
+const DefaultUserName = "sandbox"
+
+// Identity is the sandbox user as it should appear in passwd and group.
+type Identity struct {
+	Name   string
+	UID    int
+	GID    int
+	Home   string
+	Shell  string
+	Groups []Group
+}
+
+// Group is a supplementary group of the sandbox user.
+type Group struct {
+	Name string
+	GID  int
+}
+
+// IdentityFromEnv describes the running user (the pod's runAsUser and
+// primary group) with the name, shell and groups the pod spec passes in.
+func IdentityFromEnv() (Identity, error) {
+	id := Identity{
+		Name:  os.Getenv("KUBEPARK_USER"),
+		UID:   os.Getuid(),
+		GID:   os.Getgid(),
+		Home:  os.Getenv("HOME"),
+		Shell: loginShell(),
+	}
+	if id.Name == "" {
+		id.Name = DefaultUserName
+	}
+	if id.Home == "" {
+		id.Home = "/home/sandbox"
+	}
+	if v := os.Getenv("KUBEPARK_GROUPS"); v != "" {
+		for _, g := range strings.Split(v, ",") {
+			name, gid, ok := strings.Cut(g, ":")
+			n, err := strconv.Atoi(gid)
+			if !ok || err != nil {
+				return Identity{}, fmt.Errorf("parse KUBEPARK_GROUPS entry %q", g)
+			}
+			id.Groups = append(id.Groups, Group{Name: name, GID: n})
+		}
+	}
+	return id, nil
+}
+
+// WriteIdentity writes passwd and group files into dir: the image's own
+// /etc entries with the sandbox user added. The sandbox container mounts
+// them over /etc/passwd and /etc/group, so whoami, ~ expansion, ssh and git
+// work for any runAsUser.
+func WriteIdentity(dir string, id Identity) error {
+	return writeIdentity("/etc", dir, id)
+}
+
+func writeIdentity(etcDir, dir string, id Identity) error {
+	passwd, err := readEntries(filepath.Join(etcDir, "passwd"))
+	if err != nil {
+		return err
+	}
+	group, err := readEntries(filepath.Join(etcDir, "group"))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", dir, err)
+	}
+	if err := writeEntries(filepath.Join(dir, "passwd"), withUser(passwd, id)); err != nil {
+		return err
+	}
+	return writeEntries(filepath.Join(dir, "group"), withGroups(group, id))
+}
+
+// withUser replaces any entry for the user's name or UID with the sandbox
+// user's.
+func withUser(passwd [][]string, id Identity) [][]string {
+	uid := strconv.Itoa(id.UID)
+	out := make([][]string, 0, len(passwd)+1)
+	for _, e := range passwd {
+		if len(e) >= 3 && (e[0] == id.Name || e[2] == uid) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return append(out, []string{id.Name, "x", uid, strconv.Itoa(id.GID), "kubepark sandbox user", id.Home, id.Shell})
+}
+
+// withGroups makes sure the primary group resolves and adds the user to its
+// supplementary groups, creating those the image lacks.
+func withGroups(group [][]string, id Identity) [][]string {
+	byGID := func(gid int) []string {
+		for _, e := range group {
+			if len(e) >= 3 && e[2] == strconv.Itoa(gid) {
+				return e
+			}
+		}
+		return nil
+	}
+	nameTaken := func(name string) bool {
+		return slices.ContainsFunc(group, func(e []string) bool { return e[0] == name })
+	}
+
+	if byGID(id.GID) == nil && !nameTaken(id.Name) {
+		group = append(group, []string{id.Name, "x", strconv.Itoa(id.GID), ""})
+	}
+	for _, g := range id.Groups {
+		e := byGID(g.GID)
+		if e == nil {
+			if nameTaken(g.Name) {
+				continue
+			}
+			group = append(group, []string{g.Name, "x", strconv.Itoa(g.GID), id.Name})
+			continue
+		}
+		addMember(e, id.Name)
+	}
+	return group
+}
+
+// addMember adds user to a group entry's member list in place.
+func addMember(e []string, user string) {
+	if len(e) < 4 {
+		return
+	}
+	if e[3] == "" {
+		e[3] = user
+		return
+	}
+	if !slices.Contains(strings.Split(e[3], ","), user) {
+		e[3] += "," + user
+	}
+}
+
+// readEntries parses a colon-separated database, skipping comments. A
+// missing file (scratch or distroless images) is empty.
+func readEntries(path string) ([][]string, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var entries [][]string
+	for _, line := range strings.Split(string(raw), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, strings.Split(line, ":"))
+	}
+	return entries, nil
+}
+
+func writeEntries(path string, entries [][]string) error {
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(strings.Join(e, ":"))
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
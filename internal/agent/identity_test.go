@@ -0,0 +1,76 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteIdentity(t *testing.T) {
+	etc, out := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(etc, "passwd"), []byte(
+		"root:x:0:0:root:/root:/bin/bash\n"+
+			"ubuntu:x:1000:1000:Ubuntu:/home/ubuntu:/bin/bash\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(etc, "group"), []byte(
+		"# comment\nroot:x:0:\ndocker:x:999:ubuntu\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	id := Identity{
+		Name: "alice", UID: 1000, GID: 1000, Home: "/home/sandbox", Shell: "/bin/zsh",
+		Groups: []Group{{Name: "docker", GID: 999}, {Name: "render", GID: 107}},
+	}
+	if err := writeIdentity(etc, out, id); err != nil {
+		t.Fatal(err)
+	}
+
+	passwd, _ := os.ReadFile(filepath.Join(out, "passwd"))
+	want := "root:x:0:0:root:/root:/bin/bash\n" +
+		"alice:x:1000:1000:kubepark sandbox user:/home/sandbox:/bin/zsh\n"
+	if string(passwd) != want {
+		t.Errorf("passwd: the image's entry for the UID must be replaced\ngot:\n%s\nwant:\n%s", passwd, want)
+	}
+	group, _ := os.ReadFile(filepath.Join(out, "group"))
+	want = "root:x:0:\n" +
+		"docker:x:999:ubuntu,alice\n" +
+		"alice:x:1000:\n" +
+		"render:x:107:alice\n"
+	if string(group) != want {
+		t.Errorf("group:\ngot:\n%s\nwant:\n%s", group, want)
+	}
+}
+
+// TestWriteIdentityWithoutEtc covers scratch and distroless images, which
+// have no passwd or group files at all.
+func TestWriteIdentityWithoutEtc(t *testing.T) {
+	out := t.TempDir()
+	id := Identity{Name: "sandbox", UID: 4242, GID: 4242, Home: "/home/sandbox", Shell: "/bin/sh"}
+	if err := writeIdentity(t.TempDir(), out, id); err != nil {
+		t.Fatal(err)
+	}
+	passwd, _ := os.ReadFile(filepath.Join(out, "passwd"))
+	if string(passwd) != "sandbox:x:4242:4242:kubepark sandbox user:/home/sandbox:/bin/sh\n" {
+		t.Errorf("unexpected passwd %q", passwd)
+	}
+	group, _ := os.ReadFile(filepath.Join(out, "group"))
+	if string(group) != "sandbox:x:4242:\n" {
+		t.Errorf("unexpected group %q", group)
+	}
+}
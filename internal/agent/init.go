@@ -0,0 +1,173 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// reaper makes the agent a real init. The agent is PID 1 in the sandbox
+// container, so every orphaned grandchild (a backgrounded job whose shell
+// exited, a build tool's daemon) is re-parented to it and must be waited on
+// or it lingers as a zombie. Because wait(-1) would otherwise race with
+// exec.Cmd.Wait for the agent's own children, the reaper owns ALL waiting:
+// children the agent starts are registered with it and receive their exit
+// status over a channel; anything else is an orphan and is simply reaped.
+type reaper struct {
+	mu      sync.Mutex
+	tracked map[int]chan syscall.WaitStatus
+	// idle is closed (and replaced) whenever the last tracked child exits,
+	// so shutdown can wait for the process tree to drain.
+	idle chan struct{}
+}
+
+var (
+	initOnce   sync.Once
+	procReaper *reaper
+)
+
+// processReaper returns the process-wide reaper, starting it on first use.
+// There is exactly one per process: two wait(-1) loops would steal each
+// other's children.
+func processReaper() *reaper {
+	initOnce.Do(func() {
+		// Outside PID 1 (tests, shared process namespaces) orphans would be
+		// re-parented past the agent; becoming a subreaper keeps them ours.
+		_ = setChildSubreaper()
+		procReaper = &reaper{
+			tracked: map[int]chan syscall.WaitStatus{},
+			idle:    make(chan struct{}),
+		}
+		close(procReaper.idle)
+		go procReaper.loop()
+	})
+	return procReaper
+}
+
+// start runs startFn (which must call cmd.Start, directly or through
+// pty.Start) and registers the child before any SIGCHLD for it can be
+// processed. The returned channel receives the child's wait status exactly
+// once.
+func (r *reaper) start(cmd *exec.Cmd, startFn func() error) (<-chan syscall.WaitStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := startFn(); err != nil {
+		return nil, err
+	}
+	ch := make(chan syscall.WaitStatus, 1)
+	if len(r.tracked) == 0 {
+		r.idle = make(chan struct{})
+	}
+	r.tracked[cmd.Process.Pid] = ch
+	return ch, nil
+}
+
+// wait blocks until a child registered via start exits, then lets exec.Cmd
+// finish its stdio copies and release its pipes. cmd.Wait itself reports
+// ECHILD because the reaper already collected the status, so its error is
+// ignored in favour of the status the reaper delivered.
+func (r *reaper) wait(cmd *exec.Cmd, ch <-chan syscall.WaitStatus) syscall.WaitStatus {
+	ws := <-ch
+	_ = cmd.Wait()
+	return ws
+}
+
+// run is cmd.Run for a child of this process: the reaper collects its
+// status, so cmd.Run would report ECHILD. A nil reaper (the clone init
+// container, which has none) runs cmd directly.
+func (r *reaper) run(cmd *exec.Cmd) error {
+	if r == nil {
+		return cmd.Run()
+	}
+	exited, err := r.start(cmd, cmd.Start)
+	if err != nil {
+		return err
+	}
+	switch ws := r.wait(cmd, exited); {
+	case ws.Signaled():
+		return fmt.Errorf("killed by %s", ws.Signal())
+	case ws.ExitStatus() != 0:
+		return fmt.Errorf("exit status %d", ws.ExitStatus())
+	}
+	return nil
+}
+
+// loop reaps every exited child whenever SIGCHLD arrives. Signals coalesce,
+// so each wake-up drains all available zombies.
+func (r *reaper) loop() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGCHLD)
+	for range sigs {
+		r.reapAll()
+	}
+}
+
+func (r *reaper) reapAll() {
+	for {
+		var ws syscall.WaitStatus
+		r.mu.Lock()
+		pid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			r.mu.Unlock()
+			continue
+		}
+		if err != nil || pid <= 0 {
+			r.mu.Unlock()
+			return
+		}
+		if ch, ok := r.tracked[pid]; ok {
+			delete(r.tracked, pid)
+			ch <- ws
+			if len(r.tracked) == 0 {
+				close(r.idle)
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+// signalAll delivers sig to every tracked child. A child that leads its own
+// process group (the PTY shell, the main process) is signalled as a group so
+// its jobs see it too.
+func (r *reaper) signalAll(sig syscall.Signal) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for pid := range r.tracked {
+		signalTree(pid, sig)
+	}
+}
+
+// drained returns a channel that is closed once no tracked child remains.
+func (r *reaper) drained() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.idle
+}
+
+// signalTree signals pid's process group if pid leads one, else just pid.
+func signalTree(pid int, sig syscall.Signal) {
+	if pgid, err := syscall.Getpgid(pid); err == nil && pgid == pid {
+		_ = syscall.Kill(-pid, sig)
+		return
+	}
+	_ = syscall.Kill(pid, sig)
+}
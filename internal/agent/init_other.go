@@ -0,0 +1,24 @@
+//go:build !linux
+
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+// setChildSubreaper is a no-op off Linux; the agent only runs as PID 1 in
+// Linux containers, this build exists so the package compiles on developer
+// machines.
+func setChildSubreaper() error { return nil }
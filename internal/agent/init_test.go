@@ -0,0 +1,207 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gliderssh "github.com/gliderlabs/ssh"
+)
+
+// procParent returns the parent PID of pid from /proc, or false once the
+// process is fully gone (reaped).
+func procParent(pid int) (int, bool) {
+	raw, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, false
+	}
+	// The command name is parenthesised and may contain spaces; fields
+	// after the closing paren are "state ppid ...".
+	fields := strings.Fields(string(raw[bytes.LastIndexByte(raw, ')')+1:]))
+	ppid, _ := strconv.Atoi(fields[1])
+	return ppid, true
+}
+
+// TestReaperReapsOrphans backgrounds a grandchild and lets its parent exit:
+// the orphan must be re-parented to the agent and reaped when it exits
+// instead of lingering as a zombie.
+func TestReaperReapsOrphans(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("subreaper semantics are Linux-only")
+	}
+	r := processReaper()
+
+	var out bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", "sleep 0.5 & echo $!")
+	cmd.Stdout = &out
+	exited, err := r.start(cmd, cmd.Start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws := r.wait(cmd, exited); ws.ExitStatus() != 0 {
+		t.Fatalf("parent shell exited %d", ws.ExitStatus())
+	}
+	orphan, err := strconv.Atoi(strings.TrimSpace(out.String()))
+	if err != nil {
+		t.Fatalf("parse orphan pid from %q: %v", out.String(), err)
+	}
+
+	if ppid, ok := procParent(orphan); ok && ppid != os.Getpid() {
+		t.Fatalf("orphan %d re-parented to %d, want the agent (%d)", orphan, ppid, os.Getpid())
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := procParent(orphan); !ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("orphan %d was not reaped", orphan)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// TestReaperRun runs commands alongside a busy reaper: cmd.Run would lose
+// their statuses to it and fail with ECHILD.
+func TestReaperRun(t *testing.T) {
+	r := processReaper()
+	// Keep the reaper draining zombies while the commands run.
+	noise := exec.Command("/bin/sh", "-c", "for i in 1 2 3 4 5; do true & done; wait")
+	exited, err := r.start(noise, noise.Start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.wait(noise, exited)
+
+	var out bytes.Buffer
+	ok := exec.Command("/bin/sh", "-c", "echo ok")
+	ok.Stdout = &out
+	if err := r.run(ok); err != nil || strings.TrimSpace(out.String()) != "ok" {
+		t.Errorf("expected ok, got %q (%v)", out.String(), err)
+	}
+	if err := r.run(exec.Command("/bin/sh", "-c", "exit 3")); err == nil || err.Error() != "exit status 3" {
+		t.Errorf("expected exit status 3, got %v", err)
+	}
+}
+
+// fakeSession records what the agent writes to a connected client.
+type fakeSession struct {
+	gliderssh.Session
+	mu     sync.Mutex
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+}
+
+func (f *fakeSession) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stdout.Write(p)
+}
+
+func (f *fakeSession) Stderr() io.ReadWriter { return &lockedBuffer{mu: &f.mu, buf: &f.stderr} }
+
+type lockedBuffer struct {
+	mu  *sync.Mutex
+	buf *bytes.Buffer
+}
+
+func (l *lockedBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+func (l *lockedBuffer) Read(p []byte) (int, error) { return 0, io.EOF }
+
+// TestShutdownForwardsSIGTERM runs a main process that exits cleanly on
+// SIGTERM, and checks that shutdown delivers it, waits for the exit, and
+// warns both kinds of attached client.
+func TestShutdownForwardsSIGTERM(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "terminated")
+	m := newSessionManager(Config{
+		HomeDir: t.TempDir(),
+		Command: []string{"/bin/sh", "-c", fmt.Sprintf(`trap 'touch %s; exit 0' TERM; while :; do sleep 0.05; done`, marker)},
+	})
+	m.startMainProcess()
+
+	ptyClient, execClient := &fakeSession{}, &fakeSession{}
+	m.clients[ptyClient] = true
+	m.clients[execClient] = false
+
+	// Give the shell a moment to install its trap.
+	time.Sleep(200 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	m.shutdown(ctx)
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("shutdown waited %v for a process that handles SIGTERM", elapsed)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Error("main process did not receive SIGTERM")
+	}
+	if !strings.Contains(ptyClient.stdout.String(), "suspending") {
+		t.Errorf("PTY client not warned, got %q", ptyClient.stdout.String())
+	}
+	if !strings.Contains(execClient.stderr.String(), "suspending") || execClient.stdout.Len() != 0 {
+		t.Errorf("exec client must be warned on stderr only, got stdout=%q stderr=%q",
+			execClient.stdout.String(), execClient.stderr.String())
+	}
+}
+
+// TestShutdownKillsAfterGracePeriod runs a main process that ignores
+// SIGTERM: shutdown must give up waiting when its context expires and kill
+// the whole process group.
+func TestShutdownKillsAfterGracePeriod(t *testing.T) {
+	m := newSessionManager(Config{
+		HomeDir: t.TempDir(),
+		Command: []string{"/bin/sh", "-c", `trap '' TERM; sleep 60`},
+	})
+	m.startMainProcess()
+	time.Sleep(200 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		m.shutdown(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("shutdown did not kill a process that ignores SIGTERM")
+	}
+	select {
+	case <-m.reaper.drained():
+	default:
+		t.Error("expected no tracked children after shutdown")
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+
+	gliderssh "github.com/gliderlabs/ssh"
+
+	"github.com/frauniki/kubepark/internal/tunnel"
+)
+
+// readOrigin takes the origin a gateway names ahead of the SSH version on
+// a port-forward as the connection's peer, so the session log joins the
+// gateway's SandboxSession as it does over a tunnel. Only loopback
+// connections, which is how the kubelet forwards, are read for it: the
+// line is the gateway's word, and a process in the sandbox could only
+// mislabel its own connection.
+func readOrigin(_ gliderssh.Context, conn net.Conn) net.Conn {
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || !addr.IP.IsLoopback() {
+		return conn
+	}
+	return &originConn{Conn: conn, r: bufio.NewReader(conn)}
+}
+
+// originConn reads the origin line, if the connection starts with one, on
+// its first read; the SSH server reads the client's version before it
+// asks for the peer.
+type originConn struct {
+	net.Conn
+	r    *bufio.Reader
+	once sync.Once
+
+	mu     sync.Mutex
+	origin net.Addr
+}
+
+func (c *originConn) Read(p []byte) (int, error) {
+	c.once.Do(c.readLine)
+	return c.r.Read(p)
+}
+
+func (c *originConn) readLine() {
+	// Compare a byte at a time: a client's version differs at the first,
+	// and it may send no more until the server answers.
+	for i := 1; i <= len(tunnel.OriginPrefix); i++ {
+		b, err := c.r.Peek(i)
+		if err != nil || b[i-1] != tunnel.OriginPrefix[i-1] {
+			return
+		}
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return
+	}
+	origin := strings.TrimSpace(strings.TrimPrefix(line, tunnel.OriginPrefix))
+	if origin == "" {
+		return
+	}
+	c.mu.Lock()
+	c.origin = tunnel.Addr(origin)
+	c.mu.Unlock()
+}
+
+func (c *originConn) RemoteAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.origin != nil {
+		return c.origin
+	}
+	return c.Conn.RemoteAddr()
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/pkg/sftp"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/frauniki/kubepark/internal/tunnel"
+)
+
+// TestOriginLine checks that a connection naming its origin ahead of the
+// SSH version, as the gateway's port-forward does, is logged with it as
+// the peer.
+func TestOriginLine(t *testing.T) {
+	audit := &auditLog{}
+	addr, owner := startTestServer(t, Config{Log: funcr.New(audit.write, funcr.Options{})})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(conn, tunnel.OriginPrefix+"gateway-0/7\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	sshConn, chans, reqs, err := gossh.NewClientConn(conn, addr, &gossh.ClientConfig{
+		User:            "sandbox",
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(owner)},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("handshake after the origin line: %v", err)
+	}
+	ssh := gossh.NewClient(sshConn, chans, reqs)
+	t.Cleanup(func() { _ = ssh.Close() })
+	client, err := sftp.NewClient(ssh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	f, err := client.Create("/notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	line := audit.find(`"op"="upload"`)
+	if !strings.Contains(line, `"peer"="gateway-0/7"`) {
+		t.Errorf("audit line = %q, want the origin as the peer", line)
+	}
+}
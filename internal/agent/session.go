@@ -17,10 +17,11 @@ limitations under the License.
 package agent
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
-	"strings"
 	"sync"
 	"syscall"
 
@@ -33,60 +34,69 @@ import (
 // (though not pod death — the honest boundary). Non-interactive exec (scp,
 // rsync, `ssh host cmd`) runs as an ephemeral child instead.
 type sessionManager struct {
-	cfg Config
+	cfg    Config
+	reaper *reaper
+	// agents forwards `ssh -A` agents into the sandbox; nil when the
+	// template disables agent forwarding.
+	agents *agentForwarder
+	// activity records terminal input for idle evaluation.
+	activity *activityTracker
 
 	mu       sync.Mutex
 	ptmx     *os.File
 	shellCmd *exec.Cmd
 	attached int
+	// clients are the connected sessions, kept so shutdown can tell them
+	// the sandbox is going away.
+	clients map[gliderssh.Session]bool
 }
 
 func newSessionManager(cfg Config) *sessionManager {
-	return &sessionManager{cfg: cfg}
+	return &sessionManager{
+		cfg:      cfg,
+		reaper:   processReaper(),
+		activity: newActivityTracker(cfg),
+		clients:  map[gliderssh.Session]bool{},
+	}
 }
 
 // handle dispatches a session to exec or the persistent shell.
 func (m *sessionManager) handle(s gliderssh.Session) {
-	if len(s.Command()) > 0 {
-		m.runExec(s)
+	_, _, isPty := s.Pty()
+	m.mu.Lock()
+	m.clients[s] = isPty
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.clients, s)
+		m.mu.Unlock()
+	}()
+
+	// A forwarding client's agent is reachable for as long as its session
+	// lasts: directly for exec, and via the stable link for the shared
+	// shell.
+	var agentSock string
+	if m.agents != nil && wantsAgent(s) {
+		sock, stop, err := m.agents.forward(s)
+		if err == nil {
+			agentSock = sock
+			defer stop()
+		}
+	}
+
+	if s.RawCommand() != "" {
+		m.runExec(s, agentSock)
 		return
 	}
 	ptyReq, winCh, isPty := s.Pty()
 	if !isPty {
 		// No PTY and no command: run a login shell reading stdin to EOF.
-		m.runExec(s)
+		m.runExec(s, agentSock)
 		return
 	}
 	m.attachShell(s, ptyReq, winCh)
 }
 
-// runExec runs a one-off command (or a non-interactive shell) as a child
-// process, wiring stdio directly. This is the scp/rsync/`ssh host cmd`
-// path.
-func (m *sessionManager) runExec(s gliderssh.Session) {
-	name, args := m.shellInvocation(s.Command())
-	cmd := exec.Command(name, args...)
-	cmd.Dir = m.cfg.HomeDir
-	cmd.Env = append(os.Environ(), "HOME="+m.cfg.HomeDir)
-
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		_ = s.Exit(1)
-		return
-	}
-	cmd.Stdout = s
-	cmd.Stderr = s.Stderr()
-	if err := cmd.Start(); err != nil {
-		_ = s.Exit(127)
-		return
-	}
-	go func() {
-		_, _ = io.Copy(stdin, s)
-		_ = stdin.Close()
-	}()
-	_ = s.Exit(waitStatus(cmd.Wait()))
-}
-
 // attachShell attaches the client to the shared persistent PTY, starting it
 // on first use.
 func (m *sessionManager) attachShell(s gliderssh.Session, ptyReq gliderssh.Pty, winCh <-chan gliderssh.Window) {
@@ -112,9 +122,11 @@ func (m *sessionManager) attachShell(s gliderssh.Session, ptyReq gliderssh.Pty,
 	}()
 
 	// Bridge the client and the shared PTY. When the client disconnects the
-	// copies end but the shell keeps running for the next attach.
+	// copies end but the shell keeps running for the next attach. Only what
+	// the client types counts as input; output alone (a build scrolling by)
+	// does not.
 	done := make(chan struct{}, 2)
-	go func() { _, _ = io.Copy(ptmx, s); done <- struct{}{} }()
+	go func() { _, _ = io.Copy(ptmx, inputReader{Reader: s, act: m.activity}); done <- struct{}{} }()
 	go func() { _, _ = io.Copy(s, ptmx); done <- struct{}{} }()
 	<-done
 }
@@ -129,24 +141,34 @@ func (m *sessionManager) ensureShell(term string) (*os.File, error) {
 		return m.ptmx, nil
 	}
 
-	name, args := m.shellInvocation(nil)
+	name, args := m.shellInvocation("")
 	cmd := exec.Command(name, args...)
 	cmd.Dir = m.cfg.HomeDir
 	if term == "" {
 		term = "xterm-256color"
 	}
 	cmd.Env = append(os.Environ(), "HOME="+m.cfg.HomeDir, "TERM="+term)
+	if m.agents != nil {
+		// The shell outlives its clients, so it gets the stable link that
+		// follows whichever forwarding client attached last.
+		cmd.Env = append(cmd.Env, "SSH_AUTH_SOCK="+m.agents.link())
+	}
 
-	ptmx, err := pty.Start(cmd)
+	var ptmx *os.File
+	exited, err := m.reaper.start(cmd, func() error {
+		var startErr error
+		ptmx, startErr = pty.Start(cmd)
+		return startErr
+	})
 	if err != nil {
 		return nil, err
 	}
 	m.ptmx = ptmx
 	m.shellCmd = cmd
-	// Reap the shell so a persistent session that finally exits does not
-	// leave a zombie; drop the shared PTY so the next attach restarts it.
+	// Drop the shared PTY once the shell exits so the next attach restarts
+	// it (the reaper has already collected its status).
 	go func() {
-		_ = cmd.Wait()
+		m.reaper.wait(cmd, exited)
 		m.mu.Lock()
 		if m.shellCmd == cmd {
 			_ = m.ptmx.Close()
@@ -159,14 +181,15 @@ func (m *sessionManager) ensureShell(term string) (*os.File, error) {
 }
 
 // shellInvocation resolves the command to run for a session. A
-// client-supplied command runs through the shell (scp, rsync, `ssh host
-// cmd`); an interactive session always gets a login shell. The template
-// command is the pod's main workload, not the interactive shell, so it is
-// never used here — it is supervised separately (see startMainProcess).
-func (m *sessionManager) shellInvocation(clientCmd []string) (string, []string) {
+// client-supplied command is passed verbatim to `$SHELL -c` as sshd does
+// (scp, rsync, `ssh host cmd`); an interactive session always gets a login
+// shell. The template command is the pod's main workload, not the
+// interactive shell, so it is never used here — it is supervised
+// separately (see startMainProcess).
+func (m *sessionManager) shellInvocation(rawCmd string) (string, []string) {
 	shell := loginShell()
-	if len(clientCmd) > 0 {
-		return shell, []string{"-c", joinCommand(clientCmd)}
+	if rawCmd != "" {
+		return shell, []string{"-c", rawCmd}
 	}
 	return shell, []string{"-l"}
 }
@@ -181,10 +204,53 @@ func (m *sessionManager) startMainProcess() {
 	cmd := exec.Command(m.cfg.Command[0], m.cfg.Command[1:]...)
 	cmd.Dir = m.cfg.HomeDir
 	cmd.Env = append(os.Environ(), "HOME="+m.cfg.HomeDir)
-	if err := cmd.Start(); err != nil {
+	// Its own process group, so shutdown's SIGTERM reaches the whole
+	// workload tree and not just its leader.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	exited, err := m.reaper.start(cmd, cmd.Start)
+	if err != nil {
 		return
 	}
-	go func() { _ = cmd.Wait() }()
+	go m.reaper.wait(cmd, exited)
+}
+
+// shutdown is the SIGTERM path (suspend, pod deletion): attached clients are
+// told the sandbox is going away, SIGTERM is forwarded to the main process
+// and every shell, and the agent waits for them to exit until ctx expires,
+// after which whatever is left is killed so the agent can exit before the
+// kubelet's own SIGKILL.
+func (m *sessionManager) shutdown(ctx context.Context) {
+	m.broadcast("kubepark: sandbox is suspending; this session will be closed")
+
+	m.reaper.signalAll(syscall.SIGTERM)
+	// Interactive shells ignore SIGTERM; a hangup is what closes a terminal
+	// and makes the shell pass SIGHUP on to its jobs.
+	m.mu.Lock()
+	if m.shellCmd != nil && m.shellCmd.Process != nil {
+		signalTree(m.shellCmd.Process.Pid, syscall.SIGHUP)
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-m.reaper.drained():
+	case <-ctx.Done():
+		m.reaper.signalAll(syscall.SIGKILL)
+		<-m.reaper.drained()
+	}
+}
+
+// broadcast writes msg to every connected client: into the terminal for
+// PTY sessions, to stderr for exec sessions so command output stays clean.
+func (m *sessionManager) broadcast(msg string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for s, isPty := range m.clients {
+		if isPty {
+			_, _ = fmt.Fprintf(s, "\r\n*** %s ***\r\n", msg)
+			continue
+		}
+		_, _ = fmt.Fprintf(s.Stderr(), "%s\n", msg)
+	}
 }
 
 func loginShell() string {
@@ -199,25 +265,11 @@ func loginShell() string {
 	return "/bin/sh"
 }
 
-// joinCommand renders an SSH command vector the way OpenSSH does: the client
-// already shell-quoted it into a single string per element boundary, so a
-// space join reproduces the original command line.
-func joinCommand(cmd []string) string {
-	return strings.Join(cmd, " ")
-}
-
-func waitStatus(err error) int {
-	if err == nil {
-		return 0
-	}
-	var exitErr *exec.ExitError
-	if e, ok := err.(*exec.ExitError); ok {
-		exitErr = e
-	}
-	if exitErr != nil {
-		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok {
-			return ws.ExitStatus()
-		}
+// exitCode maps a wait status to a shell-style exit code (128+n for a
+// child killed by signal n).
+func exitCode(ws syscall.WaitStatus) int {
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
 	}
-	return 1
+	return ws.ExitStatus()
 }
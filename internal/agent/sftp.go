@@ -17,27 +17,293 @@ limitations under the License.
 package agent
 
 import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
 	gliderssh "github.com/gliderlabs/ssh"
+	"github.com/go-logr/logr"
 	"github.com/pkg/sftp"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
 )
 
 // sftpHandler serves the SFTP subsystem, which powers `sftp` and the modern
 // scp protocol as well as IDE file sync. The client is already
-// authenticated as the owner; the server exposes the pod filesystem with
-// the process's own (non-root) permissions.
-func sftpHandler(_ string) gliderssh.SubsystemHandler {
+// authenticated as the owner; files are served with the process's own
+// (non-root) permissions, confined according to mode. Transfers, deletes
+// and other modifications are logged with the session's peer address so
+// they can be joined to the gateway's SandboxSession.
+func sftpHandler(homeDir string, mode kubeparkv1alpha1.SFTPMode, log logr.Logger) gliderssh.SubsystemHandler {
 	return func(s gliderssh.Session) {
-		server, err := sftp.NewServer(s)
+		// An os.Root cannot be escaped through "..", absolute symlinks or
+		// symlinks planted mid-operation, unlike prefix checks on paths.
+		rootDir, start := homeDir, "/"
+		if mode == kubeparkv1alpha1.SFTPFull {
+			rootDir, start = "/", homeDir
+		}
+		root, err := os.OpenRoot(rootDir)
 		if err != nil {
 			_ = s.Exit(1)
 			return
 		}
-		defer func() { _ = server.Close() }()
-		if err := server.Serve(); err != nil {
-			// io.EOF is the normal end of an SFTP session.
-			_ = s.Exit(0)
-			return
+		defer func() { _ = root.Close() }()
+
+		fs := &sftpFS{
+			root:     root,
+			start:    start,
+			readOnly: mode == kubeparkv1alpha1.SFTPReadOnly,
+			log:      sessionLogger(log, s).WithValues("subsystem", "sftp"),
 		}
+		handlers := sftp.Handlers{FileGet: fs, FilePut: fs, FileCmd: fs, FileList: fs}
+		server := sftp.NewRequestServer(s, handlers, sftp.WithStartDirectory(start))
+		defer func() { _ = server.Close() }()
+		// io.EOF is the normal end of an SFTP session; either way the
+		// client gets a clean exit.
+		_ = server.Serve()
 		_ = s.Exit(0)
 	}
 }
+
+// sftpFS implements the pkg/sftp request handlers over an os.Root. Request
+// paths are absolute within the root.
+type sftpFS struct {
+	root     *os.Root
+	start    string
+	readOnly bool
+	log      logr.Logger
+}
+
+// rel maps a request path to a path relative to the root.
+func rel(p string) string {
+	if r := strings.TrimPrefix(path.Clean("/"+p), "/"); r != "" {
+		return r
+	}
+	return "."
+}
+
+func (f *sftpFS) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	file, err := f.root.Open(rel(r.Filepath))
+	if err != nil {
+		return nil, err
+	}
+	return &auditedFile{File: file, log: f.log, op: "download", path: r.Filepath}, nil
+}
+
+func (f *sftpFS) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return f.OpenFile(r)
+}
+
+func (f *sftpFS) OpenFile(r *sftp.Request) (sftp.WriterAtReaderAt, error) {
+	if f.readOnly {
+		return nil, sftp.ErrSSHFxPermissionDenied
+	}
+	pflags := r.Pflags()
+	flags := os.O_WRONLY
+	if pflags.Read {
+		flags = os.O_RDWR
+	}
+	// Append is not mapped: clients always write at explicit offsets, and
+	// WriteAt is refused on O_APPEND files.
+	if pflags.Creat {
+		flags |= os.O_CREATE
+	}
+	if pflags.Trunc {
+		flags |= os.O_TRUNC
+	}
+	if pflags.Excl {
+		flags |= os.O_EXCL
+	}
+	file, err := f.root.OpenFile(rel(r.Filepath), flags, 0o644)
+	if err != nil {
+		f.audit(r, err)
+		return nil, err
+	}
+	return &auditedFile{File: file, log: f.log, op: "upload", path: r.Filepath}, nil
+}
+
+func (f *sftpFS) Filecmd(r *sftp.Request) error {
+	if f.readOnly {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	name := rel(r.Filepath)
+	var err error
+	switch r.Method {
+	case "Setstat":
+		err = f.setstat(name, r)
+	case "Rename":
+		// SFTP rename must not clobber; PosixRename (below) may.
+		if _, statErr := f.root.Lstat(rel(r.Target)); statErr == nil {
+			return os.ErrExist
+		}
+		err = f.root.Rename(name, rel(r.Target))
+	case "Rmdir", "Remove":
+		err = f.root.Remove(name)
+	case "Mkdir":
+		err = f.root.Mkdir(name, 0o755)
+	case "Link":
+		err = f.root.Link(rel(r.Target), name)
+	case "Symlink":
+		// The target is stored verbatim; following it later is still
+		// confined to the root.
+		err = f.root.Symlink(r.Target, name)
+	default:
+		return sftp.ErrSSHFxOpUnsupported
+	}
+	f.audit(r, err)
+	return err
+}
+
+func (f *sftpFS) PosixRename(r *sftp.Request) error {
+	if f.readOnly {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	err := f.root.Rename(rel(r.Filepath), rel(r.Target))
+	f.audit(r, err)
+	return err
+}
+
+func (f *sftpFS) setstat(name string, r *sftp.Request) error {
+	flags, attrs := r.AttrFlags(), r.Attributes()
+	if flags.Size {
+		file, err := f.root.OpenFile(name, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		err = file.Truncate(int64(attrs.Size))
+		_ = file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if flags.Permissions {
+		if err := f.root.Chmod(name, attrs.FileMode().Perm()); err != nil {
+			return err
+		}
+	}
+	if flags.Acmodtime {
+		if err := f.root.Chtimes(name, attrs.AccessTime(), attrs.ModTime()); err != nil {
+			return err
+		}
+	}
+	if flags.UidGid {
+		if err := f.root.Chown(name, int(attrs.UID), int(attrs.GID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// audit logs a modification; stat and list traffic is not logged.
+func (f *sftpFS) audit(r *sftp.Request, err error) {
+	kv := []any{"op", strings.ToLower(r.Method), "path", r.Filepath}
+	if r.Target != "" {
+		kv = append(kv, "target", r.Target)
+	}
+	if err != nil {
+		kv = append(kv, "err", err.Error())
+	}
+	f.log.Info("sftp operation", kv...)
+}
+
+func (f *sftpFS) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	name := rel(r.Filepath)
+	switch r.Method {
+	case "List":
+		dir, err := f.root.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = dir.Close() }()
+		entries, err := dir.Readdir(-1)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt(entries), nil
+	case "Stat":
+		fi, err := f.root.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{fi}, nil
+	case "Readlink":
+		target, err := f.root.Readlink(name)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{linkName(target)}, nil
+	default:
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+func (f *sftpFS) Lstat(r *sftp.Request) (sftp.ListerAt, error) {
+	fi, err := f.root.Lstat(rel(r.Filepath))
+	if err != nil {
+		return nil, err
+	}
+	return listerAt{fi}, nil
+}
+
+// RealPath canonicalises a path within the root, relative to the start
+// directory, without resolving symlinks.
+func (f *sftpFS) RealPath(p string) (string, error) {
+	if !path.IsAbs(p) {
+		p = path.Join(f.start, p)
+	}
+	return path.Clean(p), nil
+}
+
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(out []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(out, l[offset:])
+	if n < len(out) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// linkName carries a Readlink result, which pkg/sftp reads from Name().
+type linkName string
+
+func (l linkName) Name() string { return string(l) }
+
+func (linkName) Size() int64        { return 0 }
+func (linkName) Mode() os.FileMode  { return os.ModeSymlink }
+func (linkName) ModTime() time.Time { return time.Time{} }
+func (linkName) IsDir() bool        { return false }
+func (linkName) Sys() any           { return nil }
+
+// auditedFile counts the bytes moved through an open file and logs the
+// transfer when the client closes its handle.
+type auditedFile struct {
+	*os.File
+	log   logr.Logger
+	op    string
+	path  string
+	bytes atomic.Int64
+}
+
+func (a *auditedFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := a.File.ReadAt(p, off)
+	a.bytes.Add(int64(n))
+	return n, err
+}
+
+func (a *auditedFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := a.File.WriteAt(p, off)
+	a.bytes.Add(int64(n))
+	return n, err
+}
+
+func (a *auditedFile) Close() error {
+	a.log.Info("sftp operation", "op", a.op, "path", a.path, "bytes", a.bytes.Load())
+	return a.File.Close()
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/pkg/sftp"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+// auditLog collects the agent's log lines.
+type auditLog struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (a *auditLog) write(prefix, args string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lines = append(a.lines, args)
+}
+
+func (a *auditLog) find(substr string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, l := range a.lines {
+		if strings.Contains(l, substr) {
+			return l
+		}
+	}
+	return ""
+}
+
+// startSFTP runs an agent with the given mode and returns an SFTP client,
+// the home directory and the audit log.
+func startSFTP(t *testing.T, mode kubeparkv1alpha1.SFTPMode) (*sftp.Client, string, *auditLog) {
+	t.Helper()
+	audit := &auditLog{}
+	home := t.TempDir()
+	addr, owner := startTestServer(t, Config{
+		HomeDir: home,
+		SFTP:    mode,
+		Log:     funcr.New(audit.write, funcr.Options{}),
+	})
+	client, err := sftp.NewClient(dialTestServer(t, addr, owner))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client, home, audit
+}
+
+func TestSFTPHomeJail(t *testing.T) {
+	client, home, _ := startSFTP(t, kubeparkv1alpha1.SFTPHome)
+
+	if wd, _ := client.Getwd(); wd != "/" {
+		t.Errorf("expected home to appear as /, got %q", wd)
+	}
+	f, err := client.Create("/../../notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("hi"))
+	_ = f.Close()
+	if _, err := os.Stat(filepath.Join(home, "notes.txt")); err != nil {
+		t.Errorf("expected .. to stay inside home: %v", err)
+	}
+
+	// A symlink planted in home must not lead out of it.
+	if err := os.Symlink("/etc", filepath.Join(home, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Open("/escape/hostname"); err == nil {
+		t.Error("expected a symlink out of home to be refused")
+	}
+}
+
+func TestSFTPReadOnly(t *testing.T) {
+	client, home, _ := startSFTP(t, kubeparkv1alpha1.SFTPReadOnly)
+	if err := os.WriteFile(filepath.Join(home, "data.csv"), []byte("a,b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := client.Open("/data.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(f)
+	_ = f.Close()
+	if string(got) != "a,b\n" {
+		t.Errorf("expected downloads to work, got %q", got)
+	}
+	if _, err := client.Create("/upload.txt"); err == nil {
+		t.Error("expected uploads to be refused")
+	}
+	if err := client.Remove("/data.csv"); err == nil {
+		t.Error("expected deletes to be refused")
+	}
+	if err := client.Mkdir("/dir"); err == nil {
+		t.Error("expected mkdir to be refused")
+	}
+}
+
+func TestSFTPFull(t *testing.T) {
+	client, home, _ := startSFTP(t, kubeparkv1alpha1.SFTPFull)
+	if wd, _ := client.Getwd(); wd != home {
+		t.Errorf("expected to start in home %q, got %q", home, wd)
+	}
+	if _, err := client.Stat("/proc/self"); err != nil {
+		t.Errorf("expected the pod filesystem to be visible: %v", err)
+	}
+}
+
+// TestSFTPAudit checks that uploads, downloads and deletes are logged
+// with the fields that join them to the gateway's SandboxSession.
+func TestSFTPAudit(t *testing.T) {
+	client, _, audit := startSFTP(t, kubeparkv1alpha1.SFTPHome)
+
+	f, err := client.Create("/secret.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("12345"))
+	_ = f.Close()
+	r, err := client.Open("/secret.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.ReadAll(r)
+	_ = r.Close()
+	if err := client.Remove("/secret.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range []string{`"op"="upload"`, `"op"="download"`, `"op"="remove"`} {
+		line := audit.find(op)
+		if line == "" {
+			t.Errorf("expected an audit line for %s, got %v", op, audit.lines)
+			continue
+		}
+		for _, field := range []string{`"path"="/secret.txt"`, `"peer"="127.0.0.1:`, `"certSerial"=`, `"user"="alice@example.com"`} {
+			if !strings.Contains(line, field) {
+				t.Errorf("audit line for %s lacks %s: %s", op, field, line)
+			}
+		}
+	}
+	if line := audit.find(`"op"="upload"`); !strings.Contains(line, `"bytes"=5`) {
+		t.Errorf("expected the upload size to be logged: %s", line)
+	}
+}
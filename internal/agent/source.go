@@ -0,0 +1,297 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/frauniki/kubepark/internal/devcontainer"
+)
+
+const (
+	// sourceDialTimeout bounds the reachability check before cloning.
+	sourceDialTimeout = 10 * time.Second
+	// cloneOutputTail is how much trailing git output a failure reports.
+	cloneOutputTail = 512
+)
+
+// ErrSourceUnreachable marks a clone that failed because the git host could
+// not be reached.
+var ErrSourceUnreachable = errors.New("git host unreachable")
+
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Source is the repository the clone init step checks out into the home.
+type Source struct {
+	URL string
+	Ref string
+	// Dir is relative to Home; empty means the repository name.
+	Dir  string
+	Home string
+	// CredentialsDir holds the mounted credentials Secret, if any.
+	CredentialsDir string
+	// Devcontainer is the path of a devcontainer.json in the repository
+	// to report, if any.
+	Devcontainer string
+}
+
+// SourceFromEnv reads the source the pod spec passes to the clone step.
+func SourceFromEnv() (Source, error) {
+	src := Source{
+		URL:            os.Getenv("KUBEPARK_SOURCE_URL"),
+		Ref:            os.Getenv("KUBEPARK_SOURCE_REF"),
+		Dir:            os.Getenv("KUBEPARK_SOURCE_DIR"),
+		Home:           os.Getenv("HOME"),
+		CredentialsDir: os.Getenv("KUBEPARK_SOURCE_CREDENTIALS"),
+		Devcontainer:   os.Getenv("KUBEPARK_SOURCE_DEVCONTAINER"),
+	}
+	if src.URL == "" {
+		return Source{}, errors.New("KUBEPARK_SOURCE_URL is not set")
+	}
+	if src.Home == "" {
+		src.Home = "/home/sandbox"
+	}
+	return src, nil
+}
+
+// Clone clones the source into the home unless its directory already
+// exists there, and describes the outcome. A failed clone leaves nothing
+// behind, so the next start retries it. With a devcontainer path, the
+// description is followed by a line with the devcontainer report.
+func Clone(src Source) (string, error) {
+	dir := src.Dir
+	if dir == "" {
+		dir = repoName(src.URL)
+	}
+	target := filepath.Join(src.Home, dir)
+	msg, err := clone(nil, src, dir, target)
+	if err != nil || src.Devcontainer == "" {
+		return msg, err
+	}
+	// Read on every start, so the file in the home (not the one first
+	// cloned) is what applies.
+	return msg + "\n" + string(devcontainer.Read(target, src.Devcontainer)), nil
+}
+
+// clone clones src into target, running git through r.
+func clone(r *reaper, src Source, dir, target string) (string, error) {
+	if _, err := os.Lstat(target); err == nil {
+		return fmt.Sprintf("~/%s already exists, not cloned", dir), nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", errors.New("git is not installed in the template image")
+	}
+	if err := probeSource(src.URL); err != nil {
+		return "", err
+	}
+
+	scratch, err := os.MkdirTemp("", "kubepark-source-")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.RemoveAll(scratch) }()
+	env, err := gitEnv(src, scratch)
+	if err != nil {
+		return "", err
+	}
+
+	// Clone next to the target and rename, so an interrupted clone never
+	// looks like a finished one.
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(target), ".kubepark-clone-")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+
+	args := []string{"clone", "--progress"}
+	if src.Ref != "" && !commitSHA.MatchString(src.Ref) {
+		args = append(args, "--branch", src.Ref)
+	}
+	if err := runGit(r, env, append(args, "--", src.URL, tmp)...); err != nil {
+		return "", fmt.Errorf("git clone failed: %w", err)
+	}
+	if commitSHA.MatchString(src.Ref) {
+		if err := runGit(r, env, "-C", tmp, "checkout", "--detach", src.Ref); err != nil {
+			return "", fmt.Errorf("git checkout %s failed: %w", src.Ref, err)
+		}
+	}
+	var head bytes.Buffer
+	rev := exec.Command("git", "-C", tmp, "rev-parse", "--short=12", "HEAD")
+	rev.Stdout = &head
+	if err := r.run(rev); err != nil {
+		return "", fmt.Errorf("resolve HEAD: %w", err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("cloned %s at %s into ~/%s", src.URL, strings.TrimSpace(head.String()), dir), nil
+}
+
+// runGit runs git with its output in the container log; a failure carries
+// the tail of that output.
+func runGit(r *reaper, env []string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Env = env
+	tail := &tailBuffer{max: cloneOutputTail}
+	out := io.MultiWriter(os.Stderr, tail)
+	cmd.Stdout, cmd.Stderr = out, out
+	if err := r.run(cmd); err != nil {
+		return fmt.Errorf("%w%s", err, tail.suffix())
+	}
+	return nil
+}
+
+// gitEnv builds git's environment from the credentials, writing the files
+// ssh needs into scratch. Credentials go through the environment so they
+// are neither visible in the process list nor persisted in the clone's
+// config.
+func gitEnv(src Source, scratch string) ([]string, error) {
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	read := func(name string) ([]byte, bool) {
+		if src.CredentialsDir == "" {
+			return nil, false
+		}
+		raw, err := os.ReadFile(filepath.Join(src.CredentialsDir, name))
+		return raw, err == nil
+	}
+
+	if user, ok := read("username"); ok {
+		password, _ := read("password")
+		auth := base64.StdEncoding.EncodeToString([]byte(strings.TrimSpace(string(user)) + ":" + strings.TrimSpace(string(password))))
+		env = append(env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth,
+		)
+	}
+
+	if !isSSHURL(src.URL) {
+		return env, nil
+	}
+	// Without known_hosts the host key is trusted on first use; it is kept
+	// in scratch, so the user's own known_hosts is untouched.
+	knownHosts, strict := filepath.Join(scratch, "known_hosts"), "accept-new"
+	if raw, ok := read("known_hosts"); ok {
+		if err := os.WriteFile(knownHosts, raw, 0o600); err != nil {
+			return nil, err
+		}
+		strict = "yes"
+	}
+	sshCmd := fmt.Sprintf("ssh -o UserKnownHostsFile=%s -o StrictHostKeyChecking=%s -o ConnectTimeout=%d",
+		knownHosts, strict, int(sourceDialTimeout.Seconds()))
+	// Secret volumes are group-readable under fsGroup, which ssh refuses
+	// for private keys; a private copy is not.
+	if key, ok := read("ssh-privatekey"); ok {
+		keyFile := filepath.Join(scratch, "id")
+		if err := os.WriteFile(keyFile, key, 0o600); err != nil {
+			return nil, err
+		}
+		sshCmd += " -o IdentitiesOnly=yes -i " + keyFile
+	}
+	return append(env, "GIT_SSH_COMMAND="+sshCmd), nil
+}
+
+// probeSource checks that the git host accepts connections, so a sandbox
+// whose egress does not allow it fails fast with a clear reason instead of
+// a git timeout. It is skipped behind a proxy, which git dials instead.
+func probeSource(rawURL string) error {
+	hostport := sourceEndpoint(rawURL)
+	if hostport == "" {
+		return nil
+	}
+	if !isSSHURL(rawURL) && (os.Getenv("HTTPS_PROXY") != "" || os.Getenv("https_proxy") != "" ||
+		os.Getenv("HTTP_PROXY") != "" || os.Getenv("http_proxy") != "") {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", hostport, sourceDialTimeout)
+	if err != nil {
+		return fmt.Errorf("%w: cannot connect to %s (%v); the template's egress must allow it",
+			ErrSourceUnreachable, hostport, err)
+	}
+	_ = conn.Close()
+	return nil
+}
+
+// sourceEndpoint returns the host:port git connects to for a URL.
+func sourceEndpoint(rawURL string) string {
+	if host, ok := scpHost(rawURL); ok {
+		return net.JoinHostPort(host, "22")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	if port := u.Port(); port != "" {
+		return net.JoinHostPort(u.Hostname(), port)
+	}
+	switch u.Scheme {
+	case "ssh":
+		return net.JoinHostPort(u.Hostname(), "22")
+	case "http":
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+	return net.JoinHostPort(u.Hostname(), "443")
+}
+
+// scpHost parses the host of an scp-like URL (git@host:org/repo.git).
+func scpHost(rawURL string) (string, bool) {
+	if strings.Contains(rawURL, "://") {
+		return "", false
+	}
+	userHost, _, ok := strings.Cut(rawURL, ":")
+	if !ok {
+		return "", false
+	}
+	_, host, ok := strings.Cut(userHost, "@")
+	return host, ok && host != ""
+}
+
+func isSSHURL(rawURL string) bool {
+	_, scp := scpHost(rawURL)
+	return scp || strings.HasPrefix(rawURL, "ssh://")
+}
+
+// repoName is the directory git itself would clone a URL into.
+func repoName(rawURL string) string {
+	p := rawURL
+	if _, rest, ok := strings.Cut(rawURL, "://"); ok {
+		p = rest
+	} else if _, rest, ok := strings.Cut(rawURL, ":"); ok {
+		p = rest
+	}
+	name := strings.TrimSuffix(path.Base(strings.TrimRight(p, "/")), ".git")
+	if name == "" || name == "." || name == "/" {
+		return "src"
+	}
+	return name
+}
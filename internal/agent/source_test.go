@@ -0,0 +1,143 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frauniki/kubepark/internal/devcontainer"
+)
+
+// testRepo creates a repository with one commit on branch main and a
+// "feature" branch, returning its file:// URL.
+func testRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := filepath.Join(t.TempDir(), "project")
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main", dir},
+		{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "--allow-empty", "-m", "init"},
+		{"-C", dir, "branch", "feature"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	return "file://" + dir
+}
+
+func TestCloneIntoHome(t *testing.T) {
+	url := testRepo(t)
+	home := t.TempDir()
+	msg, err := Clone(Source{URL: url, Ref: "feature", Home: home})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(msg, "cloned "+url+" at ") || !strings.HasSuffix(msg, " into ~/project") {
+		t.Errorf("unexpected message %q", msg)
+	}
+	head, err := exec.Command("git", "-C", filepath.Join(home, "project"), "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil || strings.TrimSpace(string(head)) != "feature" {
+		t.Errorf("expected branch feature checked out, got %q (%v)", head, err)
+	}
+	entries, _ := os.ReadDir(home)
+	if len(entries) != 1 {
+		t.Errorf("expected only the clone in the home, got %v", entries)
+	}
+
+	// An existing directory is never touched again.
+	msg, err = Clone(Source{URL: url, Home: home})
+	if err != nil || !strings.Contains(msg, "already exists") {
+		t.Errorf("expected the clone to be skipped, got %q, %v", msg, err)
+	}
+}
+
+func TestCloneReportsDevcontainer(t *testing.T) {
+	url := testRepo(t)
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, "project", ".devcontainer"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// The file in the home applies, cloned or not.
+	if err := os.WriteFile(filepath.Join(home, "project", ".devcontainer", "devcontainer.json"),
+		[]byte(`{"image": "app", // edited
+}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := Clone(Source{URL: url, Home: home, Devcontainer: ".devcontainer/devcontainer.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, raw, ok := strings.Cut(msg, "\n")
+	if !ok || !strings.Contains(first, "already exists") {
+		t.Fatalf("expected a message line and a report, got %q", msg)
+	}
+	var report devcontainer.Report
+	if err := json.Unmarshal([]byte(raw), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Workspace != filepath.Join(home, "project") || report.Config == nil || report.Config.Image != "app" {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestCloneFailureLeavesNothing(t *testing.T) {
+	url := testRepo(t)
+	home := t.TempDir()
+	_, err := Clone(Source{URL: url, Ref: "no-such-branch", Dir: "work/app", Home: home})
+	if err == nil || !strings.Contains(err.Error(), "git clone failed") {
+		t.Fatalf("expected a clone failure, got %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(home, "work"))
+	if len(entries) != 0 {
+		t.Errorf("expected no partial clone, got %v", entries)
+	}
+}
+
+func TestCloneUnreachable(t *testing.T) {
+	_, err := Clone(Source{URL: "https://127.0.0.1:1/org/repo.git", Home: t.TempDir()})
+	if !errors.Is(err, ErrSourceUnreachable) {
+		t.Errorf("expected an unreachable source, got %v", err)
+	}
+}
+
+func TestSourceURLs(t *testing.T) {
+	cases := []struct {
+		url, endpoint, name string
+	}{
+		{"https://github.com/org/repo.git", "github.com:443", "repo"},
+		{"http://git.internal:8080/org/repo", "git.internal:8080", "repo"},
+		{"ssh://git@gitlab.example.com:2222/group/sub/app.git", "gitlab.example.com:2222", "app"},
+		{"git@github.com:org/repo.git", "github.com:22", "repo"},
+	}
+	for _, tc := range cases {
+		if got := sourceEndpoint(tc.url); got != tc.endpoint {
+			t.Errorf("%s: expected endpoint %s, got %s", tc.url, tc.endpoint, got)
+		}
+		if got := repoName(tc.url); got != tc.name {
+			t.Errorf("%s: expected name %s, got %s", tc.url, tc.name, got)
+		}
+	}
+}
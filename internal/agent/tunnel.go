@@ -0,0 +1,200 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	gliderssh "github.com/gliderlabs/ssh"
+	"github.com/go-logr/logr"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/frauniki/kubepark/internal/sshca"
+	"github.com/frauniki/kubepark/internal/tunnel"
+)
+
+const (
+	tunnelKeepalive   = 30 * time.Second
+	tunnelDialTimeout = 10 * time.Second
+	tunnelMinBackoff  = time.Second
+	tunnelMaxBackoff  = 30 * time.Second
+)
+
+// tunnelClient keeps the agent's reverse tunnel to the gateway open: an
+// outbound SSH connection on which the gateway opens a channel per
+// connection to the pod, so the gateway needs no route to the pod IP.
+type tunnelClient struct {
+	addr      string
+	user      string
+	signer    gossh.Signer
+	hostCA    gossh.PublicKey
+	agentPort uint32
+	ssh       *gliderssh.Server
+	log       logr.Logger
+	now       func() time.Time
+	done      chan struct{}
+}
+
+func newTunnelClient(cfg Config, signer gossh.Signer, srv *gliderssh.Server) (*tunnelClient, error) {
+	hostCA, err := sshca.ParsePublicKey(cfg.HostCAAuthorized)
+	if err != nil {
+		return nil, fmt.Errorf("parse host CA: %w", err)
+	}
+	_, portStr, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("parse listen address: %w", err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("parse listen port: %w", err)
+	}
+	return &tunnelClient{
+		addr:      cfg.TunnelAddr,
+		user:      tunnel.User(cfg.Cluster, cfg.Namespace, cfg.Sandbox),
+		signer:    signer,
+		hostCA:    hostCA,
+		agentPort: uint32(port),
+		ssh:       srv,
+		log:       cfg.Log.WithName("tunnel"),
+		now:       cfg.Now,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// ServeTunnel keeps the reverse tunnel to the gateway open, reconnecting
+// with backoff, until Shutdown. It returns at once when no tunnel address
+// is configured.
+func (s *Server) ServeTunnel() error {
+	c := s.tunnel
+	if c == nil {
+		return nil
+	}
+	backoff := tunnelMinBackoff
+	for {
+		start := time.Now()
+		err := c.connect()
+		select {
+		case <-c.done:
+			return nil
+		default:
+		}
+		c.log.Info("tunnel to gateway closed", "addr", c.addr, "err", fmt.Sprint(err))
+		// A connection that lived a while starts the backoff over.
+		if time.Since(start) > tunnelMaxBackoff {
+			backoff = tunnelMinBackoff
+		}
+		select {
+		case <-c.done:
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, tunnelMaxBackoff)
+	}
+}
+
+// connect runs one tunnel connection until it ends.
+func (c *tunnelClient) connect() error {
+	nc, err := net.DialTimeout("tcp", c.addr, tunnelDialTimeout)
+	if err != nil {
+		return err
+	}
+	conn, chans, reqs, err := gossh.NewClientConn(nc, c.addr, &gossh.ClientConfig{
+		User: c.user,
+		Auth: []gossh.AuthMethod{gossh.PublicKeys(c.signer)},
+		// Only the gateway holds a host certificate for its principal.
+		HostKeyCallback: func(_ string, _ net.Addr, key gossh.PublicKey) error {
+			cert, ok := key.(*gossh.Certificate)
+			if !ok {
+				return errors.New("gateway presented no host certificate")
+			}
+			return sshca.CheckHostCert(cert, c.hostCA, tunnel.GatewayPrincipal, c.now())
+		},
+		HostKeyAlgorithms: []string{gossh.CertAlgoED25519v01},
+		Timeout:           tunnelDialTimeout,
+	})
+	if err != nil {
+		_ = nc.Close()
+		return err
+	}
+	c.log.Info("tunnel to gateway open", "addr", c.addr)
+	go gossh.DiscardRequests(reqs)
+	go tunnel.Keepalive(conn, tunnelKeepalive)
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		select {
+		case <-c.done:
+		case <-closed:
+		}
+		_ = conn.Close()
+	}()
+
+	local := tunnel.Addr(nc.LocalAddr().String())
+	for newChan := range chans {
+		go c.handle(newChan, local)
+	}
+	return conn.Wait()
+}
+
+// handle serves one DialChannel: the agent port is handed to the agent's
+// own SSH server, so it authenticates the client as on a direct
+// connection; any other port is dialed on loopback.
+func (c *tunnelClient) handle(newChan gossh.NewChannel, local net.Addr) {
+	if newChan.ChannelType() != tunnel.DialChannel {
+		_ = newChan.Reject(gossh.UnknownChannelType, "unsupported channel type")
+		return
+	}
+	var req tunnel.DialRequest
+	if err := gossh.Unmarshal(newChan.ExtraData(), &req); err != nil {
+		_ = newChan.Reject(gossh.ConnectionFailed, "invalid dial payload")
+		return
+	}
+
+	if req.Port == c.agentPort {
+		ch, reqs, err := newChan.Accept()
+		if err != nil {
+			return
+		}
+		go gossh.DiscardRequests(reqs)
+		// The origin is the peer, as the gateway recorded it on the session.
+		c.ssh.HandleConn(&tunnel.Conn{Channel: ch, Local: local, Remote: tunnel.Addr(req.Origin)})
+		return
+	}
+
+	upstream, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(req.Port))), tunnelDialTimeout)
+	if err != nil {
+		_ = newChan.Reject(gossh.ConnectionFailed, "port not reachable")
+		return
+	}
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		_ = upstream.Close()
+		return
+	}
+	go gossh.DiscardRequests(reqs)
+	done := make(chan struct{}, 2)
+	go func() { _, _ = io.Copy(ch, upstream); _ = ch.CloseWrite(); done <- struct{}{} }()
+	go func() { _, _ = io.Copy(upstream, ch); done <- struct{}{} }()
+	<-done
+	_ = ch.Close()
+	_ = upstream.Close()
+}
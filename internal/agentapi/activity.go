@@ -0,0 +1,38 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package agentapi holds what the in-pod agent and the operator exchange:
+// the activity and hook reports the agent serves, and the clone step's
+// termination message. Neither side imports the other.
+package agentapi
+
+import "time"
+
+// ActivityPath is the HTTP path the operator polls for agent activity.
+const ActivityPath = "/activity"
+
+// Activity is what the agent reports to the operator's idle evaluation:
+// when each kind of activity was last seen. Nil means never (since the
+// agent started).
+type Activity struct {
+	// LastInput is the last keystroke on an interactive terminal.
+	LastInput *time.Time `json:"lastInput,omitempty"`
+	// LastCPU is the end of the last sample in which the container's CPU
+	// usage exceeded the threshold.
+	LastCPU *time.Time `json:"lastCPU,omitempty"`
+	// LastPortForward is the last traffic through a local (-L) forward.
+	LastPortForward *time.Time `json:"lastPortForward,omitempty"`
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agentapi
+
+import "time"
+
+// HooksPath reports lifecycle hook outcomes (GET). POSTing to
+// HooksPath + "/" + HookPreSuspend starts the preSuspend hook.
+const HooksPath = "/hooks"
+
+const (
+	// DefaultHookTimeout bounds postCreate and postStart hooks that set
+	// no timeout.
+	DefaultHookTimeout = 10 * time.Minute
+	// DefaultPreSuspendTimeout bounds a preSuspend hook that sets no
+	// timeout; it is shorter because it delays the suspension.
+	DefaultPreSuspendTimeout = time.Minute
+)
+
+// HookName names a lifecycle hook. Values match the template's hooks
+// fields.
+type HookName string
+
+const (
+	HookPostCreate HookName = "postCreate"
+	HookPostStart  HookName = "postStart"
+	HookPreSuspend HookName = "preSuspend"
+	// HookDotfiles reports the install of the owner's dotfiles, which
+	// runs before postCreate.
+	HookDotfiles HookName = "dotfiles"
+)
+
+// HookState is the progress of one hook run.
+type HookState string
+
+const (
+	HookRunning   HookState = "Running"
+	HookSucceeded HookState = "Succeeded"
+	HookFailed    HookState = "Failed"
+)
+
+// HookStatus is one hook's outcome as reported to the operator.
+type HookStatus struct {
+	State HookState `json:"state"`
+	// Message explains the outcome: how long a successful run took, or the
+	// exit status and the tail of a failed run's output.
+	Message   string     `json:"message,omitempty"`
+	StartTime time.Time  `json:"startTime"`
+	EndTime   *time.Time `json:"endTime,omitempty"`
+}
+
+// HookReport maps each hook that has run (or is running) since the agent
+// started to its status.
+type HookReport map[HookName]HookStatus
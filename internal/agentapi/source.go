@@ -0,0 +1,29 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agentapi
+
+// The clone step exits 0 even when it fails, so a failure never keeps the
+// sandbox from starting; its termination message then starts with one of
+// these prefixes instead.
+const (
+	// CloneFailedPrefix marks a failed clone.
+	CloneFailedPrefix = "failed: "
+	// CloneUnreachablePrefix marks a clone that failed because the git
+	// host cannot be reached, which usually means egress does not allow
+	// it.
+	CloneUnreachablePrefix = "unreachable: "
+)
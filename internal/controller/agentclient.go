@@ -0,0 +1,102 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/frauniki/kubepark/internal/agentapi"
+	"github.com/frauniki/kubepark/internal/controller/podspec"
+)
+
+// AgentClient talks to the operator endpoint of a sandbox agent, which
+// only operator pods can reach.
+type AgentClient interface {
+	// Activity fetches the agent's activity report.
+	Activity(ctx context.Context, podIP string) (*agentapi.Activity, error)
+	// Hooks fetches the lifecycle hook outcomes since the agent started.
+	Hooks(ctx context.Context, podIP string) (agentapi.HookReport, error)
+	// StartPreSuspend starts the preSuspend hook; it is a no-op once
+	// started.
+	StartPreSuspend(ctx context.Context, podIP string) error
+}
+
+// agentRequestTimeout bounds a single request to an agent.
+const agentRequestTimeout = 3 * time.Second
+
+// httpAgentClient is the AgentClient used in clusters.
+type httpAgentClient struct{}
+
+func (r *SandboxReconciler) agent() AgentClient {
+	if r.Agent != nil {
+		return r.Agent
+	}
+	return httpAgentClient{}
+}
+
+func (httpAgentClient) Activity(ctx context.Context, podIP string) (*agentapi.Activity, error) {
+	var act agentapi.Activity
+	if err := agentRequest(ctx, http.MethodGet, podIP, agentapi.ActivityPath, &act); err != nil {
+		return nil, err
+	}
+	return &act, nil
+}
+
+func (httpAgentClient) Hooks(ctx context.Context, podIP string) (agentapi.HookReport, error) {
+	var report agentapi.HookReport
+	if err := agentRequest(ctx, http.MethodGet, podIP, agentapi.HooksPath, &report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (httpAgentClient) StartPreSuspend(ctx context.Context, podIP string) error {
+	return agentRequest(ctx, http.MethodPost, podIP, agentapi.HooksPath+"/"+string(agentapi.HookPreSuspend), nil)
+}
+
+// agentRequest calls the agent endpoint and decodes a JSON reply into out
+// when it is non-nil.
+func agentRequest(ctx context.Context, method, podIP, path string, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, agentRequestTimeout)
+	defer cancel()
+	url := "http://" + net.JoinHostPort(podIP, strconv.Itoa(podspec.ActivityPort)) + path
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s returned %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	return nil
+}
@@ -17,12 +17,15 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/agentapi"
 )
 
 func TestEffectiveIdleTimeout(t *testing.T) {
@@ -65,3 +68,69 @@ func TestIdleExpired(t *testing.T) {
 		t.Error("stale activity must be expired")
 	}
 }
+
+func TestIdleSignalsDefaultToSessions(t *testing.T) {
+	got := idleSignals(&kubeparkv1alpha1.SandboxTemplate{})
+	if len(got) != 1 || got[0] != kubeparkv1alpha1.IdleSignalSessions {
+		t.Errorf("expected [sessions] by default, got %v", got)
+	}
+	if usesAgentSignals(got) {
+		t.Error("the session signal is not reported by the agent")
+	}
+	if !usesAgentSignals([]kubeparkv1alpha1.IdleSignal{kubeparkv1alpha1.IdleSignalSessions, kubeparkv1alpha1.IdleSignalCPU}) {
+		t.Error("cpu is an agent signal")
+	}
+}
+
+func TestLastActivityHonorsPolicy(t *testing.T) {
+	base := metav1.NewTime(time.Now().Add(-time.Hour))
+	input := metav1.NewTime(base.Add(10 * time.Minute))
+	cpu := metav1.NewTime(base.Add(20 * time.Minute))
+	status := &kubeparkv1alpha1.SandboxStatus{
+		LastActivityTime: &base,
+		Activity: &kubeparkv1alpha1.SandboxActivity{
+			LastInputTime: &input,
+			LastCPUTime:   &cpu,
+		},
+	}
+	cases := []struct {
+		signals []kubeparkv1alpha1.IdleSignal
+		want    metav1.Time
+	}{
+		{[]kubeparkv1alpha1.IdleSignal{kubeparkv1alpha1.IdleSignalSessions}, base},
+		{[]kubeparkv1alpha1.IdleSignal{kubeparkv1alpha1.IdleSignalInput}, input},
+		{[]kubeparkv1alpha1.IdleSignal{kubeparkv1alpha1.IdleSignalInput, kubeparkv1alpha1.IdleSignalCPU}, cpu},
+		{[]kubeparkv1alpha1.IdleSignal{kubeparkv1alpha1.IdleSignalPortForward}, base},
+	}
+	for _, tc := range cases {
+		if got := lastActivity(tc.signals, status); got == nil || !got.Equal(&tc.want) {
+			t.Errorf("signals %v: expected %v, got %v", tc.signals, tc.want, got)
+		}
+	}
+}
+
+func TestRecordActivityOnlyMovesForward(t *testing.T) {
+	earlier := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	later := earlier.Add(30 * time.Minute)
+	// A restarted agent has no input yet but fresh CPU activity.
+	fake := &fakeAgent{activity: &agentapi.Activity{LastCPU: &later}}
+	r := &SandboxReconciler{Agent: fake}
+	prevInput := metav1.NewTime(earlier)
+	status := &kubeparkv1alpha1.SandboxStatus{
+		PodIP:    "10.0.0.1",
+		Activity: &kubeparkv1alpha1.SandboxActivity{LastInputTime: &prevInput},
+	}
+	r.recordActivity(context.Background(), status)
+	if status.Activity.LastInputTime == nil || !status.Activity.LastInputTime.Time.Equal(earlier) {
+		t.Errorf("expected the previous input time to be kept, got %v", status.Activity.LastInputTime)
+	}
+	if status.Activity.LastCPUTime == nil || !status.Activity.LastCPUTime.Time.Equal(later) {
+		t.Errorf("expected the reported CPU time, got %v", status.Activity.LastCPUTime)
+	}
+
+	fake.err = errors.New("connection refused")
+	r.recordActivity(context.Background(), status)
+	if status.Activity.LastCPUTime == nil {
+		t.Error("a failed probe must keep the previous report")
+	}
+}
@@ -24,6 +24,9 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -47,6 +50,8 @@ const (
 
 	// AgentPort is the fixed in-pod SSH port served by the agent.
 	AgentPort = 2222
+	// ActivityPort is where the agent reports activity to the operator.
+	ActivityPort = 2223
 
 	// HomeMountPath is where the home PVC is mounted. The image ENTRYPOINT
 	// is not used and /home/sandbox is the documented home directory.
@@ -59,10 +64,33 @@ const (
 
 	annotationSafeToEvict = "cluster-autoscaler.kubernetes.io/safe-to-evict"
 
+	// terminationGracePeriodSeconds bounds the agent's graceful shutdown on
+	// suspend; the agent is told the value so it can drain its children
+	// and exit before the kubelet's SIGKILL.
+	terminationGracePeriodSeconds = 30
+
 	volumeHome    = "home"
 	volumeAgent   = "kubepark-bin"
 	volumeHostKey = "kubepark-host"
 
+	volumeSourceCredentials = "kubepark-source"
+
+	// defaultUserName is the sandbox user's login name unless the template
+	// names it.
+	defaultUserName = "sandbox"
+
+	// identityDir (in the agent volume) holds the passwd and group files
+	// written for the sandbox user.
+	identityDir = agentDir + "/etc"
+
+	// SourceContainerName is the init container that clones spec.source;
+	// the controller reads the clone outcome from its status.
+	SourceContainerName = "source"
+
+	// sourceCredentialsDir is where the source credentials Secret is
+	// mounted in the clone init container.
+	sourceCredentialsDir = "/etc/kubepark/source"
+
 	// HostKeyMountPath is where the agent reads its host key, host cert and
 	// the user CA public key. Only public CA material is ever mounted here.
 	HostKeyMountPath = "/etc/kubepark/host"
@@ -78,6 +106,19 @@ type Options struct {
 	// ServiceAccountName carries AccessProfile grants. When empty the pod
 	// runs without a mounted token.
 	ServiceAccountName string
+	// ExtraPorts are exposed besides spec.exposedPorts: the forwardPorts
+	// of a devcontainer.json.
+	ExtraPorts []kubeparkv1alpha1.ExposedPort
+	// Profile is the owner's UserProfile, if any. Its dotfiles and
+	// authorized keys are passed to the agent; the rest is applied to the
+	// template beforehand.
+	Profile *kubeparkv1alpha1.UserProfileSpec
+	// TunnelAddress, when set, is the gateway's reverse-tunnel listener
+	// the agent keeps a connection open to.
+	TunnelAddress string
+	// ClusterName, when set, names this cluster as a member of a gateway
+	// elsewhere; the agent claims its tunnel under it.
+	ClusterName string
 }
 
 // Names derived from the sandbox name. Kept together so the controller and
@@ -87,6 +128,13 @@ func PVCName(sandbox string) string     { return "kubepark-home-" + sandbox }
 func HostKeyName(sandbox string) string { return "kubepark-hostkey-" + sandbox }
 func NetPolName(sandbox string) string  { return "kubepark-sb-" + sandbox }
 
+// Keys of a sandbox's host key Secret. The hub's gateway writes the
+// certificate of a member cluster's sandbox.
+const (
+	HostKeyPublic = "ssh_host_ed25519_key.pub"
+	HostKeyCert   = "ssh_host_ed25519_key-cert.pub"
+)
+
 // Labels returns the canonical label set for resources owned by a sandbox.
 func Labels(sb *kubeparkv1alpha1.Sandbox) map[string]string {
 	return map[string]string{
@@ -99,9 +147,14 @@ func Labels(sb *kubeparkv1alpha1.Sandbox) map[string]string {
 
 // TemplateHash returns a stable short hash of the template spec, used to
 // pin the template snapshot a pod was built from (template edits must never
-// restart running pods).
-func TemplateHash(spec *kubeparkv1alpha1.SandboxTemplateSpec) string {
-	raw, err := json.Marshal(spec)
+// restart running pods). The owner's dotfiles and authorized keys, which
+// the pod carries besides the template, are part of the snapshot.
+func TemplateHash(spec *kubeparkv1alpha1.SandboxTemplateSpec, profile *kubeparkv1alpha1.UserProfileSpec) string {
+	var v any = spec
+	if profile != nil && (profile.Dotfiles != nil || len(profile.AuthorizedKeys) > 0) {
+		v = []any{spec, profile.Dotfiles, profile.AuthorizedKeys}
+	}
+	raw, err := json.Marshal(v)
 	if err != nil {
 		// A SandboxTemplateSpec always marshals; guard for completeness.
 		return "unhashable"
@@ -123,6 +176,25 @@ func BuildPod(sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplat
 		runAsUser = *tpl.Spec.RunAsUser
 	}
 
+	userName, shell := defaultUserName, ""
+	var groups []string
+	var supplementalGroups []int64
+	if u := tpl.Spec.User; u != nil {
+		if u.Name != "" {
+			userName = u.Name
+		}
+		shell = u.Shell
+		for _, g := range u.Groups {
+			groups = append(groups, fmt.Sprintf("%s:%d", g.Name, g.GID))
+			supplementalGroups = append(supplementalGroups, g.GID)
+		}
+	}
+
+	agentForwarding := true
+	if tpl.Spec.SSH != nil && tpl.Spec.SSH.AgentForwarding != nil {
+		agentForwarding = *tpl.Spec.SSH.AgentForwarding
+	}
+
 	// The agent is PID 1. A non-empty template command runs as its child;
 	// with no command the agent idles and spawns shells per connection.
 	command := []string{agentDir + "/agent"}
@@ -133,14 +205,78 @@ func BuildPod(sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplat
 
 	env := append([]corev1.EnvVar{
 		{Name: "HOME", Value: HomeMountPath},
+		{Name: "USER", Value: userName},
+		{Name: "LOGNAME", Value: userName},
 		{Name: "KUBEPARK_SANDBOX", Value: sb.Name},
 		{Name: "KUBEPARK_NAMESPACE", Value: sb.Namespace},
 		{Name: "KUBEPARK_OWNER", Value: sb.Spec.Owner.Name},
+		{Name: "KUBEPARK_GRACE_PERIOD_SECONDS", Value: strconv.Itoa(terminationGracePeriodSeconds)},
+		{Name: "KUBEPARK_AGENT_FORWARDING", Value: strconv.FormatBool(agentForwarding)},
 	}, tpl.Spec.Env...)
 
-	ports := make([]corev1.ContainerPort, 0, 1+len(sb.Spec.ExposedPorts))
-	ports = append(ports, corev1.ContainerPort{Name: "ssh", ContainerPort: AgentPort, Protocol: corev1.ProtocolTCP})
-	for _, p := range sb.Spec.ExposedPorts {
+	if shell != "" {
+		env = append(env, corev1.EnvVar{Name: "SHELL", Value: shell})
+	}
+	// The identity init container resolves the same user and shell as the
+	// agent, so its only inputs are the name, shell and groups.
+	identityEnv := []corev1.EnvVar{
+		{Name: "HOME", Value: HomeMountPath},
+		{Name: "KUBEPARK_USER", Value: userName},
+	}
+	if shell != "" {
+		identityEnv = append(identityEnv, corev1.EnvVar{Name: "SHELL", Value: shell})
+	}
+	if len(groups) > 0 {
+		identityEnv = append(identityEnv, corev1.EnvVar{Name: "KUBEPARK_GROUPS", Value: strings.Join(groups, ",")})
+	}
+
+	if tpl.Spec.SSH != nil && tpl.Spec.SSH.SFTP != "" {
+		env = append(env, corev1.EnvVar{Name: "KUBEPARK_SFTP", Value: string(tpl.Spec.SSH.SFTP)})
+	}
+	if tpl.Spec.SSH != nil && tpl.Spec.SSH.AcceptEnv != nil {
+		env = append(env, corev1.EnvVar{Name: "KUBEPARK_ACCEPT_ENV", Value: strings.Join(tpl.Spec.SSH.AcceptEnv, ",")})
+	}
+
+	if tpl.Spec.IdlePolicy != nil && tpl.Spec.IdlePolicy.CPUThreshold != nil {
+		env = append(env, corev1.EnvVar{
+			Name:  "KUBEPARK_CPU_THRESHOLD_MILLICORES",
+			Value: strconv.FormatInt(tpl.Spec.IdlePolicy.CPUThreshold.MilliValue(), 10),
+		})
+	}
+
+	if tpl.Spec.Hooks != nil {
+		// The agent runs the hooks; their JSON form (durations as Go
+		// duration strings) is what it parses.
+		if raw, err := json.Marshal(tpl.Spec.Hooks); err == nil {
+			env = append(env, corev1.EnvVar{Name: "KUBEPARK_HOOKS", Value: string(raw)})
+		}
+	}
+
+	if p := opts.Profile; p != nil {
+		if p.Dotfiles != nil {
+			if raw, err := json.Marshal(p.Dotfiles); err == nil {
+				env = append(env, corev1.EnvVar{Name: "KUBEPARK_DOTFILES", Value: string(raw)})
+			}
+		}
+		if len(p.AuthorizedKeys) > 0 {
+			env = append(env, corev1.EnvVar{Name: "KUBEPARK_AUTHORIZED_KEYS", Value: strings.Join(p.AuthorizedKeys, "\n")})
+		}
+	}
+
+	if opts.TunnelAddress != "" {
+		env = append(env, corev1.EnvVar{Name: "KUBEPARK_TUNNEL_ADDR", Value: opts.TunnelAddress})
+	}
+	if opts.ClusterName != "" {
+		env = append(env, corev1.EnvVar{Name: "KUBEPARK_CLUSTER", Value: opts.ClusterName})
+	}
+
+	exposed := append(slices.Clip(sb.Spec.ExposedPorts), opts.ExtraPorts...)
+	ports := make([]corev1.ContainerPort, 0, 2+len(exposed))
+	ports = append(ports,
+		corev1.ContainerPort{Name: "ssh", ContainerPort: AgentPort, Protocol: corev1.ProtocolTCP},
+		corev1.ContainerPort{Name: "activity", ContainerPort: ActivityPort, Protocol: corev1.ProtocolTCP},
+	)
+	for _, p := range exposed {
 		ports = append(ports, corev1.ContainerPort{
 			Name:          p.Name,
 			ContainerPort: p.Port,
@@ -174,24 +310,41 @@ func BuildPod(sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplat
 			// profile-less sandboxes carry no credentials.
 			ServiceAccountName:            opts.ServiceAccountName,
 			AutomountServiceAccountToken:  ptr.To(opts.ServiceAccountName != ""),
-			TerminationGracePeriodSeconds: ptr.To(int64(30)),
+			TerminationGracePeriodSeconds: ptr.To(int64(terminationGracePeriodSeconds)),
 			SecurityContext: &corev1.PodSecurityContext{
 				RunAsNonRoot: ptr.To(true),
 				RunAsUser:    ptr.To(runAsUser),
-				FSGroup:      ptr.To(runAsUser),
+				// The primary group stays the image's; the identity init
+				// container names it in the passwd entry it writes.
+				FSGroup:            ptr.To(runAsUser),
+				SupplementalGroups: supplementalGroups,
 				SeccompProfile: &corev1.SeccompProfile{
 					Type: corev1.SeccompProfileTypeRuntimeDefault,
 				},
 			},
-			InitContainers: []corev1.Container{{
-				Name:            "agent-install",
-				Image:           opts.AgentImage,
-				Args:            []string{"agent", "install", agentDir},
-				SecurityContext: containerSecurity,
-				VolumeMounts: []corev1.VolumeMount{
-					{Name: volumeAgent, MountPath: agentDir},
+			InitContainers: []corev1.Container{
+				{
+					Name:            "agent-install",
+					Image:           opts.AgentImage,
+					Args:            []string{"agent", "install", agentDir},
+					SecurityContext: containerSecurity,
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: volumeAgent, MountPath: agentDir},
+					},
 				},
-			}},
+				{
+					// Runs on the template image so the image's own
+					// passwd and group entries are kept.
+					Name:            "identity",
+					Image:           tpl.Spec.Image,
+					Command:         []string{agentDir + "/agent", "identity", identityDir},
+					Env:             identityEnv,
+					SecurityContext: containerSecurity,
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: volumeAgent, MountPath: agentDir},
+					},
+				},
+			},
 			Containers: []corev1.Container{{
 				Name:            "sandbox",
 				Image:           tpl.Spec.Image,
@@ -205,6 +358,8 @@ func BuildPod(sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplat
 					{Name: volumeHome, MountPath: HomeMountPath},
 					{Name: volumeAgent, MountPath: agentDir, ReadOnly: true},
 					{Name: volumeHostKey, MountPath: HostKeyMountPath, ReadOnly: true},
+					{Name: volumeAgent, MountPath: "/etc/passwd", SubPath: "etc/passwd", ReadOnly: true},
+					{Name: volumeAgent, MountPath: "/etc/group", SubPath: "etc/group", ReadOnly: true},
 				},
 			}},
 			Volumes: []corev1.Volume{
@@ -237,6 +392,9 @@ func BuildPod(sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplat
 		},
 	}
 
+	if sb.Spec.Source != nil {
+		addSourceClone(pod, sb.Spec.Source, tpl.Spec.Image, containerSecurity)
+	}
 	if opts.PriorityClassName != "" {
 		pod.Spec.PriorityClassName = opts.PriorityClassName
 	}
@@ -246,6 +404,55 @@ func BuildPod(sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplat
 	return pod
 }
 
+// addSourceClone appends the init container that clones the source into
+// the home. It runs on the template image, whose git it uses, as the
+// sandbox user with the synthesized passwd entry (ssh requires one).
+func addSourceClone(pod *corev1.Pod, src *kubeparkv1alpha1.SourceSpec, image string, security *corev1.SecurityContext) {
+	env := []corev1.EnvVar{
+		{Name: "HOME", Value: HomeMountPath},
+		{Name: "KUBEPARK_SOURCE_URL", Value: src.URL},
+	}
+	if src.Ref != "" {
+		env = append(env, corev1.EnvVar{Name: "KUBEPARK_SOURCE_REF", Value: src.Ref})
+	}
+	if src.Dir != "" {
+		env = append(env, corev1.EnvVar{Name: "KUBEPARK_SOURCE_DIR", Value: src.Dir})
+	}
+	if src.Devcontainer != "" {
+		env = append(env, corev1.EnvVar{Name: "KUBEPARK_SOURCE_DEVCONTAINER", Value: src.Devcontainer})
+	}
+	mounts := []corev1.VolumeMount{
+		{Name: volumeHome, MountPath: HomeMountPath},
+		{Name: volumeAgent, MountPath: agentDir, ReadOnly: true},
+		{Name: volumeAgent, MountPath: "/etc/passwd", SubPath: "etc/passwd", ReadOnly: true},
+		{Name: volumeAgent, MountPath: "/etc/group", SubPath: "etc/group", ReadOnly: true},
+	}
+	if ref := src.CredentialsSecretRef; ref != nil && ref.Name != "" {
+		env = append(env, corev1.EnvVar{Name: "KUBEPARK_SOURCE_CREDENTIALS", Value: sourceCredentialsDir})
+		mounts = append(mounts, corev1.VolumeMount{Name: volumeSourceCredentials, MountPath: sourceCredentialsDir, ReadOnly: true})
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: volumeSourceCredentials,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName:  ref.Name,
+					DefaultMode: ptr.To(int32(0o400)),
+				},
+			},
+		})
+	}
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{
+		Name:            SourceContainerName,
+		Image:           image,
+		Command:         []string{agentDir + "/agent", "clone"},
+		Env:             env,
+		SecurityContext: security,
+		VolumeMounts:    mounts,
+		// The clone outcome is the termination message; a crash without
+		// one still explains itself through the log tail.
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	})
+}
+
 // BuildPVC renders the home PVC for a sandbox that does not use an existing
 // claim.
 func BuildPVC(sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplate) *corev1.PersistentVolumeClaim {
@@ -280,7 +487,13 @@ func BuildPVC(sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplat
 }
 
 // FQDNPrincipals returns the host-certificate principals clients may use to
-// reach this sandbox through the gateway.
-func FQDNPrincipals(sb *kubeparkv1alpha1.Sandbox) []string {
+// reach this sandbox through the gateway: <sandbox>.<namespace>, or only
+// <sandbox>.<namespace>.<cluster> when the cluster is a named member. Every
+// cluster's host CA is the same, so a member's certificate must not also
+// name the hub's same-named sandbox: its owner can read the host key.
+func FQDNPrincipals(sb *kubeparkv1alpha1.Sandbox, cluster string) []string {
+	if cluster != "" {
+		return []string{fmt.Sprintf("%s.%s.%s", sb.Name, sb.Namespace, cluster)}
+	}
 	return []string{fmt.Sprintf("%s.%s", sb.Name, sb.Namespace)}
 }
@@ -17,7 +17,9 @@ limitations under the License.
 package podspec
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -113,6 +115,282 @@ func TestBuildPod_AgentWrapsCommand(t *testing.T) {
 	}
 }
 
+// The agent drains its children on SIGTERM within the pod's grace period,
+// so the two must agree.
+func TestBuildPod_GracePeriodPassedToAgent(t *testing.T) {
+	pod := BuildPod(testSandbox(), testTemplate(), Options{AgentImage: testImage})
+	want := *pod.Spec.TerminationGracePeriodSeconds
+	for _, e := range pod.Spec.Containers[0].Env {
+		if e.Name == "KUBEPARK_GRACE_PERIOD_SECONDS" {
+			if e.Value != fmt.Sprint(want) {
+				t.Errorf("expected agent grace period %d, got %q", want, e.Value)
+			}
+			return
+		}
+	}
+	t.Error("expected KUBEPARK_GRACE_PERIOD_SECONDS in the sandbox env")
+}
+
+func TestBuildPod_AgentForwardingPolicy(t *testing.T) {
+	envValue := func(pod *corev1.Pod) string {
+		for _, e := range pod.Spec.Containers[0].Env {
+			if e.Name == "KUBEPARK_AGENT_FORWARDING" {
+				return e.Value
+			}
+		}
+		return ""
+	}
+	if got := envValue(BuildPod(testSandbox(), testTemplate(), Options{AgentImage: testImage})); got != "true" {
+		t.Errorf("expected agent forwarding enabled by default, got %q", got)
+	}
+	tpl := testTemplate()
+	tpl.Spec.SSH = &kubeparkv1alpha1.SSHPolicy{AgentForwarding: ptr.To(false)}
+	if got := envValue(BuildPod(testSandbox(), tpl, Options{AgentImage: testImage})); got != "false" {
+		t.Errorf("expected template policy to disable agent forwarding, got %q", got)
+	}
+}
+
+func TestBuildPod_AcceptEnvOnlyWhenSet(t *testing.T) {
+	find := func(pod *corev1.Pod) (string, bool) {
+		for _, e := range pod.Spec.Containers[0].Env {
+			if e.Name == "KUBEPARK_ACCEPT_ENV" {
+				return e.Value, true
+			}
+		}
+		return "", false
+	}
+	if _, ok := find(BuildPod(testSandbox(), testTemplate(), Options{AgentImage: testImage})); ok {
+		t.Error("expected the agent default allowlist when the template sets none")
+	}
+	tpl := testTemplate()
+	tpl.Spec.SSH = &kubeparkv1alpha1.SSHPolicy{AcceptEnv: []string{"LANG", "GIT_*"}}
+	if v, _ := find(BuildPod(testSandbox(), tpl, Options{AgentImage: testImage})); v != "LANG,GIT_*" {
+		t.Errorf("expected template allowlist passed to the agent, got %q", v)
+	}
+	tpl.Spec.SSH.AcceptEnv = []string{}
+	if v, ok := find(BuildPod(testSandbox(), tpl, Options{AgentImage: testImage})); !ok || v != "" {
+		t.Errorf("expected an explicit empty allowlist to be passed through, got %q (set=%v)", v, ok)
+	}
+}
+
+func TestBuildPod_SFTPMode(t *testing.T) {
+	tpl := testTemplate()
+	tpl.Spec.SSH = &kubeparkv1alpha1.SSHPolicy{SFTP: kubeparkv1alpha1.SFTPReadOnly}
+	pod := BuildPod(testSandbox(), tpl, Options{AgentImage: testImage})
+	for _, e := range pod.Spec.Containers[0].Env {
+		if e.Name == "KUBEPARK_SFTP" {
+			if e.Value != "readOnly" {
+				t.Errorf("expected SFTP mode readOnly, got %q", e.Value)
+			}
+			return
+		}
+	}
+	t.Error("expected KUBEPARK_SFTP in the sandbox env")
+}
+
+func TestBuildPod_CPUThreshold(t *testing.T) {
+	threshold := resource.MustParse("0.5")
+	tpl := testTemplate()
+	tpl.Spec.IdlePolicy = &kubeparkv1alpha1.IdlePolicy{
+		Signals:      []kubeparkv1alpha1.IdleSignal{kubeparkv1alpha1.IdleSignalCPU},
+		CPUThreshold: &threshold,
+	}
+	pod := BuildPod(testSandbox(), tpl, Options{AgentImage: testImage})
+	for _, e := range pod.Spec.Containers[0].Env {
+		if e.Name == "KUBEPARK_CPU_THRESHOLD_MILLICORES" {
+			if e.Value != "500" {
+				t.Errorf("expected 500 millicores, got %q", e.Value)
+			}
+			return
+		}
+	}
+	t.Error("expected KUBEPARK_CPU_THRESHOLD_MILLICORES in the sandbox env")
+}
+
+func TestBuildPod_Hooks(t *testing.T) {
+	tpl := testTemplate()
+	tpl.Spec.Hooks = &kubeparkv1alpha1.LifecycleHooks{
+		PostCreate: &kubeparkv1alpha1.LifecycleHook{
+			Command: []string{"make", "setup"},
+			Timeout: &metav1.Duration{Duration: 2 * time.Minute},
+		},
+	}
+	pod := BuildPod(testSandbox(), tpl, Options{AgentImage: testImage})
+	for _, e := range pod.Spec.Containers[0].Env {
+		if e.Name == "KUBEPARK_HOOKS" {
+			want := `{"postCreate":{"command":["make","setup"],"timeout":"2m0s"}}`
+			if e.Value != want {
+				t.Errorf("expected %s, got %s", want, e.Value)
+			}
+			return
+		}
+	}
+	t.Error("expected KUBEPARK_HOOKS in the sandbox env")
+}
+
+func TestBuildPod_Profile(t *testing.T) {
+	tpl := testTemplate()
+	profile := &kubeparkv1alpha1.UserProfileSpec{
+		Principal:      "alice@example.com",
+		Dotfiles:       &kubeparkv1alpha1.DotfilesSpec{URL: "https://github.com/alice/dotfiles.git"},
+		AuthorizedKeys: []string{"ssh-ed25519 AAAA1 ci", "ssh-ed25519 AAAA2 ide"},
+	}
+	pod := BuildPod(testSandbox(), tpl, Options{AgentImage: testImage, Profile: profile})
+	env := map[string]string{}
+	for _, e := range pod.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	if env["KUBEPARK_DOTFILES"] != `{"url":"https://github.com/alice/dotfiles.git"}` {
+		t.Errorf("unexpected KUBEPARK_DOTFILES %q", env["KUBEPARK_DOTFILES"])
+	}
+	if env["KUBEPARK_AUTHORIZED_KEYS"] != "ssh-ed25519 AAAA1 ci\nssh-ed25519 AAAA2 ide" {
+		t.Errorf("unexpected KUBEPARK_AUTHORIZED_KEYS %q", env["KUBEPARK_AUTHORIZED_KEYS"])
+	}
+
+	// Only what the pod carries is part of the snapshot.
+	if TemplateHash(&tpl.Spec, &kubeparkv1alpha1.UserProfileSpec{DefaultTemplate: "x"}) != TemplateHash(&tpl.Spec, nil) {
+		t.Error("a profile without dotfiles or keys must not change the hash")
+	}
+	if TemplateHash(&tpl.Spec, profile) == TemplateHash(&tpl.Spec, nil) {
+		t.Error("dotfiles and keys must change the hash")
+	}
+}
+
+func TestBuildPod_SourceClone(t *testing.T) {
+	sb := testSandbox()
+	sb.Spec.Source = &kubeparkv1alpha1.SourceSpec{
+		URL:                  "git@github.com:org/repo.git",
+		Ref:                  "main",
+		CredentialsSecretRef: &corev1.LocalObjectReference{Name: "deploy-key"},
+	}
+	pod := BuildPod(sb, testTemplate(), Options{AgentImage: testImage})
+	inits := pod.Spec.InitContainers
+	clone := inits[len(inits)-1]
+	if clone.Name != SourceContainerName || clone.Image != testTemplate().Spec.Image {
+		t.Fatalf("expected the clone to run last on the template image, got %s on %s", clone.Name, clone.Image)
+	}
+	env := map[string]string{}
+	for _, e := range clone.Env {
+		env[e.Name] = e.Value
+	}
+	if env["KUBEPARK_SOURCE_URL"] != sb.Spec.Source.URL || env["KUBEPARK_SOURCE_REF"] != "main" ||
+		env["KUBEPARK_SOURCE_CREDENTIALS"] != sourceCredentialsDir {
+		t.Errorf("unexpected clone env %v", env)
+	}
+	var secret string
+	for _, v := range pod.Spec.Volumes {
+		if v.Name == volumeSourceCredentials {
+			secret = v.Secret.SecretName
+		}
+	}
+	if secret != "deploy-key" {
+		t.Errorf("expected the credentials Secret to be mounted, got %q", secret)
+	}
+	for _, m := range pod.Spec.Containers[0].VolumeMounts {
+		if m.Name == volumeSourceCredentials {
+			t.Error("source credentials must not reach the sandbox container")
+		}
+	}
+}
+
+func TestBuildNetworkPolicy_OperatorReachesActivityOnly(t *testing.T) {
+	np := BuildNetworkPolicy(testSandbox(), testTemplate(), NetPolOptions{
+		GatewayNamespace:  "kubepark-gateway",
+		OperatorNamespace: "kubepark-system",
+	})
+	for _, rule := range np.Spec.Ingress {
+		peer := rule.From[0]
+		if peer.PodSelector.MatchLabels[LabelComponent] != ComponentOperator {
+			continue
+		}
+		if ns := peer.NamespaceSelector.MatchLabels[corev1.LabelMetadataName]; ns != "kubepark-system" {
+			t.Errorf("expected the operator namespace, got %q", ns)
+		}
+		if len(rule.Ports) != 1 || rule.Ports[0].Port.IntValue() != ActivityPort {
+			t.Errorf("operator must reach the activity port only, got %v", rule.Ports)
+		}
+		return
+	}
+	t.Error("expected an ingress rule for operator pods")
+}
+
+// With the reverse tunnel on, the agent learns the listener from its env
+// and its network policy lets it connect out to the gateway pods.
+func TestBuildPod_ReverseTunnel(t *testing.T) {
+	pod := BuildPod(testSandbox(), testTemplate(), Options{AgentImage: testImage, TunnelAddress: "gw.kubepark-system.svc:2224"})
+	found := false
+	for _, e := range pod.Spec.Containers[0].Env {
+		found = found || (e.Name == "KUBEPARK_TUNNEL_ADDR" && e.Value == "gw.kubepark-system.svc:2224")
+	}
+	if !found {
+		t.Error("expected KUBEPARK_TUNNEL_ADDR in the sandbox env")
+	}
+
+	np := BuildNetworkPolicy(testSandbox(), testTemplate(), NetPolOptions{
+		GatewayNamespace:  "kubepark-gateway",
+		OperatorNamespace: "kubepark-system",
+		TunnelPort:        2224,
+	})
+	for _, rule := range np.Spec.Egress {
+		peer := rule.To[0]
+		if peer.PodSelector == nil || peer.PodSelector.MatchLabels[LabelComponent] != ComponentGateway {
+			continue
+		}
+		if ns := peer.NamespaceSelector.MatchLabels[corev1.LabelMetadataName]; ns != "kubepark-gateway" {
+			t.Errorf("expected the gateway namespace, got %q", ns)
+		}
+		if len(rule.Ports) != 1 || rule.Ports[0].Port.IntValue() != 2224 {
+			t.Errorf("the agent must reach the tunnel port only, got %v", rule.Ports)
+		}
+		return
+	}
+	t.Error("expected an egress rule to the gateway's tunnel listener")
+}
+
+func TestBuildPod_SandboxUserIdentity(t *testing.T) {
+	tpl := testTemplate()
+	tpl.Spec.RunAsUser = ptr.To(int64(4242))
+	tpl.Spec.User = &kubeparkv1alpha1.SandboxUser{
+		Name:   "alice",
+		Shell:  "/bin/zsh",
+		Groups: []kubeparkv1alpha1.SandboxGroup{{Name: "docker", GID: 999}},
+	}
+	pod := BuildPod(testSandbox(), tpl, Options{AgentImage: testImage})
+
+	sc := pod.Spec.SecurityContext
+	if sc.RunAsGroup != nil || len(sc.SupplementalGroups) != 1 || sc.SupplementalGroups[0] != 999 {
+		t.Errorf("expected the image's primary group and supplemental [999], got %v %v", sc.RunAsGroup, sc.SupplementalGroups)
+	}
+
+	var identity *corev1.Container
+	for i := range pod.Spec.InitContainers {
+		if pod.Spec.InitContainers[i].Name == "identity" {
+			identity = &pod.Spec.InitContainers[i]
+		}
+	}
+	if identity == nil {
+		t.Fatal("expected an identity init container")
+	}
+	if identity.Image != tpl.Spec.Image {
+		t.Errorf("identity must run on the template image to keep its entries, got %q", identity.Image)
+	}
+	env := map[string]string{}
+	for _, e := range identity.Env {
+		env[e.Name] = e.Value
+	}
+	if env["KUBEPARK_USER"] != "alice" || env["SHELL"] != "/bin/zsh" || env["KUBEPARK_GROUPS"] != "docker:999" {
+		t.Errorf("unexpected identity env %v", env)
+	}
+
+	mounts := map[string]string{}
+	for _, m := range pod.Spec.Containers[0].VolumeMounts {
+		mounts[m.MountPath] = m.SubPath
+	}
+	if mounts["/etc/passwd"] != "etc/passwd" || mounts["/etc/group"] != "etc/group" {
+		t.Errorf("expected the generated passwd and group mounted over /etc, got %v", mounts)
+	}
+}
+
 func TestBuildPod_ServiceAccountMountsToken(t *testing.T) {
 	pod := BuildPod(testSandbox(), testTemplate(), Options{AgentImage: testImage, ServiceAccountName: "kubepark-sb-demo"})
 	if pod.Spec.ServiceAccountName != "kubepark-sb-demo" {
@@ -170,12 +448,12 @@ func TestBuildPVC_SizeOverride(t *testing.T) {
 
 func TestTemplateHash_StableAndSensitive(t *testing.T) {
 	tpl := testTemplate()
-	h1 := TemplateHash(&tpl.Spec)
-	if h1 != TemplateHash(&tpl.Spec) {
+	h1 := TemplateHash(&tpl.Spec, nil)
+	if h1 != TemplateHash(&tpl.Spec, nil) {
 		t.Error("hash must be stable for identical specs")
 	}
 	tpl.Spec.Image = "ghcr.io/example/ops:v2"
-	if h1 == TemplateHash(&tpl.Spec) {
+	if h1 == TemplateHash(&tpl.Spec, nil) {
 		t.Error("hash must change when the spec changes")
 	}
 }
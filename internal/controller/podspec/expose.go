@@ -0,0 +1,226 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podspec
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+// ExposeMode selects whether exposed ports are also published through the
+// cluster's own ingress, besides the kubepark gateway.
+type ExposeMode string
+
+const (
+	// ExposeGateway publishes exposed ports through the gateway only.
+	ExposeGateway ExposeMode = "gateway"
+	// ExposeIngress adds a Service and an Ingress per sandbox.
+	ExposeIngress ExposeMode = "ingress"
+	// ExposeHTTPRoute adds a Service per sandbox and a Gateway API
+	// HTTPRoute per exposed port.
+	ExposeHTTPRoute ExposeMode = "httproute"
+)
+
+// ParseExposeMode validates an expose mode flag value.
+func ParseExposeMode(s string) (ExposeMode, error) {
+	switch m := ExposeMode(s); m {
+	case ExposeGateway, ExposeIngress, ExposeHTTPRoute:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown expose mode %q (want gateway, ingress or httproute)", s)
+}
+
+// HTTPRouteGVK is the Gateway API HTTPRoute kind. It is handled
+// unstructured so the operator does not depend on the Gateway API module,
+// and runs on clusters without its CRDs unless asked to use them.
+var HTTPRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+
+// ExposeOptions carries the cluster-specific inputs of the ingress
+// objects.
+type ExposeOptions struct {
+	// BaseDomain is the parent of the routing hosts,
+	// <port>--<sandbox>--<namespace>.<baseDomain>, as on the gateway.
+	BaseDomain string
+	// IngressClassName is set on Ingresses when non-empty.
+	IngressClassName string
+	// Annotations are set on every Ingress or HTTPRoute, e.g. for the
+	// ingress controller's authentication.
+	Annotations map[string]string
+	// ParentNamespace, ParentName and ParentSection reference the Gateway
+	// that HTTPRoutes attach to.
+	ParentNamespace string
+	ParentName      string
+	ParentSection   string
+}
+
+// ServiceName names the per-sandbox Service of exposed ports.
+func ServiceName(sandbox string) string { return "kubepark-sb-" + sandbox }
+
+// IngressName names the per-sandbox Ingress.
+func IngressName(sandbox string) string { return "kubepark-sb-" + sandbox }
+
+// HTTPRouteName names the HTTPRoute of one exposed port.
+func HTTPRouteName(sandbox, port string) string { return "kubepark-sb-" + sandbox + "-" + port }
+
+// RouteHost returns the routing host of a port, or false when its label
+// does not fit in one DNS label, which the gateway would refuse as well.
+func RouteHost(sb *kubeparkv1alpha1.Sandbox, port, baseDomain string) (string, bool) {
+	label := port + "--" + sb.Name + "--" + sb.Namespace
+	if len(label) > 63 {
+		return "", false
+	}
+	return label + "." + strings.TrimPrefix(baseDomain, "."), true
+}
+
+// PublishedPorts filters ports down to those published through the
+// cluster's ingress: HTTP ports with auth none. The gateway's OIDC login,
+// share links and tokens do not apply there, so any other port would be
+// public.
+func PublishedPorts(ports []kubeparkv1alpha1.ExposedPort) []kubeparkv1alpha1.ExposedPort {
+	var out []kubeparkv1alpha1.ExposedPort
+	for _, p := range ports {
+		if p.Kind != kubeparkv1alpha1.ExposedPortTCP && p.Auth == kubeparkv1alpha1.AuthModeNone {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// BuildService renders the Service that ingress objects route through:
+// one named port per exposed port, selecting the sandbox pod.
+func BuildService(sb *kubeparkv1alpha1.Sandbox, ports []kubeparkv1alpha1.ExposedPort) *corev1.Service {
+	servicePorts := make([]corev1.ServicePort, 0, len(ports))
+	for _, p := range ports {
+		servicePorts = append(servicePorts, corev1.ServicePort{
+			Name:       p.Name,
+			Protocol:   corev1.ProtocolTCP,
+			Port:       p.Port,
+			TargetPort: intstr.FromInt32(p.Port),
+		})
+	}
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ServiceName(sb.Name),
+			Namespace: sb.Namespace,
+			Labels:    Labels(sb),
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Selector: map[string]string{
+				LabelSandboxUID: string(sb.UID),
+				LabelComponent:  ComponentSandbox,
+			},
+			Ports: servicePorts,
+		},
+	}
+}
+
+// BuildIngress renders one Ingress with a host rule per exposed port.
+func BuildIngress(sb *kubeparkv1alpha1.Sandbox, ports []kubeparkv1alpha1.ExposedPort, opts ExposeOptions) *networkingv1.Ingress {
+	pathType := networkingv1.PathTypePrefix
+	rules := make([]networkingv1.IngressRule, 0, len(ports))
+	for _, p := range ports {
+		host, ok := RouteHost(sb, p.Name, opts.BaseDomain)
+		if !ok {
+			continue
+		}
+		rules = append(rules, networkingv1.IngressRule{
+			Host: host,
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+				Paths: []networkingv1.HTTPIngressPath{{
+					Path:     "/",
+					PathType: &pathType,
+					Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+						Name: ServiceName(sb.Name),
+						Port: networkingv1.ServiceBackendPort{Name: p.Name},
+					}},
+				}},
+			}},
+		})
+	}
+	ing := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        IngressName(sb.Name),
+			Namespace:   sb.Namespace,
+			Labels:      Labels(sb),
+			Annotations: maps.Clone(opts.Annotations),
+		},
+		Spec: networkingv1.IngressSpec{Rules: rules},
+	}
+	if opts.IngressClassName != "" {
+		ing.Spec.IngressClassName = &opts.IngressClassName
+	}
+	return ing
+}
+
+// BuildHTTPRoutes renders an HTTPRoute per exposed port: HTTPRoute
+// hostnames apply to the whole route, so each host needs its own.
+func BuildHTTPRoutes(sb *kubeparkv1alpha1.Sandbox, ports []kubeparkv1alpha1.ExposedPort, opts ExposeOptions) []*unstructured.Unstructured {
+	parent := map[string]any{
+		"group": HTTPRouteGVK.Group,
+		"kind":  "Gateway",
+		"name":  opts.ParentName,
+	}
+	if opts.ParentNamespace != "" {
+		parent["namespace"] = opts.ParentNamespace
+	}
+	if opts.ParentSection != "" {
+		parent["sectionName"] = opts.ParentSection
+	}
+
+	routes := make([]*unstructured.Unstructured, 0, len(ports))
+	for _, p := range ports {
+		host, ok := RouteHost(sb, p.Name, opts.BaseDomain)
+		if !ok {
+			continue
+		}
+		route := &unstructured.Unstructured{Object: map[string]any{
+			"spec": map[string]any{
+				"parentRefs": []any{maps.Clone(parent)},
+				"hostnames":  []any{host},
+				"rules": []any{map[string]any{
+					"matches": []any{map[string]any{
+						"path": map[string]any{"type": "PathPrefix", "value": "/"},
+					}},
+					"backendRefs": []any{map[string]any{
+						"name": ServiceName(sb.Name),
+						"port": int64(p.Port),
+					}},
+				}},
+			},
+		}}
+		route.SetGroupVersionKind(HTTPRouteGVK)
+		route.SetName(HTTPRouteName(sb.Name, p.Name))
+		route.SetNamespace(sb.Namespace)
+		route.SetLabels(Labels(sb))
+		if len(opts.Annotations) > 0 {
+			route.SetAnnotations(maps.Clone(opts.Annotations))
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podspec
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+func exposedSandbox() *kubeparkv1alpha1.Sandbox {
+	sb := testSandbox()
+	sb.Spec.ExposedPorts = []kubeparkv1alpha1.ExposedPort{
+		{Name: "jupyter", Port: 8888, Auth: kubeparkv1alpha1.AuthModeOIDC},
+		{Name: "web", Port: 8080, Auth: kubeparkv1alpha1.AuthModeNone},
+	}
+	return sb
+}
+
+func TestRouteHost(t *testing.T) {
+	sb := exposedSandbox()
+	host, ok := RouteHost(sb, "jupyter", "sb.example.com")
+	if !ok || host != "jupyter--demo--alice.sb.example.com" {
+		t.Fatalf("RouteHost = %q, %v", host, ok)
+	}
+
+	sb.Namespace = strings.Repeat("n", 50)
+	if _, ok := RouteHost(sb, "jupyter", "sb.example.com"); ok {
+		t.Error("a label over 63 characters must not be routed")
+	}
+}
+
+func TestPublishedPorts(t *testing.T) {
+	sb := exposedSandbox()
+	sb.Spec.ExposedPorts = append(sb.Spec.ExposedPorts,
+		kubeparkv1alpha1.ExposedPort{Name: "db", Port: 5432, Kind: kubeparkv1alpha1.ExposedPortTCP, Auth: kubeparkv1alpha1.AuthModeNone})
+	// jupyter needs the gateway's login; the ingress would serve it to anyone.
+	if ports := PublishedPorts(sb.Spec.ExposedPorts); len(ports) != 1 || ports[0].Name != "web" {
+		t.Errorf("published = %+v, want web only", ports)
+	}
+}
+
+func TestBuildService_SelectsSandboxPod(t *testing.T) {
+	sb := exposedSandbox()
+	svc := BuildService(sb, sb.Spec.ExposedPorts)
+	if svc.Name != ServiceName("demo") || svc.Spec.Selector[LabelSandboxUID] != "uid-123" ||
+		svc.Spec.Selector[LabelComponent] != ComponentSandbox {
+		t.Errorf("service %s selects %v", svc.Name, svc.Spec.Selector)
+	}
+	if len(svc.Spec.Ports) != 2 || svc.Spec.Ports[0].Name != "jupyter" || svc.Spec.Ports[0].TargetPort.IntValue() != 8888 {
+		t.Errorf("ports = %+v", svc.Spec.Ports)
+	}
+}
+
+func TestBuildIngress_HostPerPort(t *testing.T) {
+	sb := exposedSandbox()
+	ing := BuildIngress(sb, sb.Spec.ExposedPorts, ExposeOptions{
+		BaseDomain:       "sb.example.com",
+		IngressClassName: "nginx",
+		Annotations:      map[string]string{"nginx.ingress.kubernetes.io/auth-url": "https://auth.example.com"},
+	})
+	if ing.Spec.IngressClassName == nil || *ing.Spec.IngressClassName != "nginx" {
+		t.Error("expected the ingress class")
+	}
+	if ing.Annotations["nginx.ingress.kubernetes.io/auth-url"] == "" {
+		t.Error("expected the configured annotations")
+	}
+	if len(ing.Spec.Rules) != 2 {
+		t.Fatalf("rules = %d, want one per port", len(ing.Spec.Rules))
+	}
+	rule := ing.Spec.Rules[1]
+	backend := rule.HTTP.Paths[0].Backend.Service
+	if rule.Host != "web--demo--alice.sb.example.com" || backend.Name != ServiceName("demo") || backend.Port.Name != "web" {
+		t.Errorf("rule %s routes to %+v", rule.Host, backend)
+	}
+}
+
+func TestBuildHTTPRoutes_OnePerPort(t *testing.T) {
+	sb := exposedSandbox()
+	routes := BuildHTTPRoutes(sb, sb.Spec.ExposedPorts, ExposeOptions{
+		BaseDomain: "sb.example.com", ParentNamespace: "infra", ParentName: "public", ParentSection: "https",
+	})
+	if len(routes) != 2 {
+		t.Fatalf("routes = %d, want one per port", len(routes))
+	}
+	route := routes[0]
+	if route.GroupVersionKind() != HTTPRouteGVK || route.GetName() != "kubepark-sb-demo-jupyter" ||
+		route.GetLabels()[LabelSandboxUID] != "uid-123" {
+		t.Errorf("route %s %v", route.GroupVersionKind(), route.GetName())
+	}
+	hosts, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+	if len(hosts) != 1 || hosts[0] != "jupyter--demo--alice.sb.example.com" {
+		t.Errorf("hostnames = %q", hosts)
+	}
+	parents, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	if parent := parents[0].(map[string]any); parent["namespace"] != "infra" || parent["name"] != "public" ||
+		parent["sectionName"] != "https" {
+		t.Errorf("parentRef = %v", parent)
+	}
+	rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+	backend := rules[0].(map[string]any)["backendRefs"].([]any)[0].(map[string]any)
+	if backend["name"] != ServiceName("demo") || backend["port"] != int64(8888) {
+		t.Errorf("backendRef = %v", backend)
+	}
+}
+
+func TestBuildNetworkPolicy_IngressControllerReachesExposedPorts(t *testing.T) {
+	sb := exposedSandbox()
+	sb.Spec.ExposedPorts = append(sb.Spec.ExposedPorts,
+		kubeparkv1alpha1.ExposedPort{Name: "db", Port: 5432, Kind: kubeparkv1alpha1.ExposedPortTCP})
+	np := BuildNetworkPolicy(sb, testTemplate(), NetPolOptions{
+		GatewayNamespace:  "kubepark-gateway",
+		OperatorNamespace: "kubepark-system",
+		IngressNamespace:  "ingress-nginx",
+	})
+	for _, rule := range np.Spec.Ingress {
+		peer := rule.From[0]
+		if peer.PodSelector != nil || peer.NamespaceSelector.MatchLabels[corev1.LabelMetadataName] != "ingress-nginx" {
+			continue
+		}
+		if len(rule.Ports) != 1 || rule.Ports[0].Port.IntValue() != 8080 {
+			t.Errorf("the ingress controller must reach the published ports only, got %v", rule.Ports)
+		}
+		if gateway := np.Spec.Ingress[0].Ports; len(gateway) != 4 || gateway[3].Port.IntValue() != 5432 {
+			t.Errorf("the gateway must reach TCP ports too, got %v", gateway)
+		}
+		return
+	}
+	t.Error("expected an ingress rule for the ingress controller")
+}
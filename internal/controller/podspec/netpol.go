@@ -17,6 +17,8 @@ limitations under the License.
 package podspec
 
 import (
+	"slices"
+
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -29,6 +31,10 @@ import (
 // ingress is restricted to pods carrying it.
 const ComponentGateway = "gateway"
 
+// ComponentOperator is the LabelComponent value on operator pods, which
+// poll the agent's activity endpoint.
+const ComponentOperator = "operator"
+
 // APIServerEndpoint is one resolved address of the Kubernetes API server.
 type APIServerEndpoint struct {
 	IP   string
@@ -40,6 +46,21 @@ type APIServerEndpoint struct {
 type NetPolOptions struct {
 	// GatewayNamespace is where gateway pods run (ingress allowance).
 	GatewayNamespace string
+	// OperatorNamespace is where operator pods run (activity polling).
+	OperatorNamespace string
+	// IngressNamespace, when set, is where the cluster's ingress controller
+	// runs; it may reach the exposed ports, not the agent.
+	IngressNamespace string
+	// ExtraPorts are exposed besides spec.exposedPorts (see
+	// Options.ExtraPorts).
+	ExtraPorts []kubeparkv1alpha1.ExposedPort
+	// TunnelPort, when set, is the gateway's reverse-tunnel port, which
+	// the agent connects out to.
+	TunnelPort int32
+	// TunnelRemote lets the tunnel leave the cluster, for a member cluster
+	// whose gateway runs in another: the tunnel port is allowed to any
+	// destination rather than to the gateway pods.
+	TunnelRemote bool
 	// APIServerEndpoints are the resolved kubernetes.default endpoints.
 	// A static egress rule cannot express "the API server" portably, so
 	// the controller resolves the Endpoints object and keeps this fresh.
@@ -47,8 +68,10 @@ type NetPolOptions struct {
 }
 
 // BuildNetworkPolicy renders the per-sandbox policy: default-deny both
-// directions, ingress only from the gateway, egress to DNS, the API server
-// and whatever the template allows.
+// directions, ingress only from the gateway (and the operator, to the
+// activity port, and any ingress controller, to the exposed HTTP ports),
+// egress to DNS, the API server, the gateway's tunnel listener and whatever
+// the template allows.
 func BuildNetworkPolicy(sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplate, opts NetPolOptions) *networkingv1.NetworkPolicy {
 	protoTCP := corev1.ProtocolTCP
 	protoUDP := corev1.ProtocolUDP
@@ -66,14 +89,59 @@ func BuildNetworkPolicy(sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.Sand
 			},
 		},
 	}
-	ingressPorts := make([]networkingv1.NetworkPolicyPort, 0, 1+len(sb.Spec.ExposedPorts))
+	exposed := append(slices.Clip(sb.Spec.ExposedPorts), opts.ExtraPorts...)
+	ingressPorts := make([]networkingv1.NetworkPolicyPort, 0, 1+len(exposed))
 	ingressPorts = append(ingressPorts, networkingv1.NetworkPolicyPort{Protocol: &protoTCP, Port: ptrIntStr(AgentPort)})
-	for _, p := range sb.Spec.ExposedPorts {
+	for _, p := range exposed {
 		ingressPorts = append(ingressPorts, networkingv1.NetworkPolicyPort{
 			Protocol: &protoTCP, Port: ptrIntStr(p.Port),
 		})
 	}
 
+	// Ingress: operator pods, to the agent's activity endpoint only.
+	operatorPeer := networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				corev1.LabelMetadataName: opts.OperatorNamespace,
+			},
+		},
+		PodSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				LabelComponent: ComponentOperator,
+			},
+		},
+	}
+
+	ingressRules := []networkingv1.NetworkPolicyIngressRule{
+		{
+			From:  []networkingv1.NetworkPolicyPeer{gatewayPeer},
+			Ports: ingressPorts,
+		},
+		{
+			From:  []networkingv1.NetworkPolicyPeer{operatorPeer},
+			Ports: []networkingv1.NetworkPolicyPort{{Protocol: &protoTCP, Port: ptrIntStr(ActivityPort)}},
+		},
+	}
+	// Ingress: the ingress controller, when ports are published through
+	// it, to the published ports only; TCP ports are reached through the
+	// gateway's SSH jump host, and authenticated ones through the gateway.
+	var httpPorts []networkingv1.NetworkPolicyPort
+	for _, p := range PublishedPorts(exposed) {
+		httpPorts = append(httpPorts, networkingv1.NetworkPolicyPort{Protocol: &protoTCP, Port: ptrIntStr(p.Port)})
+	}
+	if opts.IngressNamespace != "" && len(httpPorts) > 0 {
+		ingressRules = append(ingressRules, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{{
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						corev1.LabelMetadataName: opts.IngressNamespace,
+					},
+				},
+			}},
+			Ports: httpPorts,
+		})
+	}
+
 	// Egress: DNS to kube-dns.
 	dnsPort := intstr.FromInt32(53)
 	dnsRule := networkingv1.NetworkPolicyEgressRule{
@@ -93,9 +161,20 @@ func BuildNetworkPolicy(sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.Sand
 		},
 	}
 
-	egress := make([]networkingv1.NetworkPolicyEgressRule, 0, 1+len(opts.APIServerEndpoints)+len(tpl.Spec.Egress))
+	egress := make([]networkingv1.NetworkPolicyEgressRule, 0, 2+len(opts.APIServerEndpoints)+len(tpl.Spec.Egress))
 	egress = append(egress, dnsRule)
 
+	// Egress: the agent's reverse tunnel to the gateway pods.
+	if opts.TunnelPort != 0 {
+		rule := networkingv1.NetworkPolicyEgressRule{
+			Ports: []networkingv1.NetworkPolicyPort{{Protocol: &protoTCP, Port: ptrIntStr(opts.TunnelPort)}},
+		}
+		if !opts.TunnelRemote {
+			rule.To = []networkingv1.NetworkPolicyPeer{gatewayPeer}
+		}
+		egress = append(egress, rule)
+	}
+
 	// Egress: the API server, resolved to concrete endpoints. Without this
 	// the injected ServiceAccount credentials are useless (and on CNIs
 	// that enforce NetworkPolicy, kubectl inside the sandbox hangs).
@@ -133,11 +212,8 @@ func BuildNetworkPolicy(sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.Sand
 				networkingv1.PolicyTypeIngress,
 				networkingv1.PolicyTypeEgress,
 			},
-			Ingress: []networkingv1.NetworkPolicyIngressRule{{
-				From:  []networkingv1.NetworkPolicyPeer{gatewayPeer},
-				Ports: ingressPorts,
-			}},
-			Egress: egress,
+			Ingress: ingressRules,
+			Egress:  egress,
 		},
 	}
 }
@@ -17,8 +17,12 @@ limitations under the License.
 package controller
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"net"
+	"slices"
+	"strconv"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -27,8 +31,10 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -68,6 +74,26 @@ type SandboxReconciler struct {
 	// GatewayNamespace is where gateway pods run; defaults to the operator
 	// namespace.
 	GatewayNamespace string
+	// Agent talks to sandbox agents; defaults to their HTTP endpoint.
+	Agent AgentClient
+	// ExposeMode publishes exposed ports through the cluster's ingress
+	// besides the gateway; defaults to the gateway only.
+	ExposeMode podspec.ExposeMode
+	// Expose configures the Ingresses or HTTPRoutes of ExposeMode.
+	Expose podspec.ExposeOptions
+	// IngressNamespace is where the ingress controller runs; sandbox
+	// network policies let it reach the exposed ports.
+	IngressNamespace string
+	// TunnelAddress is the gateway's reverse-tunnel listener, as agents
+	// dial it. When set, agents keep a tunnel open and sandbox network
+	// policies let them reach the gateway pods on its port.
+	TunnelAddress string
+	// ClusterName names this cluster when it is a member of a gateway in
+	// another (its ClusterRegistration's name there). Sandboxes' tunnels
+	// then carry it, and that gateway signs their host keys.
+	ClusterName string
+	// Recorder emits events for hook outcomes when set.
+	Recorder events.EventRecorder
 	// Now is overridable in tests; defaults to time.Now.
 	Now func() time.Time
 }
@@ -84,8 +110,18 @@ type SandboxReconciler struct {
 // +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;create;update;delete
 // +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=kubepark.dev,resources=accessprofiles,verbs=get;list;watch
+// The gateway shares the operator's ServiceAccount and creates profiles on
+// first login.
+// +kubebuilder:rbac:groups=kubepark.dev,resources=userprofiles,verbs=get;list;watch;create
+// The gateway reads AccessTargets to forward bastion connections.
+// +kubebuilder:rbac:groups=kubepark.dev,resources=accesstargets,verbs=get;list;watch
+// The gateway reads ClusterRegistrations to reach member clusters.
+// +kubebuilder:rbac:groups=kubepark.dev,resources=clusterregistrations,verbs=get;list;watch
+// The gateway port-forwards to sandbox pods it has no route to.
+// +kubebuilder:rbac:groups="",resources=pods/portforward,verbs=get;create
 // +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings,verbs=get;list;watch;create;update;patch;delete;bind
 
 // Reconcile drives the sandbox state machine. The pod is a disposable
@@ -127,6 +163,28 @@ func (r *SandboxReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 // children to the cluster but only mutates status in memory; the caller
 // persists it once.
 func (r *SandboxReconciler) reconcileSandbox(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, status *kubeparkv1alpha1.SandboxStatus) (ctrl.Result, error) {
+	// The owner's profile supplies a missing template and personalizes
+	// the one in use.
+	profile, err := r.userProfile(ctx, sb.Spec.Owner.Name)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if sb.Spec.Template == "" {
+		if profile == nil || profile.Spec.DefaultTemplate == "" {
+			status.Phase = kubeparkv1alpha1.SandboxPhasePending
+			r.setCondition(sb, status, kubeparkv1alpha1.ConditionReady, metav1.ConditionFalse,
+				kubeparkv1alpha1.ReasonNoTemplate,
+				fmt.Sprintf("spec.template is empty and no UserProfile of %q sets defaultTemplate", sb.Spec.Owner.Name))
+			return ctrl.Result{}, nil
+		}
+		// Recorded in the spec, so a later change of the default never
+		// moves an existing sandbox to another template.
+		sb.Spec.Template = profile.Spec.DefaultTemplate
+		if err := r.Update(ctx, sb); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
 	// Resolve the template; without it nothing can be provisioned.
 	var tpl kubeparkv1alpha1.SandboxTemplate
 	if err := r.Get(ctx, types.NamespacedName{Name: sb.Spec.Template}, &tpl); err != nil {
@@ -139,18 +197,35 @@ func (r *SandboxReconciler) reconcileSandbox(ctx context.Context, sb *kubeparkv1
 		}
 		return ctrl.Result{}, err
 	}
+	// A devcontainer.json, from the template or the cloned source, is
+	// applied over the template; everything below works on the result.
+	tpl = *r.applyDevcontainer(sb, &tpl, status)
+	tpl = *applyUserProfile(&tpl, profile)
+	clearProfileConditions(profile, status)
 
 	// Home volume, including the shared-claim guard.
-	requeue, err := r.reconcileHome(ctx, sb, status)
+	requeue, err := r.reconcileHome(ctx, sb, &tpl, status)
 	if err != nil || requeue != nil {
 		return valueOr(requeue), err
 	}
 
-	// Host key (stable across suspend/resume) and network policy.
-	if err := r.reconcileHostKey(ctx, sb); err != nil {
+	// Host key (stable across suspend/resume), network policy and any
+	// ingress routes.
+	signed, err := r.reconcileHostKey(ctx, sb)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
-	if err := r.reconcileNetworkPolicy(ctx, sb, &tpl); err != nil {
+	if !signed {
+		// The update of the Secret reconciles the sandbox again.
+		status.Phase = kubeparkv1alpha1.SandboxPhasePending
+		r.setCondition(sb, status, kubeparkv1alpha1.ConditionReady, metav1.ConditionFalse,
+			kubeparkv1alpha1.ReasonProvisioning, "waiting for the hub's gateway to sign the host certificate")
+		return ctrl.Result{}, nil
+	}
+	if err := r.reconcileNetworkPolicy(ctx, sb, &tpl, devcontainerPorts(status)); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileExposure(ctx, sb, devcontainerPorts(status)); err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -168,9 +243,9 @@ func (r *SandboxReconciler) reconcileSandbox(ctx context.Context, sb *kubeparkv1
 	}
 
 	// Desired-state machine.
-	currentHash := podspec.TemplateHash(&tpl.Spec)
+	currentHash := podspec.TemplateHash(&tpl.Spec, profileSpec(profile))
 	if sb.Spec.DesiredState == kubeparkv1alpha1.DesiredStateStopped {
-		return r.suspend(ctx, sb, status)
+		return r.suspend(ctx, sb, &tpl, status)
 	}
 
 	// Idle suspension. The suspend decision is always computed from the
@@ -182,24 +257,124 @@ func (r *SandboxReconciler) reconcileSandbox(ctx context.Context, sb *kubeparkv1
 	status.ActiveSessions = int32(active)
 
 	timeout := effectiveIdleTimeout(sb, &tpl)
-	if active == 0 && idleExpired(status.LastActivityTime, timeout) {
-		return r.suspend(ctx, sb, status)
+	signals := idleSignals(&tpl)
+	if timeout > 0 && usesAgentSignals(signals) &&
+		status.Phase == kubeparkv1alpha1.SandboxPhaseRunning && status.PodIP != "" {
+		r.recordActivity(ctx, status)
+	}
+	// An open session always wakes a sandbox that is not running; while it
+	// runs, sessions only keep it alive if the idle policy says so.
+	busy := active > 0 && (status.Phase != kubeparkv1alpha1.SandboxPhaseRunning ||
+		slices.Contains(signals, kubeparkv1alpha1.IdleSignalSessions))
+	last := lastActivity(signals, status)
+	if !busy && idleExpired(last, timeout) {
+		if active > 0 {
+			// Close the sessions the policy overrode, dated at the last
+			// activity, so they neither wake the sandbox again nor move its
+			// idle clock.
+			if err := r.closeSessions(ctx, sb, kubeparkv1alpha1.ExitReasonIdle, *last); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return r.suspend(ctx, sb, &tpl, status)
 	}
 
-	result, err := r.run(ctx, sb, &tpl, currentHash, rbac.ServiceAccount, status)
+	result, err := r.run(ctx, sb, &tpl, profile, currentHash, rbac.ServiceAccount, status)
 	if err != nil {
 		return result, err
 	}
 	// While running and idle-eligible, requeue at the idle deadline so the
-	// sandbox suspends even without another event.
-	if result.RequeueAfter == 0 && active == 0 && timeout > 0 &&
-		status.Phase == kubeparkv1alpha1.SandboxPhaseRunning && status.LastActivityTime != nil {
-		remaining := max(timeout-r.now().Sub(status.LastActivityTime.Time), time.Second)
-		result.RequeueAfter = remaining
+	// sandbox suspends even without another event. Agent signals are polled
+	// again then, pushing the deadline out if there was activity.
+	if result.RequeueAfter == 0 && !busy && timeout > 0 &&
+		status.Phase == kubeparkv1alpha1.SandboxPhaseRunning {
+		if last = lastActivity(signals, status); last != nil {
+			result.RequeueAfter = max(timeout-r.now().Sub(last.Time), time.Second)
+		}
+	}
+	if status.Phase == kubeparkv1alpha1.SandboxPhaseRunning && status.PodIP != "" &&
+		r.reconcileStartHooks(ctx, sb, &tpl, profile, status) {
+		if result.RequeueAfter == 0 || result.RequeueAfter > hookPollInterval {
+			result.RequeueAfter = hookPollInterval
+		}
 	}
 	return result, nil
 }
 
+// idleSignals returns the template's idle policy signals, defaulting to
+// open sessions.
+func idleSignals(tpl *kubeparkv1alpha1.SandboxTemplate) []kubeparkv1alpha1.IdleSignal {
+	if tpl.Spec.IdlePolicy == nil || len(tpl.Spec.IdlePolicy.Signals) == 0 {
+		return []kubeparkv1alpha1.IdleSignal{kubeparkv1alpha1.IdleSignalSessions}
+	}
+	return tpl.Spec.IdlePolicy.Signals
+}
+
+// usesAgentSignals reports whether any signal is reported by the agent
+// rather than derived from SandboxSessions.
+func usesAgentSignals(signals []kubeparkv1alpha1.IdleSignal) bool {
+	for _, s := range signals {
+		if s != kubeparkv1alpha1.IdleSignalSessions {
+			return true
+		}
+	}
+	return false
+}
+
+// lastActivity is the latest of lastActivityTime (start of Running and
+// session closes) and the agent timestamps the policy selects.
+func lastActivity(signals []kubeparkv1alpha1.IdleSignal, status *kubeparkv1alpha1.SandboxStatus) *metav1.Time {
+	last := status.LastActivityTime
+	if status.Activity == nil {
+		return last
+	}
+	for _, s := range signals {
+		switch s {
+		case kubeparkv1alpha1.IdleSignalInput:
+			last = laterTime(last, status.Activity.LastInputTime)
+		case kubeparkv1alpha1.IdleSignalCPU:
+			last = laterTime(last, status.Activity.LastCPUTime)
+		case kubeparkv1alpha1.IdleSignalPortForward:
+			last = laterTime(last, status.Activity.LastPortForwardTime)
+		}
+	}
+	return last
+}
+
+func laterTime(a, b *metav1.Time) *metav1.Time {
+	if a == nil || (b != nil && b.After(a.Time)) {
+		return b
+	}
+	return a
+}
+
+// recordActivity merges the agent's latest report into status.Activity.
+// Timestamps only move forward: a restarted agent reports nothing yet. A
+// failed probe keeps the previous report and is retried on the next
+// reconcile.
+func (r *SandboxReconciler) recordActivity(ctx context.Context, status *kubeparkv1alpha1.SandboxStatus) {
+	act, err := r.agent().Activity(ctx, status.PodIP)
+	if err != nil {
+		logf.FromContext(ctx).V(1).Info("Probing agent activity failed", "podIP", status.PodIP, "error", err.Error())
+		return
+	}
+	toMeta := func(t *time.Time) *metav1.Time {
+		if t == nil {
+			return nil
+		}
+		mt := metav1.NewTime(*t)
+		return &mt
+	}
+	merged := kubeparkv1alpha1.SandboxActivity{}
+	if status.Activity != nil {
+		merged = *status.Activity
+	}
+	merged.LastInputTime = laterTime(merged.LastInputTime, toMeta(act.LastInput))
+	merged.LastCPUTime = laterTime(merged.LastCPUTime, toMeta(act.LastCPU))
+	merged.LastPortForwardTime = laterTime(merged.LastPortForwardTime, toMeta(act.LastPortForward))
+	status.Activity = &merged
+}
+
 // activeSessionCount counts live Active sessions for the sandbox from the
 // API server (never from status).
 func (r *SandboxReconciler) activeSessionCount(ctx context.Context, sb *kubeparkv1alpha1.Sandbox) (int, error) {
@@ -248,7 +423,7 @@ func (r *SandboxReconciler) now() time.Time {
 
 // reconcileHome ensures the home PVC. A non-nil result means "stop this
 // reconcile and requeue accordingly".
-func (r *SandboxReconciler) reconcileHome(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, status *kubeparkv1alpha1.SandboxStatus) (*ctrl.Result, error) {
+func (r *SandboxReconciler) reconcileHome(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplate, status *kubeparkv1alpha1.SandboxStatus) (*ctrl.Result, error) {
 	claim := podspec.PVCName(sb.Name)
 	if sb.Spec.Home != nil && sb.Spec.Home.ExistingClaim != "" {
 		claim = sb.Spec.Home.ExistingClaim
@@ -277,17 +452,13 @@ func (r *SandboxReconciler) reconcileHome(ctx context.Context, sb *kubeparkv1alp
 			return nil, err
 		}
 	} else {
-		var tpl kubeparkv1alpha1.SandboxTemplate
-		if err := r.Get(ctx, types.NamespacedName{Name: sb.Spec.Template}, &tpl); err != nil {
-			return nil, err
-		}
 		var pvc corev1.PersistentVolumeClaim
 		err := r.Get(ctx, types.NamespacedName{Namespace: sb.Namespace, Name: claim}, &pvc)
 		if apierrors.IsNotFound(err) {
 			// No owner reference on purpose: the PVC's lifecycle is
 			// independent of the Sandbox; the finalizer applies the retain
 			// policy explicitly.
-			if err := r.Create(ctx, podspec.BuildPVC(sb, &tpl)); err != nil && !apierrors.IsAlreadyExists(err) {
+			if err := r.Create(ctx, podspec.BuildPVC(sb, tpl)); err != nil && !apierrors.IsAlreadyExists(err) {
 				return nil, err
 			}
 		} else if err != nil {
@@ -358,75 +529,157 @@ func ownerOfGeneratedClaim(claim string) (string, bool) {
 }
 
 // reconcileHostKey creates the per-sandbox host key Secret once, signed by
-// the host CA, so the host identity is stable across suspend/resume.
-func (r *SandboxReconciler) reconcileHostKey(ctx context.Context, sb *kubeparkv1alpha1.Sandbox) error {
+// the host CA, so the host identity is stable across suspend/resume. It
+// reports false while a member cluster's certificate waits for the hub.
+func (r *SandboxReconciler) reconcileHostKey(ctx context.Context, sb *kubeparkv1alpha1.Sandbox) (bool, error) {
+	if r.ClusterName != "" {
+		return r.reconcileMemberHostKey(ctx, sb)
+	}
 	name := podspec.HostKeyName(sb.Name)
+	principals := podspec.FQDNPrincipals(sb, r.ClusterName)
 	var existing corev1.Secret
 	err := r.Get(ctx, types.NamespacedName{Namespace: sb.Namespace, Name: name}, &existing)
-	if err == nil {
-		return nil
+	if err == nil && len(existing.Data[KeyHostCAPublic]) > 0 && certHasPrincipals(existing.Data[keyHostCert], principals) {
+		return true, nil
 	}
-	if !apierrors.IsNotFound(err) {
-		return err
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false, err
 	}
 
 	caSecret, err := EnsureCASecret(ctx, r.Client, OperatorNamespace())
 	if err != nil {
-		return err
+		return false, err
 	}
 	hostCA, err := sshca.ParseSigner(caSecret.Data[KeyHostCAPrivate])
 	if err != nil {
-		return fmt.Errorf("parse host CA: %w", err)
+		return false, fmt.Errorf("parse host CA: %w", err)
+	}
+	if existing.Name != "" {
+		// Secrets from before the reverse tunnel lack the host CA the
+		// agent verifies the gateway with; the agent picks the
+		// certificate up when it next starts.
+		if existing.Data == nil {
+			existing.Data = map[string][]byte{}
+		}
+		existing.Data[KeyHostCAPublic] = caSecret.Data[KeyHostCAPublic]
+		if !certHasPrincipals(existing.Data[keyHostCert], principals) {
+			hostPub, err := sshca.ParsePublicKey(existing.Data[keyHostPublic])
+			if err != nil {
+				return false, fmt.Errorf("parse host key: %w", err)
+			}
+			cert, err := sshca.SignHostCert(hostCA, hostPub, principals, hostCertValidity, time.Now())
+			if err != nil {
+				return false, err
+			}
+			existing.Data[keyHostCert] = marshalCert(cert)
+		}
+		return true, r.Update(ctx, &existing)
 	}
-	// The user CA PUBLIC key travels with the host key so the agent can
-	// verify client certificates. The private user CA key never leaves the
-	// operator namespace (H3).
-	userCAPub := caSecret.Data[KeyUserCAPublic]
 
 	key, err := sshca.GenerateKeyPair("kubepark-host-" + sb.Name)
 	if err != nil {
-		return err
+		return false, err
 	}
 	hostPub, err := sshca.ParsePublicKey(key.PublicAuthorized)
 	if err != nil {
-		return err
+		return false, err
 	}
-	cert, err := sshca.SignHostCert(hostCA, hostPub, podspec.FQDNPrincipals(sb), hostCertValidity, time.Now())
+	cert, err := sshca.SignHostCert(hostCA, hostPub, principals, hostCertValidity, time.Now())
 	if err != nil {
-		return err
+		return false, err
+	}
+	secret := hostKeySecret(sb, key, caSecret)
+	secret.Data[keyHostCert] = marshalCert(cert)
+	if err := controllerutil.SetControllerReference(sb, secret, r.Scheme); err != nil {
+		return false, err
 	}
+	if err := r.Create(ctx, secret); err != nil && !apierrors.IsAlreadyExists(err) {
+		return false, err
+	}
+	return true, nil
+}
 
-	secret := &corev1.Secret{
+// reconcileMemberHostKey creates a member cluster's host key Secret, whose
+// certificate the hub's gateway signs: a member holds only the public
+// halves of the hub's CAs. A certificate for any other principal, such as
+// one signed before the cluster was named, is dropped so the agent cannot
+// present it.
+func (r *SandboxReconciler) reconcileMemberHostKey(ctx context.Context, sb *kubeparkv1alpha1.Sandbox) (bool, error) {
+	var caSecret corev1.Secret
+	if err := r.Get(ctx, types.NamespacedName{Namespace: OperatorNamespace(), Name: CASecretName}, &caSecret); err != nil {
+		return false, fmt.Errorf("get the hub's CA public keys from Secret %s/%s: %w",
+			OperatorNamespace(), CASecretName, err)
+	}
+	principals := podspec.FQDNPrincipals(sb, r.ClusterName)
+	var existing corev1.Secret
+	err := r.Get(ctx, types.NamespacedName{Namespace: sb.Namespace, Name: podspec.HostKeyName(sb.Name)}, &existing)
+	if apierrors.IsNotFound(err) {
+		key, err := sshca.GenerateKeyPair("kubepark-host-" + sb.Name)
+		if err != nil {
+			return false, err
+		}
+		secret := hostKeySecret(sb, key, &caSecret)
+		if err := controllerutil.SetControllerReference(sb, secret, r.Scheme); err != nil {
+			return false, err
+		}
+		if err := r.Create(ctx, secret); err != nil && !apierrors.IsAlreadyExists(err) {
+			return false, err
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	signed := certHasPrincipals(existing.Data[keyHostCert], principals)
+	if bytes.Equal(existing.Data[KeyHostCAPublic], caSecret.Data[KeyHostCAPublic]) &&
+		(signed || len(existing.Data[keyHostCert]) == 0) {
+		return signed, nil
+	}
+	if existing.Data == nil {
+		existing.Data = map[string][]byte{}
+	}
+	existing.Data[KeyHostCAPublic] = caSecret.Data[KeyHostCAPublic]
+	if !signed {
+		delete(existing.Data, keyHostCert)
+	}
+	return signed, r.Update(ctx, &existing)
+}
+
+// hostKeySecret is the host key Secret of sb holding key. The user CA
+// PUBLIC key travels with the host key so the agent can verify client
+// certificates, and the host CA's so it can verify the gateway's tunnel
+// listener. The private keys never leave the operator namespace (H3).
+func hostKeySecret(sb *kubeparkv1alpha1.Sandbox, key *sshca.KeyPair, caSecret *corev1.Secret) *corev1.Secret {
+	return &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
+			Name:      podspec.HostKeyName(sb.Name),
 			Namespace: sb.Namespace,
 			Labels:    podspec.Labels(sb),
 		},
 		Data: map[string][]byte{
-			"ssh_host_ed25519_key":          key.PrivatePEM,
-			"ssh_host_ed25519_key.pub":      key.PublicAuthorized,
-			"ssh_host_ed25519_key-cert.pub": marshalCert(cert),
-			"user-ca.pub":                   userCAPub,
+			"ssh_host_ed25519_key": key.PrivatePEM,
+			keyHostPublic:          key.PublicAuthorized,
+			"user-ca.pub":          caSecret.Data[KeyUserCAPublic],
+			KeyHostCAPublic:        caSecret.Data[KeyHostCAPublic],
 		},
 	}
-	if err := controllerutil.SetControllerReference(sb, secret, r.Scheme); err != nil {
-		return err
-	}
-	if err := r.Create(ctx, secret); err != nil && !apierrors.IsAlreadyExists(err) {
-		return err
-	}
-	return nil
 }
 
 // reconcileNetworkPolicy keeps the default-deny policy (with built-in DNS
 // and API-server egress) in sync.
-func (r *SandboxReconciler) reconcileNetworkPolicy(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplate) error {
+func (r *SandboxReconciler) reconcileNetworkPolicy(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplate, extraPorts []kubeparkv1alpha1.ExposedPort) error {
 	endpoints, err := r.apiServerEndpoints(ctx)
 	if err != nil {
 		return err
 	}
 	desired := podspec.BuildNetworkPolicy(sb, tpl, podspec.NetPolOptions{
 		GatewayNamespace:   r.gatewayNamespace(),
+		OperatorNamespace:  OperatorNamespace(),
+		IngressNamespace:   r.IngressNamespace,
+		TunnelPort:         r.tunnelPort(),
+		TunnelRemote:       r.ClusterName != "",
+		ExtraPorts:         extraPorts,
 		APIServerEndpoints: endpoints,
 	})
 	if err := controllerutil.SetControllerReference(sb, desired, r.Scheme); err != nil {
@@ -477,7 +730,7 @@ func (r *SandboxReconciler) apiServerEndpoints(ctx context.Context) ([]podspec.A
 }
 
 // suspend deletes the pod while keeping PVC, host key, RBAC and route.
-func (r *SandboxReconciler) suspend(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, status *kubeparkv1alpha1.SandboxStatus) (ctrl.Result, error) {
+func (r *SandboxReconciler) suspend(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplate, status *kubeparkv1alpha1.SandboxStatus) (ctrl.Result, error) {
 	// The gateway must not dial a terminating pod (R2-L-B).
 	status.PodIP = ""
 
@@ -497,6 +750,14 @@ func (r *SandboxReconciler) suspend(ctx context.Context, sb *kubeparkv1alpha1.Sa
 	}
 
 	status.Phase = kubeparkv1alpha1.SandboxPhaseSuspending
+	// Give the preSuspend hook its chance before the pod goes away. New
+	// connections are already refused, as the pod IP is cleared.
+	if hooks := tpl.Spec.Hooks; hooks != nil && hooks.PreSuspend != nil &&
+		pod.DeletionTimestamp.IsZero() && podReady(&pod) {
+		if !r.runPreSuspend(ctx, sb, hooks.PreSuspend, status, pod.Status.PodIP) {
+			return ctrl.Result{RequeueAfter: hookPollInterval}, nil
+		}
+	}
 	if pod.DeletionTimestamp.IsZero() {
 		if err := r.Delete(ctx, &pod); err != nil && !apierrors.IsNotFound(err) {
 			return ctrl.Result{}, err
@@ -506,7 +767,7 @@ func (r *SandboxReconciler) suspend(ctx context.Context, sb *kubeparkv1alpha1.Sa
 }
 
 // run ensures the executor pod exists and reflects pod state into status.
-func (r *SandboxReconciler) run(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplate, currentHash, serviceAccount string, status *kubeparkv1alpha1.SandboxStatus) (ctrl.Result, error) {
+func (r *SandboxReconciler) run(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplate, profile *kubeparkv1alpha1.UserProfile, currentHash, serviceAccount string, status *kubeparkv1alpha1.SandboxStatus) (ctrl.Result, error) {
 	var pod corev1.Pod
 	err := r.Get(ctx, types.NamespacedName{Namespace: sb.Namespace, Name: podspec.PodName(sb.Name)}, &pod)
 	if apierrors.IsNotFound(err) {
@@ -518,7 +779,14 @@ func (r *SandboxReconciler) run(ctx context.Context, sb *kubeparkv1alpha1.Sandbo
 			AgentImage:         r.AgentImage,
 			PriorityClassName:  r.PriorityClassName,
 			ServiceAccountName: serviceAccount,
+			ExtraPorts:         devcontainerPorts(status),
+			Profile:            profileSpec(profile),
+			TunnelAddress:      r.TunnelAddress,
+			ClusterName:        r.ClusterName,
 		})
+		if _, known := sourceDevcontainer(status); wantsSourceDevcontainer(sb) && !known {
+			desired.Annotations[annotationDevcontainerPending] = "true"
+		}
 		if err := controllerutil.SetControllerReference(sb, desired, r.Scheme); err != nil {
 			return ctrl.Result{}, err
 		}
@@ -563,15 +831,34 @@ func (r *SandboxReconciler) run(ctx context.Context, sb *kubeparkv1alpha1.Sandbo
 		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
 	}
 
+	r.reflectSource(sb, &pod, status)
+	// The first pod of a sandbox whose source has a devcontainer.json is
+	// built without it; once the clone step has read it, the pod is
+	// rebuilt with it. Later changes wait for the next resume, like
+	// template changes.
+	if report, known := sourceDevcontainer(status); known && report.Config != nil &&
+		pod.Annotations[annotationDevcontainerPending] == "true" {
+		if pod.DeletionTimestamp.IsZero() {
+			if err := r.Delete(ctx, &pod); err != nil && !apierrors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
+		}
+		status.PodIP = ""
+		r.setCondition(sb, status, kubeparkv1alpha1.ConditionPodReady, metav1.ConditionFalse,
+			kubeparkv1alpha1.ReasonProvisioning, "recreating the pod with the source's devcontainer.json")
+		r.setCondition(sb, status, kubeparkv1alpha1.ConditionReady, metav1.ConditionFalse,
+			kubeparkv1alpha1.ReasonProvisioning, "waiting for sandbox pod")
+		return ctrl.Result{}, nil
+	}
 	if podReady(&pod) {
 		if status.Phase != kubeparkv1alpha1.SandboxPhaseRunning {
 			status.Phase = kubeparkv1alpha1.SandboxPhaseRunning
 			// Start the idle clock even if no session ever opens
-			// (R2-H-A); session closes move it forward later.
-			if status.LastActivityTime == nil {
-				now := metav1.Now()
-				status.LastActivityTime = &now
-			}
+			// (R2-H-A); session closes move it forward later. It restarts
+			// on every resume, so a sandbox woken by a connection is not
+			// suspended again before agent activity is first reported.
+			now := metav1.Now()
+			status.LastActivityTime = &now
 		}
 		status.PodIP = pod.Status.PodIP
 		r.setCondition(sb, status, kubeparkv1alpha1.ConditionPodReady, metav1.ConditionTrue,
@@ -627,12 +914,16 @@ func (r *SandboxReconciler) finalize(ctx context.Context, sb *kubeparkv1alpha1.S
 		}
 	}
 
+	if err := r.gcExposure(ctx, sb, r.exposeMode(), nil); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// RoleBindings live in arbitrary grant namespaces; GC them by label.
 	if err := r.gcRBAC(ctx, sb, nil); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	if err := r.closeSessions(ctx, sb); err != nil {
+	if err := r.closeSessions(ctx, sb, kubeparkv1alpha1.ExitReasonSandboxDeleted, metav1.Now()); err != nil {
 		return ctrl.Result{}, err
 	}
 	if err := r.applyHomeRetainPolicy(ctx, sb); err != nil {
@@ -645,20 +936,19 @@ func (r *SandboxReconciler) finalize(ctx context.Context, sb *kubeparkv1alpha1.S
 
 // closeSessions marks any open sessions Closed so the audit trail records
 // why they ended.
-func (r *SandboxReconciler) closeSessions(ctx context.Context, sb *kubeparkv1alpha1.Sandbox) error {
+func (r *SandboxReconciler) closeSessions(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, reason string, end metav1.Time) error {
 	var sessions kubeparkv1alpha1.SandboxSessionList
 	if err := r.List(ctx, &sessions, client.InNamespace(sb.Namespace)); err != nil {
 		return err
 	}
-	now := metav1.Now()
 	for i := range sessions.Items {
 		s := &sessions.Items[i]
 		if s.Spec.SandboxName != sb.Name || s.Status.State != kubeparkv1alpha1.SessionStateActive {
 			continue
 		}
 		s.Status.State = kubeparkv1alpha1.SessionStateClosed
-		s.Status.EndTime = &now
-		s.Status.ExitReason = kubeparkv1alpha1.ExitReasonSandboxDeleted
+		s.Status.EndTime = &end
+		s.Status.ExitReason = reason
 		if err := r.Status().Update(ctx, s); err != nil && !apierrors.IsNotFound(err) {
 			return err
 		}
@@ -720,6 +1010,20 @@ func (r *SandboxReconciler) gatewayNamespace() string {
 	return OperatorNamespace()
 }
 
+// tunnelPort is the port of TunnelAddress, which the gateway pods listen
+// on too; 0 when there is no tunnel.
+func (r *SandboxReconciler) tunnelPort() int32 {
+	_, port, err := net.SplitHostPort(r.TunnelAddress)
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.ParseInt(port, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(n)
+}
+
 func podReady(pod *corev1.Pod) bool {
 	if pod.Status.Phase != corev1.PodRunning {
 		return false
@@ -749,6 +1053,12 @@ func (r *SandboxReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		}); err != nil {
 		return err
 	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &kubeparkv1alpha1.Sandbox{},
+		indexSandboxOwner, func(obj client.Object) []string {
+			return []string{obj.(*kubeparkv1alpha1.Sandbox).Spec.Owner.Name}
+		}); err != nil {
+		return err
+	}
 	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &kubeparkv1alpha1.Sandbox{},
 		indexSandboxExistingClaim, func(obj client.Object) []string {
 			sb := obj.(*kubeparkv1alpha1.Sandbox)
@@ -770,16 +1080,29 @@ func (r *SandboxReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&kubeparkv1alpha1.Sandbox{}).
 		Owns(&corev1.Pod{}).
 		Owns(&networkingv1.NetworkPolicy{}).
 		Owns(&corev1.Secret{}).
-		Owns(&corev1.ServiceAccount{}).
+		Owns(&corev1.ServiceAccount{})
+	// Ingress objects are watched only in their mode: the HTTPRoute kind
+	// exists only where the Gateway API is installed.
+	switch r.exposeMode() {
+	case podspec.ExposeIngress:
+		b = b.Owns(&corev1.Service{}).Owns(&networkingv1.Ingress{})
+	case podspec.ExposeHTTPRoute:
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(podspec.HTTPRouteGVK)
+		b = b.Owns(&corev1.Service{}).Owns(route)
+	}
+	return b.
 		Watches(&kubeparkv1alpha1.SandboxTemplate{},
 			handler.EnqueueRequestsFromMapFunc(r.sandboxesForTemplate)).
 		Watches(&kubeparkv1alpha1.AccessProfile{},
 			handler.EnqueueRequestsFromMapFunc(r.sandboxesForAccessProfile)).
+		Watches(&kubeparkv1alpha1.UserProfile{},
+			handler.EnqueueRequestsFromMapFunc(r.sandboxesForUserProfile)).
 		Watches(&kubeparkv1alpha1.SandboxSession{},
 			handler.EnqueueRequestsFromMapFunc(r.sandboxForSession)).
 		Watches(&discoveryv1.EndpointSlice{},
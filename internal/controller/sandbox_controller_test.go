@@ -291,4 +291,16 @@ var _ = Describe("Sandbox Controller", func() {
 			Expect(phaseOf(sb.Name)).To(Equal(kubeparkv1alpha1.SandboxPhasePending))
 		})
 	})
+
+	Context("sandbox names", func() {
+		It("refuses a dot, which would let a host principal collide with a member cluster's", func() {
+			// x.ns2 in namespace m would be signed for x.ns2.m: member
+			// cluster m's sandbox x in namespace ns2.
+			sb := newSandbox("tpl-dotted")
+			sb.Name = "x.ns2"
+			err := k8sClient.Create(ctx, sb)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue(), "create = %v", err)
+			Expect(err.Error()).To(ContainSubstring("must not contain '.'"))
+		})
+	})
 })
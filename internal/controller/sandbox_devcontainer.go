@@ -0,0 +1,134 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/controller/podspec"
+	"github.com/frauniki/kubepark/internal/devcontainer"
+)
+
+// annotationDevcontainerPending marks a pod built before the source's
+// devcontainer.json was read. It is recreated once the clone step reports
+// a configuration.
+const annotationDevcontainerPending = "kubepark.dev/devcontainer-pending"
+
+// applyDevcontainer returns the template with the devcontainer.json of the
+// template, then that of the source, applied. It records the forwarded
+// ports and the outcome in status.
+func (r *SandboxReconciler) applyDevcontainer(sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplate, status *kubeparkv1alpha1.SandboxStatus) *kubeparkv1alpha1.SandboxTemplate {
+	fromSource := wantsSourceDevcontainer(sb)
+	if tpl.Spec.Devcontainer == nil && !fromSource {
+		status.Devcontainer = nil
+		meta.RemoveStatusCondition(&status.Conditions, kubeparkv1alpha1.ConditionDevcontainer)
+		return tpl
+	}
+	if status.Devcontainer == nil {
+		status.Devcontainer = &kubeparkv1alpha1.DevcontainerStatus{}
+	}
+	if !fromSource {
+		status.Devcontainer.Report = ""
+	}
+
+	effective := tpl
+	var ports []kubeparkv1alpha1.ExposedPort
+	var unsupported, limited, problems []string
+	apply := func(cfg *devcontainer.Config, workspace string) {
+		var shortfall []string
+		effective, shortfall = cfg.Apply(effective, workspace)
+		limited = append(limited, shortfall...)
+		ports = append(ports, cfg.ExposedPorts(append(slices.Clip(sb.Spec.ExposedPorts), ports...))...)
+		unsupported = append(unsupported, cfg.Unsupported...)
+	}
+	if dc := tpl.Spec.Devcontainer; dc != nil {
+		if cfg, err := devcontainer.Parse([]byte(dc.Config)); err != nil {
+			problems = append(problems, "template: "+err.Error())
+		} else {
+			apply(cfg, podspec.HomeMountPath)
+		}
+	}
+	pending := false
+	if fromSource {
+		switch report, ok := sourceDevcontainer(status); {
+		case !ok:
+			pending = true
+		case report.Error != "":
+			problems = append(problems, "source: "+report.Error)
+		default:
+			apply(report.Config, report.Workspace)
+		}
+	}
+	status.Devcontainer.ExposedPorts = ports
+
+	switch {
+	case len(problems) > 0:
+		r.setCondition(sb, status, kubeparkv1alpha1.ConditionDevcontainer, metav1.ConditionFalse,
+			kubeparkv1alpha1.ReasonInvalidDevcontainer, strings.Join(problems, "; "))
+	case pending:
+		r.setCondition(sb, status, kubeparkv1alpha1.ConditionDevcontainer, metav1.ConditionUnknown,
+			kubeparkv1alpha1.ReasonPending,
+			fmt.Sprintf("waiting for the clone step to read %s", sb.Spec.Source.Devcontainer))
+	case len(unsupported) > 0 || len(limited) > 0:
+		msg := "applied"
+		if len(unsupported) > 0 {
+			msg += "; not supported: " + strings.Join(unsupported, ", ")
+		}
+		if len(limited) > 0 {
+			msg += "; limited by the template: " + strings.Join(limited, ", ")
+		}
+		r.setCondition(sb, status, kubeparkv1alpha1.ConditionDevcontainer, metav1.ConditionTrue,
+			kubeparkv1alpha1.ReasonUnsupported, msg)
+	default:
+		r.setCondition(sb, status, kubeparkv1alpha1.ConditionDevcontainer, metav1.ConditionTrue,
+			kubeparkv1alpha1.ReasonApplied, "devcontainer.json applied")
+	}
+	return effective
+}
+
+// devcontainerPorts returns the ports a devcontainer.json forwards.
+func devcontainerPorts(status *kubeparkv1alpha1.SandboxStatus) []kubeparkv1alpha1.ExposedPort {
+	if status.Devcontainer == nil {
+		return nil
+	}
+	return status.Devcontainer.ExposedPorts
+}
+
+func wantsSourceDevcontainer(sb *kubeparkv1alpha1.Sandbox) bool {
+	return sb.Spec.Source != nil && sb.Spec.Source.Devcontainer != ""
+}
+
+// sourceDevcontainer decodes the clone step's last report, if any.
+func sourceDevcontainer(status *kubeparkv1alpha1.SandboxStatus) (devcontainer.Report, bool) {
+	var report devcontainer.Report
+	if status.Devcontainer == nil || status.Devcontainer.Report == "" {
+		return report, false
+	}
+	if err := json.Unmarshal([]byte(status.Devcontainer.Report), &report); err != nil {
+		report.Error = "unreadable report from the clone step"
+	} else if report.Config == nil && report.Error == "" {
+		report.Error = "empty report from the clone step"
+	}
+	return report, true
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/devcontainer"
+)
+
+func TestApplyDevcontainer(t *testing.T) {
+	tpl := &kubeparkv1alpha1.SandboxTemplate{Spec: kubeparkv1alpha1.SandboxTemplateSpec{
+		Image: "base",
+		Devcontainer: &kubeparkv1alpha1.DevcontainerSpec{
+			Config: `{"image": "team", "forwardPorts": [3000], "features": {}}`,
+		},
+	}}
+	sb := &kubeparkv1alpha1.Sandbox{Spec: kubeparkv1alpha1.SandboxSpec{
+		Source: &kubeparkv1alpha1.SourceSpec{URL: "https://github.com/org/app.git", Devcontainer: ".devcontainer/devcontainer.json"},
+	}}
+	r := &SandboxReconciler{}
+	status := &kubeparkv1alpha1.SandboxStatus{}
+
+	// Until the clone step reports, only the template's file applies.
+	got := r.applyDevcontainer(sb, tpl, status)
+	if got.Spec.Image != "team" || tpl.Spec.Image != "base" {
+		t.Errorf("expected the template's devcontainer image on a copy, got %q (template %q)", got.Spec.Image, tpl.Spec.Image)
+	}
+	cond := meta.FindStatusCondition(status.Conditions, kubeparkv1alpha1.ConditionDevcontainer)
+	if cond == nil || cond.Reason != kubeparkv1alpha1.ReasonPending {
+		t.Errorf("expected a pending condition, got %+v", cond)
+	}
+
+	cfg, err := devcontainer.Parse([]byte(`{"image": "app", "forwardPorts": [3000, 8080]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, _ := json.Marshal(devcontainer.Report{Workspace: "/home/sandbox/app", Config: cfg})
+	status.Devcontainer.Report = string(report)
+	got = r.applyDevcontainer(sb, tpl, status)
+	if got.Spec.Image != "app" {
+		t.Errorf("expected the source's image to win, got %q", got.Spec.Image)
+	}
+	if ports := status.Devcontainer.ExposedPorts; len(ports) != 2 || ports[0].Port != 3000 || ports[1].Port != 8080 {
+		t.Errorf("expected ports 3000 and 8080 once each, got %+v", ports)
+	}
+	cond = meta.FindStatusCondition(status.Conditions, kubeparkv1alpha1.ConditionDevcontainer)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != kubeparkv1alpha1.ReasonUnsupported ||
+		cond.Message != "applied; not supported: features" {
+		t.Errorf("expected the unsupported property to be reported, got %+v", cond)
+	}
+
+	status.Devcontainer.Report = `{"workspace": "/home/sandbox/app", "error": "cannot read .devcontainer/devcontainer.json: no such file or directory"}`
+	r.applyDevcontainer(sb, tpl, status)
+	cond = meta.FindStatusCondition(status.Conditions, kubeparkv1alpha1.ConditionDevcontainer)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != kubeparkv1alpha1.ReasonInvalidDevcontainer {
+		t.Errorf("expected an invalid condition, got %+v", cond)
+	}
+
+	// Without any devcontainer.json, nothing is left behind.
+	sb.Spec.Source, tpl.Spec.Devcontainer = nil, nil
+	r.applyDevcontainer(sb, tpl, status)
+	if status.Devcontainer != nil || meta.FindStatusCondition(status.Conditions, kubeparkv1alpha1.ConditionDevcontainer) != nil {
+		t.Errorf("expected the devcontainer status to be cleared, got %+v", status)
+	}
+}
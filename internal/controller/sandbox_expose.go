@@ -0,0 +1,186 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/controller/podspec"
+)
+
+// fieldOwner is the server-side apply field manager of the operator.
+const fieldOwner = "kubepark-operator"
+
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
+
+// reconcileExposure publishes the exposed ports with auth none through the
+// cluster's own ingress when the operator runs in the ingress or httproute
+// mode: a Service selecting the sandbox pod, plus an Ingress or an
+// HTTPRoute per port, all owned by the sandbox. They are kept while it is
+// suspended; the Service simply has no endpoints then.
+func (r *SandboxReconciler) reconcileExposure(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, extraPorts []kubeparkv1alpha1.ExposedPort) error {
+	mode := r.exposeMode()
+	if mode == podspec.ExposeGateway {
+		return nil
+	}
+	ports := podspec.PublishedPorts(append(slices.Clip(sb.Spec.ExposedPorts), extraPorts...))
+	for _, p := range ports {
+		if _, ok := podspec.RouteHost(sb, p.Name, r.Expose.BaseDomain); !ok {
+			logf.FromContext(ctx).Info("exposed port hostname does not fit a DNS label; not routed", "port", p.Name)
+		}
+	}
+	if len(ports) == 0 {
+		return r.gcExposure(ctx, sb, mode, nil)
+	}
+
+	if err := r.applyService(ctx, sb, podspec.BuildService(sb, ports)); err != nil {
+		return err
+	}
+	if mode == podspec.ExposeIngress {
+		ing := podspec.BuildIngress(sb, ports, r.Expose)
+		if len(ing.Spec.Rules) == 0 {
+			return r.gcExposure(ctx, sb, mode, nil)
+		}
+		return r.applyIngress(ctx, sb, ing)
+	}
+	routes := podspec.BuildHTTPRoutes(sb, ports, r.Expose)
+	keep := make([]string, 0, len(routes))
+	for _, route := range routes {
+		if err := controllerutil.SetControllerReference(sb, route, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Apply(ctx, client.ApplyConfigurationFromUnstructured(route),
+			client.FieldOwner(fieldOwner), client.ForceOwnership); err != nil {
+			return err
+		}
+		keep = append(keep, route.GetName())
+	}
+	return r.gcExposure(ctx, sb, mode, keep)
+}
+
+// applyService creates the Service, or updates its ports and selector. The
+// rest of its spec is left to the API server, which fills in the cluster
+// IP.
+func (r *SandboxReconciler) applyService(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, desired *corev1.Service) error {
+	if err := controllerutil.SetControllerReference(sb, desired, r.Scheme); err != nil {
+		return err
+	}
+	var existing corev1.Service
+	err := r.Get(ctx, types.NamespacedName{Namespace: desired.Namespace, Name: desired.Name}, &existing)
+	if apierrors.IsNotFound(err) {
+		return client.IgnoreAlreadyExists(r.Create(ctx, desired))
+	}
+	if err != nil {
+		return err
+	}
+	if !equality(existing.Spec.Ports, desired.Spec.Ports) || !equality(existing.Spec.Selector, desired.Spec.Selector) {
+		existing.Spec.Ports = desired.Spec.Ports
+		existing.Spec.Selector = desired.Spec.Selector
+		return r.Update(ctx, &existing)
+	}
+	return nil
+}
+
+// applyIngress creates the Ingress, or updates its spec and the
+// annotations the operator sets; others, from the ingress controller, are
+// kept.
+func (r *SandboxReconciler) applyIngress(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, desired *networkingv1.Ingress) error {
+	if err := controllerutil.SetControllerReference(sb, desired, r.Scheme); err != nil {
+		return err
+	}
+	var existing networkingv1.Ingress
+	err := r.Get(ctx, types.NamespacedName{Namespace: desired.Namespace, Name: desired.Name}, &existing)
+	if apierrors.IsNotFound(err) {
+		return client.IgnoreAlreadyExists(r.Create(ctx, desired))
+	}
+	if err != nil {
+		return err
+	}
+	changed := !equality(existing.Spec, desired.Spec)
+	for k, v := range desired.Annotations {
+		if existing.Annotations[k] != v {
+			metav1.SetMetaDataAnnotation(&existing.ObjectMeta, k, v)
+			changed = true
+		}
+	}
+	if changed {
+		existing.Spec = desired.Spec
+		return r.Update(ctx, &existing)
+	}
+	return nil
+}
+
+// gcExposure deletes the mode's objects of a sandbox, except HTTPRoutes
+// named in keep; a nil keep removes the Service too. Objects of another
+// mode are left to owner-reference garbage collection, as their kinds may
+// not exist in the cluster.
+func (r *SandboxReconciler) gcExposure(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, mode podspec.ExposeMode, keep []string) error {
+	switch mode {
+	case podspec.ExposeGateway:
+		return nil
+	case podspec.ExposeHTTPRoute:
+		var routes unstructured.UnstructuredList
+		routes.SetGroupVersionKind(podspec.HTTPRouteGVK.GroupVersion().WithKind(podspec.HTTPRouteGVK.Kind + "List"))
+		if err := r.List(ctx, &routes, client.InNamespace(sb.Namespace),
+			client.MatchingLabels{podspec.LabelSandboxUID: string(sb.UID)}); err != nil {
+			return err
+		}
+		for i := range routes.Items {
+			if slices.Contains(keep, routes.Items[i].GetName()) {
+				continue
+			}
+			if err := r.Delete(ctx, &routes.Items[i]); err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+	case podspec.ExposeIngress:
+		if keep == nil {
+			ing := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: sb.Namespace, Name: podspec.IngressName(sb.Name)}}
+			if err := r.Delete(ctx, ing); err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+	if keep == nil {
+		svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: sb.Namespace, Name: podspec.ServiceName(sb.Name)}}
+		if err := r.Delete(ctx, svc); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SandboxReconciler) exposeMode() podspec.ExposeMode {
+	if r.ExposeMode == "" {
+		return podspec.ExposeGateway
+	}
+	return r.ExposeMode
+}
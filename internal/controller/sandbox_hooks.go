@@ -0,0 +1,155 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/agentapi"
+)
+
+const (
+	// hookPollInterval is how often hook progress is polled while a hook
+	// runs.
+	hookPollInterval = 5 * time.Second
+	// preSuspendMargin is added to the preSuspend timeout before the
+	// controller stops waiting for an agent that never reports an outcome.
+	preSuspendMargin = 30 * time.Second
+)
+
+// reconcileStartHooks reflects the dotfiles, postCreate and postStart
+// outcomes of a running sandbox into its conditions, and reports whether
+// any is still pending and should be polled again.
+func (r *SandboxReconciler) reconcileStartHooks(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, tpl *kubeparkv1alpha1.SandboxTemplate, profile *kubeparkv1alpha1.UserProfile, status *kubeparkv1alpha1.SandboxStatus) bool {
+	hooks := tpl.Spec.Hooks
+	if hooks == nil {
+		hooks = &kubeparkv1alpha1.LifecycleHooks{}
+	}
+	if hooks.PostCreate == nil && hooks.PostStart == nil && !dotfilesWanted(profile) {
+		return false
+	}
+	report, err := r.agent().Hooks(ctx, status.PodIP)
+	if err != nil {
+		logf.FromContext(ctx).V(1).Info("Fetching hook status failed", "podIP", status.PodIP, "error", err.Error())
+		return true
+	}
+	pending := false
+	for _, h := range []struct {
+		name    agentapi.HookName
+		cond    string
+		defined bool
+	}{
+		{agentapi.HookDotfiles, kubeparkv1alpha1.ConditionDotfiles, dotfilesWanted(profile)},
+		{agentapi.HookPostCreate, kubeparkv1alpha1.ConditionPostCreateHook, hooks.PostCreate != nil},
+		{agentapi.HookPostStart, kubeparkv1alpha1.ConditionPostStartHook, hooks.PostStart != nil},
+	} {
+		if !h.defined {
+			continue
+		}
+		st, ok := report[h.name]
+		if !ok || st.State == agentapi.HookRunning {
+			pending = true
+		}
+		if ok {
+			r.setHookCondition(sb, status, h.cond, h.name, st)
+		}
+	}
+	return pending
+}
+
+// runPreSuspend drives the preSuspend hook of a pod about to be deleted and
+// reports whether the pod may be deleted now: once the hook finished, timed
+// out or cannot be reached. Its outcome never blocks the suspension.
+func (r *SandboxReconciler) runPreSuspend(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, hook *kubeparkv1alpha1.LifecycleHook, status *kubeparkv1alpha1.SandboxStatus, podIP string) bool {
+	unreachable := func(err error) bool {
+		r.setCondition(sb, status, kubeparkv1alpha1.ConditionPreSuspendHook, metav1.ConditionFalse,
+			kubeparkv1alpha1.ReasonHookUnreachable, err.Error())
+		r.hookEvent(sb, corev1.EventTypeWarning, kubeparkv1alpha1.ReasonHookUnreachable,
+			"preSuspend hook not run: %v", err)
+		return true
+	}
+	report, err := r.agent().Hooks(ctx, podIP)
+	if err != nil {
+		return unreachable(err)
+	}
+	st, started := report[agentapi.HookPreSuspend]
+	if !started {
+		if err := r.agent().StartPreSuspend(ctx, podIP); err != nil {
+			return unreachable(err)
+		}
+		r.setHookCondition(sb, status, kubeparkv1alpha1.ConditionPreSuspendHook, agentapi.HookPreSuspend,
+			agentapi.HookStatus{State: agentapi.HookRunning})
+		return false
+	}
+	if st.State != agentapi.HookRunning {
+		r.setHookCondition(sb, status, kubeparkv1alpha1.ConditionPreSuspendHook, agentapi.HookPreSuspend, st)
+		return true
+	}
+
+	// The agent kills the hook at its timeout; the margin only covers an
+	// agent that stops answering.
+	timeout := agentapi.DefaultPreSuspendTimeout
+	if hook.Timeout != nil {
+		timeout = hook.Timeout.Duration
+	}
+	if r.now().Sub(st.StartTime) > timeout+preSuspendMargin {
+		r.setHookCondition(sb, status, kubeparkv1alpha1.ConditionPreSuspendHook, agentapi.HookPreSuspend,
+			agentapi.HookStatus{State: agentapi.HookFailed, Message: fmt.Sprintf("no outcome after %s", timeout)})
+		return true
+	}
+	r.setHookCondition(sb, status, kubeparkv1alpha1.ConditionPreSuspendHook, agentapi.HookPreSuspend, st)
+	return false
+}
+
+// setHookCondition records a hook's status as a condition, and emits an
+// event when it reaches a new outcome.
+func (r *SandboxReconciler) setHookCondition(sb *kubeparkv1alpha1.Sandbox, status *kubeparkv1alpha1.SandboxStatus, condType string, name agentapi.HookName, st agentapi.HookStatus) {
+	condStatus, reason, eventType := metav1.ConditionUnknown, kubeparkv1alpha1.ReasonHookRunning, ""
+	switch st.State {
+	case agentapi.HookSucceeded:
+		condStatus, reason, eventType = metav1.ConditionTrue, kubeparkv1alpha1.ReasonHookSucceeded, corev1.EventTypeNormal
+	case agentapi.HookFailed:
+		condStatus, reason, eventType = metav1.ConditionFalse, kubeparkv1alpha1.ReasonHookFailed, corev1.EventTypeWarning
+	}
+	message := st.Message
+	if message == "" {
+		message = "running"
+	}
+	prev := meta.FindStatusCondition(status.Conditions, condType)
+	changed := prev == nil || prev.Reason != reason || prev.Message != message
+	r.setCondition(sb, status, condType, condStatus, reason, message)
+	if changed && eventType != "" {
+		r.hookEvent(sb, eventType, reason, "%s hook: %s", name, message)
+	}
+}
+
+// hookEvent records a hook event on the sandbox when a recorder is
+// configured.
+func (r *SandboxReconciler) hookEvent(sb *kubeparkv1alpha1.Sandbox, eventType, reason, note string, args ...any) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Eventf(sb, nil, eventType, reason, "LifecycleHook", note, args...)
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/events"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/agentapi"
+)
+
+// fakeAgent is an AgentClient serving canned reports.
+type fakeAgent struct {
+	activity *agentapi.Activity
+	hooks    agentapi.HookReport
+	err      error
+
+	preSuspendStarts int
+}
+
+func (f *fakeAgent) Activity(context.Context, string) (*agentapi.Activity, error) {
+	return f.activity, f.err
+}
+
+func (f *fakeAgent) Hooks(context.Context, string) (agentapi.HookReport, error) {
+	return f.hooks, f.err
+}
+
+func (f *fakeAgent) StartPreSuspend(context.Context, string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.preSuspendStarts++
+	return nil
+}
+
+func TestReconcileStartHooks(t *testing.T) {
+	tpl := &kubeparkv1alpha1.SandboxTemplate{Spec: kubeparkv1alpha1.SandboxTemplateSpec{
+		Hooks: &kubeparkv1alpha1.LifecycleHooks{
+			PostCreate: &kubeparkv1alpha1.LifecycleHook{Command: []string{"make", "setup"}},
+			PostStart:  &kubeparkv1alpha1.LifecycleHook{Command: []string{"true"}},
+		},
+	}}
+	fake := &fakeAgent{hooks: agentapi.HookReport{
+		agentapi.HookPostCreate: {State: agentapi.HookRunning},
+	}}
+	recorder := events.NewFakeRecorder(10)
+	r := &SandboxReconciler{Agent: fake, Recorder: recorder}
+	sb := &kubeparkv1alpha1.Sandbox{}
+	status := &kubeparkv1alpha1.SandboxStatus{PodIP: "10.0.0.1"}
+
+	if !r.reconcileStartHooks(context.Background(), sb, tpl, nil, status) {
+		t.Fatal("expected running hooks to be pending")
+	}
+	cond := meta.FindStatusCondition(status.Conditions, kubeparkv1alpha1.ConditionPostCreateHook)
+	if cond == nil || cond.Status != metav1.ConditionUnknown || cond.Reason != kubeparkv1alpha1.ReasonHookRunning {
+		t.Errorf("expected a running postCreate condition, got %+v", cond)
+	}
+
+	fake.hooks = agentapi.HookReport{
+		agentapi.HookPostCreate: {State: agentapi.HookFailed, Message: "exit status 2: no rule to make target"},
+		agentapi.HookPostStart:  {State: agentapi.HookSucceeded, Message: "completed in 0s"},
+	}
+	for range 2 {
+		if r.reconcileStartHooks(context.Background(), sb, tpl, nil, status) {
+			t.Fatal("expected finished hooks not to be pending")
+		}
+	}
+	cond = meta.FindStatusCondition(status.Conditions, kubeparkv1alpha1.ConditionPostCreateHook)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != kubeparkv1alpha1.ReasonHookFailed {
+		t.Errorf("expected a failed postCreate condition, got %+v", cond)
+	}
+	// One event per outcome, however often it is observed.
+	if got := len(recorder.Events); got != 2 {
+		t.Errorf("expected 2 events, got %d", got)
+	}
+}
+
+func TestRunPreSuspend(t *testing.T) {
+	now := time.Now()
+	hook := &kubeparkv1alpha1.LifecycleHook{
+		Command: []string{"git", "stash"},
+		Timeout: &metav1.Duration{Duration: time.Minute},
+	}
+	fake := &fakeAgent{hooks: agentapi.HookReport{}}
+	r := &SandboxReconciler{Agent: fake, Now: func() time.Time { return now }}
+	sb := &kubeparkv1alpha1.Sandbox{}
+	status := &kubeparkv1alpha1.SandboxStatus{}
+
+	if r.runPreSuspend(context.Background(), sb, hook, status, "10.0.0.1") {
+		t.Fatal("expected the pod to be kept while the hook starts")
+	}
+	if fake.preSuspendStarts != 1 {
+		t.Errorf("expected the hook to be started once, got %d", fake.preSuspendStarts)
+	}
+
+	fake.hooks[agentapi.HookPreSuspend] = agentapi.HookStatus{State: agentapi.HookRunning, StartTime: now}
+	if r.runPreSuspend(context.Background(), sb, hook, status, "10.0.0.1") {
+		t.Fatal("expected the pod to be kept while the hook runs")
+	}
+	if fake.preSuspendStarts != 1 {
+		t.Errorf("expected a running hook not to be restarted, got %d starts", fake.preSuspendStarts)
+	}
+
+	// An agent that never reports an outcome stops holding the pod.
+	now = now.Add(time.Minute + preSuspendMargin + time.Second)
+	if !r.runPreSuspend(context.Background(), sb, hook, status, "10.0.0.1") {
+		t.Fatal("expected the pod to be released after the timeout")
+	}
+	cond := meta.FindStatusCondition(status.Conditions, kubeparkv1alpha1.ConditionPreSuspendHook)
+	if cond == nil || cond.Reason != kubeparkv1alpha1.ReasonHookFailed {
+		t.Errorf("expected a failed preSuspend condition, got %+v", cond)
+	}
+
+	fake.err = errors.New("connection refused")
+	if !r.runPreSuspend(context.Background(), sb, hook, status, "10.0.0.1") {
+		t.Fatal("expected an unreachable agent not to block the suspension")
+	}
+	cond = meta.FindStatusCondition(status.Conditions, kubeparkv1alpha1.ConditionPreSuspendHook)
+	if cond == nil || cond.Reason != kubeparkv1alpha1.ReasonHookUnreachable {
+		t.Errorf("expected an unreachable preSuspend condition, got %+v", cond)
+	}
+}
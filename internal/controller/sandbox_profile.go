@@ -0,0 +1,115 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+// indexSandboxOwner indexes sandboxes by their owner principal.
+const indexSandboxOwner = ".spec.owner.name"
+
+// userProfile returns the UserProfile of principal, or nil when there is
+// none.
+func (r *SandboxReconciler) userProfile(ctx context.Context, principal string) (*kubeparkv1alpha1.UserProfile, error) {
+	var profiles kubeparkv1alpha1.UserProfileList
+	if err := r.List(ctx, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles.ForPrincipal(principal), nil
+}
+
+// applyUserProfile returns the template with the owner's shell, timezone,
+// locale and environment applied; they win over the template's.
+func applyUserProfile(tpl *kubeparkv1alpha1.SandboxTemplate, profile *kubeparkv1alpha1.UserProfile) *kubeparkv1alpha1.SandboxTemplate {
+	if profile == nil {
+		return tpl
+	}
+	p := &profile.Spec
+	var env []kubeparkv1alpha1.ProfileEnvVar
+	if p.Timezone != "" {
+		env = append(env, kubeparkv1alpha1.ProfileEnvVar{Name: "TZ", Value: p.Timezone})
+	}
+	if p.Locale != "" {
+		env = append(env, kubeparkv1alpha1.ProfileEnvVar{Name: "LANG", Value: p.Locale})
+	}
+	env = append(env, p.Env...)
+	if p.Shell == "" && len(env) == 0 {
+		return tpl
+	}
+
+	out := tpl.DeepCopy()
+	if p.Shell != "" {
+		if out.Spec.User == nil {
+			out.Spec.User = &kubeparkv1alpha1.SandboxUser{}
+		}
+		out.Spec.User.Shell = p.Shell
+	}
+	for _, e := range env {
+		// The API refuses these names; an older object may still carry one.
+		if strings.HasPrefix(e.Name, "KUBEPARK_") || slices.Contains([]string{"HOME", "USER", "LOGNAME"}, e.Name) {
+			continue
+		}
+		out.Spec.Env = slices.DeleteFunc(out.Spec.Env, func(v corev1.EnvVar) bool { return v.Name == e.Name })
+		out.Spec.Env = append(out.Spec.Env, corev1.EnvVar{Name: e.Name, Value: e.Value})
+	}
+	return out
+}
+
+// profileSpec is the spec of profile, or nil.
+func profileSpec(profile *kubeparkv1alpha1.UserProfile) *kubeparkv1alpha1.UserProfileSpec {
+	if profile == nil {
+		return nil
+	}
+	return &profile.Spec
+}
+
+// dotfilesWanted reports whether the owner's profile installs dotfiles.
+func dotfilesWanted(profile *kubeparkv1alpha1.UserProfile) bool {
+	return profile != nil && profile.Spec.Dotfiles != nil
+}
+
+// clearProfileConditions drops the conditions a profile no longer backs.
+func clearProfileConditions(profile *kubeparkv1alpha1.UserProfile, status *kubeparkv1alpha1.SandboxStatus) {
+	if !dotfilesWanted(profile) {
+		meta.RemoveStatusCondition(&status.Conditions, kubeparkv1alpha1.ConditionDotfiles)
+	}
+}
+
+// sandboxesForUserProfile re-queues the sandboxes of a changed profile's
+// principal, so changes surface as template drift.
+func (r *SandboxReconciler) sandboxesForUserProfile(ctx context.Context, obj client.Object) []ctrl.Request {
+	profile, ok := obj.(*kubeparkv1alpha1.UserProfile)
+	if !ok {
+		return nil
+	}
+	var sandboxes kubeparkv1alpha1.SandboxList
+	if err := r.List(ctx, &sandboxes,
+		client.MatchingFields{indexSandboxOwner: profile.Spec.Principal}); err != nil {
+		return nil
+	}
+	return toRequests(sandboxes.Items)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+func TestApplyUserProfile(t *testing.T) {
+	tpl := &kubeparkv1alpha1.SandboxTemplate{Spec: kubeparkv1alpha1.SandboxTemplateSpec{
+		Image: "base",
+		Env:   []corev1.EnvVar{{Name: "EDITOR", Value: "vi"}, {Name: "PAGER", Value: "less"}},
+	}}
+	if got := applyUserProfile(tpl, nil); got != tpl {
+		t.Error("expected the template unchanged without a profile")
+	}
+
+	profile := &kubeparkv1alpha1.UserProfile{Spec: kubeparkv1alpha1.UserProfileSpec{
+		Principal: "alice@example.com",
+		Shell:     "/bin/zsh",
+		Timezone:  "Europe/Berlin",
+		Locale:    "de_DE.UTF-8",
+		Env: []kubeparkv1alpha1.ProfileEnvVar{
+			{Name: "EDITOR", Value: "nvim"},
+			{Name: "KUBEPARK_OWNER", Value: "mallory@example.com"},
+		},
+	}}
+	got := applyUserProfile(tpl, profile)
+	if tpl.Spec.User != nil || len(tpl.Spec.Env) != 2 {
+		t.Error("applyUserProfile must not modify its input")
+	}
+	if got.Spec.User == nil || got.Spec.User.Shell != "/bin/zsh" {
+		t.Errorf("expected the profile's shell, got %+v", got.Spec.User)
+	}
+	env := map[string]string{}
+	for _, e := range got.Spec.Env {
+		if _, dup := env[e.Name]; dup {
+			t.Errorf("duplicate variable %s", e.Name)
+		}
+		env[e.Name] = e.Value
+	}
+	want := map[string]string{"EDITOR": "nvim", "PAGER": "less", "TZ": "Europe/Berlin", "LANG": "de_DE.UTF-8"}
+	if len(env) != len(want) {
+		t.Errorf("expected %v, got %v", want, env)
+	}
+	for k, v := range want {
+		if env[k] != v {
+			t.Errorf("%s: expected %q, got %q", k, v, env[k])
+		}
+	}
+}
+
+func TestUserProfileForPrincipal(t *testing.T) {
+	now := time.Now()
+	profile := func(name, principal string, age time.Duration) kubeparkv1alpha1.UserProfile {
+		return kubeparkv1alpha1.UserProfile{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(now.Add(-age))},
+			Spec:       kubeparkv1alpha1.UserProfileSpec{Principal: principal},
+		}
+	}
+	list := kubeparkv1alpha1.UserProfileList{Items: []kubeparkv1alpha1.UserProfile{
+		profile("bob", "bob@example.com", time.Hour),
+		profile("alice-new", "alice@example.com", time.Minute),
+		profile("alice", "alice@example.com", time.Hour),
+	}}
+	if p := list.ForPrincipal("alice@example.com"); p == nil || p.Name != "alice" {
+		t.Errorf("expected the oldest profile to win, got %+v", p)
+	}
+	if p := list.ForPrincipal("carol@example.com"); p != nil {
+		t.Errorf("expected no profile, got %+v", p)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/agentapi"
+	"github.com/frauniki/kubepark/internal/controller/podspec"
+)
+
+// reflectSource mirrors the clone init container of the pod into the
+// SourceReady condition. A failed clone is reported and the sandbox starts
+// without it; the next start retries.
+func (r *SandboxReconciler) reflectSource(sb *kubeparkv1alpha1.Sandbox, pod *corev1.Pod, status *kubeparkv1alpha1.SandboxStatus) {
+	src := sb.Spec.Source
+	if src == nil {
+		meta.RemoveStatusCondition(&status.Conditions, kubeparkv1alpha1.ConditionSourceReady)
+		return
+	}
+	var cs *corev1.ContainerStatus
+	for i := range pod.Status.InitContainerStatuses {
+		if pod.Status.InitContainerStatuses[i].Name == podspec.SourceContainerName {
+			cs = &pod.Status.InitContainerStatuses[i]
+		}
+	}
+	if cs == nil {
+		msg := fmt.Sprintf("waiting to clone %s", src.URL)
+		if podReady(pod) {
+			// spec.source was set after this pod was created.
+			msg = fmt.Sprintf("%s is cloned when the sandbox pod is next created", src.URL)
+		}
+		r.setCondition(sb, status, kubeparkv1alpha1.ConditionSourceReady, metav1.ConditionUnknown,
+			kubeparkv1alpha1.ReasonCloning, msg)
+		return
+	}
+
+	if term := cs.State.Terminated; term != nil && term.ExitCode == 0 {
+		if msg, ok := strings.CutPrefix(term.Message, agentapi.CloneUnreachablePrefix); ok {
+			r.setCondition(sb, status, kubeparkv1alpha1.ConditionSourceReady, metav1.ConditionFalse,
+				kubeparkv1alpha1.ReasonEgressBlocked, msg)
+			return
+		}
+		if msg, ok := strings.CutPrefix(term.Message, agentapi.CloneFailedPrefix); ok {
+			r.setCondition(sb, status, kubeparkv1alpha1.ConditionSourceReady, metav1.ConditionFalse,
+				kubeparkv1alpha1.ReasonCloneFailed, msg)
+			return
+		}
+		// A devcontainer report follows the first line.
+		msg, report, _ := strings.Cut(term.Message, "\n")
+		if report != "" && src.Devcontainer != "" {
+			if status.Devcontainer == nil {
+				status.Devcontainer = &kubeparkv1alpha1.DevcontainerStatus{}
+			}
+			status.Devcontainer.Report = report
+		}
+		r.setCondition(sb, status, kubeparkv1alpha1.ConditionSourceReady, metav1.ConditionTrue,
+			kubeparkv1alpha1.ReasonCloned, msg)
+		return
+	}
+	if cs.State.Running != nil {
+		r.setCondition(sb, status, kubeparkv1alpha1.ConditionSourceReady, metav1.ConditionUnknown,
+			kubeparkv1alpha1.ReasonCloning, fmt.Sprintf("cloning %s", src.URL))
+		return
+	}
+	term := cs.State.Terminated
+	if term == nil {
+		term = cs.LastTerminationState.Terminated
+	}
+	if term == nil {
+		r.setCondition(sb, status, kubeparkv1alpha1.ConditionSourceReady, metav1.ConditionUnknown,
+			kubeparkv1alpha1.ReasonCloning, fmt.Sprintf("waiting to clone %s", src.URL))
+		return
+	}
+	// A crash: the agent reports its own failures with status 0.
+	msg := term.Message
+	if msg == "" {
+		msg = fmt.Sprintf("clone exited with status %d", term.ExitCode)
+	}
+	r.setCondition(sb, status, kubeparkv1alpha1.ConditionSourceReady, metav1.ConditionFalse,
+		kubeparkv1alpha1.ReasonCloneFailed, msg)
+}
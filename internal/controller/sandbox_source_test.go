@@ -0,0 +1,79 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/agentapi"
+	"github.com/frauniki/kubepark/internal/controller/podspec"
+)
+
+func TestReflectSource(t *testing.T) {
+	sb := &kubeparkv1alpha1.Sandbox{Spec: kubeparkv1alpha1.SandboxSpec{
+		Source: &kubeparkv1alpha1.SourceSpec{URL: "https://github.com/org/repo.git"},
+	}}
+	cases := []struct {
+		name   string
+		cs     corev1.ContainerStatus
+		status metav1.ConditionStatus
+		reason string
+	}{
+		{"running", corev1.ContainerStatus{
+			State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+		}, metav1.ConditionUnknown, kubeparkv1alpha1.ReasonCloning},
+		{"cloned", corev1.ContainerStatus{
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: "cloned"}},
+		}, metav1.ConditionTrue, kubeparkv1alpha1.ReasonCloned},
+		{"failed", corev1.ContainerStatus{
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				Message: agentapi.CloneFailedPrefix + "git clone failed: exit status 128",
+			}},
+		}, metav1.ConditionFalse, kubeparkv1alpha1.ReasonCloneFailed},
+		{"backing off after a crash", corev1.ContainerStatus{
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+			LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				ExitCode: 1, Message: "git clone failed: exit status 128",
+			}},
+		}, metav1.ConditionFalse, kubeparkv1alpha1.ReasonCloneFailed},
+		{"egress blocked", corev1.ContainerStatus{
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				Message: agentapi.CloneUnreachablePrefix + "cannot connect to github.com:443",
+			}},
+		}, metav1.ConditionFalse, kubeparkv1alpha1.ReasonEgressBlocked},
+	}
+	r := &SandboxReconciler{}
+	for _, tc := range cases {
+		tc.cs.Name = podspec.SourceContainerName
+		pod := &corev1.Pod{Status: corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{tc.cs}}}
+		status := &kubeparkv1alpha1.SandboxStatus{}
+		r.reflectSource(sb, pod, status)
+		cond := meta.FindStatusCondition(status.Conditions, kubeparkv1alpha1.ConditionSourceReady)
+		if cond == nil || cond.Status != tc.status || cond.Reason != tc.reason {
+			t.Errorf("%s: expected %s/%s, got %+v", tc.name, tc.status, tc.reason, cond)
+		} else if strings.HasPrefix(cond.Message, agentapi.CloneFailedPrefix) ||
+			strings.HasPrefix(cond.Message, agentapi.CloneUnreachablePrefix) {
+			t.Errorf("%s: expected the prefix stripped, got %q", tc.name, cond.Message)
+		}
+	}
+}
@@ -128,6 +128,10 @@ func (r *SandboxSessionReconciler) reconcileClosed(ctx context.Context, session
 // bumpSandboxActivity advances the sandbox's lastActivityTime to this
 // session's end time (the idle clock only starts once sessions close).
 func (r *SandboxSessionReconciler) bumpSandboxActivity(ctx context.Context, session *kubeparkv1alpha1.SandboxSession) error {
+	if session.Spec.SandboxName == "" {
+		// A bastion session keeps no sandbox awake.
+		return nil
+	}
 	var sb kubeparkv1alpha1.Sandbox
 	err := r.Get(ctx, types.NamespacedName{Namespace: session.Namespace, Name: session.Spec.SandboxName}, &sb)
 	if apierrors.IsNotFound(err) {
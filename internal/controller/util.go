@@ -17,6 +17,8 @@ limitations under the License.
 package controller
 
 import (
+	"slices"
+
 	"golang.org/x/crypto/ssh"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -24,6 +26,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/controller/podspec"
+	"github.com/frauniki/kubepark/internal/sshca"
 )
 
 // controllerSetOwner sets the sandbox as the controller owner of a
@@ -38,6 +42,32 @@ func equality(a, b any) bool {
 	return apiequality.Semantic.DeepEqual(a, b)
 }
 
+// Keys of a sandbox's host key Secret.
+const (
+	keyHostPublic = podspec.HostKeyPublic
+	keyHostCert   = podspec.HostKeyCert
+)
+
+// certHasPrincipals reports whether the authorized_keys-form certificate
+// lists exactly principals: a principal it should no longer carry calls for
+// a new certificate as much as a missing one.
+func certHasPrincipals(authorized []byte, principals []string) bool {
+	key, err := sshca.ParsePublicKey(authorized)
+	if err != nil {
+		return false
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok || len(cert.ValidPrincipals) != len(principals) {
+		return false
+	}
+	for _, p := range principals {
+		if !slices.Contains(cert.ValidPrincipals, p) {
+			return false
+		}
+	}
+	return true
+}
+
 // marshalCert renders a certificate in authorized_keys format (the
 // *-cert.pub file layout OpenSSH expects).
 func marshalCert(cert *ssh.Certificate) []byte {
@@ -0,0 +1,476 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package devcontainer derives sandbox configuration from a
+// devcontainer.json. Parse keeps the properties kubepark can apply, in a
+// normalized form that the clone step reports to the operator, and lists
+// the rest; Apply folds them into a template.
+package devcontainer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+// Variables substituted in env values and commands. Others, such as
+// ${localEnv:...}, have no meaning in a sandbox.
+const (
+	varWorkspace         = "${containerWorkspaceFolder}"
+	varWorkspaceBasename = "${containerWorkspaceFolderBasename}"
+)
+
+// ignored are properties with nothing to apply that are not worth
+// reporting.
+var ignored = []string{"$schema", "name", "customizations"}
+
+// Config is the part of a devcontainer.json that kubepark applies.
+type Config struct {
+	Image string `json:"image,omitempty"`
+	// Env merges containerEnv and remoteEnv; remoteEnv wins.
+	Env          map[string]string `json:"env,omitempty"`
+	ForwardPorts []int32           `json:"forwardPorts,omitempty"`
+	// Commands are argv; the string form runs through /bin/sh -c.
+	PostCreateCommand []string `json:"postCreateCommand,omitempty"`
+	PostStartCommand  []string `json:"postStartCommand,omitempty"`
+	// RunAsUser is a numeric remoteUser; UserName a named one.
+	RunAsUser *int64 `json:"runAsUser,omitempty"`
+	UserName  string `json:"userName,omitempty"`
+	// Requests and Storage come from hostRequirements.
+	CPU     *resource.Quantity `json:"cpu,omitempty"`
+	Memory  *resource.Quantity `json:"memory,omitempty"`
+	Storage *resource.Quantity `json:"storage,omitempty"`
+	// Unsupported lists the properties (or values) that were not applied.
+	Unsupported []string `json:"unsupported,omitempty"`
+}
+
+// Parse reads a devcontainer.json, which may contain comments and
+// trailing commas.
+func Parse(raw []byte) (*Config, error) {
+	var props map[string]json.RawMessage
+	if err := json.Unmarshal(standardize(raw), &props); err != nil {
+		return nil, fmt.Errorf("devcontainer.json: %w", err)
+	}
+	c := &Config{}
+	// remoteUser is who tools run as, so it wins over containerUser.
+	for _, key := range []string{"containerUser", "remoteUser"} {
+		if val, ok := props[key]; ok {
+			var user string
+			if err := json.Unmarshal(val, &user); err != nil {
+				return nil, fmt.Errorf("devcontainer.json: %s: %w", key, err)
+			}
+			c.setUser(key, user)
+			delete(props, key)
+		}
+	}
+	for key, val := range props {
+		if err := c.parseProperty(key, val); err != nil {
+			return nil, fmt.Errorf("devcontainer.json: %s: %w", key, err)
+		}
+	}
+	slices.Sort(c.Unsupported)
+	return c, nil
+}
+
+func (c *Config) parseProperty(key string, val json.RawMessage) error {
+	switch key {
+	case "image":
+		return json.Unmarshal(val, &c.Image)
+	case "containerEnv", "remoteEnv":
+		var env map[string]*string
+		if err := json.Unmarshal(val, &env); err != nil {
+			return err
+		}
+		for name, v := range env {
+			switch {
+			case v == nil:
+				// remoteEnv null unsets a variable; there is nothing to set.
+			case hasUnknownVariable(*v):
+				c.unsupported("%s.%s", key, name)
+			default:
+				if c.Env == nil {
+					c.Env = map[string]string{}
+				}
+				if _, set := c.Env[name]; !set || key == "remoteEnv" {
+					c.Env[name] = *v
+				}
+			}
+		}
+	case "forwardPorts":
+		var ports []json.RawMessage
+		if err := json.Unmarshal(val, &ports); err != nil {
+			return err
+		}
+		for _, p := range ports {
+			if port, ok := forwardPort(p); ok {
+				c.ForwardPorts = append(c.ForwardPorts, port)
+			} else {
+				c.unsupported("forwardPorts %s", p)
+			}
+		}
+		slices.Sort(c.ForwardPorts)
+		c.ForwardPorts = slices.Compact(c.ForwardPorts)
+	case "postCreateCommand", "postStartCommand":
+		argv, ok, err := command(val)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			c.unsupported("%s (parallel commands)", key)
+			return nil
+		}
+		if key == "postCreateCommand" {
+			c.PostCreateCommand = argv
+		} else {
+			c.PostStartCommand = argv
+		}
+	case "hostRequirements":
+		return c.parseHostRequirements(val)
+	default:
+		if !slices.Contains(ignored, key) {
+			c.unsupported("%s", key)
+		}
+	}
+	return nil
+}
+
+func (c *Config) setUser(key, user string) {
+	c.RunAsUser, c.UserName = nil, ""
+	if uid, err := strconv.ParseInt(user, 10, 64); err == nil {
+		if uid > 0 {
+			c.RunAsUser = &uid
+			return
+		}
+		user = "root"
+	}
+	if user == "root" {
+		// Sandboxes never run as root.
+		c.unsupported("%s root", key)
+		return
+	}
+	c.UserName = user
+}
+
+func (c *Config) parseHostRequirements(val json.RawMessage) error {
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(val, &req); err != nil {
+		return err
+	}
+	for key, v := range req {
+		switch key {
+		case "cpus":
+			var cpus int64
+			if err := json.Unmarshal(v, &cpus); err != nil {
+				return err
+			}
+			c.CPU = resource.NewQuantity(cpus, resource.DecimalSI)
+		case "memory", "storage":
+			var s string
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			q, err := size(s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			if key == "memory" {
+				c.Memory = &q
+			} else {
+				c.Storage = &q
+			}
+		default:
+			// Notably gpu: sandboxes are clients to GPU infrastructure,
+			// never GPU hosts.
+			c.unsupported("hostRequirements.%s", key)
+		}
+	}
+	return nil
+}
+
+func (c *Config) unsupported(format string, args ...any) {
+	c.Unsupported = append(c.Unsupported, fmt.Sprintf(format, args...))
+}
+
+// Apply returns a copy of tpl with the configuration applied, and the
+// hostRequirements the template's limits held back. workspace is the
+// directory the commands run in and ${containerWorkspaceFolder} names.
+func (c *Config) Apply(tpl *kubeparkv1alpha1.SandboxTemplate, workspace string) (_ *kubeparkv1alpha1.SandboxTemplate, shortfall []string) {
+	out := tpl.DeepCopy()
+	spec := &out.Spec
+	subst := strings.NewReplacer(
+		varWorkspace, workspace,
+		varWorkspaceBasename, workspace[strings.LastIndex(workspace, "/")+1:],
+	)
+
+	if c.Image != "" {
+		spec.Image = c.Image
+	}
+	names := make([]string, 0, len(c.Env))
+	for name := range c.Env {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		v := corev1.EnvVar{Name: name, Value: subst.Replace(c.Env[name])}
+		if i := slices.IndexFunc(spec.Env, func(e corev1.EnvVar) bool { return e.Name == name }); i >= 0 {
+			spec.Env[i] = v
+		} else {
+			spec.Env = append(spec.Env, v)
+		}
+	}
+
+	hook := func(argv []string) *kubeparkv1alpha1.LifecycleHook {
+		// Hooks run in the home; devcontainer commands run in the
+		// workspace.
+		cmd := []string{"/bin/sh", "-c", `cd "$0" && exec "$@"`, workspace}
+		for _, a := range argv {
+			cmd = append(cmd, subst.Replace(a))
+		}
+		return &kubeparkv1alpha1.LifecycleHook{Command: cmd}
+	}
+	if c.PostCreateCommand != nil || c.PostStartCommand != nil {
+		if spec.Hooks == nil {
+			spec.Hooks = &kubeparkv1alpha1.LifecycleHooks{}
+		}
+		if c.PostCreateCommand != nil {
+			spec.Hooks.PostCreate = hook(c.PostCreateCommand)
+		}
+		if c.PostStartCommand != nil {
+			spec.Hooks.PostStart = hook(c.PostStartCommand)
+		}
+	}
+
+	if c.RunAsUser != nil {
+		spec.RunAsUser = c.RunAsUser
+	}
+	if c.UserName != "" {
+		if spec.User == nil {
+			spec.User = &kubeparkv1alpha1.SandboxUser{}
+		}
+		spec.User.Name = c.UserName
+	}
+
+	// hostRequirements only raise the template's limits and home size
+	// when it allows them to; otherwise requests are clamped to the
+	// limits and the shortfall is returned.
+	allow := spec.Devcontainer != nil && spec.Devcontainer.AllowHostRequirements
+	setRequest := func(name corev1.ResourceName, q *resource.Quantity) {
+		if q == nil {
+			return
+		}
+		if spec.Resources.Requests == nil {
+			spec.Resources.Requests = corev1.ResourceList{}
+		}
+		req := *q
+		if limit, ok := spec.Resources.Limits[name]; ok && limit.Cmp(req) < 0 {
+			if allow {
+				spec.Resources.Limits[name] = req
+			} else {
+				shortfall = append(shortfall, fmt.Sprintf("hostRequirements.%s %s (limit %s)",
+					hostRequirement[name], req.String(), limit.String()))
+				req = limit
+			}
+		}
+		spec.Resources.Requests[name] = req
+	}
+	setRequest(corev1.ResourceCPU, c.CPU)
+	setRequest(corev1.ResourceMemory, c.Memory)
+	if c.Storage != nil {
+		switch {
+		case allow:
+			spec.HomeSize = *c.Storage
+		case spec.HomeSize.Cmp(*c.Storage) < 0:
+			shortfall = append(shortfall, fmt.Sprintf("hostRequirements.storage %s (home size %s)",
+				c.Storage.String(), spec.HomeSize.String()))
+		}
+	}
+	return out, shortfall
+}
+
+// hostRequirement names the hostRequirements property of a resource.
+var hostRequirement = map[corev1.ResourceName]string{
+	corev1.ResourceCPU:    "cpus",
+	corev1.ResourceMemory: "memory",
+}
+
+// ExposedPorts maps forwardPorts to gateway-routed ports behind OIDC,
+// skipping ports the sandbox already exposes.
+func (c *Config) ExposedPorts(explicit []kubeparkv1alpha1.ExposedPort) []kubeparkv1alpha1.ExposedPort {
+	var out []kubeparkv1alpha1.ExposedPort
+	for _, port := range c.ForwardPorts {
+		name := fmt.Sprintf("port-%d", port)
+		if slices.ContainsFunc(explicit, func(p kubeparkv1alpha1.ExposedPort) bool {
+			return p.Port == port || p.Name == name
+		}) {
+			continue
+		}
+		out = append(out, kubeparkv1alpha1.ExposedPort{Name: name, Port: port, Auth: kubeparkv1alpha1.AuthModeOIDC})
+	}
+	return out
+}
+
+// forwardPort accepts a port number or "localhost:port"; ports on other
+// hosts (such as a compose service) do not exist in a sandbox.
+func forwardPort(raw json.RawMessage) (int32, bool) {
+	var n int32
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n, n > 0
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, false
+	}
+	host, port, ok := strings.Cut(s, ":")
+	if !ok || (host != "localhost" && host != "127.0.0.1") {
+		return 0, false
+	}
+	p, err := strconv.ParseInt(port, 10, 32)
+	return int32(p), err == nil && p > 0 && p <= 65535
+}
+
+// command parses a lifecycle command; ok is false for the object form.
+func command(raw json.RawMessage) (argv []string, ok bool, err error) {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return []string{"/bin/sh", "-c", s}, true, nil
+	}
+	if json.Unmarshal(raw, &argv) == nil {
+		return argv, true, nil
+	}
+	var parallel map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &parallel); err != nil {
+		return nil, false, fmt.Errorf("expected a string, an array or an object")
+	}
+	return nil, false, nil
+}
+
+// hasUnknownVariable reports a ${...} reference other than the
+// workspace folder variables.
+func hasUnknownVariable(s string) bool {
+	s = strings.NewReplacer(varWorkspace, "", varWorkspaceBasename, "").Replace(s)
+	return strings.Contains(s, "${")
+}
+
+// size parses a devcontainer size such as "8gb" (binary units, as the
+// reference implementation reads them).
+func size(s string) (resource.Quantity, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for suffix, unit := range map[string]string{"tb": "Ti", "gb": "Gi", "mb": "Mi", "kb": "Ki"} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			return resource.ParseQuantity(strings.TrimSpace(n) + unit)
+		}
+	}
+	return resource.ParseQuantity(s)
+}
+
+// standardize turns JSON with comments and trailing commas into JSON.
+func standardize(raw []byte) []byte {
+	out := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		switch ch := raw[i]; {
+		case ch == '"':
+			start := i
+			for i++; i < len(raw) && raw[i] != '"'; i++ {
+				if raw[i] == '\\' {
+					i++
+				}
+			}
+			out = append(out, raw[start:min(i+1, len(raw))]...)
+		case ch == '/' && i+1 < len(raw) && raw[i+1] == '/':
+			for i < len(raw) && raw[i] != '\n' {
+				i++
+			}
+			i--
+		case ch == '/' && i+1 < len(raw) && raw[i+1] == '*':
+			i += 2
+			for i+1 < len(raw) && (raw[i] != '*' || raw[i+1] != '/') {
+				i++
+			}
+			i++
+		case ch == ',':
+			// Drop the comma if only whitespace and comments separate it
+			// from a closing bracket.
+			if next := nextToken(raw[i+1:]); next == '}' || next == ']' {
+				continue
+			}
+			out = append(out, ch)
+		default:
+			out = append(out, ch)
+		}
+	}
+	return out
+}
+
+// nextToken returns the next byte that is not whitespace or inside a
+// comment, or 0 at the end.
+func nextToken(raw []byte) byte {
+	for i := 0; i < len(raw); i++ {
+		switch {
+		case raw[i] == ' ' || raw[i] == '\t' || raw[i] == '\n' || raw[i] == '\r':
+		case raw[i] == '/' && i+1 < len(raw) && raw[i+1] == '/':
+			for i < len(raw) && raw[i] != '\n' {
+				i++
+			}
+		case raw[i] == '/' && i+1 < len(raw) && raw[i+1] == '*':
+			for i += 2; i+1 < len(raw) && (raw[i] != '*' || raw[i+1] != '/'); i++ {
+			}
+			i++
+		default:
+			return raw[i]
+		}
+	}
+	return 0
+}
+
+// MaxReportSize keeps a report within the kubelet's limit on termination
+// messages, which carry it, leaving room for the clone step's own line.
+const MaxReportSize = 3072
+
+// Report is what the clone step tells the operator about a source's
+// devcontainer.json.
+type Report struct {
+	// Workspace is the clone's directory in the sandbox.
+	Workspace string  `json:"workspace"`
+	Config    *Config `json:"config,omitempty"`
+	// Error explains why there is no Config.
+	Error string `json:"error,omitempty"`
+}
+
+// Read reads the devcontainer.json at path, relative to workspace, into an
+// encoded report.
+func Read(workspace, path string) []byte {
+	report := Report{Workspace: workspace}
+	if raw, err := os.ReadFile(filepath.Join(workspace, path)); err != nil {
+		report.Error = fmt.Sprintf("cannot read %s: %v", path, errors.Unwrap(err))
+	} else if report.Config, err = Parse(raw); err != nil {
+		report.Error = err.Error()
+	}
+	out, _ := json.Marshal(report)
+	if len(out) > MaxReportSize {
+		out, _ = json.Marshal(Report{Workspace: workspace, Error: path + " has too much configuration to report"})
+	}
+	return out
+}
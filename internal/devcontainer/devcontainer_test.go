@@ -0,0 +1,145 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package devcontainer
+
+import (
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+const sample = `// Generated by the editor.
+{
+	"name": "app",
+	"image": "mcr.microsoft.com/devcontainers/go:1", /* pinned by CI */
+	"containerEnv": {"GOFLAGS": "-mod=mod", "SRC": "${containerWorkspaceFolder}/src"},
+	"remoteEnv": {"GOFLAGS": "-mod=vendor", "TOKEN": "${localEnv:TOKEN}"},
+	"forwardPorts": [8080, "localhost:3000", "db:5432", 8080],
+	"postCreateCommand": "make setup",
+	"postStartCommand": ["go", "version"],
+	"remoteUser": "vscode",
+	"containerUser": "1001",
+	"hostRequirements": {"cpus": 4, "memory": "8gb", "storage": "32gb", "gpu": true},
+	"features": {"ghcr.io/devcontainers/features/node:1": {}},
+	"customizations": {"vscode": {"extensions": ["golang.go",]}},
+}`
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Image != "mcr.microsoft.com/devcontainers/go:1" {
+		t.Errorf("unexpected image %q", c.Image)
+	}
+	if c.Env["GOFLAGS"] != "-mod=vendor" || c.Env["SRC"] != "${containerWorkspaceFolder}/src" {
+		t.Errorf("unexpected env %v", c.Env)
+	}
+	if !slices.Equal(c.ForwardPorts, []int32{3000, 8080}) {
+		t.Errorf("unexpected ports %v", c.ForwardPorts)
+	}
+	if c.UserName != "vscode" || c.RunAsUser != nil {
+		t.Errorf("expected remoteUser to win, got %q/%v", c.UserName, c.RunAsUser)
+	}
+	if c.Memory.String() != "8Gi" || c.CPU.String() != "4" {
+		t.Errorf("unexpected requests cpu=%s memory=%s", c.CPU, c.Memory)
+	}
+	want := []string{"features", `forwardPorts "db:5432"`, "hostRequirements.gpu", "remoteEnv.TOKEN"}
+	if !slices.Equal(c.Unsupported, want) {
+		t.Errorf("expected unsupported %v, got %v", want, c.Unsupported)
+	}
+}
+
+func TestParseRejectsRoot(t *testing.T) {
+	c, err := Parse([]byte(`{"remoteUser": "root"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.UserName != "" || c.RunAsUser != nil || !slices.Equal(c.Unsupported, []string{"remoteUser root"}) {
+		t.Errorf("expected root to be refused, got %+v", c)
+	}
+}
+
+func TestApply(t *testing.T) {
+	c, err := Parse([]byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &kubeparkv1alpha1.SandboxTemplate{Spec: kubeparkv1alpha1.SandboxTemplateSpec{
+		Image: "base",
+		Env:   []corev1.EnvVar{{Name: "GOFLAGS", Value: "-x"}},
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("4Gi")},
+		},
+		HomeSize: resource.MustParse("10Gi"),
+	}}
+	out, shortfall := c.Apply(tpl, "/home/sandbox/app")
+	if tpl.Spec.Image != "base" {
+		t.Error("Apply must not modify its input")
+	}
+	if out.Spec.Image != c.Image {
+		t.Errorf("unexpected image %q", out.Spec.Image)
+	}
+	env := map[string]string{}
+	for _, e := range out.Spec.Env {
+		env[e.Name] = e.Value
+	}
+	if len(out.Spec.Env) != 2 || env["GOFLAGS"] != "-mod=vendor" || env["SRC"] != "/home/sandbox/app/src" {
+		t.Errorf("unexpected env %v", out.Spec.Env)
+	}
+	wantHook := []string{"/bin/sh", "-c", `cd "$0" && exec "$@"`, "/home/sandbox/app", "/bin/sh", "-c", "make setup"}
+	if out.Spec.Hooks == nil || !slices.Equal(out.Spec.Hooks.PostCreate.Command, wantHook) {
+		t.Errorf("unexpected postCreate hook %+v", out.Spec.Hooks)
+	}
+	if out.Spec.User == nil || out.Spec.User.Name != "vscode" {
+		t.Errorf("expected the user name vscode, got %+v", out.Spec.User)
+	}
+	if limit := out.Spec.Resources.Limits[corev1.ResourceMemory]; limit.String() != "4Gi" {
+		t.Errorf("expected the memory limit kept, got %s", limit.String())
+	}
+	if req := out.Spec.Resources.Requests[corev1.ResourceMemory]; req.String() != "4Gi" {
+		t.Errorf("expected the memory request clamped to the limit, got %s", req.String())
+	}
+	if req := out.Spec.Resources.Requests[corev1.ResourceCPU]; req.String() != "4" {
+		t.Errorf("expected the unlimited cpu request applied, got %s", req.String())
+	}
+	if out.Spec.HomeSize.String() != "10Gi" {
+		t.Errorf("expected the home size kept, got %s", out.Spec.HomeSize.String())
+	}
+	wantShortfall := []string{"hostRequirements.memory 8Gi (limit 4Gi)", "hostRequirements.storage 32Gi (home size 10Gi)"}
+	if !slices.Equal(shortfall, wantShortfall) {
+		t.Errorf("unexpected shortfall %q", shortfall)
+	}
+
+	tpl.Spec.Devcontainer = &kubeparkv1alpha1.DevcontainerSpec{Config: sample, AllowHostRequirements: true}
+	out, shortfall = c.Apply(tpl, "/home/sandbox/app")
+	if limit := out.Spec.Resources.Limits[corev1.ResourceMemory]; limit.String() != "8Gi" || len(shortfall) != 0 {
+		t.Errorf("expected the memory limit raised to the request, got %s (shortfall %q)", limit.String(), shortfall)
+	}
+	if out.Spec.HomeSize.String() != "32Gi" {
+		t.Errorf("unexpected home size %s", out.Spec.HomeSize.String())
+	}
+
+	ports := c.ExposedPorts([]kubeparkv1alpha1.ExposedPort{{Name: "web", Port: 8080}})
+	if len(ports) != 1 || ports[0].Name != "port-3000" || ports[0].Auth != kubeparkv1alpha1.AuthModeOIDC {
+		t.Errorf("unexpected exposed ports %+v", ports)
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gliderssh "github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+// bastionRecheckInterval is how often an open bastion connection is
+// checked against its AccessTarget again, so removing a principal or
+// destination cuts it.
+const bastionRecheckInterval = 30 * time.Second
+
+// bastionSuffix marks a jump destination as an AccessTarget rather than a
+// sandbox. A sandbox target in a member cluster also has two dots; no
+// ClusterRegistration may be named "target", so the two cannot collide.
+const bastionSuffix = ".target"
+
+// BastionTarget is a parsed AccessTarget jump destination.
+type BastionTarget struct {
+	AccessTarget string
+	Destination  string
+}
+
+// ParseBastionTarget parses a jump destination host of the form
+// "<destination>.<accessTarget>.target", reporting false for any other
+// form.
+func ParseBastionTarget(host string) (BastionTarget, bool) {
+	rest, ok := strings.CutSuffix(strings.TrimSpace(host), bastionSuffix)
+	if !ok {
+		return BastionTarget{}, false
+	}
+	dest, target, found := strings.Cut(rest, ".")
+	if !found || dest == "" || target == "" || strings.Contains(target, ".") {
+		return BastionTarget{}, false
+	}
+	return BastionTarget{AccessTarget: target, Destination: dest}, true
+}
+
+// handleBastion forwards a direct-tcpip channel to an AccessTarget
+// destination. The connection is recorded as a bastion session in the
+// destination's namespace and cut when the target's time bound is reached,
+// or when the target no longer allows it.
+func (h *jumpHandler) handleBastion(ctx gliderssh.Context, newChan gossh.NewChannel, target BastionTarget, port uint32,
+	principal string) {
+	logger := log.FromContext(ctx).WithValues("accessTarget", target.AccessTarget, "destination", target.Destination,
+		"principal", principal)
+
+	at, err := h.cfg.Store.GetAccessTarget(ctx, target.AccessTarget)
+	var dest *kubeparkv1alpha1.AccessDestination
+	if err == nil {
+		dest, err = authorizeBastion(at, target.Destination, principal, port, h.cfg.Now())
+	}
+	if err != nil {
+		logger.Info("rejected bastion route", "reason", err.Error())
+		_ = newChan.Reject(gossh.Prohibited, "not authorized for this target")
+		return
+	}
+
+	serial, _ := ctx.Value(ctxKeyCertSerial).(string)
+	_, closeSession := h.recordSession(ctx, &kubeparkv1alpha1.SandboxSession{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: dest.Namespace,
+			Name:      fmt.Sprintf("%s-%s-%s", at.Name, dest.Name, randomSuffix(ctx)),
+		},
+		Spec: kubeparkv1alpha1.SandboxSessionSpec{
+			AccessTarget: at.Name,
+			Destination:  dest.Name,
+			User:         principal,
+			ClientAddr:   ctx.RemoteAddr().String(),
+			Kind:         kubeparkv1alpha1.SessionKindBastion,
+			CertSerial:   serial,
+			Port:         dest.Port,
+		},
+	}, heartbeatInterval(0))
+	reason := kubeparkv1alpha1.ExitReasonDisconnected
+	defer func() { closeSession(reason) }()
+
+	upstream, err := h.cfg.DialTarget(ctx, "tcp", destinationAddr(dest))
+	if err != nil {
+		logger.Info("bastion dial failed", "reason", err.Error())
+		_ = newChan.Reject(gossh.ConnectionFailed, "cannot reach target")
+		return
+	}
+	defer func() { _ = upstream.Close() }()
+
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		return
+	}
+	go gossh.DiscardRequests(reqs)
+
+	var once sync.Once
+	cutReason := ""
+	cut := func(why string) {
+		once.Do(func() {
+			cutReason = why
+			_ = ch.Close()
+			_ = upstream.Close()
+		})
+	}
+	if deadline, ok := bastionDeadline(at, h.cfg.Now()); ok {
+		timer := time.AfterFunc(deadline.Sub(h.cfg.Now()), func() { cut(kubeparkv1alpha1.ExitReasonExpired) })
+		defer timer.Stop()
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(bastionRecheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			fresh, err := h.cfg.Store.GetAccessTarget(ctx, target.AccessTarget)
+			if err == nil {
+				_, err = authorizeBastion(fresh, target.Destination, principal, port, h.cfg.Now())
+			}
+			if err != nil {
+				logger.Info("bastion access revoked", "reason", err.Error())
+				cut(kubeparkv1alpha1.ExitReasonRevoked)
+				return
+			}
+		}
+	}()
+
+	bridge(ch, upstream)
+	// Wait out a cut in progress, and keep a later one from firing.
+	once.Do(func() {})
+	if cutReason != "" {
+		reason = cutReason
+	}
+}
+
+// authorizeBastion enforces the AccessTarget's policy: the principal is
+// listed, the destination exists and is asked for on its port, and now is
+// within the target's validity.
+func authorizeBastion(at *kubeparkv1alpha1.AccessTarget, destination, principal string, port uint32,
+	now time.Time) (*kubeparkv1alpha1.AccessDestination, error) {
+	if principal == "" || !slices.Contains(at.Spec.Principals, principal) {
+		return nil, fmt.Errorf("principal %q is not listed", principal)
+	}
+	dest := at.Destination(destination)
+	if dest == nil {
+		return nil, fmt.Errorf("no destination %q", destination)
+	}
+	if port != uint32(dest.Port) {
+		return nil, fmt.Errorf("port %d requested, destination is on %d", port, dest.Port)
+	}
+	if at.Spec.NotBefore != nil && now.Before(at.Spec.NotBefore.Time) {
+		return nil, fmt.Errorf("not valid before %s", at.Spec.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if at.Spec.NotAfter != nil && !now.Before(at.Spec.NotAfter.Time) {
+		return nil, fmt.Errorf("expired at %s", at.Spec.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return dest, nil
+}
+
+// bastionDeadline is when a connection opened now must be cut: the
+// earlier of the target's notAfter and maxSessionDuration from now.
+func bastionDeadline(at *kubeparkv1alpha1.AccessTarget, now time.Time) (time.Time, bool) {
+	var deadline time.Time
+	if at.Spec.NotAfter != nil {
+		deadline = at.Spec.NotAfter.Time
+	}
+	if d := at.Spec.MaxSessionDuration; d != nil && d.Duration > 0 {
+		if end := now.Add(d.Duration); deadline.IsZero() || end.Before(deadline) {
+			deadline = end
+		}
+	}
+	return deadline, !deadline.IsZero()
+}
+
+// destinationAddr is the dial address of a destination: a Service by its
+// cluster DNS name, or the host as given.
+func destinationAddr(dest *kubeparkv1alpha1.AccessDestination) string {
+	host := dest.Host
+	if dest.Service != "" {
+		host = dest.Service + "." + dest.Namespace + ".svc"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(dest.Port)))
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway_test
+
+import (
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/gateway"
+)
+
+func TestParseBastionTarget(t *testing.T) {
+	got, ok := gateway.ParseBastionTarget("orders-db.prod.target")
+	if !ok || got.Destination != "orders-db" || got.AccessTarget != "prod" {
+		t.Errorf("ParseBastionTarget = %+v, %v", got, ok)
+	}
+	for _, host := range []string{"demo.alice", "demo", "prod.target", "a.b.c.target", ".prod.target"} {
+		if _, ok := gateway.ParseBastionTarget(host); ok {
+			t.Errorf("%q must not parse as a bastion target", host)
+		}
+	}
+}
+
+// TestBastionForward proves an AccessTarget destination is reachable by a
+// listed principal on its port, recorded as a bastion session in the
+// destination's namespace, and cut at maxSessionDuration.
+func TestBastionForward(t *testing.T) {
+	userCA := newCA(t, "user-ca")
+	host, portStr, _ := net.SplitHostPort(startEcho(t))
+	port, _ := strconv.Atoi(portStr)
+
+	target := &kubeparkv1alpha1.AccessTarget{
+		ObjectMeta: metav1.ObjectMeta{Name: "prod"},
+		Spec: kubeparkv1alpha1.AccessTargetSpec{
+			Destinations: []kubeparkv1alpha1.AccessDestination{
+				{Name: "db", Namespace: "payments", Host: host, Port: int32(port)},
+			},
+			Principals:         []string{"alice@example.com"},
+			MaxSessionDuration: &metav1.Duration{Duration: 500 * time.Millisecond},
+		},
+	}
+	expired := target.DeepCopy()
+	expired.Name = "old"
+	expired.Spec.NotAfter = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+	store := &fakeStore{targets: map[string]*kubeparkv1alpha1.AccessTarget{"prod": target, "old": expired}}
+	gwAddr := startGateway(t, userCA, store, fakeDialer{addr: "127.0.0.1:1"})
+	alice := userCert(t, userCA, "alice@example.com")
+
+	dest := net.JoinHostPort("db.prod.target", portStr)
+	tunnel, jump, err := dialGatewayJump(t, gwAddr, alice, dest)
+	if err != nil {
+		t.Fatalf("bastion dial: %v", err)
+	}
+	defer func() { _ = jump.Close() }()
+	expectEcho(t, tunnel)
+
+	// The connection is cut once maxSessionDuration passes.
+	_ = tunnel.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadAll(tunnel); err != nil {
+		t.Fatalf("expected the tunnel to be closed, got %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		store.mu.Lock()
+		sessions, reasons := slices.Clone(store.sessions), slices.Clone(store.reasons)
+		store.mu.Unlock()
+		if len(reasons) == 1 {
+			if reasons[0] != kubeparkv1alpha1.ExitReasonExpired {
+				t.Errorf("exit reason = %q, want Expired", reasons[0])
+			}
+			s := sessions[0]
+			if s.Kind != kubeparkv1alpha1.SessionKindBastion || s.AccessTarget != "prod" || s.Destination != "db" ||
+				s.User != "alice@example.com" {
+				t.Errorf("session = %+v", s)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("session was not closed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	for name, try := range map[string]struct {
+		principal, dest string
+	}{
+		"an unlisted principal": {"mallory@example.com", dest},
+		"another port":          {"alice@example.com", "db.prod.target:1"},
+		"an unknown target":     {"alice@example.com", net.JoinHostPort("db.staging.target", portStr)},
+		"an expired target":     {"alice@example.com", net.JoinHostPort("db.old.target", portStr)},
+	} {
+		if _, _, err := dialGatewayJump(t, gwAddr, userCert(t, userCA, try.principal), try.dest); err == nil {
+			t.Errorf("expected %s to be refused", name)
+		}
+	}
+}
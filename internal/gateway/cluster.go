@@ -0,0 +1,243 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+type clusterKey struct{}
+
+// WithCluster returns ctx naming the cluster a sandbox lives in; "" is the
+// gateway's own. The Store and Dialer act on that cluster, and since a
+// detached context keeps its values, so do the session writes made after
+// the connection ends.
+func WithCluster(ctx context.Context, cluster string) context.Context {
+	return context.WithValue(ctx, clusterKey{}, cluster)
+}
+
+// ClusterFromContext returns the cluster ctx names, "" for the gateway's
+// own.
+func ClusterFromContext(ctx context.Context) string {
+	cluster, _ := ctx.Value(clusterKey{}).(string)
+	return cluster
+}
+
+// clusterClient is the client of the cluster ctx names: local for the
+// gateway's own, else the member's in clusters.
+func clusterClient(ctx context.Context, local client.Client, clusters *Clusters) (client.Client, error) {
+	cluster := ClusterFromContext(ctx)
+	if cluster == "" {
+		return local, nil
+	}
+	if clusters != nil {
+		if c, ok := clusters.Client(cluster); ok {
+			return c, nil
+		}
+	}
+	return nil, ErrNoRoute{Reason: fmt.Sprintf("cluster %q is not registered", cluster)}
+}
+
+// clusterConfig is the REST config of the cluster ctx names, as
+// clusterClient's client.
+func clusterConfig(ctx context.Context, local *rest.Config, clusters *Clusters) (*rest.Config, error) {
+	cluster := ClusterFromContext(ctx)
+	if cluster == "" {
+		return local, nil
+	}
+	if clusters != nil {
+		if cfg, ok := clusters.Config(cluster); ok {
+			return cfg, nil
+		}
+	}
+	return nil, ErrNoRoute{Reason: fmt.Sprintf("cluster %q is not registered", cluster)}
+}
+
+// Clusters holds a client for each member cluster a ClusterRegistration
+// joins to the gateway, built from the kubeconfig Secret it names. Its
+// reconciler keeps them current on every replica.
+type Clusters struct {
+	reader    client.Reader
+	namespace string
+	scheme    *runtime.Scheme
+
+	mu      sync.RWMutex
+	members map[string]member
+}
+
+// member is a registered cluster's client, its REST config, and the
+// kubeconfig they were built from, so an unchanged Secret does not rebuild
+// them.
+type member struct {
+	client     client.Client
+	config     *rest.Config
+	kubeconfig []byte
+}
+
+// NewClusters returns an empty set reading ClusterRegistrations and their
+// Secrets, in namespace, through reader.
+func NewClusters(reader client.Reader, namespace string, scheme *runtime.Scheme) *Clusters {
+	return &Clusters{reader: reader, namespace: namespace, scheme: scheme, members: map[string]member{}}
+}
+
+// Client returns the client of the named member cluster.
+func (c *Clusters) Client(name string) (client.Client, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m, ok := c.members[name]
+	return m.client, ok
+}
+
+// Config returns the REST config of the named member cluster, for
+// requests its client does not make, like port-forwards.
+func (c *Clusters) Config(name string) (*rest.Config, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m, ok := c.members[name]
+	return m.config, ok && m.config != nil
+}
+
+// Names returns the registered member clusters, in order.
+func (c *Clusters) Names() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Sorted(maps.Keys(c.members))
+}
+
+// Set registers the client of a member cluster, replacing any other.
+func (c *Clusters) Set(name string, cl client.Client) {
+	c.set(name, member{client: cl})
+}
+
+func (c *Clusters) set(name string, m member) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.members[name] = m
+}
+
+func (c *Clusters) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.members, name)
+}
+
+// Reconcile builds the client of one ClusterRegistration, or drops it once
+// the registration is gone.
+func (c *Clusters) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	logger := log.FromContext(ctx)
+	var reg kubeparkv1alpha1.ClusterRegistration
+	if err := c.reader.Get(ctx, req.NamespacedName, &reg); err != nil {
+		if apierrors.IsNotFound(err) {
+			c.remove(req.Name)
+			logger.Info("cluster unregistered")
+		}
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+
+	kubeconfig, err := c.kubeconfig(ctx, &reg)
+	if err != nil {
+		// The Secret may yet be created; its watch retries then.
+		c.remove(reg.Name)
+		logger.Error(err, "cluster registration has no usable kubeconfig")
+		return reconcile.Result{}, nil
+	}
+	c.mu.RLock()
+	current, ok := c.members[reg.Name]
+	c.mu.RUnlock()
+	if ok && bytes.Equal(current.kubeconfig, kubeconfig) {
+		return reconcile.Result{}, nil
+	}
+	restCfg, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		c.remove(reg.Name)
+		logger.Error(err, "cluster registration has an invalid kubeconfig")
+		return reconcile.Result{}, nil
+	}
+	// Uncached: the gateway reads a member's sandboxes only as connections
+	// arrive, and would otherwise watch every one in every cluster.
+	cl, err := client.New(restCfg, client.Options{Scheme: c.scheme})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	c.set(reg.Name, member{client: cl, config: restCfg, kubeconfig: kubeconfig})
+	logger.Info("cluster registered", "host", restCfg.Host)
+	return reconcile.Result{}, nil
+}
+
+// kubeconfig reads the registration's kubeconfig from its Secret.
+func (c *Clusters) kubeconfig(ctx context.Context, reg *kubeparkv1alpha1.ClusterRegistration) ([]byte, error) {
+	ref := reg.Spec.KubeconfigSecretRef
+	key := ref.Key
+	if key == "" {
+		key = kubeparkv1alpha1.DefaultKubeconfigKey
+	}
+	var secret corev1.Secret
+	if err := c.reader.Get(ctx, types.NamespacedName{Namespace: c.namespace, Name: ref.Name}, &secret); err != nil {
+		return nil, fmt.Errorf("read secret %s/%s: %w", c.namespace, ref.Name, err)
+	}
+	data := secret.Data[key]
+	if len(data) == 0 {
+		return nil, fmt.Errorf("secret %s/%s has no key %q", c.namespace, ref.Name, key)
+	}
+	return data, nil
+}
+
+// SetupWithManager runs the reconciler on mgr, on every replica. A change
+// to a kubeconfig Secret reconciles the registrations naming it.
+func (c *Clusters) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kubeparkv1alpha1.ClusterRegistration{}).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(c.registrationsForSecret)).
+		Named("clusterregistration").
+		Complete(c)
+}
+
+func (c *Clusters) registrationsForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetNamespace() != c.namespace {
+		return nil
+	}
+	var regs kubeparkv1alpha1.ClusterRegistrationList
+	if err := c.reader.List(ctx, &regs); err != nil {
+		return nil
+	}
+	var reqs []reconcile.Request
+	for _, reg := range regs.Items {
+		if reg.Spec.KubeconfigSecretRef.Name == obj.GetName() {
+			reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Name: reg.Name}})
+		}
+	}
+	return reqs
+}
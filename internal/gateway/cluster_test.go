@@ -0,0 +1,158 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+func kubeparkScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = kubeparkv1alpha1.AddToScheme(scheme)
+	return scheme
+}
+
+func sandboxClient(owner string) client.Client {
+	sb := &kubeparkv1alpha1.Sandbox{
+		ObjectMeta: metav1.ObjectMeta{Namespace: nsAlice, Name: sbName},
+		Spec:       kubeparkv1alpha1.SandboxSpec{Owner: kubeparkv1alpha1.OwnerSpec{Name: owner}},
+	}
+	return fake.NewClientBuilder().WithScheme(kubeparkScheme()).WithObjects(sb).
+		WithStatusSubresource(&kubeparkv1alpha1.SandboxSession{}).Build()
+}
+
+// TestClusterStore proves sandboxes and sessions are read and written in
+// the cluster the context names.
+func TestClusterStore(t *testing.T) {
+	hub, tokyo := sandboxClient("bob@example.com"), sandboxClient("alice@example.com")
+	clusters := NewClusters(hub, "kubepark-system", kubeparkScheme())
+	clusters.Set("tokyo", tokyo)
+	store := NewClusterStore(hub, clusters)
+	ctx := context.Background()
+
+	for cluster, owner := range map[string]string{"": "bob@example.com", "tokyo": "alice@example.com"} {
+		sb, err := store.GetSandbox(WithCluster(ctx, cluster), nsAlice, sbName)
+		if err != nil || sb.Spec.Owner.Name != owner {
+			t.Fatalf("cluster %q: sandbox %v, %v; want owner %s", cluster, sb, err, owner)
+		}
+	}
+
+	session := &kubeparkv1alpha1.SandboxSession{ObjectMeta: metav1.ObjectMeta{Namespace: nsAlice, Name: "demo-1"}}
+	if err := store.CreateSession(WithCluster(ctx, "tokyo"), session); err != nil {
+		t.Fatal(err)
+	}
+	// A detached context still names the cluster.
+	closeCtx := context.WithoutCancel(WithCluster(ctx, "tokyo"))
+	if err := store.CloseSession(closeCtx, nsAlice, "demo-1", kubeparkv1alpha1.ExitReasonDisconnected); err != nil {
+		t.Fatal(err)
+	}
+	var got kubeparkv1alpha1.SandboxSession
+	if err := tokyo.Get(ctx, types.NamespacedName{Namespace: nsAlice, Name: "demo-1"}, &got); err != nil ||
+		got.Status.State != kubeparkv1alpha1.SessionStateClosed {
+		t.Fatalf("member session = %+v, %v; want it closed", got.Status, err)
+	}
+	if err := hub.Get(ctx, types.NamespacedName{Namespace: nsAlice, Name: "demo-1"}, &got); err == nil {
+		t.Fatal("the session was recorded in the gateway's cluster too")
+	}
+
+	var noRoute ErrNoRoute
+	if _, err := store.GetSandbox(WithCluster(ctx, "osaka"), nsAlice, sbName); !errors.As(err, &noRoute) {
+		t.Fatalf("unregistered cluster = %v, want ErrNoRoute", err)
+	}
+}
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: tokyo
+  cluster:
+    server: https://tokyo.example.com:6443
+contexts:
+- name: tokyo
+  context:
+    cluster: tokyo
+    user: gateway
+current-context: tokyo
+users:
+- name: gateway
+  user:
+    token: secret-token
+`
+
+// TestClustersReconcile proves a registration's client follows its
+// kubeconfig Secret and the registration itself.
+func TestClustersReconcile(t *testing.T) {
+	const ns = "kubepark-system"
+	reg := &kubeparkv1alpha1.ClusterRegistration{
+		ObjectMeta: metav1.ObjectMeta{Name: "tokyo"},
+		Spec: kubeparkv1alpha1.ClusterRegistrationSpec{
+			KubeconfigSecretRef: kubeparkv1alpha1.KubeconfigSecretReference{Name: "kubepark-cluster-tokyo"},
+		},
+	}
+	hub := fake.NewClientBuilder().WithScheme(kubeparkScheme()).WithObjects(reg).Build()
+	clusters := NewClusters(hub, ns, kubeparkScheme())
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "tokyo"}}
+
+	if _, err := clusters.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := clusters.Client("tokyo"); ok {
+		t.Fatal("a registration without its Secret was registered")
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "kubepark-cluster-tokyo"},
+		Data:       map[string][]byte{kubeparkv1alpha1.DefaultKubeconfigKey: []byte(testKubeconfig)},
+	}
+	if err := hub.Create(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	if got := clusters.registrationsForSecret(ctx, secret); len(got) != 1 || got[0] != req {
+		t.Fatalf("secret maps to %v, want %v", got, req)
+	}
+	if _, err := clusters.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := clusters.Client("tokyo"); !ok {
+		t.Fatal("the registration was not registered")
+	}
+
+	if err := hub.Delete(ctx, reg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clusters.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := clusters.Client("tokyo"); ok {
+		t.Fatal("a deleted registration is still registered")
+	}
+}
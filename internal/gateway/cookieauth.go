@@ -26,11 +26,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"golang.org/x/oauth2"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 // randomString returns a URL-safe random token for OIDC state.
@@ -41,86 +44,225 @@ func randomString() string {
 }
 
 const (
+	// sessionCookie is a per-host session, minted from the master session
+	// by a ticket handoff.
 	sessionCookie = "kubepark_session"
+	// ssoCookie is the master session, set on the auth host only.
+	ssoCookie = "kubepark_sso"
+	// handoffCookie binds a ticket to the browser that asked for it.
+	handoffCookie = "kubepark_handoff"
 	stateCookie   = "kubepark_oidc_state"
+	// shareCookie holds a redeemed share link.
+	shareCookie = "kubepark_share"
 	// oidcCallbackPath is where the IdP redirects back to; it lives under a
 	// reserved prefix so it never collides with a sandbox route.
 	oidcCallbackPath = "/kubepark/oidc/callback"
 )
 
+// CookieAuthConfig configures a CookieAuthenticator.
+type CookieAuthConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// PrincipalClaim is the ID-token claim used as the principal (default
+	// "email").
+	PrincipalClaim string
+	// AuthHost keeps the master session and receives the OIDC callback;
+	// every other host gets its session from it by ticket.
+	AuthHost string
+	// BaseDomain bounds the hosts a ticket is issued for: the base domain
+	// itself and its routing hosts.
+	BaseDomain string
+	// HMACKey signs cookies and tickets; it should be stable across gateway
+	// replicas (sourced from a Secret).
+	HMACKey []byte
+	// TTL bounds the master session, and with it every host session.
+	TTL time.Duration
+	// Secure marks cookies Secure and host-locked and builds https URLs;
+	// only tests run without it.
+	Secure bool
+	// Revocations, when set, makes a logout end the session on every host
+	// and replica rather than only in the browser that signed out.
+	Revocations Revocations
+	// Tokens, when set, accepts personal access tokens as bearer tokens.
+	Tokens *Tokens
+}
+
 // CookieAuthenticator implements Authenticator with an OIDC auth-code flow
-// and an HMAC-signed session cookie. It is the browser counterpart to the
-// CLI's PKCE flow.
+// and HMAC-signed session cookies. It is the browser counterpart to the
+// CLI's PKCE flow. Logging in happens once, on the auth host; other hosts
+// receive their own host-only session through a single-use ticket, so no
+// cookie is ever shared between sandboxes.
 type CookieAuthenticator struct {
+	cfg      CookieAuthConfig
 	oauth    oauth2.Config
 	verifier *oidc.IDTokenVerifier
-	claim    string
-	hmacKey  []byte
-	ttl      time.Duration
-	secure   bool
+	// Now is injected for tests.
+	Now func() time.Time
+
+	mu sync.Mutex
+	// redeemed maps the tickets redeemed on this replica to their expiry.
+	redeemed map[string]int64
 }
 
-// NewCookieAuthenticator builds the authenticator against the given
-// provider. hmacKey signs session cookies; it should be stable across
-// gateway replicas (sourced from a Secret).
-func NewCookieAuthenticator(ctx context.Context, issuer, clientID, clientSecret, redirectBase, claim string, hmacKey []byte, ttl time.Duration, secure bool) (*CookieAuthenticator, error) {
-	provider, err := oidc.NewProvider(ctx, issuer)
+// NewCookieAuthenticator builds the authenticator against the configured
+// provider.
+func NewCookieAuthenticator(ctx context.Context, cfg CookieAuthConfig) (*CookieAuthenticator, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
 	if err != nil {
 		return nil, fmt.Errorf("discover OIDC provider: %w", err)
 	}
-	if claim == "" {
-		claim = defaultPrincipalClaim
-	}
-	return &CookieAuthenticator{
-		oauth: oauth2.Config{
-			ClientID:     clientID,
-			ClientSecret: clientSecret,
-			Endpoint:     provider.Endpoint(),
-			RedirectURL:  strings.TrimSuffix(redirectBase, "/") + oidcCallbackPath,
-			Scopes:       []string{oidc.ScopeOpenID, "email", "profile", "groups"},
-		},
-		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
-		claim:    claim,
-		hmacKey:  hmacKey,
-		ttl:      ttl,
-		secure:   secure,
-	}, nil
+	a := newCookieAuthenticator(cfg)
+	a.oauth = oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  a.authURL(oidcCallbackPath),
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile", "groups"},
+	}
+	a.verifier = provider.Verifier(&oidc.Config{ClientID: cfg.ClientID})
+	return a, nil
+}
+
+func newCookieAuthenticator(cfg CookieAuthConfig) *CookieAuthenticator {
+	if cfg.PrincipalClaim == "" {
+		cfg.PrincipalClaim = defaultPrincipalClaim
+	}
+	if cfg.AuthHost == "" {
+		cfg.AuthHost = cfg.BaseDomain
+	}
+	return &CookieAuthenticator{cfg: cfg, Now: time.Now, redeemed: map[string]int64{}}
 }
 
 type sessionClaims struct {
 	Principal string   `json:"p"`
 	Groups    []string `json:"g,omitempty"`
-	Expiry    int64    `json:"e"`
+	// SID names the master session; every host session minted from it
+	// shares it, so revoking it signs the user out everywhere.
+	SID    string `json:"s"`
+	Expiry int64  `json:"e"`
+	// Host is the host a host session was minted for; empty for the
+	// master session.
+	Host string `json:"h,omitempty"`
+}
+
+// Identify authenticates a programmatic client by its bearer token, an ID
+// token of the same issuer or a personal access token, and a browser by the
+// signed session cookie for the request's host. A bearer token that does
+// not verify may belong to the app itself, so a valid cookie still counts.
+func (a *CookieAuthenticator) Identify(r *http.Request) (Identity, bool) {
+	if token, ok := bearerToken(r); ok {
+		if id, ok := a.identifyBearer(r, token); ok {
+			return id, true
+		}
+	}
+	claims, ok, err := a.session(r, sessionCookie, purposeSession)
+	if err != nil {
+		log.FromContext(r.Context()).Error(err, "failed to check session revocation")
+	}
+	if !ok || !strings.EqualFold(claims.Host, r.Host) {
+		return Identity{}, false
+	}
+	return Identity{Principal: claims.Principal, Groups: claims.Groups}, true
+}
+
+// identifyBearer verifies a bearer token.
+func (a *CookieAuthenticator) identifyBearer(r *http.Request, token string) (Identity, bool) {
+	logger := log.FromContext(r.Context())
+	if isPersonalToken(token) {
+		if a.cfg.Tokens == nil {
+			return Identity{}, false
+		}
+		claims, err := a.cfg.Tokens.Verify(r.Context(), token)
+		if err != nil {
+			logger.V(1).Info("rejected personal access token", "reason", err.Error())
+			return Identity{}, false
+		}
+		// Tokens are always scoped; no scopes would read as unrestricted.
+		if len(claims.Scopes) == 0 {
+			return Identity{}, false
+		}
+		return Identity{
+			Principal: claims.Principal, Groups: claims.Groups, FromAuthorization: true, Scopes: claims.Scopes,
+		}, true
+	}
+	if a.verifier == nil {
+		return Identity{}, false
+	}
+	idToken, err := a.verifier.Verify(r.Context(), token)
+	if err != nil {
+		logger.V(1).Info("rejected bearer ID token", "reason", err.Error())
+		return Identity{}, false
+	}
+	principal, groups := identityFromToken(idToken, a.cfg.PrincipalClaim)
+	if principal == "" {
+		return Identity{}, false
+	}
+	return Identity{Principal: principal, Groups: groups, FromAuthorization: true}, true
 }
 
-// Identify verifies the signed session cookie.
-func (a *CookieAuthenticator) Identify(r *http.Request) (string, []string, bool) {
-	cookie, err := r.Cookie(sessionCookie)
+// session verifies the named session cookie and that it has not been
+// revoked. An error means revocation could not be checked; the session is
+// then not honored.
+func (a *CookieAuthenticator) session(r *http.Request, name, purpose string) (sessionClaims, bool, error) {
+	claims, ok := a.cookieClaims(r, name, purpose)
+	if !ok || a.cfg.Revocations == nil {
+		return claims, ok, nil
+	}
+	revoked, err := a.cfg.Revocations.Revoked(r.Context(), claims.SID)
+	if err != nil || revoked {
+		return sessionClaims{}, false, err
+	}
+	return claims, true, nil
+}
+
+// cookieClaims verifies the named session cookie and its expiry.
+func (a *CookieAuthenticator) cookieClaims(r *http.Request, name, purpose string) (sessionClaims, bool) {
+	cookie, err := r.Cookie(a.cookieName(name))
 	if err != nil {
-		return "", nil, false
+		return sessionClaims{}, false
 	}
-	claims, ok := a.verifyCookie(cookie.Value)
-	if !ok || time.Now().Unix() > claims.Expiry {
-		return "", nil, false
+	var claims sessionClaims
+	if !a.verify(purpose, cookie.Value, &claims) || a.Now().Unix() > claims.Expiry {
+		return sessionClaims{}, false
 	}
-	return claims.Principal, claims.Groups, true
+	return claims, true
 }
 
-// StartLogin redirects into the OIDC flow, remembering the original URL.
+// StartLogin sends the browser to the auth host for a ticket, remembering
+// the original URL. The handoff cookie it sets here is what a ticket must
+// match, so a ticket minted for another browser is refused. A client that
+// sent a bearer token is not a browser and gets a 401 instead.
 func (a *CookieAuthenticator) StartLogin(w http.ResponseWriter, r *http.Request) {
+	if _, ok := bearerToken(r); ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="kubepark", error="invalid_token"`)
+		http.Error(w, "invalid bearer token", http.StatusUnauthorized)
+		return
+	}
+	nonce := randomString()
+	// Logins racing in several tabs share one nonce, so each tab's ticket
+	// still matches.
+	if c, err := r.Cookie(a.cookieName(handoffCookie)); err == nil && c.Value != "" {
+		nonce = c.Value
+	}
+	a.setCookie(w, handoffCookie, nonce, 600)
+	back := url.URL{Scheme: a.scheme(), Host: r.Host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+	q := url.Values{"rd": {back.String()}, "n": {nonce}}
+	http.Redirect(w, r, a.authURL(authStartPath)+"?"+q.Encode(), http.StatusFound)
+}
+
+// beginOIDC starts the auth-code flow on the auth host, returning to
+// returnTo, a path on the auth host, once the master session is set.
+func (a *CookieAuthenticator) beginOIDC(w http.ResponseWriter, r *http.Request, returnTo string) {
 	state := randomString()
-	http.SetCookie(w, &http.Cookie{
-		Name: stateCookie, Value: state + "|" + r.URL.String(),
-		Path: "/", HttpOnly: true, Secure: a.secure, SameSite: http.SameSiteLaxMode,
-		MaxAge: 600,
-	})
+	a.setCookie(w, stateCookie, state+"|"+returnTo, 600)
 	http.Redirect(w, r, a.oauth.AuthCodeURL(state), http.StatusFound)
 }
 
 // Callback handles the OIDC redirect: it verifies the ID token, sets the
-// session cookie, and returns the user to their original URL.
+// master session cookie, and resumes the ticket handoff.
 func (a *CookieAuthenticator) Callback(w http.ResponseWriter, r *http.Request) {
-	stateRaw, err := r.Cookie(stateCookie)
+	stateRaw, err := r.Cookie(a.cookieName(stateCookie))
 	if err != nil {
 		http.Error(w, "missing state", http.StatusBadRequest)
 		return
@@ -145,60 +287,110 @@ func (a *CookieAuthenticator) Callback(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid id_token", http.StatusUnauthorized)
 		return
 	}
-	principal, groups := identityFromToken(idToken, a.claim)
+	principal, groups := identityFromToken(idToken, a.cfg.PrincipalClaim)
 	if principal == "" {
 		http.Error(w, "no principal claim", http.StatusBadRequest)
 		return
 	}
 
-	value := a.signCookie(sessionClaims{
-		Principal: principal, Groups: groups, Expiry: time.Now().Add(a.ttl).Unix(),
+	a.setCookie(w, stateCookie, "", -1)
+	a.setSession(w, ssoCookie, purposeSSO, sessionClaims{
+		Principal: principal, Groups: groups, SID: randomString(), Expiry: a.Now().Add(a.cfg.TTL).Unix(),
 	})
+	http.Redirect(w, r, localPath(returnTo), http.StatusFound)
+}
+
+// setSession sets a session cookie that lives as long as the session.
+func (a *CookieAuthenticator) setSession(w http.ResponseWriter, name, purpose string, claims sessionClaims) {
+	a.setCookie(w, name, a.sign(purpose, claims), int(claims.Expiry-a.Now().Unix()))
+}
+
+// setCookie sets a gateway cookie, host-only and for the whole host: with
+// Secure it takes the __Host- prefix, so the browser refuses a copy that a
+// sibling sandbox host tries to plant with a Domain attribute. A negative
+// maxAge deletes it.
+func (a *CookieAuthenticator) setCookie(w http.ResponseWriter, name, value string, maxAge int) {
 	http.SetCookie(w, &http.Cookie{
-		Name: sessionCookie, Value: value, Path: "/",
-		HttpOnly: true, Secure: a.secure, SameSite: http.SameSiteLaxMode,
-		MaxAge: int(a.ttl.Seconds()),
+		Name: a.cookieName(name), Value: value, Path: "/",
+		HttpOnly: true, Secure: a.cfg.Secure, SameSite: http.SameSiteLaxMode,
+		MaxAge: maxAge,
 	})
-	if returnTo == "" {
-		returnTo = "/"
+}
+
+func (a *CookieAuthenticator) cookieName(name string) string {
+	if a.cfg.Secure {
+		return hostCookiePrefix + name
 	}
-	http.Redirect(w, r, returnTo, http.StatusFound)
+	return name
 }
 
-// IsCallback reports whether a request targets the OIDC callback path.
-func (a *CookieAuthenticator) IsCallback(r *http.Request) bool {
-	return r.URL.Path == oidcCallbackPath
+func (a *CookieAuthenticator) scheme() string {
+	if a.cfg.Secure {
+		return "https"
+	}
+	return "http"
+}
+
+// authURL is the URL of path on the auth host.
+func (a *CookieAuthenticator) authURL(path string) string {
+	return a.scheme() + "://" + a.cfg.AuthHost + path
 }
 
-func (a *CookieAuthenticator) signCookie(claims sessionClaims) string {
+// Signing purposes keep a value signed for one use from passing as
+// another, such as a ticket presented as a session cookie.
+const (
+	purposeSession = "session"
+	purposeSSO     = "sso"
+	purposeTicket  = "ticket"
+	purposeToken   = "token"
+	purposeShare   = "share"
+)
+
+func (a *CookieAuthenticator) sign(purpose string, claims any) string {
+	return signValue(a.cfg.HMACKey, purpose, claims)
+}
+
+func (a *CookieAuthenticator) verify(purpose, value string, claims any) bool {
+	return verifyValue(a.cfg.HMACKey, purpose, value, claims)
+}
+
+// signValue serializes claims with an HMAC under key for purpose.
+func signValue(key []byte, purpose string, claims any) string {
 	payload, _ := json.Marshal(claims)
 	b := base64.RawURLEncoding.EncodeToString(payload)
-	mac := hmac.New(sha256.New, a.hmacKey)
-	mac.Write([]byte(b))
-	sig := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
-	return b + "." + sig
+	return b + "." + macValue(key, purpose, b)
 }
 
-func (a *CookieAuthenticator) verifyCookie(value string) (sessionClaims, bool) {
+// verifyValue checks a value made by signValue for purpose and decodes its
+// claims.
+func verifyValue(key []byte, purpose, value string, claims any) bool {
 	b, sig, ok := strings.Cut(value, ".")
 	if !ok {
-		return sessionClaims{}, false
+		return false
 	}
-	mac := hmac.New(sha256.New, a.hmacKey)
-	mac.Write([]byte(b))
-	want := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
-	if subtle.ConstantTimeCompare([]byte(sig), []byte(want)) != 1 {
-		return sessionClaims{}, false
+	if subtle.ConstantTimeCompare([]byte(sig), []byte(macValue(key, purpose, b))) != 1 {
+		return false
 	}
 	payload, err := base64.RawURLEncoding.DecodeString(b)
 	if err != nil {
-		return sessionClaims{}, false
+		return false
 	}
-	var claims sessionClaims
-	if err := json.Unmarshal(payload, &claims); err != nil {
-		return sessionClaims{}, false
+	return json.Unmarshal(payload, claims) == nil
+}
+
+func macValue(key []byte, purpose, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose + "\x00" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// localPath returns p when it is a path on the current host, and "/"
+// otherwise, so a redirect parameter cannot send the browser elsewhere.
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
 	}
-	return claims, true
+	return p
 }
 
 // identityFromToken extracts the principal claim and any groups.
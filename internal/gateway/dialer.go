@@ -18,21 +18,28 @@ package gateway
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
-	"github.com/frauniki/kubepark/internal/controller/podspec"
 )
 
-// Dialer opens a TCP connection to a sandbox's agent. The interface is the
-// seam a future reverse-tunnel transport slots into without touching auth
-// or routing; v1 dials the pod IP directly (the gateway runs in-cluster).
+// Dialer opens a TCP connection to a port of a sandbox pod: the agent, or
+// an exposed port. It keeps the transport apart from auth and routing: the
+// direct dialer reaches the pod IP (the gateway runs in-cluster), Tunnels
+// goes through the agent's reverse tunnel where there is no such route, and
+// the port-forward dialer through the API server.
 type Dialer interface {
-	DialSandbox(ctx context.Context, sb *kubeparkv1alpha1.Sandbox) (net.Conn, error)
+	DialSandbox(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, port int32) (net.Conn, error)
 }
 
-// directDialer connects straight to status.podIP:2222.
+// directDialer connects straight to status.podIP:<port>. A member
+// cluster's pod IPs mean nothing on the gateway's network, and may name an
+// unrelated pod of its own, so it never dials them.
 type directDialer struct {
 	dial func(ctx context.Context, network, addr string) (net.Conn, error)
 }
@@ -43,14 +50,51 @@ func NewDirectDialer() Dialer {
 	return &directDialer{dial: d.DialContext}
 }
 
-func (d *directDialer) DialSandbox(ctx context.Context, sb *kubeparkv1alpha1.Sandbox) (net.Conn, error) {
+func (d *directDialer) DialSandbox(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, port int32) (net.Conn, error) {
+	if cluster := ClusterFromContext(ctx); cluster != "" {
+		return nil, ErrNoRoute{Reason: "pod IPs of member clusters are not dialed directly", Cluster: cluster}
+	}
 	if sb.Status.PodIP == "" {
 		return nil, ErrNoRoute{Reason: "sandbox has no pod IP yet"}
 	}
-	addr := net.JoinHostPort(sb.Status.PodIP, fmt.Sprintf("%d", podspec.AgentPort))
+	addr := net.JoinHostPort(sb.Status.PodIP, fmt.Sprintf("%d", port))
 	conn, err := d.dial(ctx, "tcp", addr)
 	if err != nil {
-		return nil, fmt.Errorf("dial sandbox agent %s: %w", addr, err)
+		return nil, fmt.Errorf("dial sandbox %s: %w", addr, err)
 	}
 	return conn, nil
 }
+
+// fallbackDialTimeout bounds the primary dial of a fallbackDialer, since
+// an unroutable pod IP otherwise hangs until the kernel gives up.
+const fallbackDialTimeout = 5 * time.Second
+
+// fallbackDialer dials through primary, and through fallback when primary
+// fails to connect.
+type fallbackDialer struct {
+	primary, fallback Dialer
+	timeout           time.Duration
+}
+
+// NewFallbackDialer returns a Dialer that tries primary, e.g. the direct
+// dialer, and falls back to fallback, e.g. port-forward, when it cannot
+// connect. A sandbox primary has no route to at all, like one without a
+// pod, is not retried; one in a member cluster primary cannot reach is.
+func NewFallbackDialer(primary, fallback Dialer) Dialer {
+	return &fallbackDialer{primary: primary, fallback: fallback, timeout: fallbackDialTimeout}
+}
+
+func (d *fallbackDialer) DialSandbox(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, port int32) (net.Conn, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, d.timeout)
+	conn, err := d.primary.DialSandbox(dialCtx, sb, port)
+	cancel()
+	if err == nil {
+		return conn, nil
+	}
+	var noRoute ErrNoRoute
+	if (errors.As(err, &noRoute) && noRoute.Cluster == "") || ctx.Err() != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).V(1).Info("falling back", "sandbox", sb.Name, "port", port, "reason", err.Error())
+	return d.fallback.DialSandbox(ctx, sb, port)
+}
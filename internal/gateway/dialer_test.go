@@ -0,0 +1,104 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+// dialFunc adapts a function to a Dialer, counting its calls.
+type dialFunc struct {
+	calls int
+	dial  func() (net.Conn, error)
+}
+
+func (d *dialFunc) DialSandbox(context.Context, *kubeparkv1alpha1.Sandbox, int32) (net.Conn, error) {
+	d.calls++
+	return d.dial()
+}
+
+// TestFallbackDialer proves a failed connect falls back, and so does a
+// member cluster the primary cannot reach, but a sandbox with no route at
+// all does not.
+func TestFallbackDialer(t *testing.T) {
+	ctx := context.Background()
+	sb := portForwardSandbox("kubepark-sb-demo")
+	fallbackConn, _ := net.Pipe()
+	for _, tc := range []struct {
+		name         string
+		primaryErr   error
+		wantFallback bool
+	}{
+		{name: "connected", primaryErr: nil},
+		{name: "connect failed", primaryErr: errors.New("dial tcp 10.0.0.5:2222: i/o timeout"), wantFallback: true},
+		{name: "no route", primaryErr: ErrNoRoute{Reason: "sandbox has no pod IP yet"}},
+		{name: "member cluster", primaryErr: ErrNoRoute{Reason: "not dialed", Cluster: "tokyo"}, wantFallback: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			primaryConn, _ := net.Pipe()
+			primary := &dialFunc{dial: func() (net.Conn, error) {
+				if tc.primaryErr != nil {
+					return nil, tc.primaryErr
+				}
+				return primaryConn, nil
+			}}
+			fallback := &dialFunc{dial: func() (net.Conn, error) { return fallbackConn, nil }}
+
+			conn, err := NewFallbackDialer(primary, fallback).DialSandbox(ctx, sb, 2222)
+			switch {
+			case tc.wantFallback:
+				if err != nil || conn != fallbackConn {
+					t.Errorf("dial = %v, %v; want the fallback's connection", conn, err)
+				}
+			case tc.primaryErr != nil:
+				if !errors.Is(err, tc.primaryErr) || fallback.calls != 0 {
+					t.Errorf("dial = %v with %d fallbacks; want the primary's error alone", err, fallback.calls)
+				}
+			default:
+				if err != nil || conn != primaryConn || fallback.calls != 0 {
+					t.Errorf("dial = %v, %v; want the primary's connection", conn, err)
+				}
+			}
+		})
+	}
+}
+
+// TestDirectDialerMemberCluster proves a member cluster's pod IP is never
+// dialed on the gateway's network, where it may name another pod.
+func TestDirectDialerMemberCluster(t *testing.T) {
+	dialed := false
+	d := &directDialer{dial: func(context.Context, string, string) (net.Conn, error) {
+		dialed = true
+		c, _ := net.Pipe()
+		return c, nil
+	}}
+	sb := &kubeparkv1alpha1.Sandbox{Status: kubeparkv1alpha1.SandboxStatus{PodIP: "10.0.0.5"}}
+
+	_, err := d.DialSandbox(WithCluster(context.Background(), "tokyo"), sb, 2222)
+	var noRoute ErrNoRoute
+	if !errors.As(err, &noRoute) || noRoute.Cluster != "tokyo" || dialed {
+		t.Fatalf("member dial = %v (dialed %v), want ErrNoRoute for tokyo", err, dialed)
+	}
+	if _, err := d.DialSandbox(context.Background(), sb, 2222); err != nil || !dialed {
+		t.Fatalf("own cluster dial = %v (dialed %v), want the pod IP dialed", err, dialed)
+	}
+}
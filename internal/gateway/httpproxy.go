@@ -17,44 +17,82 @@ limitations under the License.
 package gateway
 
 import (
+	"context"
 	"fmt"
+	"html/template"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"slices"
+	"strings"
+	"time"
 
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
 )
 
+// Identity is the authenticated caller of an HTTP request.
+type Identity struct {
+	Principal string
+	Groups    []string
+	// FromAuthorization is set when the Authorization header carried the
+	// credential; it is then not forwarded to the sandbox.
+	FromAuthorization bool
+	// Scopes, when set, limits a personal access token to some sandboxes
+	// and ports.
+	Scopes []TokenScope
+}
+
 // Authenticator resolves the authenticated OIDC identity of an HTTP request
-// (via a session cookie), or returns ok=false to trigger a login redirect.
+// (via a session cookie or a bearer token), or returns ok=false to trigger
+// a login.
 // It is an interface so the cookie/OIDC machinery can evolve independently
 // of routing and authorization.
 type Authenticator interface {
-	// Identify returns the caller's principal and groups, or ok=false when
-	// the request is unauthenticated.
-	Identify(r *http.Request) (principal string, groups []string, ok bool)
+	// Identify returns the caller's identity, or ok=false when the request
+	// is unauthenticated.
+	Identify(r *http.Request) (id Identity, ok bool)
 	// StartLogin redirects an unauthenticated request into the OIDC flow.
 	StartLogin(w http.ResponseWriter, r *http.Request)
 }
 
 // HTTPProxyConfig configures the HTTP reverse proxy.
 type HTTPProxyConfig struct {
+	// BaseDomain is the parent domain of routing hosts, and the gateway's
+	// own host name.
 	BaseDomain string
-	Store      Store
+	// Routing selects host routing, path routing or both (default host).
+	Routing RoutingMode
+	Store   Store
 	// Auth is optional; without it, only auth:none ports are reachable.
 	Auth Authenticator
+	// Shares, when set, admits share links to the auth:oidc ports that
+	// allow them.
+	Shares *ShareLinks
+	// Identity, when set, signs an identity assertion for every request to
+	// an auth:oidc port and serves its JWKS.
+	Identity *IdentitySigner
+	// Terminal, when set, serves the web terminal on the auth host.
+	Terminal *WebTerminal
 	// DialAddr resolves a sandbox and its resolved numeric container port to
 	// an upstream base URL; defaults to http://<podIP>:<port>.
 	DialAddr func(sb *kubeparkv1alpha1.Sandbox, port int32) string
+	// Dialer, when set, carries the upstream connections, e.g. through the
+	// reverse tunnel; by default they are dialed at DialAddr.
+	Dialer Dialer
+	// Now is injected for tests.
+	Now func() time.Time
 }
 
 // HTTPProxy routes authenticated browser traffic to a sandbox's exposed
-// ports by host name.
+// ports by host name. Traffic to auth:oidc ports is recorded as HTTP
+// sessions, which keep the sandbox awake and wake it when it is not
+// running; run Start to maintain them.
 type HTTPProxy struct {
-	cfg HTTPProxyConfig
+	cfg      HTTPProxyConfig
+	sessions *httpSessions
 }
 
 // NewHTTPProxy builds the proxy handler.
@@ -64,25 +102,55 @@ func NewHTTPProxy(cfg HTTPProxyConfig) *HTTPProxy {
 			return fmt.Sprintf("http://%s:%d", sb.Status.PodIP, port)
 		}
 	}
-	return &HTTPProxy{cfg: cfg}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if cfg.Routing == "" {
+		cfg.Routing = RoutingHost
+	}
+	return &HTTPProxy{cfg: cfg, sessions: newHTTPSessions(cfg.Store, cfg.Now)}
+}
+
+// Start heartbeats and closes HTTP sessions until ctx is done, then closes
+// those still open. It implements manager.Runnable.
+func (p *HTTPProxy) Start(ctx context.Context) error {
+	p.sessions.run(ctx)
+	return nil
 }
 
 func (p *HTTPProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	logger := log.FromContext(r.Context())
 
-	// The OIDC callback is handled before routing so it works regardless of
-	// which sandbox host the browser is on.
-	if ca, ok := p.cfg.Auth.(*CookieAuthenticator); ok && ca.IsCallback(r) {
-		ca.Callback(w, r)
+	// Login and logout are handled before routing so they work regardless
+	// of which host the browser is on.
+	if ca, ok := p.cfg.Auth.(*CookieAuthenticator); ok && ca.IsAuthEndpoint(r) {
+		ca.ServeHTTP(w, r)
+		return
+	}
+	if p.cfg.Identity != nil && r.URL.Path == jwksPath {
+		p.cfg.Identity.ServeHTTP(w, r)
+		return
+	}
+	if p.cfg.Terminal != nil && p.cfg.Terminal.Handles(r) {
+		p.cfg.Terminal.ServeHTTP(w, r)
 		return
 	}
 
-	target, err := ParseHTTPHost(r.Host, p.cfg.BaseDomain)
+	target, prefix, err := p.route(r)
 	if err != nil {
 		http.Error(w, "unknown route", http.StatusNotFound)
 		return
 	}
+	// The sandbox sees its root as "/": without the slash, relative links
+	// on its index page would resolve outside the route.
+	if prefix != "" && r.URL.Path == prefix {
+		to := url.URL{Path: prefix + "/", RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, to.String(), http.StatusPermanentRedirect)
+		return
+	}
 
+	// The store, sessions and dialer act on the sandbox's cluster.
+	r = r.WithContext(WithCluster(r.Context(), target.Cluster))
 	sb, err := p.cfg.Store.GetSandbox(r.Context(), target.Namespace, target.Sandbox)
 	if err != nil {
 		http.Error(w, "sandbox not found", http.StatusNotFound)
@@ -94,30 +162,59 @@ func (p *HTTPProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Authorization depends on the port's auth mode.
-	if port.Auth == kubeparkv1alpha1.AuthModeOIDC {
+	// Authorization depends on the port's auth mode. A share link admits
+	// its holder without an identity, so like auth:none it neither wakes
+	// the sandbox nor records sessions.
+	var id *Identity
+	shared := false
+	if port.Auth == kubeparkv1alpha1.AuthModeOIDC && port.ShareLinks != nil && p.cfg.Shares != nil {
+		var done bool
+		if shared, done = p.cfg.Shares.admit(w, r, sb, port, prefix); done {
+			return
+		}
+	}
+	if port.Auth == kubeparkv1alpha1.AuthModeOIDC && !shared {
 		if p.cfg.Auth == nil {
 			http.Error(w, "OIDC is not configured on this gateway", http.StatusServiceUnavailable)
 			return
 		}
-		principal, groups, ok := p.cfg.Auth.Identify(r)
+		caller, ok := p.cfg.Auth.Identify(r)
 		if !ok {
 			p.cfg.Auth.StartLogin(w, r)
 			return
 		}
-		if !authorizedForPort(sb, port, principal, groups) {
+		id = &caller
+		principal := caller.Principal
+		if !authorizedForPort(sb, port, principal, caller.Groups) ||
+			!scopesAllow(caller.Scopes, target.Cluster, sb.Namespace, sb.Name, port.Name) {
 			http.Error(w, "forbidden", http.StatusForbidden)
 			return
 		}
+
+		// Authenticated traffic wakes the sandbox and keeps it awake. The
+		// session outlives the request, so it must not be cancelled with it.
+		sessionCtx := context.WithoutCancel(r.Context())
+		if !sandboxRunning(sb) {
+			p.wake(sessionCtx, w, r, sb, principal)
+			return
+		}
+		defer p.sessions.begin(sessionCtx, sb, principal, r.RemoteAddr)()
 	}
 
-	// Unauthenticated (auth:none) traffic must never wake a suspended
+	// Unauthenticated (auth:none or shared) traffic must never wake a suspended
 	// sandbox or create session records; return a clear 503 instead.
 	if sb.Status.PodIP == "" {
 		http.Error(w, "sandbox is suspended", http.StatusServiceUnavailable)
 		return
 	}
 
+	// A member cluster's pod IP means nothing here, and may name another
+	// pod; only a Dialer reaches it.
+	if p.cfg.Dialer == nil && target.Cluster != "" {
+		http.Error(w, "no route to the sandbox's cluster", http.StatusBadGateway)
+		return
+	}
+
 	upstream, err := url.Parse(p.cfg.DialAddr(sb, port.Port))
 	if err != nil {
 		http.Error(w, "bad upstream", http.StatusInternalServerError)
@@ -125,21 +222,234 @@ func (p *HTTPProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	logger.V(1).Info("proxying http", "sandbox", sb.Name, "port", target.Port)
 
+	var assertion string
+	if id != nil && p.cfg.Identity != nil {
+		if assertion, err = p.cfg.Identity.Assert(id.Principal, id.Groups, target.Cluster, sb.Namespace, sb.Name); err != nil {
+			logger.Error(err, "failed to sign identity assertion")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// httputil.ReverseProxy transparently supports WebSocket upgrades.
 	proxy := httputil.NewSingleHostReverseProxy(upstream)
+	if p.cfg.Dialer != nil {
+		proxy.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return p.cfg.Dialer.DialSandbox(ctx, sb, port.Port)
+			},
+			// The transport lives for this request; pooled connections
+			// would only leak.
+			DisableKeepAlives: true,
+		}
+	}
+	direct := proxy.Director
+	proxy.Director = func(out *http.Request) {
+		direct(out)
+		// The sandbox owner controls the app; it gets the caller's identity,
+		// never a credential it could replay against another sandbox.
+		scrubRequest(out.Header, id != nil && id.FromAuthorization)
+		if id != nil {
+			out.Header.Set(HeaderForwardedUser, id.Principal)
+			if len(id.Groups) > 0 {
+				out.Header.Set(HeaderForwardedGroups, strings.Join(id.Groups, ","))
+			}
+			if assertion != "" {
+				out.Header.Set(HeaderIdentity, assertion)
+			}
+		}
+	}
+	if prefix != "" {
+		r = stripPrefix(r, prefix)
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		scrubResponse(resp.Header)
+		if prefix != "" {
+			restorePrefix(resp.Header, prefix, upstream.Host, r.Host)
+		}
+		return nil
+	}
 	proxy.ServeHTTP(w, r)
 }
 
-// findExposedPort returns the exposed port with the given name.
+// route resolves the target of a request under the configured routing
+// mode. The prefix is empty for a host route.
+func (p *HTTPProxy) route(r *http.Request) (HTTPTarget, string, error) {
+	if p.cfg.Routing != RoutingPath {
+		target, err := ParseHTTPHost(r.Host, p.cfg.BaseDomain)
+		if err == nil || p.cfg.Routing == RoutingHost {
+			return target, "", err
+		}
+	}
+	return ParseHTTPPath(r.URL.Path)
+}
+
+// stripPrefix returns r as the sandbox should see it: rooted at "/", with
+// the route prefix passed in X-Forwarded-Prefix for apps that build
+// absolute URLs.
+func stripPrefix(r *http.Request, prefix string) *http.Request {
+	out := r.Clone(r.Context())
+	out.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+	out.URL.RawPath = ""
+	if raw, ok := strings.CutPrefix(r.URL.RawPath, prefix); ok {
+		out.URL.RawPath = raw
+	}
+	out.Header.Set("X-Forwarded-Prefix", prefix)
+	return out
+}
+
+// restorePrefix puts the route prefix back on the paths a sandbox hands
+// out in redirects and cookies. Paths that already carry it, from apps
+// honoring X-Forwarded-Prefix, are left alone.
+func restorePrefix(h http.Header, prefix, upstreamHost, publicHost string) {
+	if loc := h.Get("Location"); loc != "" {
+		h.Set("Location", prefixLocation(loc, prefix, upstreamHost, publicHost))
+	}
+	cookies := h.Values("Set-Cookie")
+	for i, c := range cookies {
+		cookies[i] = prefixCookiePath(c, prefix)
+	}
+}
+
+// prefixLocation rewrites a redirect to an absolute path, or to the
+// sandbox's or gateway's own host, into the route. Relative redirects
+// already resolve inside it and other hosts are not the sandbox's.
+func prefixLocation(loc, prefix, upstreamHost, publicHost string) string {
+	u, err := url.Parse(loc)
+	if err != nil {
+		return loc
+	}
+	if u.Host != "" && u.Host != upstreamHost && u.Host != publicHost {
+		return loc
+	}
+	if u.Host == "" && (u.Scheme != "" || !strings.HasPrefix(u.Path, "/")) {
+		return loc
+	}
+	u.Scheme, u.Host = "", ""
+	if !hasPathPrefix(u.Path, prefix) {
+		u.Path = prefix + u.Path
+		if u.RawPath != "" {
+			u.RawPath = prefix + u.RawPath
+		}
+	}
+	return u.String()
+}
+
+// prefixCookiePath scopes a Set-Cookie to the route: its Path moves under
+// the prefix, defaulting to the route root, and any Domain is dropped, as
+// the sandbox's host is not the browser's.
+func prefixCookiePath(line, prefix string) string {
+	attrs := strings.Split(line, ";")
+	out := []string{attrs[0]}
+	hasPath := false
+	for _, attr := range attrs[1:] {
+		name, value, _ := strings.Cut(strings.TrimSpace(attr), "=")
+		switch strings.ToLower(name) {
+		case "domain":
+			continue
+		case "path":
+			hasPath = true
+			if !strings.HasPrefix(value, "/") {
+				value = "/"
+			}
+			if !hasPathPrefix(value, prefix) {
+				value = prefix + value
+			}
+			attr = " Path=" + value
+		}
+		out = append(out, attr)
+	}
+	if !hasPath {
+		out = append(out, " Path="+prefix+"/")
+	}
+	return strings.Join(out, ";")
+}
+
+// hasPathPrefix reports whether path is prefix or lies under it.
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// wake resumes a sandbox that is not running for an authorized user, and
+// answers with a page that reloads until it is.
+func (p *HTTPProxy) wake(ctx context.Context, w http.ResponseWriter, r *http.Request, sb *kubeparkv1alpha1.Sandbox, principal string) {
+	logger := log.FromContext(ctx)
+	p.sessions.revalidate(ctx, sb, principal)
+	p.sessions.begin(ctx, sb, principal, r.RemoteAddr)()
+	if err := p.cfg.Store.SetDesiredRunning(ctx, sb); err != nil {
+		logger.Error(err, "failed to resume sandbox", "sandbox", sb.Name)
+		http.Error(w, "sandbox could not be resumed", http.StatusInternalServerError)
+		return
+	}
+	logger.V(1).Info("waking sandbox for http", "sandbox", sb.Name, "user", principal)
+
+	w.Header().Set("Retry-After", fmt.Sprint(startingRefreshSeconds))
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodGet || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Error(w, "sandbox is starting", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_ = startingPage.Execute(w, struct {
+		Sandbox string
+		Refresh int
+	}{sb.Name, startingRefreshSeconds})
+}
+
+// sandboxRunning reports whether the sandbox can be proxied to now.
+func sandboxRunning(sb *kubeparkv1alpha1.Sandbox) bool {
+	return sb.Status.PodIP != "" && sb.Spec.DesiredState == kubeparkv1alpha1.DesiredStateRunning
+}
+
+// startingRefreshSeconds is how often the starting page reloads.
+const startingRefreshSeconds = 3
+
+// startingPage is shown to a browser while its sandbox starts. It reloads
+// the original URL, which is proxied once the sandbox is running.
+var startingPage = template.Must(template.New("starting").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Starting {{.Sandbox}}</title>
+<style>
+body { font-family: system-ui, sans-serif; display: flex; align-items: center; justify-content: center; height: 100vh; margin: 0; color: #333; }
+main { text-align: center; }
+</style>
+</head>
+<body>
+<main>
+<h1>Starting your sandbox</h1>
+<p><strong>{{.Sandbox}}</strong> was suspended and is starting up. This page reloads by itself.</p>
+</main>
+</body>
+</html>
+`))
+
+// findExposedPort returns the HTTP exposed port with the given name,
+// declared in the spec or forwarded by the sandbox's devcontainer.json.
+// TCP ports are not routed over HTTP.
 func findExposedPort(sb *kubeparkv1alpha1.Sandbox, name string) *kubeparkv1alpha1.ExposedPort {
-	for i := range sb.Spec.ExposedPorts {
-		if sb.Spec.ExposedPorts[i].Name == name {
-			return &sb.Spec.ExposedPorts[i]
+	ports := exposedPorts(sb)
+	for i := range ports {
+		if ports[i].Name == name && ports[i].Kind != kubeparkv1alpha1.ExposedPortTCP {
+			return &ports[i]
 		}
 	}
 	return nil
 }
 
+// exposedPorts lists the sandbox's exposed ports of either kind.
+func exposedPorts(sb *kubeparkv1alpha1.Sandbox) []kubeparkv1alpha1.ExposedPort {
+	ports := sb.Spec.ExposedPorts
+	if dc := sb.Status.Devcontainer; dc != nil {
+		ports = append(slices.Clip(ports), dc.ExposedPorts...)
+	}
+	return ports
+}
+
 // authorizedForPort enforces owner-match by default, widened by the port's
 // optional allowedUsers/allowedGroups. Authentication alone is never
 // sufficient — the request must map to the owner or an explicit allowee.
@@ -17,6 +17,12 @@ limitations under the License.
 package gateway
 
 import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -56,3 +62,143 @@ func TestAuthorizedForPort(t *testing.T) {
 		t.Error("a non-matching group must be forbidden")
 	}
 }
+
+func TestHTTPProxyPathRouting(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") == "echo" {
+			conn, buf, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+			_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+			_ = buf.Flush()
+			_, _ = io.Copy(conn, buf)
+			return
+		}
+		w.Header().Set("X-Seen-Path", r.URL.RequestURI())
+		w.Header().Set("X-Seen-Prefix", r.Header.Get("X-Forwarded-Prefix"))
+		w.Header().Add("Set-Cookie", "a=1; Path=/; HttpOnly")
+		w.Header().Add("Set-Cookie", "b=2; Domain=upstream.local")
+		w.Header().Set("Location", "/login?next=%2Flab")
+		w.WriteHeader(http.StatusFound)
+	}))
+	defer upstream.Close()
+
+	store := newSessionStore(testSandbox("10.0.0.1"))
+	gw := httptest.NewServer(NewHTTPProxy(HTTPProxyConfig{
+		BaseDomain: "kubepark.example.com",
+		Routing:    RoutingPath,
+		Store:      store,
+		Auth:       staticAuth{principal: "alice@example.com"},
+		DialAddr:   func(*kubeparkv1alpha1.Sandbox, int32) string { return upstream.URL },
+	}))
+	defer gw.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	// The route root gets its trailing slash.
+	resp, err := client.Get(gw.URL + "/s/alice/demo/jupyter?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if loc := resp.Header.Get("Location"); resp.StatusCode != http.StatusPermanentRedirect || loc != "/s/alice/demo/jupyter/?x=1" {
+		t.Fatalf("route root: %d %q, want a redirect to the trailing slash", resp.StatusCode, loc)
+	}
+
+	// The prefix is stripped on the way in and restored on the way out.
+	resp, err = client.Get(gw.URL + "/s/alice/demo/jupyter/lab/tree?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if got := resp.Header.Get("X-Seen-Path"); got != "/lab/tree?x=1" {
+		t.Errorf("upstream path = %q, want /lab/tree?x=1", got)
+	}
+	if got := resp.Header.Get("X-Seen-Prefix"); got != "/s/alice/demo/jupyter" {
+		t.Errorf("X-Forwarded-Prefix = %q", got)
+	}
+	if got := resp.Header.Get("Location"); got != "/s/alice/demo/jupyter/login?next=%2Flab" {
+		t.Errorf("Location = %q", got)
+	}
+	cookies := resp.Header.Values("Set-Cookie")
+	if len(cookies) != 2 || cookies[0] != "a=1; Path=/s/alice/demo/jupyter/; HttpOnly" ||
+		cookies[1] != "b=2; Path=/s/alice/demo/jupyter/" {
+		t.Errorf("Set-Cookie = %q", cookies)
+	}
+
+	// Other paths are not routed.
+	resp, err = client.Get(gw.URL + "/jupyter/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unrouted path: %d, want 404", resp.StatusCode)
+	}
+
+	// Upgrades pass through.
+	conn, err := net.Dial("tcp", strings.TrimPrefix(gw.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_, _ = io.WriteString(conn, "GET /s/alice/demo/jupyter/ws HTTP/1.1\r\nHost: kubepark.example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade: %d, want 101", resp.StatusCode)
+	}
+	_, _ = io.WriteString(conn, "ping")
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("echo over the upgraded connection = %q, %v", buf, err)
+	}
+}
+
+func TestPrefixLocation(t *testing.T) {
+	const prefix = "/s/alice/demo/jupyter"
+	cases := map[string]string{
+		"/lab":                              prefix + "/lab",
+		"lab":                               "lab",
+		prefix + "/lab":                     prefix + "/lab",
+		"http://10.0.0.1:8888/lab":          prefix + "/lab",
+		"https://kubepark.example.com/lab":  prefix + "/lab",
+		"https://idp.example.com/authorize": "https://idp.example.com/authorize",
+		"//idp.example.com/authorize":       "//idp.example.com/authorize",
+	}
+	for in, want := range cases {
+		if got := prefixLocation(in, prefix, "10.0.0.1:8888", "kubepark.example.com"); got != want {
+			t.Errorf("prefixLocation(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestHTTPProxyMemberNeedsDialer proves a member cluster's sandbox is not
+// proxied to its pod IP on the gateway's network, where it may be another
+// pod, when no Dialer can reach the cluster.
+func TestHTTPProxyMemberNeedsDialer(t *testing.T) {
+	hit := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { hit = true }))
+	defer upstream.Close()
+	gw := httptest.NewServer(NewHTTPProxy(HTTPProxyConfig{
+		BaseDomain: "kubepark.example.com",
+		Routing:    RoutingPath,
+		Store:      newSessionStore(testSandbox("10.0.0.1")),
+		Auth:       staticAuth{principal: "alice@example.com"},
+		DialAddr:   func(*kubeparkv1alpha1.Sandbox, int32) string { return upstream.URL },
+	}))
+	defer gw.Close()
+
+	resp, err := http.Get(gw.URL + "/s/alice.tokyo/demo/jupyter/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || hit {
+		t.Fatalf("member request = %d (upstream hit %v), want 502", resp.StatusCode, hit)
+	}
+}
@@ -18,14 +18,45 @@ package gateway
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 )
 
+// RoutingMode selects how the HTTP proxy finds the sandbox port a request
+// is for.
+type RoutingMode string
+
+const (
+	// RoutingHost routes by host name, <port>--<sandbox>--<ns>.<baseDomain>,
+	// or <port>--<sandbox>--<ns>.<cluster>.<baseDomain> for a member
+	// cluster. It needs wildcard DNS and a wildcard certificate (one per
+	// member cluster).
+	RoutingHost RoutingMode = "host"
+	// RoutingPath routes by path, /s/<ns>/<sandbox>/<port>/..., or
+	// /s/<ns>.<cluster>/<sandbox>/<port>/... for a member cluster, so a
+	// single host name serves every sandbox.
+	RoutingPath RoutingMode = "path"
+	// RoutingBoth accepts either; a routing host takes precedence.
+	RoutingBoth RoutingMode = "both"
+)
+
+// ParseRoutingMode validates a routing mode flag value.
+func ParseRoutingMode(s string) (RoutingMode, error) {
+	switch m := RoutingMode(s); m {
+	case RoutingHost, RoutingPath, RoutingBoth:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown HTTP routing mode %q (want host, path or both)", s)
+}
+
 // HTTPTarget is a parsed HTTP routing host.
 type HTTPTarget struct {
 	Port      string
 	Sandbox   string
 	Namespace string
+	// Cluster is the member cluster the sandbox lives in, "" for the
+	// gateway's own.
+	Cluster string
 }
 
 // maxLabelLen is the DNS single-label limit; the whole
@@ -34,7 +65,10 @@ type HTTPTarget struct {
 const maxLabelLen = 63
 
 // ParseHTTPHost parses a routing host of the form
-// "<port>--<sandbox>--<ns>.<baseDomain>". Parsing is LEFT-anchored: the
+// "<port>--<sandbox>--<ns>.<baseDomain>", where a member cluster's sandbox
+// has its cluster as one more label before the base domain. The routing
+// label keeps its form, so a cluster's hosts need only their own wildcard
+// certificate. Parsing of the routing label is LEFT-anchored: the
 // first "--" ends the port, the second ends the sandbox, and the remainder
 // is the namespace (which alone may legally contain "--"). The result is
 // re-serialized and compared to the input label so an ambiguous or crafted
@@ -56,6 +90,10 @@ func ParseHTTPHost(host, baseDomain string) (HTTPTarget, error) {
 		label = h
 	}
 
+	label, cluster, _ := strings.Cut(label, ".")
+	if baseDomain != "" && strings.Contains(cluster, ".") {
+		return HTTPTarget{}, fmt.Errorf("host %q has too many labels for base domain %q", host, baseDomain)
+	}
 	if len(label) > maxLabelLen {
 		return HTTPTarget{}, fmt.Errorf("routing label %q exceeds %d characters", label, maxLabelLen)
 	}
@@ -73,6 +111,9 @@ func ParseHTTPHost(host, baseDomain string) (HTTPTarget, error) {
 	}
 
 	target := HTTPTarget{Port: port, Sandbox: sandbox, Namespace: namespace}
+	if baseDomain != "" {
+		target.Cluster = cluster
+	}
 	// Round-trip check: the reconstructed label must equal the requested
 	// one, so a sandbox name containing "--" (which CEL forbids) or any
 	// other ambiguity cannot spoof another tenant's route.
@@ -81,3 +122,55 @@ func ParseHTTPHost(host, baseDomain string) (HTTPTarget, error) {
 	}
 	return target, nil
 }
+
+// pathRoutePrefix starts every path route.
+const pathRoutePrefix = "/s/"
+
+// dnsLabel matches a namespace, sandbox or port name.
+var dnsLabel = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// ParseHTTPPath parses a routing path of the form
+// "/s/<ns>/<sandbox>/<port>/<rest>", or "/s/<ns>.<cluster>/..." for a
+// member cluster, and returns the target and its route prefix,
+// "/s/<ns>/<sandbox>/<port>". Every component must be a DNS label, so the
+// prefix reads the same escaped or not and cannot smuggle a "/".
+func ParseHTTPPath(path string) (HTTPTarget, string, error) {
+	rest, ok := strings.CutPrefix(path, pathRoutePrefix)
+	if !ok {
+		return HTTPTarget{}, "", fmt.Errorf("path %q is not a sandbox route", path)
+	}
+	parts := strings.SplitN(rest, "/", 4)
+	if len(parts) < 3 {
+		return HTTPTarget{}, "", fmt.Errorf("path %q is missing components", path)
+	}
+	namespace, cluster, hasCluster := strings.Cut(parts[0], ".")
+	labels := []string{namespace, parts[1], parts[2]}
+	if hasCluster {
+		labels = append(labels, cluster)
+	}
+	for _, part := range labels {
+		if !dnsLabel.MatchString(part) {
+			return HTTPTarget{}, "", fmt.Errorf("path %q has an invalid component %q", path, part)
+		}
+	}
+	target := HTTPTarget{Namespace: namespace, Sandbox: parts[1], Port: parts[2], Cluster: cluster}
+	return target, pathRoutePrefix + strings.Join(parts[:3], "/"), nil
+}
+
+// routeHost is the routing host of target under baseDomain.
+func routeHost(target HTTPTarget, baseDomain string) string {
+	host := target.Port + "--" + target.Sandbox + "--" + target.Namespace
+	if target.Cluster != "" {
+		host += "." + target.Cluster
+	}
+	return host + "." + baseDomain
+}
+
+// routePrefix is the path route prefix of target.
+func routePrefix(target HTTPTarget) string {
+	ns := target.Namespace
+	if target.Cluster != "" {
+		ns += "." + target.Cluster
+	}
+	return pathRoutePrefix + ns + "/" + target.Sandbox + "/" + target.Port
+}
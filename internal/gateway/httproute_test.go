@@ -28,11 +28,15 @@ func TestParseHTTPHost(t *testing.T) {
 		wantP   string
 		wantSB  string
 		wantNS  string
+		wantCl  string
 		wantErr bool
 	}{
 		{host: "jupyter--demo--alice.kubepark.example.com", wantP: "jupyter", wantSB: sbName, wantNS: "alice"},
 		// A namespace may legally contain "--"; left-anchoring handles it.
 		{host: "web--demo--team--a.kubepark.example.com", wantP: "web", wantSB: sbName, wantNS: "team--a"},
+		// A member cluster's sandbox is one label deeper.
+		{host: "web--demo--alice.tokyo.kubepark.example.com", wantP: "web", wantSB: sbName, wantNS: "alice", wantCl: "tokyo"},
+		{host: "web--demo--alice.a.b.kubepark.example.com", wantErr: true},             // too deep
 		{host: "jupyter--demo--alice.other.com", wantErr: true},                        // wrong base domain
 		{host: "demo.kubepark.example.com", wantErr: true},                             // missing separators
 		{host: "jupyter--demo.kubepark.example.com", wantErr: true},                    // missing namespace
@@ -51,8 +55,49 @@ func TestParseHTTPHost(t *testing.T) {
 			t.Errorf("ParseHTTPHost(%q): unexpected error %v", tc.host, err)
 			continue
 		}
-		if got.Port != tc.wantP || got.Sandbox != tc.wantSB || got.Namespace != tc.wantNS {
-			t.Errorf("ParseHTTPHost(%q) = %+v, want %s/%s/%s", tc.host, got, tc.wantP, tc.wantSB, tc.wantNS)
+		if got.Port != tc.wantP || got.Sandbox != tc.wantSB || got.Namespace != tc.wantNS || got.Cluster != tc.wantCl {
+			t.Errorf("ParseHTTPHost(%q) = %+v, want %s/%s/%s in %q", tc.host, got, tc.wantP, tc.wantSB, tc.wantNS, tc.wantCl)
+		}
+	}
+}
+
+func TestParseHTTPPath(t *testing.T) {
+	cases := []struct {
+		path       string
+		wantPrefix string
+		wantCl     string
+		wantErr    bool
+	}{
+		{path: "/s/alice/demo/jupyter/lab/tree", wantPrefix: "/s/alice/demo/jupyter"},
+		{path: "/s/alice/demo/jupyter/", wantPrefix: "/s/alice/demo/jupyter"},
+		{path: "/s/alice/demo/jupyter", wantPrefix: "/s/alice/demo/jupyter"},
+		{path: "/s/alice.tokyo/demo/jupyter/", wantPrefix: "/s/alice.tokyo/demo/jupyter", wantCl: "tokyo"},
+		{path: "/s/alice./demo/jupyter/", wantErr: true},                 // empty cluster
+		{path: "/s/alice.a.b/demo/jupyter/", wantErr: true},              // dotted cluster
+		{path: "/s/alice/demo", wantErr: true},                           // missing port
+		{path: "/x/alice/demo/jupyter/", wantErr: true},                  // not a route
+		{path: "/s/Alice/demo/jupyter/", wantErr: true},                  // not a DNS label
+		{path: "/s/alice//jupyter/", wantErr: true},                      // empty sandbox
+		{path: "/s/alice/demo/../jupyter/", wantErr: true},               // dot segment
+		{path: "/s/alice/demo%2Fx/jupyter/", wantErr: true},              // escaped slash
+		{path: "/s/alice/-demo/jupyter/", wantErr: true},                 // leading hyphen
+		{path: "/s/" + strings.Repeat("a", 64) + "/d/j/", wantErr: true}, // too long
+	}
+	for _, tc := range cases {
+		got, prefix, err := ParseHTTPPath(tc.path)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseHTTPPath(%q): expected error", tc.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseHTTPPath(%q): unexpected error %v", tc.path, err)
+			continue
+		}
+		if got.Namespace != nsAlice || got.Sandbox != sbName || got.Port != "jupyter" || got.Cluster != tc.wantCl ||
+			prefix != tc.wantPrefix {
+			t.Errorf("ParseHTTPPath(%q) = %+v, %q", tc.path, got, prefix)
 		}
 	}
 }
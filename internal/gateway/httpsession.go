@@ -0,0 +1,236 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+// httpSweepInterval is how often open HTTP sessions are heartbeated or
+// closed.
+const httpSweepInterval = 15 * time.Second
+
+// httpSessionKey identifies an HTTP session: one per (sandbox, user).
+type httpSessionKey struct {
+	cluster, namespace, sandbox, user string
+}
+
+// context names the key's cluster, where its session is recorded.
+func (k httpSessionKey) context(ctx context.Context) context.Context {
+	return WithCluster(ctx, k.cluster)
+}
+
+// httpSession is the gateway's view of one open HTTP SandboxSession.
+type httpSession struct {
+	name string
+	// window is the heartbeat interval: the session closes once no request
+	// has been seen for this long.
+	window   time.Duration
+	lastSeen time.Time
+	lastBeat time.Time
+	// inflight counts unfinished requests, such as WebSockets, which keep
+	// the session open however long they last.
+	inflight int
+}
+
+// httpSessions tracks the HTTP SandboxSessions of one gateway. Browser
+// traffic has no connection to hang a session on, so a session opens on a
+// user's first request to a sandbox and slides forward with every request;
+// it closes once a whole window passes without one. Like the rest of the
+// gateway it keeps nothing that matters across a restart: sessions left
+// open by a crash are closed by the stale reaper.
+type httpSessions struct {
+	store Store
+	now   func() time.Time
+
+	mu   sync.Mutex
+	open map[httpSessionKey]*httpSession
+}
+
+func newHTTPSessions(store Store, now func() time.Time) *httpSessions {
+	return &httpSessions{store: store, now: now, open: map[httpSessionKey]*httpSession{}}
+}
+
+// begin records the start of a request by user to sb, opening a session
+// when none is open, and returns the func that records its end. sb lives
+// in the cluster ctx names.
+func (s *httpSessions) begin(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, user, clientAddr string) func() {
+	key := httpSessionKey{cluster: ClusterFromContext(ctx), namespace: sb.Namespace, sandbox: sb.Name, user: user}
+	now := s.now()
+	s.mu.Lock()
+	sess, ok := s.open[key]
+	if !ok {
+		sess = &httpSession{
+			name:     fmt.Sprintf("%s-%s", sb.Name, randomSuffix(ctx)),
+			window:   heartbeatInterval(effectiveIdleTimeout(sb)),
+			lastBeat: now,
+		}
+		s.open[key] = sess
+	}
+	sess.lastSeen = now
+	sess.inflight++
+	s.mu.Unlock()
+
+	// Requests racing the first one go ahead without waiting for the
+	// record; it exists well before the first heartbeat is due.
+	if !ok {
+		s.create(ctx, key, sess, clientAddr)
+	}
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		sess.inflight--
+		sess.lastSeen = s.now()
+	}
+}
+
+// create records a new session, forgetting it again when that fails so
+// the next request retries.
+func (s *httpSessions) create(ctx context.Context, key httpSessionKey, sess *httpSession, clientAddr string) {
+	logger := log.FromContext(ctx)
+	hb := metav1.Duration{Duration: sess.window}
+	session := &kubeparkv1alpha1.SandboxSession{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.namespace, Name: sess.name},
+		Spec: kubeparkv1alpha1.SandboxSessionSpec{
+			SandboxName:       key.sandbox,
+			User:              key.user,
+			ClientAddr:        clientAddr,
+			Kind:              kubeparkv1alpha1.SessionKindHTTP,
+			HeartbeatInterval: &hb,
+		},
+	}
+	if err := s.store.CreateSession(ctx, session); err != nil {
+		logger.Error(err, "failed to record http session")
+		s.forget(key, sess)
+		return
+	}
+	logger.Info("session opened", "sandbox", key.sandbox, "user", key.user, "client", clientAddr, "kind", "http")
+}
+
+// revalidate drops the open session of user on sb when the operator has
+// closed it, as idle suspension does, so the next request opens a fresh
+// one. A request to a sandbox that is not running calls it first: only a
+// new Active session wakes a sandbox suspended while one was open.
+func (s *httpSessions) revalidate(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, user string) {
+	key := httpSessionKey{cluster: ClusterFromContext(ctx), namespace: sb.Namespace, sandbox: sb.Name, user: user}
+	s.mu.Lock()
+	sess, ok := s.open[key]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	if err := s.store.Heartbeat(ctx, key.namespace, sess.name); isSessionGone(err) {
+		s.forget(key, sess)
+	}
+}
+
+// sweep closes the sessions whose window has passed and heartbeats the
+// others once per window.
+func (s *httpSessions) sweep(ctx context.Context) {
+	logger := log.FromContext(ctx)
+	type item struct {
+		key  httpSessionKey
+		sess *httpSession
+	}
+	var expired, due []item
+	now := s.now()
+	s.mu.Lock()
+	for key, sess := range s.open {
+		switch {
+		case sess.inflight == 0 && now.Sub(sess.lastSeen) >= sess.window:
+			delete(s.open, key)
+			expired = append(expired, item{key, sess})
+		case now.Sub(sess.lastBeat) >= sess.window:
+			sess.lastBeat = now
+			due = append(due, item{key, sess})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, it := range expired {
+		err := s.store.CloseSession(it.key.context(ctx), it.key.namespace, it.sess.name,
+			kubeparkv1alpha1.ExitReasonDisconnected)
+		if err != nil {
+			logger.Error(err, "failed to close http session", "session", it.sess.name)
+			continue
+		}
+		logger.Info("session closed", "sandbox", it.key.sandbox, "user", it.key.user, "kind", "http")
+	}
+	for _, it := range due {
+		err := s.store.Heartbeat(it.key.context(ctx), it.key.namespace, it.sess.name)
+		switch {
+		case isSessionGone(err):
+			s.forget(it.key, it.sess)
+		case err != nil:
+			logger.V(1).Info("heartbeat failed", "session", it.sess.name, "err", err.Error())
+		}
+	}
+}
+
+// run sweeps until ctx is done, then closes every open session.
+func (s *httpSessions) run(ctx context.Context) {
+	ticker := time.NewTicker(httpSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.closeAll(context.WithoutCancel(ctx))
+			return
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+// closeAll closes every open session, on gateway shutdown.
+func (s *httpSessions) closeAll(ctx context.Context) {
+	s.mu.Lock()
+	open := s.open
+	s.open = map[httpSessionKey]*httpSession{}
+	s.mu.Unlock()
+	for key, sess := range open {
+		err := s.store.CloseSession(key.context(ctx), key.namespace, sess.name, kubeparkv1alpha1.ExitReasonDisconnected)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "failed to close http session", "session", sess.name)
+		}
+	}
+}
+
+// forget drops sess unless it was already replaced.
+func (s *httpSessions) forget(key httpSessionKey, sess *httpSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.open[key] == sess {
+		delete(s.open, key)
+	}
+}
+
+// isSessionGone reports whether a heartbeat found the session closed or
+// deleted.
+func isSessionGone(err error) bool {
+	return errors.Is(err, ErrSessionClosed) || apierrors.IsNotFound(err)
+}
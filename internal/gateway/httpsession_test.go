@@ -0,0 +1,242 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+// sessionStore records session bookkeeping; the other Store methods are
+// not used by HTTP sessions.
+type sessionStore struct {
+	Store
+
+	mu       sync.Mutex
+	sb       *kubeparkv1alpha1.Sandbox
+	sessions map[string]*kubeparkv1alpha1.SandboxSession
+	beats    int
+	woken    bool
+}
+
+func newSessionStore(sb *kubeparkv1alpha1.Sandbox) *sessionStore {
+	return &sessionStore{sb: sb, sessions: map[string]*kubeparkv1alpha1.SandboxSession{}}
+}
+
+func (s *sessionStore) GetSandbox(_ context.Context, _, _ string) (*kubeparkv1alpha1.Sandbox, error) {
+	return s.sb.DeepCopy(), nil
+}
+
+func (s *sessionStore) SetDesiredRunning(_ context.Context, _ *kubeparkv1alpha1.Sandbox) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.woken = true
+	return nil
+}
+
+func (s *sessionStore) CreateSession(_ context.Context, session *kubeparkv1alpha1.SandboxSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session.Status.State = kubeparkv1alpha1.SessionStateActive
+	s.sessions[session.Name] = session
+	return nil
+}
+
+func (s *sessionStore) Heartbeat(_ context.Context, _, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions[name].Status.State != kubeparkv1alpha1.SessionStateActive {
+		return ErrSessionClosed
+	}
+	s.beats++
+	return nil
+}
+
+func (s *sessionStore) CloseSession(_ context.Context, _, name, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[name].Status.State = kubeparkv1alpha1.SessionStateClosed
+	s.sessions[name].Status.ExitReason = reason
+	return nil
+}
+
+// active returns the Active sessions.
+func (s *sessionStore) active() []*kubeparkv1alpha1.SandboxSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*kubeparkv1alpha1.SandboxSession
+	for _, session := range s.sessions {
+		if session.Status.State == kubeparkv1alpha1.SessionStateActive {
+			out = append(out, session)
+		}
+	}
+	return out
+}
+
+func testSandbox(podIP string) *kubeparkv1alpha1.Sandbox {
+	return &kubeparkv1alpha1.Sandbox{
+		ObjectMeta: metav1.ObjectMeta{Name: sbName, Namespace: nsAlice},
+		Spec: kubeparkv1alpha1.SandboxSpec{
+			Owner:        kubeparkv1alpha1.OwnerSpec{Name: "alice@example.com"},
+			DesiredState: kubeparkv1alpha1.DesiredStateRunning,
+			ExposedPorts: []kubeparkv1alpha1.ExposedPort{
+				{Name: "jupyter", Port: 8888, Auth: kubeparkv1alpha1.AuthModeOIDC},
+				{Name: "web", Port: 8080, Auth: kubeparkv1alpha1.AuthModeNone},
+			},
+		},
+		Status: kubeparkv1alpha1.SandboxStatus{PodIP: podIP},
+	}
+}
+
+func TestHTTPSessionsSlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	sb := testSandbox("10.0.0.1")
+	store := newSessionStore(sb)
+	s := newHTTPSessions(store, func() time.Time { return now })
+	const window = 60 * time.Second
+
+	// Requests within the window share one session.
+	s.begin(ctx, sb, "alice@example.com", "192.0.2.1:1234")()
+	now = now.Add(window / 2)
+	s.begin(ctx, sb, "alice@example.com", "192.0.2.1:1234")()
+	if got := len(store.active()); got != 1 {
+		t.Fatalf("active sessions = %d, want 1", got)
+	}
+	if kind := store.active()[0].Spec.Kind; kind != kubeparkv1alpha1.SessionKindHTTP {
+		t.Errorf("session kind = %q, want http", kind)
+	}
+
+	// A request keeps the window sliding; the session is heartbeated
+	// once per window.
+	now = now.Add(window / 2)
+	s.sweep(ctx)
+	if len(store.active()) != 1 || store.beats != 1 {
+		t.Fatalf("after one window: active=%d beats=%d, want 1 and 1", len(store.active()), store.beats)
+	}
+
+	// A whole window without a request closes it.
+	now = now.Add(window)
+	s.sweep(ctx)
+	if got := len(store.active()); got != 0 {
+		t.Fatalf("active sessions after an idle window = %d, want 0", got)
+	}
+	for _, session := range store.sessions {
+		if session.Status.ExitReason != kubeparkv1alpha1.ExitReasonDisconnected {
+			t.Errorf("exit reason = %q, want Disconnected", session.Status.ExitReason)
+		}
+	}
+
+	// The next request opens a new session.
+	s.begin(ctx, sb, "alice@example.com", "192.0.2.1:1234")()
+	if len(store.sessions) != 2 || len(store.active()) != 1 {
+		t.Fatalf("sessions = %d (active %d), want a second session", len(store.sessions), len(store.active()))
+	}
+}
+
+func TestHTTPSessionsInflightKeepsOpen(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	sb := testSandbox("10.0.0.1")
+	store := newSessionStore(sb)
+	s := newHTTPSessions(store, func() time.Time { return now })
+
+	// A WebSocket stays open for longer than the window.
+	done := s.begin(ctx, sb, "alice@example.com", "192.0.2.1:1234")
+	now = now.Add(5 * time.Minute)
+	s.sweep(ctx)
+	if len(store.active()) != 1 {
+		t.Fatal("a session with a request in flight must stay open")
+	}
+	done()
+	now = now.Add(2 * time.Minute)
+	s.sweep(ctx)
+	if len(store.active()) != 0 {
+		t.Fatal("the session must close a window after its last request ended")
+	}
+}
+
+func TestHTTPProxyWakesSuspendedSandbox(t *testing.T) {
+	store := newSessionStore(testSandbox(""))
+	p := NewHTTPProxy(HTTPProxyConfig{
+		BaseDomain: "sb.example.com",
+		Store:      store,
+		Auth:       staticAuth{principal: "alice@example.com"},
+	})
+
+	// auth:none never wakes the sandbox nor records a session.
+	req := httptest.NewRequest(http.MethodGet, "http://web--demo--alice.sb.example.com/", nil)
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || store.woken || len(store.sessions) != 0 {
+		t.Fatalf("auth:none: code=%d woken=%v sessions=%d, want 503 without waking", rec.Code, store.woken, len(store.sessions))
+	}
+
+	// An authorized browser request wakes it and gets the starting page.
+	req = httptest.NewRequest(http.MethodGet, "http://jupyter--demo--alice.sb.example.com/lab", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || !store.woken {
+		t.Fatalf("oidc: code=%d woken=%v, want 503 and a wake", rec.Code, store.woken)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `http-equiv="refresh"`) || !strings.Contains(body, sbName) {
+		t.Errorf("starting page missing refresh or sandbox name:\n%s", body)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("starting response must carry Retry-After")
+	}
+	if got := len(store.active()); got != 1 {
+		t.Fatalf("active sessions = %d, want 1 to wake the sandbox", got)
+	}
+
+	// Reloads while it starts reuse the session.
+	p.ServeHTTP(httptest.NewRecorder(), req)
+	if got := len(store.sessions); got != 1 {
+		t.Fatalf("sessions after a reload = %d, want 1", got)
+	}
+
+	// A session the operator closed while suspending is replaced, so the
+	// sandbox wakes again.
+	for _, session := range store.sessions {
+		session.Status.State = kubeparkv1alpha1.SessionStateClosed
+	}
+	p.ServeHTTP(httptest.NewRecorder(), req)
+	if got := len(store.active()); got != 1 {
+		t.Fatalf("active sessions after the operator closed one = %d, want 1", got)
+	}
+}
+
+// staticAuth authenticates every request as principal.
+type staticAuth struct{ principal string }
+
+func (a staticAuth) Identify(*http.Request) (Identity, bool) {
+	return Identity{Principal: a.principal}, true
+}
+
+func (a staticAuth) StartLogin(w http.ResponseWriter, _ *http.Request) {
+	http.Error(w, "login", http.StatusUnauthorized)
+}
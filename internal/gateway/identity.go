@@ -0,0 +1,180 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const (
+	// HeaderForwardedUser and HeaderForwardedGroups carry the caller's
+	// identity to sandbox apps on auth:oidc ports.
+	HeaderForwardedUser   = "X-Forwarded-User"
+	HeaderForwardedGroups = "X-Forwarded-Groups"
+	// HeaderIdentity carries the same identity as a JWT signed by the
+	// gateway, for apps that must not trust a plain header.
+	HeaderIdentity = "X-Kubepark-Identity"
+
+	// jwksPath publishes the keys that verify HeaderIdentity, under the
+	// gateway's reserved prefix.
+	jwksPath = "/kubepark/jwks.json"
+
+	// identityTTL bounds how long a captured assertion can be replayed.
+	identityTTL = 5 * time.Minute
+)
+
+// IdentitySigner issues the short-lived identity assertions the proxy
+// passes to sandbox apps and publishes the key that verifies them.
+type IdentitySigner struct {
+	issuer string
+	signer jose.Signer
+	jwks   []byte
+	// Now is injected for tests.
+	Now func() time.Time
+}
+
+// identityClaims are the claims of an assertion. The audience is the
+// sandbox, "<namespace>/<sandbox>", so an assertion one sandbox receives
+// is refused by every other.
+type identityClaims struct {
+	jwt.Claims
+	Groups []string `json:"groups,omitempty"`
+}
+
+// NewIdentitySigner builds a signer from a PEM ECDSA P-256 key; issuer is
+// the gateway's URL.
+func NewIdentitySigner(keyPEM []byte, issuer string) (*IdentitySigner, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("identity key is not PEM")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse identity key: %w", err)
+	}
+	if key.Curve != elliptic.P256() {
+		return nil, errors.New("identity key must be ECDSA P-256")
+	}
+	jwk := jose.JSONWebKey{Key: key, Algorithm: string(jose.ES256), Use: "sig"}
+	thumb, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	jwk.KeyID = base64.RawURLEncoding.EncodeToString(thumb)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk},
+		(&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		return nil, err
+	}
+	jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}})
+	if err != nil {
+		return nil, err
+	}
+	return &IdentitySigner{issuer: issuer, signer: signer, jwks: jwks, Now: time.Now}, nil
+}
+
+// Assert signs the identity of principal for the sandbox namespace/name,
+// in cluster when it lives in a member cluster.
+func (s *IdentitySigner) Assert(principal string, groups []string, cluster, namespace, name string) (string, error) {
+	now := s.Now()
+	audience := namespace + "/" + name
+	if cluster != "" {
+		audience = cluster + "/" + audience
+	}
+	claims := identityClaims{
+		Claims: jwt.Claims{
+			Issuer:    s.issuer,
+			Subject:   principal,
+			Audience:  jwt.Audience{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now.Add(-30 * time.Second)),
+			Expiry:    jwt.NewNumericDate(now.Add(identityTTL)),
+		},
+		Groups: groups,
+	}
+	return jwt.Signed(s.signer).Claims(claims).Serialize()
+}
+
+// ServeHTTP serves the JWKS.
+func (s *IdentitySigner) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	_, _ = w.Write(s.jwks)
+}
+
+// gatewayCookies are the cookies the gateway sets for itself; sandbox
+// apps never see them, nor set them.
+var gatewayCookies = []string{sessionCookie, ssoCookie, handoffCookie, stateCookie, shareCookie}
+
+// isGatewayCookie reports whether name is a gateway cookie, with or
+// without the __Host- prefix.
+func isGatewayCookie(name string) bool {
+	return slices.Contains(gatewayCookies, strings.TrimPrefix(name, hostCookiePrefix))
+}
+
+// scrubRequest removes what the gateway consumed or must vouch for from a
+// request bound for a sandbox: its own cookies, an Authorization header
+// it authenticated, and any identity headers the client sent.
+func scrubRequest(h http.Header, consumedAuthorization bool) {
+	h.Del(HeaderForwardedUser)
+	h.Del(HeaderForwardedGroups)
+	h.Del(HeaderIdentity)
+	if consumedAuthorization {
+		h.Del("Authorization")
+	}
+	lines := h.Values("Cookie")
+	h.Del("Cookie")
+	for _, line := range lines {
+		var kept []string
+		for pair := range strings.SplitSeq(line, ";") {
+			name, _, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			if !isGatewayCookie(name) {
+				kept = append(kept, strings.TrimSpace(pair))
+			}
+		}
+		if len(kept) > 0 {
+			h.Add("Cookie", strings.Join(kept, "; "))
+		}
+	}
+}
+
+// scrubResponse drops the gateway's cookies from a sandbox response, so an
+// app cannot plant a session or handoff nonce of its choosing.
+func scrubResponse(h http.Header) {
+	lines := h.Values("Set-Cookie")
+	h.Del("Set-Cookie")
+	for _, line := range lines {
+		name, _, _ := strings.Cut(line, "=")
+		if !isGatewayCookie(strings.TrimSpace(name)) {
+			h.Add("Set-Cookie", line)
+		}
+	}
+}
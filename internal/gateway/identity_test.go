@@ -0,0 +1,194 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+func testIdentitySigner(t *testing.T) *IdentitySigner {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewIdentitySigner(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), "https://sb.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// verifyAssertion checks an assertion against the signer's published JWKS,
+// as a sandbox app would.
+func verifyAssertion(t *testing.T, s *IdentitySigner, raw string) identityClaims {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, jwksPath, nil))
+	var jwks jose.JSONWebKeySet
+	if err := json.Unmarshal(rec.Body.Bytes(), &jwks); err != nil {
+		t.Fatalf("jwks: %v", err)
+	}
+	tok, err := jwt.ParseSigned(raw, []jose.SignatureAlgorithm{jose.ES256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := jwks.Key(tok.Headers[0].KeyID)
+	if len(keys) != 1 {
+		t.Fatalf("kid %q not in the JWKS", tok.Headers[0].KeyID)
+	}
+	var claims identityClaims
+	if err := tok.Claims(keys[0].Key, &claims); err != nil {
+		t.Fatalf("signature: %v", err)
+	}
+	return claims
+}
+
+func TestIdentityAssertion(t *testing.T) {
+	s := testIdentitySigner(t)
+	now := time.Unix(1_700_000_000, 0)
+	s.Now = func() time.Time { return now }
+
+	raw, err := s.Assert("alice@example.com", []string{"team-a"}, "", nsAlice, sbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := verifyAssertion(t, s, raw)
+	if claims.Subject != "alice@example.com" || claims.Issuer != "https://sb.example.com" {
+		t.Errorf("sub=%q iss=%q", claims.Subject, claims.Issuer)
+	}
+	if len(claims.Groups) != 1 || claims.Groups[0] != "team-a" {
+		t.Errorf("groups = %q", claims.Groups)
+	}
+	want := jwt.Expected{Issuer: "https://sb.example.com", AnyAudience: jwt.Audience{nsAlice + "/" + sbName}}
+	if err := claims.ValidateWithLeeway(want.WithTime(now.Add(4*time.Minute)), 0); err != nil {
+		t.Errorf("within its lifetime: %v", err)
+	}
+	if err := claims.ValidateWithLeeway(want.WithTime(now.Add(6*time.Minute)), 0); err == nil {
+		t.Error("an assertion must expire after five minutes")
+	}
+	other := jwt.Expected{AnyAudience: jwt.Audience{nsAlice + "/other"}}
+	if err := claims.ValidateWithLeeway(other.WithTime(now), 0); err == nil {
+		t.Error("an assertion must be refused by another sandbox")
+	}
+}
+
+func TestScrubRequest(t *testing.T) {
+	h := http.Header{}
+	h.Add("Cookie", "kubepark_session=secret; app=1")
+	h.Add("Cookie", "kubepark_oidc_state=x; __Host-kubepark_sso=y")
+	h.Set("Authorization", "Bearer token")
+	h.Set(HeaderForwardedUser, "mallory@example.com")
+	h.Set(HeaderIdentity, "forged")
+
+	scrubRequest(h, false)
+	if got := h.Values("Cookie"); len(got) != 1 || got[0] != "app=1" {
+		t.Errorf("cookies = %q, want only the app's", got)
+	}
+	if h.Get(HeaderForwardedUser) != "" || h.Get(HeaderIdentity) != "" {
+		t.Error("client-supplied identity headers must be removed")
+	}
+	if h.Get("Authorization") == "" {
+		t.Error("an Authorization header the gateway did not consume belongs to the app")
+	}
+	scrubRequest(h, true)
+	if h.Get("Authorization") != "" {
+		t.Error("a consumed Authorization header must be removed")
+	}
+
+	resp := http.Header{}
+	resp.Add("Set-Cookie", "__Host-kubepark_session=planted; Path=/; Secure")
+	resp.Add("Set-Cookie", "app=2; Path=/")
+	scrubResponse(resp)
+	if got := resp.Values("Set-Cookie"); len(got) != 1 || got[0] != "app=2; Path=/" {
+		t.Errorf("Set-Cookie = %q, want only the app's", got)
+	}
+}
+
+func TestHTTPProxyForwardsIdentity(t *testing.T) {
+	var seen http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	signer := testIdentitySigner(t)
+	p := NewHTTPProxy(HTTPProxyConfig{
+		BaseDomain: "sb.example.com",
+		Store:      newSessionStore(testSandbox("10.0.0.1")),
+		Auth:       staticAuth{principal: "alice@example.com"},
+		Identity:   signer,
+		DialAddr:   func(*kubeparkv1alpha1.Sandbox, int32) string { return upstream.URL },
+	})
+	send := func(host string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil)
+		req.Header.Set("Cookie", "kubepark_session=secret; app=1")
+		req.Header.Set(HeaderForwardedUser, "mallory@example.com")
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: code %d", host, rec.Code)
+		}
+	}
+
+	send("jupyter--demo--alice.sb.example.com")
+	if got := seen.Get("Cookie"); got != "app=1" {
+		t.Errorf("oidc: upstream cookies = %q, want app=1", got)
+	}
+	if got := seen.Get(HeaderForwardedUser); got != "alice@example.com" {
+		t.Errorf("oidc: %s = %q", HeaderForwardedUser, got)
+	}
+	if claims := verifyAssertion(t, signer, seen.Get(HeaderIdentity)); claims.Subject != "alice@example.com" {
+		t.Errorf("oidc: assertion subject = %q", claims.Subject)
+	}
+
+	// auth:none has no caller to vouch for, but still drops what a client
+	// claims.
+	send("web--demo--alice.sb.example.com")
+	if seen.Get(HeaderForwardedUser) != "" || seen.Get(HeaderIdentity) != "" {
+		t.Errorf("auth:none: identity headers reached the app: %v", seen)
+	}
+	if got := seen.Get("Cookie"); got != "app=1" {
+		t.Errorf("auth:none: upstream cookies = %q, want app=1", got)
+	}
+
+	// The JWKS is served on every host.
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://sb.example.com"+jwksPath, nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("jwks: %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
@@ -17,9 +17,12 @@ limitations under the License.
 package gateway_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net"
+	"slices"
 	"sync"
 	"testing"
 	"time"
@@ -43,6 +46,7 @@ const (
 type testCA struct {
 	signer gossh.Signer
 	pub    []byte
+	priv   []byte
 }
 
 func newCA(t *testing.T, comment string) testCA {
@@ -55,7 +59,7 @@ func newCA(t *testing.T, comment string) testCA {
 	if err != nil {
 		t.Fatal(err)
 	}
-	return testCA{signer: signer, pub: kp.PublicAuthorized}
+	return testCA{signer: signer, pub: kp.PublicAuthorized, priv: kp.PrivatePEM}
 }
 
 // userCert signs a client key and returns a gossh.Signer presenting the
@@ -91,6 +95,11 @@ type fakeStore struct {
 	sandboxes map[string]*kubeparkv1alpha1.Sandbox
 	opened    int
 	closed    int
+	upstreams []string
+	sessions  []kubeparkv1alpha1.SandboxSessionSpec
+	reasons   []string
+	profiles  kubeparkv1alpha1.UserProfileList
+	targets   map[string]*kubeparkv1alpha1.AccessTarget
 }
 
 func (s *fakeStore) key(ns, name string) string { return ns + "/" + name }
@@ -109,33 +118,90 @@ func (s *fakeStore) SetDesiredRunning(_ context.Context, _ *kubeparkv1alpha1.San
 	return nil
 }
 
-func (s *fakeStore) CreateSession(_ context.Context, _ *kubeparkv1alpha1.SandboxSession) error {
+func (s *fakeStore) CreateSession(_ context.Context, session *kubeparkv1alpha1.SandboxSession) error {
 	s.mu.Lock()
 	s.opened++
+	s.sessions = append(s.sessions, session.Spec)
 	s.mu.Unlock()
 	return nil
 }
 
 func (s *fakeStore) Heartbeat(_ context.Context, _, _ string) error { return nil }
 
-func (s *fakeStore) CloseSession(_ context.Context, _, _, _ string) error {
+func (s *fakeStore) SetSessionUpstream(_ context.Context, _, _, addr string) error {
+	s.mu.Lock()
+	s.upstreams = append(s.upstreams, addr)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *fakeStore) CloseSession(_ context.Context, _, _, reason string) error {
 	s.mu.Lock()
 	s.closed++
+	s.reasons = append(s.reasons, reason)
 	s.mu.Unlock()
 	return nil
 }
 
+func (s *fakeStore) GetUserProfile(_ context.Context, principal string) (*kubeparkv1alpha1.UserProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.profiles.ForPrincipal(principal), nil
+}
+
+func (s *fakeStore) PrincipalForKey(_ context.Context, key gossh.PublicKey) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.profiles.Items {
+		for _, line := range p.Spec.AuthorizedKeys {
+			k, _, _, _, err := gossh.ParseAuthorizedKey([]byte(line))
+			if err == nil && bytes.Equal(k.Marshal(), key.Marshal()) {
+				return p.Spec.Principal, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func (s *fakeStore) EnsureUserProfile(context.Context, string) error { return nil }
+
+func (s *fakeStore) GetAccessTarget(_ context.Context, name string) (*kubeparkv1alpha1.AccessTarget, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	target, ok := s.targets[name]
+	if !ok {
+		return nil, fmt.Errorf("not found")
+	}
+	return target.DeepCopy(), nil
+}
+
 // fakeDialer dials a fixed address regardless of the sandbox pod IP, so the
-// test's in-process agent stands in for the pod.
-type fakeDialer struct{ addr string }
+// test's in-process agent stands in for the pod; ports maps other sandbox
+// ports to their stand-ins.
+type fakeDialer struct {
+	addr  string
+	ports map[int32]string
+}
 
-func (d fakeDialer) DialSandbox(ctx context.Context, _ *kubeparkv1alpha1.Sandbox) (net.Conn, error) {
+func (d fakeDialer) DialSandbox(ctx context.Context, _ *kubeparkv1alpha1.Sandbox, port int32) (net.Conn, error) {
+	addr := d.addr
+	if a, ok := d.ports[port]; ok {
+		addr = a
+	}
 	var nd net.Dialer
-	return nd.DialContext(ctx, "tcp", d.addr)
+	return nd.DialContext(ctx, "tcp", addr)
+}
+
+// startAgent runs an in-process agent, accepting keys besides the owner's
+// certificates, and returns its address.
+func startAgent(t *testing.T, owner string, userCA, hostCA testCA, keys ...gossh.PublicKey) string {
+	t.Helper()
+	return startAgentAs(t, owner, []string{owner}, userCA, hostCA, keys...)
 }
 
-// startAgent runs an in-process agent and returns its address.
-func startAgent(t *testing.T, owner string, userCA, hostCA testCA) string {
+// startAgentAs runs an in-process agent whose host certificate names
+// hostPrincipals, and returns its address.
+func startAgentAs(t *testing.T, owner string, hostPrincipals []string, userCA, hostCA testCA, keys ...gossh.PublicKey) string {
 	t.Helper()
 	hostKP, err := sshca.GenerateKeyPair("host")
 	if err != nil {
@@ -145,7 +211,7 @@ func startAgent(t *testing.T, owner string, userCA, hostCA testCA) string {
 	if err != nil {
 		t.Fatal(err)
 	}
-	hostCert, err := sshca.SignHostCert(hostCA.signer, hostPub, []string{owner}, time.Hour, time.Now())
+	hostCert, err := sshca.SignHostCert(hostCA.signer, hostPub, hostPrincipals, time.Hour, time.Now())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -156,6 +222,7 @@ func startAgent(t *testing.T, owner string, userCA, hostCA testCA) string {
 		HostCertAuthorized: gossh.MarshalAuthorizedKey(hostCert),
 		UserCAAuthorized:   userCA.pub,
 		HomeDir:            t.TempDir(),
+		AuthorizedKeys:     keys,
 	})
 	if err != nil {
 		t.Fatal(err)
@@ -196,6 +263,38 @@ func startGateway(t *testing.T, userCA testCA, store gateway.Store, dialer gatew
 	return ln.Addr().String()
 }
 
+// startEcho runs a TCP echo server and returns its address.
+func startEcho(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() { _, _ = io.Copy(conn, conn); _ = conn.Close() }()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// expectEcho checks that conn reaches an echo server.
+func expectEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo: %q, %v", buf, err)
+	}
+}
+
 func sandbox(ns, name, owner string) *kubeparkv1alpha1.Sandbox {
 	return &kubeparkv1alpha1.Sandbox{
 		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
@@ -279,6 +378,113 @@ func TestEndToEndExec(t *testing.T) {
 	if store.opened == 0 {
 		t.Error("expected a session to be recorded")
 	}
+	// The agent sees the gateway's upstream address as the peer; it is
+	// what joins agent audit logs to the session.
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.upstreams) != 1 || store.upstreams[0] == "" {
+		t.Errorf("expected the session upstream address to be recorded, got %v", store.upstreams)
+	}
+}
+
+// TestToolingKey connects with a plain key a UserProfile authorizes, by
+// sandbox name alone in the profile's default namespace.
+func TestToolingKey(t *testing.T) {
+	userCA := newCA(t, "user-ca")
+	hostCA := newCA(t, "host-ca")
+	kp, err := sshca.GenerateKeyPair("ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool, err := gossh.ParsePrivateKey(kp.PrivatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentAddr := startAgent(t, "alice@example.com", userCA, hostCA, tool.PublicKey())
+
+	store := &fakeStore{sandboxes: map[string]*kubeparkv1alpha1.Sandbox{
+		"team/demo": sandbox("team", "demo", "alice@example.com"),
+	}}
+	store.profiles.Items = []kubeparkv1alpha1.UserProfile{{Spec: kubeparkv1alpha1.UserProfileSpec{
+		Principal:        "alice@example.com",
+		DefaultNamespace: "team",
+		AuthorizedKeys:   []string{string(kp.PublicAuthorized)},
+	}}}
+	gwAddr := startGateway(t, userCA, store, fakeDialer{addr: agentAddr})
+
+	tunnel, jump, err := dialGatewayJump(t, gwAddr, tool, "demo:2222")
+	if err != nil {
+		t.Fatalf("jump dial failed: %v", err)
+	}
+	defer func() { _ = jump.Close() }()
+	agentConn, chans, reqs, err := gossh.NewClientConn(tunnel, "demo", &gossh.ClientConfig{
+		User:            "sandbox",
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(tool)},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("agent handshake failed: %v", err)
+	}
+	agentClient := gossh.NewClient(agentConn, chans, reqs)
+	defer func() { _ = agentClient.Close() }()
+	sess, err := agentClient.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sess.Close() }()
+	if out, err := sess.Output("echo tool-ok"); err != nil || string(out) != "tool-ok\n" {
+		t.Fatalf("exec: %q, %v", out, err)
+	}
+
+	// A key no profile lists is refused at the gateway.
+	other, err := sshca.GenerateKeyPair("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger, err := gossh.ParsePrivateKey(other.PrivatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := dialGatewayJump(t, gwAddr, stranger, "demo:2222"); err == nil {
+		t.Error("expected an unlisted key to be refused")
+	}
+}
+
+// TestForwardToExposedPort proves a direct-tcpip channel to an exposed
+// port reaches that port, as ssh -L does through the jump host, and that
+// ports the sandbox does not expose are refused.
+func TestForwardToExposedPort(t *testing.T) {
+	userCA := newCA(t, "user-ca")
+	echo := startEcho(t)
+
+	sb := sandbox("alice", "demo", "alice@example.com")
+	sb.Spec.ExposedPorts = []kubeparkv1alpha1.ExposedPort{
+		{Name: "db", Port: 5432, Kind: kubeparkv1alpha1.ExposedPortTCP},
+	}
+	store := &fakeStore{sandboxes: map[string]*kubeparkv1alpha1.Sandbox{testSandboxKey: sb}}
+	gwAddr := startGateway(t, userCA, store, fakeDialer{addr: "127.0.0.1:1", ports: map[int32]string{5432: echo}})
+	cert := userCert(t, userCA, "alice@example.com")
+
+	tunnel, jump, err := dialGatewayJump(t, gwAddr, cert, "demo.alice:5432")
+	if err != nil {
+		t.Fatalf("forward to an exposed port: %v", err)
+	}
+	defer func() { _ = jump.Close() }()
+	expectEcho(t, tunnel)
+	store.mu.Lock()
+	sessions := slices.Clone(store.sessions)
+	store.mu.Unlock()
+	if len(sessions) != 1 || sessions[0].Port != 5432 {
+		t.Errorf("sessions = %+v, want the forwarded port recorded", sessions)
+	}
+
+	if _, _, err := dialGatewayJump(t, gwAddr, cert, "demo.alice:6000"); err == nil {
+		t.Error("expected a port the sandbox does not expose to be refused")
+	}
+	if _, _, err := dialGatewayJump(t, gwAddr, userCert(t, userCA, "mallory@example.com"), "demo.alice:5432"); err == nil {
+		t.Error("expected a non-owner to be refused on an exposed port")
+	}
 }
 
 // TestGatewayRejectsWrongPrincipal proves the principal==owner check: a
@@ -0,0 +1,154 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/controller/podspec"
+	"github.com/frauniki/kubepark/internal/sshca"
+	"github.com/frauniki/kubepark/internal/tunnel"
+)
+
+const (
+	// memberHostCertInterval is how often member clusters are checked
+	// for host keys to sign; a new member sandbox waits up to this long.
+	memberHostCertInterval = 5 * time.Second
+	// memberHostCertValidity matches the certificates the operator signs
+	// for its own cluster: the agent reads its certificate when it starts.
+	memberHostCertValidity = 10 * 365 * 24 * time.Hour
+)
+
+// MemberHostCerts signs the host certificates of member clusters' sandboxes
+// with the hub's host CA, so that no member holds a CA private key. Each is
+// signed for <sandbox>.<namespace>.<cluster> only, the cluster being the
+// name the hub registered, so a member cannot claim another's sandboxes.
+type MemberHostCerts struct {
+	clusters *Clusters
+	ca       gossh.Signer
+	now      func() time.Time
+}
+
+// NewMemberHostCerts returns a signer of the host certificates of clusters'
+// sandboxes with the host CA private key hostCAPEM.
+func NewMemberHostCerts(clusters *Clusters, hostCAPEM []byte) (*MemberHostCerts, error) {
+	ca, err := sshca.ParseSigner(hostCAPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parse host CA: %w", err)
+	}
+	return &MemberHostCerts{clusters: clusters, ca: ca, now: time.Now}, nil
+}
+
+// Start signs every member cluster's pending host certificates until ctx
+// is done. It implements manager.Runnable.
+func (m *MemberHostCerts) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+	ticker := time.NewTicker(memberHostCertInterval)
+	defer ticker.Stop()
+	for {
+		for _, cluster := range m.clusters.Names() {
+			if err := m.SignCluster(ctx, cluster); err != nil {
+				logger.Error(err, "sign member host certificates", "cluster", cluster)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// SignCluster signs the host certificate of each of the cluster's
+// sandboxes whose host key Secret lacks a valid one for its name.
+func (m *MemberHostCerts) SignCluster(ctx context.Context, cluster string) error {
+	c, ok := m.clusters.Client(cluster)
+	if !ok {
+		return ErrNoRoute{Reason: fmt.Sprintf("cluster %q is not registered", cluster)}
+	}
+	var sandboxes kubeparkv1alpha1.SandboxList
+	if err := c.List(ctx, &sandboxes); err != nil {
+		return fmt.Errorf("list sandboxes: %w", err)
+	}
+	var secrets corev1.SecretList
+	if err := c.List(ctx, &secrets, client.MatchingLabels{
+		podspec.LabelComponent: podspec.ComponentSandbox,
+		podspec.LabelManagedBy: "kubepark",
+	}); err != nil {
+		return fmt.Errorf("list host keys: %w", err)
+	}
+	hostKeys := map[string]*corev1.Secret{}
+	for i := range secrets.Items {
+		s := &secrets.Items[i]
+		hostKeys[s.Namespace+"/"+s.Name] = s
+	}
+
+	logger := log.FromContext(ctx).WithValues("cluster", cluster)
+	for i := range sandboxes.Items {
+		sb := &sandboxes.Items[i]
+		secret := hostKeys[sb.Namespace+"/"+podspec.HostKeyName(sb.Name)]
+		// Only the Secret the member's operator made for this very
+		// sandbox; a dotted name is one the hub's could share.
+		if secret == nil || !metav1.IsControlledBy(secret, sb) || strings.Contains(sb.Name, ".") {
+			continue
+		}
+		principal := tunnel.Principal(cluster, sb.Namespace, sb.Name)
+		cert, err := m.sign(secret.Data, principal)
+		if err != nil {
+			logger.Error(err, "sign host certificate", "namespace", sb.Namespace, "sandbox", sb.Name)
+			continue
+		}
+		if cert == nil {
+			continue
+		}
+		secret.Data[podspec.HostKeyCert] = gossh.MarshalAuthorizedKey(cert)
+		if err := c.Update(ctx, secret); err != nil {
+			logger.Error(err, "store host certificate", "namespace", sb.Namespace, "sandbox", sb.Name)
+			continue
+		}
+		logger.Info("signed host certificate", "principal", principal, "serial", cert.Serial)
+	}
+	return nil
+}
+
+// sign returns a certificate for the host key in data, or nil when data
+// already holds a valid one for exactly principal.
+func (m *MemberHostCerts) sign(data map[string][]byte, principal string) (*gossh.Certificate, error) {
+	hostPub, err := sshca.ParsePublicKey(data[podspec.HostKeyPublic])
+	if err != nil {
+		return nil, fmt.Errorf("parse host key: %w", err)
+	}
+	if current, err := sshca.ParsePublicKey(data[podspec.HostKeyCert]); err == nil {
+		cert, ok := current.(*gossh.Certificate)
+		if ok && len(cert.ValidPrincipals) == 1 &&
+			sshca.CheckHostCert(cert, m.ca.PublicKey(), principal, m.now()) == nil &&
+			string(cert.Key.Marshal()) == string(hostPub.Marshal()) {
+			return nil, nil
+		}
+	}
+	return sshca.SignHostCert(m.ca, hostPub, []string{principal}, memberHostCertValidity, m.now())
+}
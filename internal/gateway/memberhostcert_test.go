@@ -0,0 +1,154 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/controller/podspec"
+	"github.com/frauniki/kubepark/internal/sshca"
+)
+
+// memberHostKey is the host key Secret a member's operator makes for sb,
+// controlled by it when controlled is set.
+func memberHostKey(t *testing.T, sb *kubeparkv1alpha1.Sandbox, controlled bool) *corev1.Secret {
+	t.Helper()
+	kp, err := sshca.GenerateKeyPair("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: sb.Namespace,
+			Name:      podspec.HostKeyName(sb.Name),
+			Labels:    podspec.Labels(sb),
+		},
+		Data: map[string][]byte{podspec.HostKeyPublic: kp.PublicAuthorized},
+	}
+	if controlled {
+		secret.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: kubeparkv1alpha1.GroupVersion.String(),
+			Kind:       "Sandbox",
+			Name:       sb.Name,
+			UID:        sb.UID,
+			Controller: ptr.To(true),
+		}}
+	}
+	return secret
+}
+
+func hostCertOf(t *testing.T, c client.Client, sb *kubeparkv1alpha1.Sandbox) *gossh.Certificate {
+	t.Helper()
+	var secret corev1.Secret
+	key := types.NamespacedName{Namespace: sb.Namespace, Name: podspec.HostKeyName(sb.Name)}
+	if err := c.Get(context.Background(), key, &secret); err != nil {
+		t.Fatal(err)
+	}
+	if len(secret.Data[podspec.HostKeyCert]) == 0 {
+		return nil
+	}
+	pub, err := sshca.ParsePublicKey(secret.Data[podspec.HostKeyCert])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub.(*gossh.Certificate)
+}
+
+// TestMemberHostCerts signs a member's host keys for the cluster-qualified
+// principal only, with the hub's CA, and leaves alone what it did not sign
+// for or need not sign again.
+func TestMemberHostCerts(t *testing.T) {
+	hostCA, err := sshca.GenerateKeyPair("host-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPub, err := sshca.ParsePublicKey(hostCA.PublicAuthorized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	demo := &kubeparkv1alpha1.Sandbox{ObjectMeta: metav1.ObjectMeta{Namespace: nsAlice, Name: sbName, UID: "uid-demo"}}
+	other := &kubeparkv1alpha1.Sandbox{ObjectMeta: metav1.ObjectMeta{Namespace: nsAlice, Name: "other", UID: "uid-other"}}
+	member := fake.NewClientBuilder().WithScheme(kubeparkScheme()).
+		WithObjects(demo, other, memberHostKey(t, demo, true), memberHostKey(t, other, false)).Build()
+	clusters := NewClusters(nil, "kubepark-system", kubeparkScheme())
+	clusters.Set("tokyo", member)
+	signer, err := NewMemberHostCerts(clusters, hostCA.PrivatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := signer.SignCluster(ctx, "tokyo"); err != nil {
+		t.Fatal(err)
+	}
+	cert := hostCertOf(t, member, demo)
+	if cert == nil {
+		t.Fatal("the member's host key was not signed")
+	}
+	if err := sshca.CheckHostCert(cert, caPub, "demo.alice.tokyo", time.Now()); err != nil {
+		t.Errorf("certificate: %v", err)
+	}
+	if len(cert.ValidPrincipals) != 1 {
+		t.Errorf("principals = %v, want the cluster-qualified one only", cert.ValidPrincipals)
+	}
+	if hostCertOf(t, member, other) != nil {
+		t.Error("signed a Secret the sandbox does not control")
+	}
+
+	if err := signer.SignCluster(ctx, "tokyo"); err != nil {
+		t.Fatal(err)
+	}
+	if again := hostCertOf(t, member, demo); again.Serial != cert.Serial {
+		t.Error("a valid certificate was signed again")
+	}
+
+	// A certificate for the hub's same-named sandbox is replaced.
+	var secret corev1.Secret
+	if err := member.Get(ctx, types.NamespacedName{Namespace: nsAlice, Name: podspec.HostKeyName(sbName)}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := sshca.ParseSigner(hostCA.PrivatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong, err := sshca.SignHostCert(ca, cert.Key, []string{"demo.alice"}, time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret.Data[podspec.HostKeyCert] = gossh.MarshalAuthorizedKey(wrong)
+	if err := member.Update(ctx, &secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.SignCluster(ctx, "tokyo"); err != nil {
+		t.Fatal(err)
+	}
+	if got := hostCertOf(t, member, demo); got.Serial == wrong.Serial ||
+		sshca.CheckHostCert(got, caPub, "demo.alice.tokyo", time.Now()) != nil {
+		t.Errorf("certificate for %v was not replaced", got.ValidPrincipals)
+	}
+}
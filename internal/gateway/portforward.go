@@ -0,0 +1,278 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/controller/podspec"
+	"github.com/frauniki/kubepark/internal/tunnel"
+)
+
+// portForwardDialer reaches a sandbox pod through the API server's
+// pods/portforward subresource, so the gateway needs a route to the API
+// server only: it can run on a laptop or outside the pod network.
+type portForwardDialer struct {
+	config   *rest.Config
+	clusters *Clusters
+	// host names this gateway in each forward's origin.
+	host string
+	seq  atomic.Uint64
+}
+
+// NewPortForwardDialer returns a Dialer that port-forwards through the API
+// server config names, or a member cluster's when ctx names one. Each
+// connection is its own port-forward, over WebSocket where the API server
+// supports it and SPDY otherwise, with an origin of its own that the agent
+// reports as the peer.
+func NewPortForwardDialer(config *rest.Config, clusters *Clusters) Dialer {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "kubepark-gateway"
+	}
+	return &portForwardDialer{config: config, clusters: clusters, host: host}
+}
+
+func (d *portForwardDialer) DialSandbox(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, port int32) (net.Conn, error) {
+	if sb.Status.PodName == "" {
+		return nil, ErrNoRoute{Reason: "sandbox has no pod yet"}
+	}
+	cfg, err := clusterConfig(ctx, d.config, d.clusters)
+	if err != nil {
+		return nil, err
+	}
+	dialer, err := portForwardStreamDialer(cfg, sb.Namespace, sb.Status.PodName)
+	if err != nil {
+		return nil, err
+	}
+
+	// httpstream dialers take no context; give up on the upgrade, and
+	// close what it returns late, when ctx ends first.
+	type dialed struct {
+		conn httpstream.Connection
+		err  error
+	}
+	done := make(chan dialed, 1)
+	go func() {
+		conn, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+		done <- dialed{conn, err}
+	}()
+	var streams httpstream.Connection
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return nil, fmt.Errorf("port-forward to pod %s/%s: %w", sb.Namespace, sb.Status.PodName, res.err)
+		}
+		streams = res.conn
+	case <-ctx.Done():
+		go func() {
+			if res := <-done; res.conn != nil {
+				_ = res.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+
+	conn, err := openPortForward(streams, port)
+	if err != nil {
+		_ = streams.Close()
+		return nil, fmt.Errorf("port-forward to pod %s/%s port %d: %w", sb.Namespace, sb.Status.PodName, port, err)
+	}
+	origin := fmt.Sprintf("%s/portforward/%d", d.host, d.seq.Add(1))
+	conn.local = portForwardAddr(origin)
+	conn.remote = portForwardAddr(fmt.Sprintf("%s/%s:%d", sb.Namespace, sb.Status.PodName, port))
+	if port == podspec.AgentPort {
+		// The agent sees the kubelet's loopback connection; name the origin
+		// ahead of the SSH version so its log joins the session.
+		if _, err := io.WriteString(conn, tunnel.OriginPrefix+origin+"\r\n"); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("port-forward to pod %s/%s port %d: %w", sb.Namespace, sb.Status.PodName, port, err)
+		}
+	}
+	return conn, nil
+}
+
+// portForwardStreamDialer upgrades to a port-forward of the pod, trying
+// WebSocket first and falling back to SPDY on API servers without it.
+func portForwardStreamDialer(cfg *rest.Config, namespace, pod string) (httpstream.Dialer, error) {
+	u, _, err := rest.DefaultServerUrlFor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("API server URL: %w", err)
+	}
+	u.Path = path.Join(u.Path, "api/v1/namespaces", namespace, "pods", pod, "portforward")
+
+	transport, upgrader, err := spdy.RoundTripperFor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("build SPDY transport: %w", err)
+	}
+	spdyDialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, u)
+	wsDialer, err := portforward.NewSPDYOverWebsocketDialer(u, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("build WebSocket dialer: %w", err)
+	}
+	return portforward.NewFallbackDialer(wsDialer, spdyDialer, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	}), nil
+}
+
+// openPortForward opens the error and data streams of one forwarded
+// connection to port.
+func openPortForward(streams httpstream.Connection, port int32) (*portForwardConn, error) {
+	headers := http.Header{}
+	headers.Set(corev1.StreamType, corev1.StreamTypeError)
+	headers.Set(corev1.PortHeader, strconv.Itoa(int(port)))
+	headers.Set(corev1.PortForwardRequestIDHeader, "0")
+	errStream, err := streams.CreateStream(headers)
+	if err != nil {
+		return nil, fmt.Errorf("create error stream: %w", err)
+	}
+	// The error stream is only read.
+	_ = errStream.Close()
+
+	headers.Set(corev1.StreamType, corev1.StreamTypeData)
+	data, err := streams.CreateStream(headers)
+	if err != nil {
+		return nil, fmt.Errorf("create data stream: %w", err)
+	}
+
+	c := &portForwardConn{streams: streams, data: data}
+	go func() {
+		// The kubelet reports a failed dial of the port, e.g. nothing
+		// listening, here; it ends the connection.
+		message, err := io.ReadAll(errStream)
+		if err == nil && len(message) > 0 {
+			c.fail(fmt.Errorf("port-forward to port %d: %s", port, message))
+		}
+	}()
+	return c, nil
+}
+
+// portForwardAddr names an end of a port-forward.
+type portForwardAddr string
+
+func (a portForwardAddr) Network() string { return "kubepark-portforward" }
+func (a portForwardAddr) String() string  { return string(a) }
+
+// portForwardConn adapts a port-forward's data stream to a net.Conn. The
+// stream cannot be interrupted short of closing it, so a deadline that
+// passes ends the forward, failing reads and writes with
+// os.ErrDeadlineExceeded.
+type portForwardConn struct {
+	streams httpstream.Connection
+	data    httpstream.Stream
+	// local is the forward's origin, unique to it.
+	local, remote net.Addr
+
+	mu  sync.Mutex
+	err error
+	// readTimer and writeTimer end the forward at a deadline.
+	readTimer, writeTimer *time.Timer
+}
+
+// fail records why the forward ended, unless it already has, and closes
+// it.
+func (c *portForwardConn) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	_ = c.Close()
+}
+
+// setDeadline replaces the timer in *timer with one failing the forward at
+// t; a zero t clears it.
+func (c *portForwardConn) setDeadline(timer **time.Timer, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
+	}
+	if !t.IsZero() {
+		*timer = time.AfterFunc(time.Until(t), func() { c.fail(os.ErrDeadlineExceeded) })
+	}
+}
+
+// failure is the recorded reason the forward ended, else err.
+func (c *portForwardConn) failure(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return err
+}
+
+func (c *portForwardConn) Read(p []byte) (int, error) {
+	n, err := c.data.Read(p)
+	if err != nil {
+		err = c.failure(err)
+	}
+	return n, err
+}
+
+func (c *portForwardConn) Write(p []byte) (int, error) {
+	n, err := c.data.Write(p)
+	if err != nil {
+		err = c.failure(err)
+	}
+	return n, err
+}
+
+func (c *portForwardConn) Close() error {
+	c.setDeadline(&c.readTimer, time.Time{})
+	c.setDeadline(&c.writeTimer, time.Time{})
+	_ = c.data.Reset()
+	return c.streams.Close()
+}
+
+func (c *portForwardConn) LocalAddr() net.Addr  { return c.local }
+func (c *portForwardConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *portForwardConn) SetDeadline(t time.Time) error {
+	c.setDeadline(&c.readTimer, t)
+	c.setDeadline(&c.writeTimer, t)
+	return nil
+}
+
+func (c *portForwardConn) SetReadDeadline(t time.Time) error {
+	c.setDeadline(&c.readTimer, t)
+	return nil
+}
+
+func (c *portForwardConn) SetWriteDeadline(t time.Time) error {
+	c.setDeadline(&c.writeTimer, t)
+	return nil
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/controller/podspec"
+	"github.com/frauniki/kubepark/internal/tunnel"
+)
+
+// fakePortForwardServer serves pods/portforward over SPDY the way the
+// kubelet does, forwarding each data stream to the port on loopback, or the
+// agent's port to agentPort when given. It refuses WebSocket, so the
+// dialer's SPDY fallback is exercised too.
+func fakePortForwardServer(t *testing.T, pod string, agentPort ...int32) *httptest.Server {
+	t.Helper()
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", nsAlice, pod)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "websocket unsupported", http.StatusBadRequest)
+			return
+		}
+		if _, err := httpstream.Handshake(r, w, []string{portforward.PortForwardProtocolV1Name}); err != nil {
+			return
+		}
+		errStreams := make(chan httpstream.Stream, 1)
+		conn := spdy.NewResponseUpgrader().UpgradeResponse(w, r,
+			func(stream httpstream.Stream, replySent <-chan struct{}) error {
+				if stream.Headers().Get(corev1.StreamType) == corev1.StreamTypeError {
+					errStreams <- stream
+					return nil
+				}
+				go func() {
+					<-replySent
+					errStream := <-errStreams
+					port := stream.Headers().Get(corev1.PortHeader)
+					if len(agentPort) > 0 && port == strconv.Itoa(podspec.AgentPort) {
+						port = strconv.Itoa(int(agentPort[0]))
+					}
+					upstream, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+					if err != nil {
+						_, _ = fmt.Fprintf(errStream, "failed to connect to localhost:%s", port)
+						_ = errStream.Close()
+						return
+					}
+					_ = errStream.Close()
+					go func() { _, _ = io.Copy(upstream, stream) }()
+					_, _ = io.Copy(stream, upstream)
+					_ = stream.Close()
+				}()
+				return nil
+			})
+		if conn != nil {
+			<-conn.CloseChan()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// echoListener echoes every connection back and returns its port.
+func echoListener(t *testing.T) int32 {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() { _, _ = io.Copy(conn, conn); _ = conn.Close() }()
+		}
+	}()
+	return int32(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func portForwardSandbox(pod string) *kubeparkv1alpha1.Sandbox {
+	return &kubeparkv1alpha1.Sandbox{
+		ObjectMeta: metav1.ObjectMeta{Namespace: nsAlice, Name: sbName},
+		Status:     kubeparkv1alpha1.SandboxStatus{PodName: pod},
+	}
+}
+
+// TestPortForwardDialer proves a connection reaches the pod's port through
+// the API server, in the cluster ctx names.
+func TestPortForwardDialer(t *testing.T) {
+	const pod = "kubepark-sb-demo"
+	srv := fakePortForwardServer(t, pod)
+	port := echoListener(t)
+	clusters := NewClusters(nil, "kubepark-system", kubeparkScheme())
+	d := NewPortForwardDialer(&rest.Config{Host: srv.URL}, clusters)
+	ctx := context.Background()
+
+	conn, err := d.DialSandbox(ctx, portForwardSandbox(pod), port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo = %q, %v", buf, err)
+	}
+
+	var noRoute ErrNoRoute
+	if _, err := d.DialSandbox(ctx, portForwardSandbox(""), port); !errors.As(err, &noRoute) {
+		t.Errorf("sandbox without a pod = %v, want ErrNoRoute", err)
+	}
+	if _, err := d.DialSandbox(WithCluster(ctx, "tokyo"), portForwardSandbox(pod), port); !errors.As(err, &noRoute) {
+		t.Errorf("unregistered cluster = %v, want ErrNoRoute", err)
+	}
+}
+
+// TestPortForwardDialerRefused proves the kubelet's report of a failed dial
+// surfaces on the connection.
+func TestPortForwardDialerRefused(t *testing.T) {
+	const pod = "kubepark-sb-demo"
+	srv := fakePortForwardServer(t, pod)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := int32(ln.Addr().(*net.TCPAddr).Port)
+	_ = ln.Close()
+
+	conn, err := NewPortForwardDialer(&rest.Config{Host: srv.URL}, nil).
+		DialSandbox(context.Background(), portForwardSandbox(pod), closed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Read(make([]byte, 1)); err == nil || !strings.Contains(err.Error(), "failed to connect") {
+		t.Fatalf("read = %v, want the kubelet's error", err)
+	}
+}
+
+// TestPortForwardDialerOrigin proves each forward has an origin of its own,
+// and that the agent is told it ahead of the SSH stream.
+func TestPortForwardDialerOrigin(t *testing.T) {
+	const pod = "kubepark-sb-demo"
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	lines := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				lines <- line
+			}()
+		}
+	}()
+	srv := fakePortForwardServer(t, pod, int32(ln.Addr().(*net.TCPAddr).Port))
+	d := NewPortForwardDialer(&rest.Config{Host: srv.URL}, nil)
+
+	var origins []string
+	for range 2 {
+		conn, err := d.DialSandbox(context.Background(), portForwardSandbox(pod), podspec.AgentPort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = conn.Close() }()
+		origin := conn.LocalAddr().String()
+		if line := <-lines; line != tunnel.OriginPrefix+origin+"\r\n" {
+			t.Errorf("agent read %q, want the origin %q", line, origin)
+		}
+		origins = append(origins, origin)
+	}
+	if origins[0] == origins[1] {
+		t.Errorf("forwards share the origin %q", origins[0])
+	}
+}
+
+// TestPortForwardDialerDeadline proves a read deadline ends a stalled
+// forward, and that a cleared one leaves the forward be.
+func TestPortForwardDialerDeadline(t *testing.T) {
+	const pod = "kubepark-sb-demo"
+	srv := fakePortForwardServer(t, pod)
+	port := echoListener(t)
+	d := NewPortForwardDialer(&rest.Config{Host: srv.URL}, nil)
+
+	conn, err := d.DialSandbox(context.Background(), portForwardSandbox(pod), port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if err := conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	var netErr net.Error
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) ||
+		!errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("read past the deadline = %v, want a timeout", err)
+	}
+
+	conn, err = d.DialSandbox(context.Background(), portForwardSandbox(pod), port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(50 * time.Millisecond))
+	_ = conn.SetDeadline(time.Time{})
+	time.Sleep(100 * time.Millisecond)
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo after clearing the deadline = %q, %v", buf, err)
+	}
+}
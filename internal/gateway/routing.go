@@ -25,12 +25,16 @@ import (
 type SSHTarget struct {
 	Sandbox   string
 	Namespace string
+	// Cluster is the member cluster the sandbox lives in, "" for the
+	// gateway's own.
+	Cluster string
 }
 
 // ParseSSHTarget parses the inner SSH destination host of the form
-// "<sandbox>.<namespace>". Both components are DNS labels containing no
-// dots, so the first dot is an unambiguous separator. A bare "<sandbox>"
-// defaults the namespace to defaultNamespace.
+// "<sandbox>.<namespace>", or "<sandbox>.<namespace>.<cluster>" for a
+// sandbox in a member cluster. Every component is a DNS label containing
+// no dots, so dots are unambiguous separators. A bare "<sandbox>" defaults
+// the namespace to defaultNamespace.
 func ParseSSHTarget(host, defaultNamespace string) (SSHTarget, error) {
 	host = strings.TrimSpace(host)
 	if host == "" {
@@ -43,8 +47,9 @@ func ParseSSHTarget(host, defaultNamespace string) (SSHTarget, error) {
 		}
 		return SSHTarget{Sandbox: sandbox, Namespace: defaultNamespace}, nil
 	}
-	if sandbox == "" || namespace == "" {
+	namespace, cluster, hasCluster := strings.Cut(namespace, ".")
+	if sandbox == "" || namespace == "" || (hasCluster && (cluster == "" || strings.Contains(cluster, "."))) {
 		return SSHTarget{}, fmt.Errorf("invalid ssh target %q", host)
 	}
-	return SSHTarget{Sandbox: sandbox, Namespace: namespace}, nil
+	return SSHTarget{Sandbox: sandbox, Namespace: namespace, Cluster: cluster}, nil
 }
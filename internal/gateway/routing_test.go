@@ -27,6 +27,7 @@ func TestParseSSHTarget(t *testing.T) {
 		defaultNS string
 		wantSB    string
 		wantNS    string
+		wantCl    string
 		wantErr   bool
 	}{
 		{in: sbName + ".alice", wantSB: sbName, wantNS: nsAlice},
@@ -35,6 +36,9 @@ func TestParseSSHTarget(t *testing.T) {
 		{in: "", wantErr: true},
 		{in: ".alice", wantErr: true},
 		{in: sbName + ".", wantErr: true},
+		{in: sbName + ".alice.tokyo", wantSB: sbName, wantNS: nsAlice, wantCl: "tokyo"},
+		{in: sbName + ".alice.", wantErr: true},
+		{in: sbName + ".alice.tokyo.x", wantErr: true},
 	}
 	for _, tc := range cases {
 		got, err := ParseSSHTarget(tc.in, tc.defaultNS)
@@ -48,8 +52,9 @@ func TestParseSSHTarget(t *testing.T) {
 			t.Errorf("ParseSSHTarget(%q, %q): unexpected error %v", tc.in, tc.defaultNS, err)
 			continue
 		}
-		if got.Sandbox != tc.wantSB || got.Namespace != tc.wantNS {
-			t.Errorf("ParseSSHTarget(%q, %q) = %+v, want %s/%s", tc.in, tc.defaultNS, got, tc.wantNS, tc.wantSB)
+		if got.Sandbox != tc.wantSB || got.Namespace != tc.wantNS || got.Cluster != tc.wantCl {
+			t.Errorf("ParseSSHTarget(%q, %q) = %+v, want %s/%s in %q", tc.in, tc.defaultNS, got, tc.wantNS, tc.wantSB,
+				tc.wantCl)
 		}
 	}
 }
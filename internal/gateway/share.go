@@ -0,0 +1,355 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+const (
+	// shareParam carries a share link's value on its first request; the
+	// gateway trades it for a cookie and drops it from the URL.
+	shareParam = "kubepark_share"
+
+	defaultShareMaxTTL            = 24 * time.Hour
+	defaultShareRequestsPerMinute = 60
+)
+
+// shareClaims are a share link: one port of one sandbox, granted by its
+// owner until expiry.
+type shareClaims struct {
+	ID        string `json:"i"`
+	Owner     string `json:"o"`
+	Namespace string `json:"n"`
+	Sandbox   string `json:"s"`
+	Port      string `json:"p"`
+	Cluster   string `json:"c,omitempty"`
+	ReadOnly  bool   `json:"r,omitempty"`
+	Expiry    int64  `json:"e"`
+}
+
+// ShareLinksConfig configures share links.
+type ShareLinksConfig struct {
+	// BaseDomain and Routing build a link's URL, as for HTTPProxyConfig.
+	BaseDomain string
+	Routing    RoutingMode
+	// Secure builds https links and Secure cookies.
+	Secure bool
+	// HMACKey signs links; it should be stable across gateway replicas.
+	HMACKey []byte
+	// Revocations keeps revoked link IDs until the links expire.
+	Revocations Revocations
+	Store       Store
+}
+
+// ShareLinks issues and admits share links: signed, expiring URLs with
+// which a sandbox owner lets anyone reach one auth:oidc port that allows
+// them. Every request through a link is rate-limited and audit-logged.
+type ShareLinks struct {
+	cfg ShareLinksConfig
+	// Now is injected for tests.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	limiters map[string]*shareLimiter
+}
+
+// shareLimiter rate-limits one link until it expires.
+type shareLimiter struct {
+	*rate.Limiter
+	perMinute int32
+	expiry    int64
+}
+
+// NewShareLinks builds the share link issuer.
+func NewShareLinks(cfg ShareLinksConfig) *ShareLinks {
+	if cfg.Routing == "" {
+		cfg.Routing = RoutingHost
+	}
+	return &ShareLinks{cfg: cfg, Now: time.Now, limiters: map[string]*shareLimiter{}}
+}
+
+// IssuedShareLink is a newly created share link.
+type IssuedShareLink struct {
+	URL       string    `json:"url"`
+	ID        string    `json:"id"`
+	ReadOnly  bool      `json:"readOnly"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// errShareNotOwner is returned when someone other than the sandbox owner
+// creates or revokes a link.
+var errShareNotOwner = errors.New("only the sandbox owner can share its ports")
+
+// Create issues a link to target, whose Port is required, on behalf of
+// principal. The port's policy may force the link read-only.
+func (s *ShareLinks) Create(
+	ctx context.Context, principal string, target TokenScope, readOnly bool, ttl time.Duration,
+) (IssuedShareLink, error) {
+	if target.Port == "" {
+		return IssuedShareLink{}, errors.New("a share link needs a port")
+	}
+	sb, err := s.cfg.Store.GetSandbox(WithCluster(ctx, target.Cluster), target.Namespace, target.Sandbox)
+	if err != nil {
+		return IssuedShareLink{}, fmt.Errorf("sandbox %s/%s not found", target.Namespace, target.Sandbox)
+	}
+	if sb.Spec.Owner.Name != principal {
+		return IssuedShareLink{}, errShareNotOwner
+	}
+	port := findExposedPort(sb, target.Port)
+	if port == nil || port.Auth != kubeparkv1alpha1.AuthModeOIDC || port.ShareLinks == nil {
+		return IssuedShareLink{}, fmt.Errorf("port %q does not allow share links", target.Port)
+	}
+	if maxTTL := shareMaxTTL(port.ShareLinks); ttl <= 0 || ttl > maxTTL {
+		return IssuedShareLink{}, fmt.Errorf("share link lifetime must be positive and at most %s", maxTTL)
+	}
+
+	claims := shareClaims{
+		ID:        randomString(),
+		Owner:     principal,
+		Namespace: sb.Namespace,
+		Sandbox:   sb.Name,
+		Port:      port.Name,
+		Cluster:   target.Cluster,
+		ReadOnly:  readOnly || port.ShareLinks.ReadOnly,
+		Expiry:    s.Now().Add(ttl).Unix(),
+	}
+	link := s.routeURL(claims)
+	link.RawQuery = url.Values{shareParam: {signValue(s.cfg.HMACKey, purposeShare, claims)}}.Encode()
+	return IssuedShareLink{
+		URL:       link.String(),
+		ID:        claims.ID,
+		ReadOnly:  claims.ReadOnly,
+		ExpiresAt: time.Unix(claims.Expiry, 0).UTC(),
+	}, nil
+}
+
+// Revoke revokes a link, given as its URL, on behalf of principal, who
+// must be the owner that created it.
+func (s *ShareLinks) Revoke(ctx context.Context, principal, link string) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return errInvalidToken
+	}
+	var claims shareClaims
+	if !verifyValue(s.cfg.HMACKey, purposeShare, u.Query().Get(shareParam), &claims) {
+		return errInvalidToken
+	}
+	if claims.Owner != principal {
+		return errShareNotOwner
+	}
+	if s.cfg.Revocations == nil {
+		return errors.New("share link revocation is not configured")
+	}
+	return s.cfg.Revocations.Revoke(ctx, claims.ID, time.Unix(claims.Expiry, 0))
+}
+
+// routeURL is the root of the route a link opens.
+func (s *ShareLinks) routeURL(c shareClaims) url.URL {
+	scheme := "http"
+	if s.cfg.Secure {
+		scheme = "https"
+	}
+	if s.cfg.Routing == RoutingPath {
+		return url.URL{Scheme: scheme, Host: s.cfg.BaseDomain, Path: routePrefix(c.target()) + "/"}
+	}
+	return url.URL{Scheme: scheme, Host: routeHost(c.target(), s.cfg.BaseDomain), Path: "/"}
+}
+
+// target is the route of a link's port.
+func (c shareClaims) target() HTTPTarget {
+	return HTTPTarget{Port: c.Port, Sandbox: c.Sandbox, Namespace: c.Namespace, Cluster: c.Cluster}
+}
+
+// admit handles a request through a share link to a port that allows
+// them. shared reports that the link admits the request, which is then
+// proxied without an identity; done reports that a response was written.
+// Neither means the request carries no link, and goes on to log in.
+func (s *ShareLinks) admit(
+	w http.ResponseWriter, r *http.Request, sb *kubeparkv1alpha1.Sandbox, port *kubeparkv1alpha1.ExposedPort, prefix string,
+) (shared, done bool) {
+	// A fresh link is swapped for a cookie, keeping it out of the app's
+	// logs and Referer headers.
+	if value := r.URL.Query().Get(shareParam); value != "" {
+		claims, ok := s.verify(r.Context(), value, sb, port)
+		if !ok {
+			http.Error(w, "invalid or expired share link", http.StatusForbidden)
+			return false, true
+		}
+		if s.refuse(w, r, claims, port) {
+			return false, true
+		}
+		s.audit(r, claims, "redeemed")
+		s.setCookie(w, prefix, value, int(claims.Expiry-s.Now().Unix()))
+		q := r.URL.Query()
+		q.Del(shareParam)
+		to := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, to.String(), http.StatusFound)
+		return false, true
+	}
+
+	cookie, err := r.Cookie(s.cookieName(prefix))
+	if err != nil {
+		return false, false
+	}
+	claims, ok := s.verify(r.Context(), cookie.Value, sb, port)
+	if !ok {
+		return false, false
+	}
+	if s.refuse(w, r, claims, port) {
+		return false, true
+	}
+	s.audit(r, claims, "allowed")
+	return true, false
+}
+
+// refuse answers a request on a valid link that is revoked, read-only for
+// it, or over its rate limit, and reports whether it did. A redemption
+// counts against the limit like any other request.
+func (s *ShareLinks) refuse(
+	w http.ResponseWriter, r *http.Request, claims shareClaims, port *kubeparkv1alpha1.ExposedPort,
+) bool {
+	revoked, err := s.revoked(r.Context(), claims.ID)
+	switch {
+	case err != nil:
+		log.FromContext(r.Context()).Error(err, "failed to check share link revocation")
+		http.Error(w, "session store unavailable", http.StatusServiceUnavailable)
+	case revoked:
+		s.audit(r, claims, "revoked")
+		http.Error(w, "this share link was revoked", http.StatusForbidden)
+	case claims.ReadOnly && !readOnlyRequest(r):
+		s.audit(r, claims, "read-only")
+		http.Error(w, "this share link is read-only", http.StatusMethodNotAllowed)
+	case !s.allow(claims, port.ShareLinks):
+		s.audit(r, claims, "rate-limited")
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	default:
+		return false
+	}
+	return true
+}
+
+// verify checks a link's signature and expiry, and that it is for this
+// port of this sandbox, in the cluster ctx names, under its current owner.
+func (s *ShareLinks) verify(
+	ctx context.Context, value string, sb *kubeparkv1alpha1.Sandbox, port *kubeparkv1alpha1.ExposedPort,
+) (shareClaims, bool) {
+	var c shareClaims
+	if !verifyValue(s.cfg.HMACKey, purposeShare, value, &c) || s.Now().Unix() > c.Expiry {
+		return shareClaims{}, false
+	}
+	if c.Cluster != ClusterFromContext(ctx) || c.Namespace != sb.Namespace || c.Sandbox != sb.Name ||
+		c.Port != port.Name || c.Owner != sb.Spec.Owner.Name {
+		return shareClaims{}, false
+	}
+	// A policy made read-only since applies to links issued before.
+	c.ReadOnly = c.ReadOnly || port.ShareLinks.ReadOnly
+	return c, true
+}
+
+func (s *ShareLinks) revoked(ctx context.Context, id string) (bool, error) {
+	if s.cfg.Revocations == nil {
+		return false, nil
+	}
+	return s.cfg.Revocations.Revoked(ctx, id)
+}
+
+// allow takes a request from the link's rate limit.
+func (s *ShareLinks) allow(c shareClaims, policy *kubeparkv1alpha1.ShareLinkPolicy) bool {
+	perMinute := int32(defaultShareRequestsPerMinute)
+	if policy.RequestsPerMinute != nil {
+		perMinute = *policy.RequestsPerMinute
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.Now()
+	for id, l := range s.limiters {
+		if now.Unix() > l.expiry {
+			delete(s.limiters, id)
+		}
+	}
+	l, ok := s.limiters[c.ID]
+	if !ok || l.perMinute != perMinute {
+		l = &shareLimiter{
+			Limiter:   rate.NewLimiter(rate.Limit(float64(perMinute)/60), int(perMinute)),
+			perMinute: perMinute,
+			expiry:    c.Expiry,
+		}
+		s.limiters[c.ID] = l
+	}
+	return l.AllowN(now, 1)
+}
+
+// audit records a request through a share link.
+func (s *ShareLinks) audit(r *http.Request, c shareClaims, outcome string) {
+	log.FromContext(r.Context()).Info("share link access",
+		"link", c.ID, "owner", c.Owner, "cluster", c.Cluster, "namespace", c.Namespace, "sandbox", c.Sandbox, "port", c.Port,
+		"method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr, "outcome", outcome)
+}
+
+// setCookie keeps a redeemed link for its route: the whole host under
+// host routing, the route's path under path routing, where one host
+// serves every sandbox.
+func (s *ShareLinks) setCookie(w http.ResponseWriter, prefix, value string, maxAge int) {
+	path := "/"
+	if prefix != "" {
+		path = prefix + "/"
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name: s.cookieName(prefix), Value: value, Path: path, MaxAge: maxAge,
+		HttpOnly: true, Secure: s.cfg.Secure, SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// cookieName locks the cookie to its host where it can be: a __Host-
+// cookie must have Path=/, which a path route cannot use.
+func (s *ShareLinks) cookieName(prefix string) string {
+	if s.cfg.Secure && prefix == "" {
+		return hostCookiePrefix + shareCookie
+	}
+	return shareCookie
+}
+
+// readOnlyRequest reports whether a request only reads: a safe method,
+// and not a WebSocket, whose messages could do anything.
+func readOnlyRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return r.Header.Get("Upgrade") == ""
+	}
+	return false
+}
+
+func shareMaxTTL(policy *kubeparkv1alpha1.ShareLinkPolicy) time.Duration {
+	if policy.MaxTTL != nil {
+		return policy.MaxTTL.Duration
+	}
+	return defaultShareMaxTTL
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+// sharedSandbox is testSandbox with share links allowed on jupyter.
+func sharedSandbox(policy kubeparkv1alpha1.ShareLinkPolicy) *kubeparkv1alpha1.Sandbox {
+	sb := testSandbox("10.0.0.1")
+	sb.Spec.ExposedPorts[0].ShareLinks = &policy
+	return sb
+}
+
+func testShareLinks(sb *kubeparkv1alpha1.Sandbox, routing RoutingMode) (*ShareLinks, memRevocations) {
+	revocations := memRevocations{}
+	return NewShareLinks(ShareLinksConfig{
+		BaseDomain:  "sb.example.com",
+		Routing:     routing,
+		HMACKey:     []byte("test-hmac-key"),
+		Revocations: revocations,
+		Store:       newSessionStore(sb),
+	}), revocations
+}
+
+func TestShareLinkCreate(t *testing.T) {
+	ctx := context.Background()
+	sb := sharedSandbox(kubeparkv1alpha1.ShareLinkPolicy{MaxTTL: &metav1.Duration{Duration: 2 * time.Hour}})
+	shares, _ := testShareLinks(sb, RoutingHost)
+	jupyter := TokenScope{Namespace: nsAlice, Sandbox: sbName, Port: "jupyter"}
+
+	issued, err := shares.Create(ctx, "alice@example.com", jupyter, false, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(issued.URL)
+	if err != nil || u.Host != jupyterHost || u.Path != "/" || u.Query().Get(shareParam) == "" {
+		t.Errorf("link = %q, want the port's host with a share value", issued.URL)
+	}
+
+	for name, create := range map[string]func() error{
+		"by someone other than the owner": func() error {
+			_, err := shares.Create(ctx, "mallory@example.com", jupyter, false, time.Hour)
+			return err
+		},
+		"to a port without a share policy": func() error {
+			_, err := shares.Create(ctx, "alice@example.com", TokenScope{Namespace: nsAlice, Sandbox: sbName, Port: "web"},
+				false, time.Hour)
+			return err
+		},
+		"to a whole sandbox": func() error {
+			_, err := shares.Create(ctx, "alice@example.com", TokenScope{Namespace: nsAlice, Sandbox: sbName}, false, time.Hour)
+			return err
+		},
+		"beyond the port's maximum lifetime": func() error {
+			_, err := shares.Create(ctx, "alice@example.com", jupyter, false, 3*time.Hour)
+			return err
+		},
+	} {
+		if create() == nil {
+			t.Errorf("a link %s must be refused", name)
+		}
+	}
+
+	path, _ := testShareLinks(sb, RoutingPath)
+	issued, err = path.Create(ctx, "alice@example.com", jupyter, false, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := url.Parse(issued.URL); u.Host != "sb.example.com" || u.Path != "/s/alice/demo/jupyter/" {
+		t.Errorf("path-routed link = %q", issued.URL)
+	}
+}
+
+// TestShareLinkCluster proves a link to a member cluster's sandbox routes
+// to that cluster and admits nothing in another.
+func TestShareLinkCluster(t *testing.T) {
+	ctx := context.Background()
+	sb := sharedSandbox(kubeparkv1alpha1.ShareLinkPolicy{})
+	shares, _ := testShareLinks(sb, RoutingHost)
+	scope := TokenScope{Namespace: nsAlice, Sandbox: sbName, Port: "jupyter", Cluster: "tokyo"}
+
+	issued, err := shares.Create(ctx, "alice@example.com", scope, false, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(issued.URL)
+	if u.Host != "jupyter--demo--alice.tokyo.sb.example.com" {
+		t.Errorf("member link = %q, want the cluster's host", issued.URL)
+	}
+	value := u.Query().Get(shareParam)
+	port := findExposedPort(sb, "jupyter")
+	if _, ok := shares.verify(WithCluster(ctx, "tokyo"), value, sb, port); !ok {
+		t.Error("the link was refused in its cluster")
+	}
+	if _, ok := shares.verify(ctx, value, sb, port); ok {
+		t.Error("the link admitted the same-named sandbox of the gateway's own cluster")
+	}
+}
+
+func TestHTTPProxyShareLinks(t *testing.T) {
+	var seen *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		seen = r
+	}))
+	defer upstream.Close()
+
+	// The redemption and one request.
+	perMinute := int32(2)
+	sb := sharedSandbox(kubeparkv1alpha1.ShareLinkPolicy{RequestsPerMinute: &perMinute})
+	sb.Spec.ExposedPorts = append(sb.Spec.ExposedPorts, kubeparkv1alpha1.ExposedPort{
+		Name: "api", Port: 9000, Auth: kubeparkv1alpha1.AuthModeOIDC, ShareLinks: &kubeparkv1alpha1.ShareLinkPolicy{},
+	})
+	shares, revocations := testShareLinks(sb, RoutingHost)
+	auth, _ := testCookieAuth()
+	p := NewHTTPProxy(HTTPProxyConfig{
+		BaseDomain: "sb.example.com",
+		Store:      newSessionStore(sb),
+		Auth:       auth,
+		Shares:     shares,
+		DialAddr:   func(*kubeparkv1alpha1.Sandbox, int32) string { return upstream.URL },
+	})
+	send := func(method, rawURL string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		seen = nil
+		req := httptest.NewRequest(method, rawURL, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		return rec
+	}
+
+	issued, err := shares.Create(context.Background(), "alice@example.com",
+		TokenScope{Namespace: nsAlice, Sandbox: sbName, Port: "jupyter"}, true, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The link is traded for a cookie and dropped from the URL.
+	rec := send(http.MethodGet, issued.URL, nil)
+	if loc := rec.Header().Get("Location"); rec.Code != http.StatusFound || loc != "/" {
+		t.Fatalf("redeem: %d %q, want a redirect to /", rec.Code, loc)
+	}
+	cookie := responseCookie(t, rec, shareCookie)
+
+	rec = send(http.MethodGet, "http://"+jupyterHost+"/notebooks", cookie)
+	if rec.Code != http.StatusOK || seen == nil {
+		t.Fatalf("shared GET: %d", rec.Code)
+	}
+	if seen.Header.Get(HeaderForwardedUser) != "" || seen.Header.Get("Cookie") != "" {
+		t.Errorf("a share link must reach the app without an identity or its cookie: %v", seen.Header)
+	}
+
+	// A read-only link refuses writes and WebSockets.
+	if rec := send(http.MethodPost, "http://"+jupyterHost+"/api", cookie); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("shared POST: %d, want 405", rec.Code)
+	}
+
+	// The link opens its port only; elsewhere it is no credential.
+	if rec := send(http.MethodGet, "http://api--demo--alice.sb.example.com/", cookie); rec.Code != http.StatusFound {
+		t.Errorf("share cookie on another port: %d, want a login redirect", rec.Code)
+	}
+	other := *cookie
+	other.Value = "forged"
+	if rec := send(http.MethodGet, "http://"+jupyterHost+"/", &other); rec.Code != http.StatusFound {
+		t.Errorf("forged share cookie: %d, want a login redirect", rec.Code)
+	}
+
+	// Each link has its own rate limit, which its redemption counts against.
+	if rec := send(http.MethodGet, "http://"+jupyterHost+"/", cookie); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("over the rate limit: %d, want 429", rec.Code)
+	}
+
+	if err := shares.Revoke(context.Background(), "mallory@example.com", issued.URL); err == nil {
+		t.Error("only the owner may revoke a link")
+	}
+	if err := shares.Revoke(context.Background(), "alice@example.com", issued.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := revocations[issued.ID]; !ok {
+		t.Fatal("revoke must record the link")
+	}
+	if rec := send(http.MethodGet, "http://"+jupyterHost+"/", cookie); rec.Code != http.StatusForbidden {
+		t.Errorf("revoked link: %d, want 403", rec.Code)
+	}
+	if rec := send(http.MethodGet, issued.URL, nil); rec.Code != http.StatusForbidden || len(rec.Result().Cookies()) != 0 {
+		t.Errorf("redeeming a revoked link: %d, want 403 without a cookie", rec.Code)
+	}
+
+	// Expired links are refused outright.
+	shares.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if rec := send(http.MethodGet, issued.URL, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("expired link: %d, want 403", rec.Code)
+	}
+}
+
+func TestReadOnlyRequest(t *testing.T) {
+	for method, want := range map[string]bool{
+		http.MethodGet: true, http.MethodHead: true, http.MethodOptions: true,
+		http.MethodPost: false, http.MethodPut: false, http.MethodDelete: false,
+	} {
+		if got := readOnlyRequest(httptest.NewRequest(method, "/", nil)); got != want {
+			t.Errorf("%s: %v, want %v", method, got, want)
+		}
+	}
+	ws := httptest.NewRequest(http.MethodGet, "/", nil)
+	ws.Header.Set("Connection", "Upgrade")
+	ws.Header.Set("Upgrade", "websocket")
+	if readOnlyRequest(ws) {
+		t.Error("a WebSocket upgrade is not read-only")
+	}
+}
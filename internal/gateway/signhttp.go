@@ -19,8 +19,10 @@ package gateway
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -41,11 +43,21 @@ type OIDCConfig struct {
 	BaseDomain string
 	// GatewaySSHAddr is advertised to clients as the jump host.
 	GatewaySSHAddr string
+	// Profiles, when set, gets an empty UserProfile for each principal
+	// that logs in without one, ready for the user to fill in.
+	Profiles Store
+	// Tokens, when set, serves /v1/token to mint personal access tokens
+	// and /v1/token/revoke to revoke them.
+	Tokens *Tokens
+	// Shares, when set, serves /v1/share to create share links and
+	// /v1/share/revoke to revoke them.
+	Shares *ShareLinks
 }
 
 // SignServer serves /v1/config and /v1/sign: the CLI fetches the OIDC
 // configuration, runs the login flow itself, then posts its public key and
-// ID token here to receive a short-lived certificate.
+// ID token here to receive a short-lived certificate. The same ID token
+// mints personal access tokens at /v1/token and share links at /v1/share.
 type SignServer struct {
 	signer   *Signer
 	oidc     OIDCConfig
@@ -73,6 +85,10 @@ func (s *SignServer) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/v1/config", s.handleConfig)
 	mux.HandleFunc("/v1/sign", s.handleSign)
+	mux.HandleFunc("/v1/token", s.handleToken)
+	mux.HandleFunc("/v1/token/revoke", s.handleRevokeToken)
+	mux.HandleFunc("/v1/share", s.handleShare)
+	mux.HandleFunc("/v1/share/revoke", s.handleRevokeShare)
 	return mux
 }
 
@@ -140,9 +156,173 @@ func (s *SignServer) handleSign(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	logger.Info("signed certificate", "principal", principal, "remote", r.RemoteAddr)
+	if s.oidc.Profiles != nil {
+		// Login never fails on the profile; the next one retries it.
+		if err := s.oidc.Profiles.EnsureUserProfile(r.Context(), principal); err != nil {
+			logger.Error(err, "failed to create user profile", "principal", principal)
+		}
+	}
 	writeJSON(w, http.StatusOK, signResponse{Certificate: string(cert), Principal: principal})
 }
 
+type tokenRequest struct {
+	IDToken    string       `json:"idToken"`
+	Scopes     []TokenScope `json:"scopes"`
+	TTLSeconds int64        `json:"ttlSeconds"`
+}
+
+func (s *SignServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	logger := log.FromContext(r.Context())
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.verifier == nil || s.oidc.Tokens == nil {
+		http.Error(w, "personal access tokens are not configured on this gateway", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	idToken, err := s.verifier.Verify(r.Context(), req.IDToken)
+	if err != nil {
+		logger.Info("rejected token request", "reason", err.Error())
+		http.Error(w, "invalid ID token", http.StatusUnauthorized)
+		return
+	}
+	principal, err := principalFromClaims(idToken, s.oidc.PrincipalClaim)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, groups := identityFromToken(idToken, s.oidc.PrincipalClaim)
+
+	issued, err := s.oidc.Tokens.Issue(principal, groups, req.Scopes, time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Info("issued personal access token", "principal", principal, "id", issued.ID,
+		"scopes", req.Scopes, "expires", issued.ExpiresAt)
+	writeJSON(w, http.StatusOK, issued)
+}
+
+// handleRevokeToken revokes the personal access token presented as the
+// bearer token.
+func (s *SignServer) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.oidc.Tokens == nil {
+		http.Error(w, "personal access tokens are not configured on this gateway", http.StatusServiceUnavailable)
+		return
+	}
+	token, ok := bearerToken(r)
+	if !ok {
+		http.Error(w, "missing bearer token", http.StatusUnauthorized)
+		return
+	}
+	if err := s.oidc.Tokens.Revoke(r.Context(), token); err != nil {
+		if errors.Is(err, errInvalidToken) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		log.FromContext(r.Context()).Error(err, "failed to revoke token")
+		http.Error(w, "revocation failed", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type shareRequest struct {
+	IDToken    string     `json:"idToken"`
+	Target     TokenScope `json:"target"`
+	ReadOnly   bool       `json:"readOnly"`
+	TTLSeconds int64      `json:"ttlSeconds"`
+}
+
+func (s *SignServer) handleShare(w http.ResponseWriter, r *http.Request) {
+	var req shareRequest
+	principal, ok := s.shareCaller(w, r, &req, func() string { return req.IDToken })
+	if !ok {
+		return
+	}
+	issued, err := s.oidc.Shares.Create(r.Context(), principal, req.Target, req.ReadOnly,
+		time.Duration(req.TTLSeconds)*time.Second)
+	if errors.Is(err, errShareNotOwner) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.FromContext(r.Context()).Info("created share link", "principal", principal, "id", issued.ID,
+		"target", req.Target, "readOnly", issued.ReadOnly, "expires", issued.ExpiresAt)
+	writeJSON(w, http.StatusOK, issued)
+}
+
+type revokeShareRequest struct {
+	IDToken string `json:"idToken"`
+	URL     string `json:"url"`
+}
+
+func (s *SignServer) handleRevokeShare(w http.ResponseWriter, r *http.Request) {
+	var req revokeShareRequest
+	principal, ok := s.shareCaller(w, r, &req, func() string { return req.IDToken })
+	if !ok {
+		return
+	}
+	err := s.oidc.Shares.Revoke(r.Context(), principal, req.URL)
+	switch {
+	case errors.Is(err, errInvalidToken):
+		http.Error(w, "invalid share link", http.StatusBadRequest)
+		return
+	case errors.Is(err, errShareNotOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		log.FromContext(r.Context()).Error(err, "failed to revoke share link")
+		http.Error(w, "revocation failed", http.StatusServiceUnavailable)
+		return
+	}
+	log.FromContext(r.Context()).Info("revoked share link", "principal", principal)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// shareCaller decodes a share request into req and returns the principal
+// of its ID token, writing an error response when it cannot.
+func (s *SignServer) shareCaller(w http.ResponseWriter, r *http.Request, req any, idToken func() string) (string, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return "", false
+	}
+	if s.verifier == nil || s.oidc.Shares == nil {
+		http.Error(w, "share links are not configured on this gateway", http.StatusServiceUnavailable)
+		return "", false
+	}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return "", false
+	}
+	token, err := s.verifier.Verify(r.Context(), idToken())
+	if err != nil {
+		log.FromContext(r.Context()).Info("rejected share request", "reason", err.Error())
+		http.Error(w, "invalid ID token", http.StatusUnauthorized)
+		return "", false
+	}
+	principal, err := principalFromClaims(token, s.oidc.PrincipalClaim)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return principal, true
+}
+
 // principalFromClaims extracts the configured claim as the principal.
 func principalFromClaims(idToken *oidc.IDToken, claim string) (string, error) {
 	var claims map[string]any
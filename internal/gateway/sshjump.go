@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strings"
 	"time"
 
 	gliderssh "github.com/gliderlabs/ssh"
@@ -31,6 +32,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/controller/podspec"
 	"github.com/frauniki/kubepark/internal/sshca"
 )
 
@@ -59,6 +61,9 @@ type SSHConfig struct {
 
 	Store  Store
 	Dialer Dialer
+	// DialTarget connects to AccessTarget destinations (default: a plain
+	// net.Dialer).
+	DialTarget func(ctx context.Context, network, addr string) (net.Conn, error)
 }
 
 // NewSSHServer builds the jump host: it accepts only certificate auth and
@@ -67,12 +72,8 @@ func NewSSHServer(cfg SSHConfig) (*gliderssh.Server, error) {
 	if cfg.Store == nil || cfg.Dialer == nil {
 		return nil, fmt.Errorf("gateway requires a store and a dialer")
 	}
-	if cfg.Now == nil {
-		cfg.Now = time.Now
-	}
-	if cfg.WakeTimeout == 0 {
-		cfg.WakeTimeout = defaultWakeTimeout
-	}
+	h := newJumpHandler(cfg)
+	cfg = h.cfg
 
 	hostSigner, err := gossh.ParsePrivateKey(cfg.HostKeyPEM)
 	if err != nil {
@@ -83,16 +84,22 @@ func NewSSHServer(cfg SSHConfig) (*gliderssh.Server, error) {
 		return nil, fmt.Errorf("parse user CA: %w", err)
 	}
 
-	h := &jumpHandler{cfg: cfg}
-
 	srv := &gliderssh.Server{
 		Addr:        cfg.Addr,
 		HostSigners: []gliderssh.Signer{hostSigner},
-		// Certificate auth only. The principal is stashed for the routing
-		// authz check.
+		// Certificate auth, or a key a UserProfile authorizes for tooling.
+		// The principal is stashed for the routing authz check.
 		PublicKeyHandler: func(ctx gliderssh.Context, key gliderssh.PublicKey) bool {
 			cert, ok := key.(*gossh.Certificate)
-			if !ok || len(cert.ValidPrincipals) == 0 {
+			if !ok {
+				principal, err := cfg.Store.PrincipalForKey(ctx, key)
+				if err != nil || principal == "" {
+					return false
+				}
+				ctx.SetValue(ctxKeyPrincipal, principal)
+				return true
+			}
+			if len(cert.ValidPrincipals) == 0 {
 				return false
 			}
 			principal := cert.ValidPrincipals[0]
@@ -116,6 +123,21 @@ type jumpHandler struct {
 	cfg SSHConfig
 }
 
+// newJumpHandler fills in cfg's defaults.
+func newJumpHandler(cfg SSHConfig) *jumpHandler {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if cfg.WakeTimeout == 0 {
+		cfg.WakeTimeout = defaultWakeTimeout
+	}
+	if cfg.DialTarget == nil {
+		var d net.Dialer
+		cfg.DialTarget = d.DialContext
+	}
+	return &jumpHandler{cfg: cfg}
+}
+
 // localForwardChannelData is the payload of a direct-tcpip channel open
 // (RFC 4254 section 7.2).
 type localForwardChannelData struct {
@@ -128,8 +150,9 @@ type localForwardChannelData struct {
 // handleDirectTCPIP is the whole gateway data plane: it resolves the target
 // sandbox from the requested host, authorizes it against the certificate
 // principal, wakes a suspended sandbox and stalls until it is ready, then
-// bridges the channel to the sandbox agent. Session bookkeeping records the
-// connection for audit.
+// bridges the channel to the sandbox agent, or to the exposed port the
+// requested port names. Session bookkeeping records the connection for
+// audit.
 func (h *jumpHandler) handleDirectTCPIP(_ *gliderssh.Server, _ *gossh.ServerConn, newChan gossh.NewChannel, ctx gliderssh.Context) {
 	logger := log.FromContext(ctx)
 
@@ -140,37 +163,54 @@ func (h *jumpHandler) handleDirectTCPIP(_ *gliderssh.Server, _ *gossh.ServerConn
 	}
 
 	principal, _ := ctx.Value(ctxKeyPrincipal).(string)
-	target, err := ParseSSHTarget(payload.DestAddr, h.cfg.DefaultNamespace)
+	if dest, ok := ParseBastionTarget(payload.DestAddr); ok {
+		h.handleBastion(ctx, newChan, dest, payload.DestPort, principal)
+		return
+	}
+	target, err := ParseSSHTarget(payload.DestAddr, h.defaultNamespace(ctx, payload.DestAddr, principal))
 	if err != nil {
 		_ = newChan.Reject(gossh.ConnectionFailed, err.Error())
 		return
 	}
 
-	sb, err := h.authorize(ctx, target, principal)
+	// The sandbox, its wake and its session records live in its cluster.
+	sbCtx := WithCluster(ctx, target.Cluster)
+	sb, err := h.authorize(sbCtx, target, principal)
 	if err != nil {
 		logger.Info("rejected ssh route", "target", payload.DestAddr, "principal", principal, "reason", err.Error())
 		_ = newChan.Reject(gossh.Prohibited, "not authorized for this sandbox")
 		return
 	}
+	port, err := forwardPort(sb, payload.DestPort)
+	if err != nil {
+		logger.Info("rejected ssh route", "target", payload.DestAddr, "principal", principal, "reason", err.Error())
+		_ = newChan.Reject(gossh.Prohibited, err.Error())
+		return
+	}
 
 	// Record the session; close it when the channel ends.
 	serial, _ := ctx.Value(ctxKeyCertSerial).(string)
-	_, closeSession := h.openSession(ctx, sb, principal, ctx.RemoteAddr().String(), serial)
+	sessionName, closeSession := h.openSession(sbCtx, sb, principal, ctx.RemoteAddr().String(), serial, port)
 	defer closeSession(kubeparkv1alpha1.ExitReasonDisconnected)
 
-	sb, err = h.wakeAndWait(ctx, sb)
+	sb, err = h.wakeAndWait(sbCtx, sb)
 	if err != nil {
 		logger.Info("wake failed", "sandbox", sb.Name, "reason", err.Error())
 		_ = newChan.Reject(gossh.ConnectionFailed, "sandbox did not become ready")
 		return
 	}
 
-	upstream, err := h.cfg.Dialer.DialSandbox(ctx, sb)
+	upstream, err := h.cfg.Dialer.DialSandbox(sbCtx, sb, port)
 	if err != nil {
 		_ = newChan.Reject(gossh.ConnectionFailed, "cannot reach sandbox")
 		return
 	}
 	defer func() { _ = upstream.Close() }()
+	if sessionName != "" && port == podspec.AgentPort {
+		if err := h.cfg.Store.SetSessionUpstream(sbCtx, sb.Namespace, sessionName, upstream.LocalAddr().String()); err != nil {
+			logger.V(1).Info("failed to record session upstream", "session", sessionName, "err", err.Error())
+		}
+	}
 
 	ch, reqs, err := newChan.Accept()
 	if err != nil {
@@ -180,6 +220,36 @@ func (h *jumpHandler) handleDirectTCPIP(_ *gliderssh.Server, _ *gossh.ServerConn
 	bridge(ch, upstream)
 }
 
+// forwardPort maps the requested port of a direct-tcpip channel to the
+// sandbox port it reaches: 22 (what ssh -J asks for) and the agent port
+// reach the agent; any other port must be exposed by the sandbox. Port 0
+// is read as the agent too, for clients that leave it unset.
+func forwardPort(sb *kubeparkv1alpha1.Sandbox, dest uint32) (int32, error) {
+	switch dest {
+	case 0, 22, podspec.AgentPort:
+		return podspec.AgentPort, nil
+	}
+	for _, p := range exposedPorts(sb) {
+		if uint32(p.Port) == dest {
+			return p.Port, nil
+		}
+	}
+	return 0, fmt.Errorf("port %d is not exposed by sandbox %s/%s", dest, sb.Namespace, sb.Name)
+}
+
+// defaultNamespace is the namespace assumed for a target without one: the
+// principal's UserProfile default, else the gateway's.
+func (h *jumpHandler) defaultNamespace(ctx context.Context, dest, principal string) string {
+	if strings.Contains(dest, ".") || principal == "" {
+		return h.cfg.DefaultNamespace
+	}
+	profile, err := h.cfg.Store.GetUserProfile(ctx, principal)
+	if err != nil || profile == nil || profile.Spec.DefaultNamespace == "" {
+		return h.cfg.DefaultNamespace
+	}
+	return profile.Spec.DefaultNamespace
+}
+
 // authorize resolves the sandbox and enforces principal == owner, the whole
 // SSH authorization model.
 func (h *jumpHandler) authorize(ctx context.Context, target SSHTarget, principal string) (*kubeparkv1alpha1.Sandbox, error) {
@@ -225,27 +295,39 @@ func (h *jumpHandler) wakeAndWait(ctx context.Context, sb *kubeparkv1alpha1.Sand
 
 // openSession creates the SandboxSession audit record, starts a heartbeat
 // that keeps it Active while the connection lives, and returns a closer.
-func (h *jumpHandler) openSession(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, principal, clientAddr, certSerial string) (string, func(reason string)) {
-	logger := log.FromContext(ctx)
-	name := fmt.Sprintf("%s-%s", sb.Name, randomSuffix(ctx))
-	interval := heartbeatInterval(effectiveIdleTimeout(sb))
-	hb := metav1.Duration{Duration: interval}
+func (h *jumpHandler) openSession(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, principal, clientAddr, certSerial string, port int32) (string, func(reason string)) {
 	session := &kubeparkv1alpha1.SandboxSession{
-		ObjectMeta: metav1.ObjectMeta{Namespace: sb.Namespace, Name: name},
+		ObjectMeta: metav1.ObjectMeta{Namespace: sb.Namespace, Name: fmt.Sprintf("%s-%s", sb.Name, randomSuffix(ctx))},
 		Spec: kubeparkv1alpha1.SandboxSessionSpec{
-			SandboxName:       sb.Name,
-			User:              principal,
-			ClientAddr:        clientAddr,
-			Kind:              kubeparkv1alpha1.SessionKindSSH,
-			CertSerial:        certSerial,
-			HeartbeatInterval: &hb,
+			SandboxName: sb.Name,
+			User:        principal,
+			ClientAddr:  clientAddr,
+			Kind:        kubeparkv1alpha1.SessionKindSSH,
+			CertSerial:  certSerial,
 		},
 	}
+	if port != podspec.AgentPort {
+		session.Spec.Port = port
+	}
+	return h.recordSession(ctx, session, heartbeatInterval(effectiveIdleTimeout(sb)))
+}
+
+// recordSession creates a session, heartbeats it every interval, and
+// returns its name and a closer.
+func (h *jumpHandler) recordSession(ctx context.Context, session *kubeparkv1alpha1.SandboxSession, interval time.Duration) (string, func(reason string)) {
+	logger := log.FromContext(ctx).WithValues("namespace", session.Namespace, "user", session.Spec.User)
+	if session.Spec.SandboxName != "" {
+		logger = logger.WithValues("sandbox", session.Spec.SandboxName)
+	} else {
+		logger = logger.WithValues("accessTarget", session.Spec.AccessTarget, "destination", session.Spec.Destination)
+	}
+	name := session.Name
+	session.Spec.HeartbeatInterval = &metav1.Duration{Duration: interval}
 	if err := h.cfg.Store.CreateSession(ctx, session); err != nil {
 		logger.Error(err, "failed to record session")
 		return "", func(string) {}
 	}
-	logger.Info("session opened", "sandbox", sb.Name, "user", principal, "client", clientAddr)
+	logger.Info("session opened", "client", session.Spec.ClientAddr, "port", session.Spec.Port)
 
 	// Heartbeat until the closer stops it.
 	stop := make(chan struct{})
@@ -257,7 +339,7 @@ func (h *jumpHandler) openSession(ctx context.Context, sb *kubeparkv1alpha1.Sand
 			case <-stop:
 				return
 			case <-ticker.C:
-				if err := h.cfg.Store.Heartbeat(context.WithoutCancel(ctx), sb.Namespace, name); err != nil {
+				if err := h.cfg.Store.Heartbeat(context.WithoutCancel(ctx), session.Namespace, name); err != nil {
 					logger.V(1).Info("heartbeat failed", "session", name, "err", err.Error())
 				}
 			}
@@ -272,10 +354,10 @@ func (h *jumpHandler) openSession(ctx context.Context, sb *kubeparkv1alpha1.Sand
 		closed = true
 		close(stop)
 		// Use a detached context: the connection context is already done.
-		if err := h.cfg.Store.CloseSession(context.WithoutCancel(ctx), sb.Namespace, name, reason); err != nil {
+		if err := h.cfg.Store.CloseSession(context.WithoutCancel(ctx), session.Namespace, name, reason); err != nil {
 			logger.Error(err, "failed to close session")
 		}
-		logger.Info("session closed", "sandbox", sb.Name, "user", principal, "reason", reason)
+		logger.Info("session closed", "reason", reason)
 	}
 }
 
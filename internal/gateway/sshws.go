@@ -0,0 +1,124 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	gliderssh "github.com/gliderlabs/ssh"
+	"github.com/gorilla/websocket"
+)
+
+// SSHWebSocketPath is where the HTTP listener carries SSH over WebSocket,
+// for clients on networks that only let HTTPS out.
+const SSHWebSocketPath = "/v1/ssh"
+
+// NewSSHWebSocketHandler serves the jump host over WebSocket: each
+// connection's binary messages are a raw SSH stream into server, which
+// authenticates it by certificate as it does on its own listener.
+func NewSSHWebSocketHandler(server *gliderssh.Server) http.Handler {
+	upgrader := websocket.Upgrader{
+		// Browsers have no business here, and would bring cookies along.
+		CheckOrigin: func(r *http.Request) bool { return r.Header.Get("Origin") == "" },
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader has answered.
+			return
+		}
+		server.HandleConn(NewWebSocketConn(ws))
+	})
+}
+
+// NewWebSocketConn adapts a WebSocket to a net.Conn carrying a byte stream
+// in binary messages; other messages are skipped. A close frame from the
+// peer reads as io.EOF.
+func NewWebSocketConn(ws *websocket.Conn) net.Conn {
+	return &webSocketConn{ws: ws}
+}
+
+type webSocketConn struct {
+	ws *websocket.Conn
+
+	rmu    sync.Mutex
+	reader io.Reader
+	// A WebSocket takes one writer at a time; control frames excepted.
+	wmu sync.Mutex
+}
+
+func (c *webSocketConn) Read(p []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	for {
+		if c.reader == nil {
+			kind, r, err := c.ws.NextReader()
+			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			if kind != websocket.BinaryMessage {
+				continue
+			}
+			c.reader = r
+		}
+		n, err := c.reader.Read(p)
+		if errors.Is(err, io.EOF) {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *webSocketConn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close says goodbye to the peer before closing the connection.
+func (c *webSocketConn) Close() error {
+	_ = c.ws.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return c.ws.Close()
+}
+
+func (c *webSocketConn) LocalAddr() net.Addr                { return c.ws.LocalAddr() }
+func (c *webSocketConn) RemoteAddr() net.Addr               { return c.ws.RemoteAddr() }
+func (c *webSocketConn) SetReadDeadline(t time.Time) error  { return c.ws.SetReadDeadline(t) }
+func (c *webSocketConn) SetWriteDeadline(t time.Time) error { return c.ws.SetWriteDeadline(t) }
+
+func (c *webSocketConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
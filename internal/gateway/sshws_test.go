@@ -0,0 +1,121 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	gossh "golang.org/x/crypto/ssh"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/gateway"
+	"github.com/frauniki/kubepark/internal/sshca"
+)
+
+// TestSSHOverWebSocket jumps to a sandbox through the jump host carried
+// over WebSocket, authenticating by certificate inside it as over TCP.
+func TestSSHOverWebSocket(t *testing.T) {
+	userCA := newCA(t, "user-ca")
+	hostCA := newCA(t, "host-ca")
+	agentAddr := startAgent(t, "alice@example.com", userCA, hostCA)
+	store := &fakeStore{sandboxes: map[string]*kubeparkv1alpha1.Sandbox{
+		testSandboxKey: sandbox("alice", "demo", "alice@example.com"),
+	}}
+	gwHost, err := sshca.GenerateKeyPair("gw-host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := gateway.NewSSHServer(gateway.SSHConfig{
+		HostKeyPEM:       gwHost.PrivatePEM,
+		UserCAAuthorized: userCA.pub,
+		Store:            store,
+		Dialer:           fakeDialer{addr: agentAddr},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(gateway.NewSSHWebSocketHandler(server))
+	t.Cleanup(srv.Close)
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + gateway.SSHWebSocketPath
+
+	// A browser's handshake is refused.
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {srv.URL}}); err == nil ||
+		resp.StatusCode != http.StatusForbidden {
+		t.Errorf("handshake with an Origin = %v, want 403", err)
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := userCert(t, userCA, "alice@example.com")
+	conn, chans, reqs, err := gossh.NewClientConn(gateway.NewWebSocketConn(ws), "kubepark-gateway", &gossh.ClientConfig{
+		User:            "jump",
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(cert)},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("jump handshake over WebSocket: %v", err)
+	}
+	jump := gossh.NewClient(conn, chans, reqs)
+	defer func() { _ = jump.Close() }()
+
+	tunnel, err := jump.Dial("tcp", testTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentConn, chans, reqs, err := gossh.NewClientConn(tunnel, testTarget, &gossh.ClientConfig{
+		User:            "sandbox",
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(cert)},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("agent handshake: %v", err)
+	}
+	agentClient := gossh.NewClient(agentConn, chans, reqs)
+	defer func() { _ = agentClient.Close() }()
+	sess, err := agentClient.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sess.Close() }()
+	if out, err := sess.Output("echo kubepark-ok"); err != nil || string(out) != "kubepark-ok\n" {
+		t.Fatalf("exec = %q, %v", out, err)
+	}
+
+	// Without a certificate, the jump host refuses as it does over TCP.
+	ws, _, err = websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, err = gossh.NewClientConn(gateway.NewWebSocketConn(ws), "kubepark-gateway", &gossh.ClientConfig{
+		User:            "jump",
+		Auth:            []gossh.AuthMethod{gossh.Password("x")},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err == nil {
+		t.Fatal("jump host accepted a connection without a certificate")
+	}
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// authStartPath, on the auth host, issues a ticket for the host a
+	// browser came from, logging in first when there is no master session.
+	authStartPath = "/kubepark/auth/start"
+	// authTicketPath, on any host, redeems a ticket for a host session.
+	authTicketPath = "/kubepark/auth/ticket"
+	// logoutPath, on any host, ends the session everywhere.
+	logoutPath = "/kubepark/logout"
+
+	// ticketTTL bounds a ticket's trip from the auth host back to the host
+	// it was issued for.
+	ticketTTL = time.Minute
+	// hostCookiePrefix makes browsers keep a Secure cookie to the host
+	// that set it.
+	hostCookiePrefix = "__Host-"
+)
+
+// ticketClaims are a ticket: the host session it mints, bound to the
+// browser's handoff nonce and redeemable once.
+type ticketClaims struct {
+	Session sessionClaims `json:"s"`
+	Nonce   string        `json:"n"`
+	ID      string        `json:"i"`
+	Expiry  int64         `json:"e"`
+}
+
+// IsAuthEndpoint reports whether a request targets one of the gateway's
+// own login and logout endpoints, which are served before routing.
+func (a *CookieAuthenticator) IsAuthEndpoint(r *http.Request) bool {
+	switch r.URL.Path {
+	case oidcCallbackPath, authStartPath, authTicketPath, logoutPath:
+		return true
+	}
+	return false
+}
+
+// ServeHTTP serves the login and logout endpoints.
+func (a *CookieAuthenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case authTicketPath:
+		a.redeem(w, r)
+		return
+	case logoutPath:
+		a.logout(w, r)
+		return
+	}
+	// The master session exists only on the auth host.
+	if !strings.EqualFold(r.Host, a.cfg.AuthHost) {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.URL.Path {
+	case oidcCallbackPath:
+		a.Callback(w, r)
+	case authStartPath:
+		a.start(w, r)
+	}
+}
+
+// start issues a ticket from the master session for the host in rd and
+// sends the browser back there to redeem it.
+func (a *CookieAuthenticator) start(w http.ResponseWriter, r *http.Request) {
+	back, err := url.Parse(r.URL.Query().Get("rd"))
+	nonce := r.URL.Query().Get("n")
+	if err != nil || back.Scheme != a.scheme() || !a.servesHost(back.Host) || nonce == "" {
+		http.Error(w, "invalid login request", http.StatusBadRequest)
+		return
+	}
+	master, ok, err := a.session(r, ssoCookie, purposeSSO)
+	if err != nil {
+		http.Error(w, "session store unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if !ok {
+		a.beginOIDC(w, r, r.URL.RequestURI())
+		return
+	}
+
+	master.Host = back.Host
+	ticket := a.sign(purposeTicket, ticketClaims{
+		Session: master,
+		Nonce:   nonce,
+		ID:      randomString(),
+		Expiry:  a.Now().Add(ticketTTL).Unix(),
+	})
+	q := url.Values{"t": {ticket}, "rd": {back.RequestURI()}}
+	to := url.URL{Scheme: a.scheme(), Host: back.Host, Path: authTicketPath, RawQuery: q.Encode()}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, to.String(), http.StatusFound)
+}
+
+// redeem exchanges a ticket for a session on this host.
+func (a *CookieAuthenticator) redeem(w http.ResponseWriter, r *http.Request) {
+	var t ticketClaims
+	nonce, err := r.Cookie(a.cookieName(handoffCookie))
+	if err != nil ||
+		!a.verify(purposeTicket, r.URL.Query().Get("t"), &t) ||
+		a.Now().Unix() > t.Expiry ||
+		!strings.EqualFold(t.Session.Host, r.Host) ||
+		subtle.ConstantTimeCompare([]byte(t.Nonce), []byte(nonce.Value)) != 1 ||
+		!a.redeemOnce(t.ID, t.Expiry) {
+		http.Error(w, "invalid or expired login ticket", http.StatusBadRequest)
+		return
+	}
+	a.setSession(w, sessionCookie, purposeSession, t.Session)
+	http.Redirect(w, r, localPath(r.URL.Query().Get("rd")), http.StatusFound)
+}
+
+// redeemOnce records a ticket as used, reporting false when it already
+// was. Tickets are only remembered by this replica; across replicas the
+// handoff nonce, which only the requesting browser holds, stops a replay.
+func (a *CookieAuthenticator) redeemOnce(id string, expiry int64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.Now().Unix()
+	for k, exp := range a.redeemed {
+		if now > exp {
+			delete(a.redeemed, k)
+		}
+	}
+	if _, used := a.redeemed[id]; used {
+		return false
+	}
+	a.redeemed[id] = expiry
+	return true
+}
+
+// logout revokes the session of this host and clears its cookies, then
+// continues on the auth host to clear the master session.
+func (a *CookieAuthenticator) logout(w http.ResponseWriter, r *http.Request) {
+	onAuthHost := strings.EqualFold(r.Host, a.cfg.AuthHost)
+	cookies := map[string]string{sessionCookie: purposeSession}
+	if onAuthHost {
+		cookies[ssoCookie] = purposeSSO
+	}
+	for name, purpose := range cookies {
+		claims, ok := a.cookieClaims(r, name, purpose)
+		if !ok || a.cfg.Revocations == nil {
+			continue
+		}
+		if err := a.cfg.Revocations.Revoke(r.Context(), claims.SID, time.Unix(claims.Expiry, 0)); err != nil {
+			log.FromContext(r.Context()).Error(err, "failed to revoke session")
+			http.Error(w, "sign-out failed, please retry", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	for name := range cookies {
+		a.setCookie(w, name, "", -1)
+	}
+	a.setCookie(w, handoffCookie, "", -1)
+
+	w.Header().Set("Cache-Control", "no-store")
+	if !onAuthHost {
+		http.Redirect(w, r, a.authURL(logoutPath), http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = fmt.Fprintln(w, "You are signed out of kubepark.")
+}
+
+// servesHost reports whether host is one the gateway serves, and so may
+// be sent a ticket.
+func (a *CookieAuthenticator) servesHost(host string) bool {
+	if strings.EqualFold(host, a.cfg.AuthHost) {
+		return true
+	}
+	if a.cfg.BaseDomain == "" {
+		return false
+	}
+	name, _, _ := strings.Cut(host, ":")
+	if strings.EqualFold(name, a.cfg.BaseDomain) {
+		return true
+	}
+	_, err := ParseHTTPHost(host, a.cfg.BaseDomain)
+	return err == nil
+}
+
+// Revocations records sessions ended by a logout, until they would have
+// expired anyway.
+type Revocations interface {
+	Revoked(ctx context.Context, sid string) (bool, error)
+	Revoke(ctx context.Context, sid string, until time.Time) error
+}
+
+// SecretRevocations keeps revoked session IDs in one Secret, mapping each
+// to its expiry, so every gateway replica honors a logout.
+type SecretRevocations struct {
+	// Reader is consulted on every authenticated request, so it should be
+	// a cached client.
+	Reader client.Reader
+	// Client writes the Secret, reading it uncached to update it.
+	Client    client.Client
+	Namespace string
+	Name      string
+}
+
+var _ Revocations = &SecretRevocations{}
+
+func (s *SecretRevocations) Revoked(ctx context.Context, sid string) (bool, error) {
+	var secret corev1.Secret
+	err := s.Reader.Get(ctx, types.NamespacedName{Namespace: s.Namespace, Name: s.Name}, &secret)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, revoked := secret.Data[sid]
+	return revoked, nil
+}
+
+// Revoke adds sid, dropping entries that have expired on the way.
+func (s *SecretRevocations) Revoke(ctx context.Context, sid string, until time.Time) error {
+	key := types.NamespacedName{Namespace: s.Namespace, Name: s.Name}
+	conflict := func(err error) bool { return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) }
+	return retry.OnError(retry.DefaultRetry, conflict, func() error {
+		var secret corev1.Secret
+		err := s.Client.Get(ctx, key, &secret)
+		if apierrors.IsNotFound(err) {
+			secret = corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: s.Namespace, Name: s.Name},
+				Data:       map[string][]byte{sid: []byte(strconv.FormatInt(until.Unix(), 10))},
+			}
+			return s.Client.Create(ctx, &secret)
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		for k, v := range secret.Data {
+			if exp, err := strconv.ParseInt(string(v), 10, 64); err != nil || exp < now {
+				delete(secret.Data, k)
+			}
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[sid] = []byte(strconv.FormatInt(until.Unix(), 10))
+		return s.Client.Update(ctx, &secret)
+	})
+}
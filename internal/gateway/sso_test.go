@@ -0,0 +1,235 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memRevocations is an in-memory Revocations.
+type memRevocations map[string]time.Time
+
+func (m memRevocations) Revoked(_ context.Context, sid string) (bool, error) {
+	_, ok := m[sid]
+	return ok, nil
+}
+
+func (m memRevocations) Revoke(_ context.Context, sid string, until time.Time) error {
+	m[sid] = until
+	return nil
+}
+
+const (
+	authHost    = "sb.example.com"
+	jupyterHost = "jupyter--demo--alice.sb.example.com"
+)
+
+func testCookieAuth() (*CookieAuthenticator, memRevocations) {
+	revocations := memRevocations{}
+	return newCookieAuthenticator(CookieAuthConfig{
+		AuthHost:    authHost,
+		BaseDomain:  "sb.example.com",
+		HMACKey:     []byte("test-hmac-key"),
+		TTL:         time.Hour,
+		Revocations: revocations,
+	}), revocations
+}
+
+// serve sends a GET for rawURL with cookies to handler.
+func serve(handler http.HandlerFunc, rawURL string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, rawURL, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// responseCookie returns the cookie name set by rec.
+func responseCookie(t *testing.T, rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	t.Helper()
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no %s cookie in %q", name, rec.Header().Values("Set-Cookie"))
+	return nil
+}
+
+func TestSSOTicketHandoff(t *testing.T) {
+	a, _ := testCookieAuth()
+	master := &http.Cookie{Name: ssoCookie, Value: a.sign(purposeSSO, sessionClaims{
+		Principal: "alice@example.com", SID: "sid-1", Expiry: time.Now().Add(time.Hour).Unix(),
+	})}
+
+	// A sandbox host without a session sends the browser to the auth host.
+	rec := serve(a.StartLogin, "http://"+jupyterHost+"/lab?x=1")
+	handoff := responseCookie(t, rec, handoffCookie)
+	start := rec.Header().Get("Location")
+	if !strings.HasPrefix(start, "http://"+authHost+authStartPath+"?") {
+		t.Fatalf("login redirect = %q, want the auth host", start)
+	}
+
+	// Without a master session, the auth host logs in first.
+	rec = serve(a.ServeHTTP, start)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("start without a master session: %d", rec.Code)
+	}
+	if state := responseCookie(t, rec, stateCookie); !strings.HasSuffix(state.Value, "|"+strings.TrimPrefix(start, "http://"+authHost)) {
+		t.Errorf("state cookie %q does not resume the handoff", state.Value)
+	}
+
+	// With one, it issues a ticket for the sandbox host.
+	rec = serve(a.ServeHTTP, start, master)
+	redeem, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || redeem.Host != jupyterHost || redeem.Path != authTicketPath {
+		t.Fatalf("ticket redirect = %q, want %s on the sandbox host", rec.Header().Get("Location"), authTicketPath)
+	}
+
+	// Redeeming it needs the browser's handoff cookie.
+	if rec := serve(a.ServeHTTP, redeem.String()); rec.Code != http.StatusBadRequest {
+		t.Errorf("ticket without the handoff cookie: %d, want 400", rec.Code)
+	}
+	rec = serve(a.ServeHTTP, redeem.String(), handoff)
+	if loc := rec.Header().Get("Location"); rec.Code != http.StatusFound || loc != "/lab?x=1" {
+		t.Fatalf("redeem: %d %q, want a redirect to /lab?x=1", rec.Code, loc)
+	}
+	session := responseCookie(t, rec, sessionCookie)
+
+	// The session works on its host only.
+	req := httptest.NewRequest(http.MethodGet, "http://"+jupyterHost+"/lab", nil)
+	req.AddCookie(session)
+	if id, ok := a.Identify(req); !ok || id.Principal != "alice@example.com" {
+		t.Fatalf("Identify = %+v, %v", id, ok)
+	}
+	req = httptest.NewRequest(http.MethodGet, "http://web--demo--alice.sb.example.com/", nil)
+	req.AddCookie(session)
+	if _, ok := a.Identify(req); ok {
+		t.Error("a host session must not work on another host")
+	}
+
+	// A ticket is redeemed once.
+	if rec := serve(a.ServeHTTP, redeem.String(), handoff); rec.Code != http.StatusBadRequest {
+		t.Errorf("replayed ticket: %d, want 400", rec.Code)
+	}
+}
+
+func TestSSORejectsForeignHosts(t *testing.T) {
+	a, _ := testCookieAuth()
+	for _, rd := range []string{"http://evil.example.org/", "https://" + jupyterHost + "/", "/relative"} {
+		q := url.Values{"rd": {rd}, "n": {"nonce"}}
+		if rec := serve(a.ServeHTTP, "http://"+authHost+authStartPath+"?"+q.Encode()); rec.Code != http.StatusBadRequest {
+			t.Errorf("start for %q: %d, want 400", rd, rec.Code)
+		}
+	}
+	// The master session lives on the auth host only.
+	if rec := serve(a.ServeHTTP, "http://"+jupyterHost+authStartPath); rec.Code != http.StatusNotFound {
+		t.Errorf("start on a sandbox host: %d, want 404", rec.Code)
+	}
+	for p, want := range map[string]string{
+		"/lab?x=1":                  "/lab?x=1",
+		"//evil.example.org/":       "/",
+		"/\\evil.example.org":       "/",
+		"https://evil.example.org/": "/",
+	} {
+		if got := localPath(p); got != want {
+			t.Errorf("localPath(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestSSOLogoutRevokesEverywhere(t *testing.T) {
+	a, revocations := testCookieAuth()
+	claims := sessionClaims{Principal: "alice@example.com", SID: "sid-1", Expiry: time.Now().Add(time.Hour).Unix()}
+	master := &http.Cookie{Name: ssoCookie, Value: a.sign(purposeSSO, claims)}
+	claims.Host = jupyterHost
+	session := &http.Cookie{Name: sessionCookie, Value: a.sign(purposeSession, claims)}
+	otherHost := claims
+	otherHost.Host = "web--demo--alice.sb.example.com"
+	other := &http.Cookie{Name: sessionCookie, Value: a.sign(purposeSession, otherHost)}
+
+	rec := serve(a.ServeHTTP, "http://"+jupyterHost+logoutPath, session)
+	if loc := rec.Header().Get("Location"); loc != "http://"+authHost+logoutPath {
+		t.Fatalf("logout on a sandbox host redirects to %q, want the auth host", loc)
+	}
+	if c := responseCookie(t, rec, sessionCookie); c.MaxAge >= 0 {
+		t.Error("logout must clear the host session")
+	}
+	if _, ok := revocations["sid-1"]; !ok {
+		t.Fatal("logout must revoke the session")
+	}
+
+	// Every host session of the login stops working, as does the master.
+	req := httptest.NewRequest(http.MethodGet, "http://"+otherHost.Host+"/", nil)
+	req.AddCookie(other)
+	if _, ok := a.Identify(req); ok {
+		t.Error("a revoked session must not work on any host")
+	}
+	q := url.Values{"rd": {"http://" + jupyterHost + "/"}, "n": {"nonce"}}
+	rec = serve(a.ServeHTTP, "http://"+authHost+authStartPath+"?"+q.Encode(), master)
+	if strings.Contains(rec.Header().Get("Location"), authTicketPath) {
+		t.Error("a revoked master session must not issue tickets")
+	}
+
+	rec = serve(a.ServeHTTP, "http://"+authHost+logoutPath, master)
+	if c := responseCookie(t, rec, ssoCookie); rec.Code != http.StatusOK || c.MaxAge >= 0 {
+		t.Errorf("logout on the auth host: %d, and must clear the master session", rec.Code)
+	}
+}
+
+func TestSecureCookiesAreHostLocked(t *testing.T) {
+	a := newCookieAuthenticator(CookieAuthConfig{AuthHost: authHost, BaseDomain: "sb.example.com", Secure: true})
+	rec := serve(a.StartLogin, "https://"+jupyterHost+"/")
+	c := responseCookie(t, rec, hostCookiePrefix+handoffCookie)
+	if !c.Secure || c.Domain != "" || c.Path != "/" {
+		t.Errorf("handoff cookie %+v is not host-locked", c)
+	}
+	if loc := rec.Header().Get("Location"); !strings.HasPrefix(loc, "https://"+authHost+"/") {
+		t.Errorf("login redirect = %q, want https", loc)
+	}
+}
+
+func TestSecretRevocations(t *testing.T) {
+	ctx := context.Background()
+	c := fakeClient()
+	r := &SecretRevocations{Reader: c, Client: c, Namespace: gatewayNS, Name: "kubepark-gateway-sessions"}
+
+	if revoked, err := r.Revoked(ctx, "sid-1"); err != nil || revoked {
+		t.Fatalf("before any logout: %v, %v", revoked, err)
+	}
+	if err := r.Revoke(ctx, "stale", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Revoke(ctx, "sid-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := r.Revoked(ctx, "sid-1"); err != nil || !revoked {
+		t.Errorf("after logout: %v, %v", revoked, err)
+	}
+	// Entries past their session's expiry are dropped on the next write.
+	if revoked, _ := r.Revoked(ctx, "stale"); revoked {
+		t.Error("an expired revocation must be pruned")
+	}
+}
@@ -21,8 +21,16 @@ package gateway
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 
+	gliderssh "github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -30,7 +38,8 @@ import (
 	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
 )
 
-// Store is the gateway's read/write view of sandboxes and their sessions.
+// Store is the gateway's read/write view of sandboxes, their sessions,
+// their owners' profiles and the AccessTargets it forwards to.
 // It is deliberately small so the gateway stays stateless (reconstructable
 // entirely from the API server).
 type Store interface {
@@ -43,15 +52,34 @@ type Store interface {
 	// its name.
 	CreateSession(ctx context.Context, session *kubeparkv1alpha1.SandboxSession) error
 	// Heartbeat refreshes a session's last-activity time so the stale
-	// reaper does not close it while the connection lives.
+	// reaper does not close it while the connection lives. It returns
+	// ErrSessionClosed once the session is no longer Active.
 	Heartbeat(ctx context.Context, namespace, name string) error
+	// SetSessionUpstream records the gateway-side address of the session's
+	// connection to the agent, which the agent logs as the peer.
+	SetSessionUpstream(ctx context.Context, namespace, name, addr string) error
 	// CloseSession marks a session Closed with the given reason.
 	CloseSession(ctx context.Context, namespace, name, reason string) error
+	// GetUserProfile returns the UserProfile of principal, or nil when
+	// there is none.
+	GetUserProfile(ctx context.Context, principal string) (*kubeparkv1alpha1.UserProfile, error)
+	// PrincipalForKey returns the principal whose UserProfile lists key in
+	// authorizedKeys, or "" when none (or more than one) does.
+	PrincipalForKey(ctx context.Context, key gossh.PublicKey) (string, error)
+	// EnsureUserProfile creates an empty UserProfile for principal unless
+	// one exists.
+	EnsureUserProfile(ctx context.Context, principal string) error
+	// GetAccessTarget returns the AccessTarget by name.
+	GetAccessTarget(ctx context.Context, name string) (*kubeparkv1alpha1.AccessTarget, error)
 }
 
 // clientStore implements Store against a controller-runtime client.
+// Sandboxes and their sessions are read and written in the cluster the
+// context names (see WithCluster); profiles and AccessTargets always live
+// in the gateway's own.
 type clientStore struct {
-	c client.Client
+	c        client.Client
+	clusters *Clusters
 }
 
 // NewStore builds a Store backed by the given client (typically a cached
@@ -60,9 +88,24 @@ func NewStore(c client.Client) Store {
 	return &clientStore{c: c}
 }
 
+// NewClusterStore builds a Store that also reaches the sandboxes of the
+// member clusters in clusters.
+func NewClusterStore(c client.Client, clusters *Clusters) Store {
+	return &clientStore{c: c, clusters: clusters}
+}
+
+// sandboxClient is the client of the cluster ctx names.
+func (s *clientStore) sandboxClient(ctx context.Context) (client.Client, error) {
+	return clusterClient(ctx, s.c, s.clusters)
+}
+
 func (s *clientStore) GetSandbox(ctx context.Context, namespace, name string) (*kubeparkv1alpha1.Sandbox, error) {
+	c, err := s.sandboxClient(ctx)
+	if err != nil {
+		return nil, err
+	}
 	var sb kubeparkv1alpha1.Sandbox
-	if err := s.c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &sb); err != nil {
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &sb); err != nil {
 		return nil, err
 	}
 	return &sb, nil
@@ -72,38 +115,67 @@ func (s *clientStore) SetDesiredRunning(ctx context.Context, sb *kubeparkv1alpha
 	if sb.Spec.DesiredState == kubeparkv1alpha1.DesiredStateRunning {
 		return nil
 	}
+	c, err := s.sandboxClient(ctx)
+	if err != nil {
+		return err
+	}
 	patch := client.MergeFrom(sb.DeepCopy())
 	sb.Spec.DesiredState = kubeparkv1alpha1.DesiredStateRunning
-	return s.c.Patch(ctx, sb, patch)
+	return c.Patch(ctx, sb, patch)
 }
 
 func (s *clientStore) CreateSession(ctx context.Context, session *kubeparkv1alpha1.SandboxSession) error {
-	if err := s.c.Create(ctx, session); err != nil {
+	c, err := s.sandboxClient(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.Create(ctx, session); err != nil {
 		return err
 	}
 	now := metav1.Now()
 	session.Status.State = kubeparkv1alpha1.SessionStateActive
 	session.Status.StartTime = &now
 	session.Status.LastActivityTime = &now
-	return s.c.Status().Update(ctx, session)
+	return c.Status().Update(ctx, session)
 }
 
 func (s *clientStore) Heartbeat(ctx context.Context, namespace, name string) error {
+	c, err := s.sandboxClient(ctx)
+	if err != nil {
+		return err
+	}
 	var session kubeparkv1alpha1.SandboxSession
-	if err := s.c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &session); err != nil {
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &session); err != nil {
 		return err
 	}
 	if session.Status.State != kubeparkv1alpha1.SessionStateActive {
-		return nil
+		return ErrSessionClosed
 	}
 	now := metav1.Now()
 	session.Status.LastActivityTime = &now
-	return s.c.Status().Update(ctx, &session)
+	return c.Status().Update(ctx, &session)
+}
+
+func (s *clientStore) SetSessionUpstream(ctx context.Context, namespace, name, addr string) error {
+	c, err := s.sandboxClient(ctx)
+	if err != nil {
+		return err
+	}
+	var session kubeparkv1alpha1.SandboxSession
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &session); err != nil {
+		return err
+	}
+	session.Status.UpstreamAddr = addr
+	return c.Status().Update(ctx, &session)
 }
 
 func (s *clientStore) CloseSession(ctx context.Context, namespace, name, reason string) error {
+	c, err := s.sandboxClient(ctx)
+	if err != nil {
+		return err
+	}
 	var session kubeparkv1alpha1.SandboxSession
-	if err := s.c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &session); err != nil {
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &session); err != nil {
 		return err
 	}
 	if session.Status.State == kubeparkv1alpha1.SessionStateClosed {
@@ -113,11 +185,98 @@ func (s *clientStore) CloseSession(ctx context.Context, namespace, name, reason
 	session.Status.State = kubeparkv1alpha1.SessionStateClosed
 	session.Status.EndTime = &now
 	session.Status.ExitReason = reason
-	return s.c.Status().Update(ctx, &session)
+	return c.Status().Update(ctx, &session)
+}
+
+func (s *clientStore) GetUserProfile(ctx context.Context, principal string) (*kubeparkv1alpha1.UserProfile, error) {
+	var profiles kubeparkv1alpha1.UserProfileList
+	if err := s.c.List(ctx, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles.ForPrincipal(principal), nil
 }
 
+func (s *clientStore) PrincipalForKey(ctx context.Context, key gossh.PublicKey) (string, error) {
+	var profiles kubeparkv1alpha1.UserProfileList
+	if err := s.c.List(ctx, &profiles); err != nil {
+		return "", err
+	}
+	found := ""
+	for i := range profiles.Items {
+		p := &profiles.Items[i]
+		// Only the profile in effect for its principal counts.
+		if profiles.ForPrincipal(p.Spec.Principal) != p || !authorizesKey(p, key) {
+			continue
+		}
+		if found != "" && found != p.Spec.Principal {
+			return "", nil
+		}
+		found = p.Spec.Principal
+	}
+	return found, nil
+}
+
+func (s *clientStore) EnsureUserProfile(ctx context.Context, principal string) error {
+	existing, err := s.GetUserProfile(ctx, principal)
+	if err != nil || existing != nil {
+		return err
+	}
+	profile := &kubeparkv1alpha1.UserProfile{
+		ObjectMeta: metav1.ObjectMeta{Name: UserProfileName(principal)},
+		Spec:       kubeparkv1alpha1.UserProfileSpec{Principal: principal},
+	}
+	if err := s.c.Create(ctx, profile); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *clientStore) GetAccessTarget(ctx context.Context, name string) (*kubeparkv1alpha1.AccessTarget, error) {
+	var target kubeparkv1alpha1.AccessTarget
+	if err := s.c.Get(ctx, types.NamespacedName{Name: name}, &target); err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// authorizesKey reports whether the profile lists key.
+func authorizesKey(p *kubeparkv1alpha1.UserProfile, key gossh.PublicKey) bool {
+	for _, line := range p.Spec.AuthorizedKeys {
+		k, _, _, _, err := gossh.ParseAuthorizedKey([]byte(line))
+		if err == nil && gliderssh.KeysEqual(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+var nonNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// UserProfileName derives the name of the profile created for principal on
+// first login: readable, and unique through a hash of the principal.
+func UserProfileName(principal string) string {
+	sum := sha256.Sum256([]byte(principal))
+	base := strings.Trim(nonNameChars.ReplaceAllString(strings.ToLower(principal), "-"), "-")
+	if len(base) > 40 {
+		base = strings.TrimRight(base[:40], "-")
+	}
+	if base == "" {
+		base = "user"
+	}
+	return base + "-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// ErrSessionClosed is returned by Heartbeat for a session that was closed,
+// for instance by idle suspension or the stale reaper.
+var ErrSessionClosed = errors.New("session is closed")
+
 // ErrNoRoute is returned when a connection names a sandbox that cannot be
 // routed (missing, wrong owner, unreachable).
-type ErrNoRoute struct{ Reason string }
+type ErrNoRoute struct {
+	Reason string
+	// Cluster is set when the dialer cannot reach the member cluster at
+	// all, rather than this sandbox; another dialer may.
+	Cluster string
+}
 
 func (e ErrNoRoute) Error() string { return fmt.Sprintf("no route: %s", e.Reason) }
@@ -0,0 +1,446 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	gossh "golang.org/x/crypto/ssh"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/controller/podspec"
+	"github.com/frauniki/kubepark/internal/sshca"
+	"github.com/frauniki/kubepark/internal/tunnel"
+)
+
+const (
+	// terminalPath, on the auth host, prefixes a sandbox's web terminal:
+	// terminalPath + "<namespace>[.<cluster>]/<sandbox>".
+	terminalPath = "/kubepark/terminal/"
+	// terminalCertTTL bounds the certificate minted for each terminal. It
+	// is only checked when the terminal connects to the agent.
+	terminalCertTTL = 5 * time.Minute
+	// terminalReadLimit bounds one message from the browser: a paste or a
+	// resize.
+	terminalReadLimit = 64 << 10
+
+	// DefaultTerminalAssets serves the terminal page's xterm.js.
+	DefaultTerminalAssets = "https://cdn.jsdelivr.net/npm"
+)
+
+// WebTerminalConfig configures the browser web terminal.
+type WebTerminalConfig struct {
+	// AuthHost is the only host the terminal is served on: sandbox hosts
+	// are their owners' origins, where a page could script it.
+	AuthHost string
+	// Auth identifies the browser by its session cookie.
+	Auth Authenticator
+	// UserCAPEM is the user CA private key, which signs the certificate
+	// each terminal connects to the agent with.
+	UserCAPEM []byte
+	// HostCAAuthorized is the host CA public key agents' host certificates
+	// must be signed by.
+	HostCAAuthorized []byte
+	// AssetsURL is where xterm.js is loaded from, as an npm CDN lays it
+	// out (default DefaultTerminalAssets).
+	AssetsURL string
+	// AssetsIntegrity pins each file of TerminalAssets, by base name, to
+	// its Subresource Integrity hash ("sha384-..."): a CDN serving other
+	// bytes cannot script the page.
+	AssetsIntegrity map[string]string
+	// WakeTimeout bounds the wake-on-connect stall (default 180s).
+	WakeTimeout time.Duration
+	// Now is injected for tests.
+	Now func() time.Time
+
+	Store  Store
+	Dialer Dialer
+}
+
+// WebTerminal serves a browser terminal on a sandbox: an xterm.js page
+// whose WebSocket the gateway bridges to an SSH session on the agent. It
+// authorizes, wakes and records the connection exactly as the SSH jump
+// host does, and connects as the caller with a certificate it mints for
+// that one connection.
+type WebTerminal struct {
+	cfg      WebTerminalConfig
+	jump     *jumpHandler
+	signer   *Signer
+	hostCA   gossh.PublicKey
+	upgrader websocket.Upgrader
+}
+
+// NewWebTerminal builds the terminal handler.
+func NewWebTerminal(cfg WebTerminalConfig) (*WebTerminal, error) {
+	if cfg.Auth == nil || cfg.Store == nil || cfg.Dialer == nil {
+		return nil, fmt.Errorf("web terminal requires an authenticator, a store and a dialer")
+	}
+	if cfg.AuthHost == "" {
+		return nil, fmt.Errorf("web terminal requires an auth host")
+	}
+	if cfg.AssetsURL == "" {
+		cfg.AssetsURL = DefaultTerminalAssets
+	}
+	cfg.AssetsURL = strings.TrimSuffix(cfg.AssetsURL, "/")
+	for _, asset := range TerminalAssets {
+		if !strings.HasPrefix(cfg.AssetsIntegrity[path.Base(asset)], "sha") {
+			return nil, fmt.Errorf("web terminal requires the integrity hash of %s", path.Base(asset))
+		}
+	}
+	signer, err := NewSigner(cfg.UserCAPEM, terminalCertTTL)
+	if err != nil {
+		return nil, err
+	}
+	hostCA, err := sshca.ParsePublicKey(cfg.HostCAAuthorized)
+	if err != nil {
+		return nil, fmt.Errorf("parse host CA: %w", err)
+	}
+	jump := newJumpHandler(SSHConfig{Store: cfg.Store, Dialer: cfg.Dialer, WakeTimeout: cfg.WakeTimeout, Now: cfg.Now})
+	cfg.Now = jump.cfg.Now
+	t := &WebTerminal{cfg: cfg, jump: jump, signer: signer, hostCA: hostCA}
+	t.upgrader = websocket.Upgrader{CheckOrigin: t.sameOrigin}
+	return t, nil
+}
+
+// Handles reports whether a request is for the web terminal, which is
+// served before routing. Sandbox hosts keep the whole path space.
+func (t *WebTerminal) Handles(r *http.Request) bool {
+	return strings.EqualFold(r.Host, t.cfg.AuthHost) && strings.HasPrefix(r.URL.Path, terminalPath)
+}
+
+// sameOrigin admits only WebSockets opened by the terminal page itself:
+// the session cookie rides along with any cross-site handshake.
+func (t *WebTerminal) sameOrigin(r *http.Request) bool {
+	origin, err := url.Parse(r.Header.Get("Origin"))
+	return err == nil && strings.EqualFold(origin.Host, t.cfg.AuthHost)
+}
+
+// ServeHTTP serves the terminal page, and its WebSocket on the same URL.
+func (t *WebTerminal) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := log.FromContext(r.Context())
+	rest, _ := strings.CutPrefix(r.URL.Path, terminalPath)
+	scope, err := ParseTokenScope(rest)
+	if !t.Handles(r) || err != nil || scope.Port != "" {
+		http.NotFound(w, r)
+		return
+	}
+	id, ok := t.cfg.Auth.Identify(r)
+	if !ok {
+		t.cfg.Auth.StartLogin(w, r)
+		return
+	}
+	// A browser session only: a token's scopes name ports, and must not
+	// widen into a shell.
+	if id.FromAuthorization {
+		http.Error(w, "the web terminal needs a browser session", http.StatusForbidden)
+		return
+	}
+
+	target := SSHTarget{Sandbox: scope.Sandbox, Namespace: scope.Namespace, Cluster: scope.Cluster}
+	ctx := WithCluster(r.Context(), target.Cluster)
+	sb, err := t.jump.authorize(ctx, target, id.Principal)
+	if err != nil {
+		logger.Info("rejected web terminal", "target", rest, "principal", id.Principal, "reason", err.Error())
+		http.Error(w, "not authorized for this sandbox", http.StatusForbidden)
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		t.page(w, target)
+		return
+	}
+	conn, err := t.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has answered.
+		return
+	}
+	socket := &terminalSocket{conn: conn}
+	defer func() { _ = conn.Close() }()
+	conn.SetReadLimit(terminalReadLimit)
+	cols, rows := queryInt(r, "cols", 80), queryInt(r, "rows", 24)
+	if err := t.serve(ctx, socket, sb, id.Principal, r.RemoteAddr, cols, rows); err != nil {
+		logger.Info("web terminal failed", "sandbox", sb.Name, "principal", id.Principal, "reason", err.Error())
+		socket.close(websocket.CloseInternalServerErr, err.Error())
+		return
+	}
+	socket.close(websocket.CloseNormalClosure, "session ended")
+}
+
+// serve connects the socket to a shell on the sandbox, recording the
+// session and waking the sandbox as the jump host does.
+func (t *WebTerminal) serve(
+	ctx context.Context, socket *terminalSocket, sb *kubeparkv1alpha1.Sandbox, principal, clientAddr string, cols, rows int,
+) error {
+	logger := log.FromContext(ctx)
+	certSigner, serial, err := t.mintCert(principal)
+	if err != nil {
+		return fmt.Errorf("sign certificate: %w", err)
+	}
+
+	sessionName, closeSession := t.jump.openSession(ctx, sb, principal, clientAddr, serial, podspec.AgentPort)
+	defer closeSession(kubeparkv1alpha1.ExitReasonDisconnected)
+
+	if !sandboxRunning(sb) {
+		_, _ = fmt.Fprintf(socket, "Starting %s...\r\n", sb.Name)
+	}
+	sb, err = t.jump.wakeAndWait(ctx, sb)
+	if err != nil {
+		return fmt.Errorf("sandbox did not become ready")
+	}
+	upstream, err := t.cfg.Dialer.DialSandbox(ctx, sb, podspec.AgentPort)
+	if err != nil {
+		return fmt.Errorf("cannot reach sandbox")
+	}
+	defer func() { _ = upstream.Close() }()
+	if sessionName != "" {
+		if err := t.cfg.Store.SetSessionUpstream(ctx, sb.Namespace, sessionName, upstream.LocalAddr().String()); err != nil {
+			logger.V(1).Info("failed to record session upstream", "session", sessionName, "err", err.Error())
+		}
+	}
+
+	// The agent proves it serves this sandbox, in this cluster, with its
+	// host certificate.
+	hostPrincipal := tunnel.Principal(ClusterFromContext(ctx), sb.Namespace, sb.Name)
+	agentConn, chans, reqs, err := gossh.NewClientConn(upstream, net.JoinHostPort(hostPrincipal, "22"), &gossh.ClientConfig{
+		User: principal,
+		Auth: []gossh.AuthMethod{gossh.PublicKeys(certSigner)},
+		HostKeyCallback: func(_ string, _ net.Addr, key gossh.PublicKey) error {
+			cert, ok := key.(*gossh.Certificate)
+			if !ok {
+				return fmt.Errorf("sandbox agent presented no host certificate")
+			}
+			return sshca.CheckHostCert(cert, t.hostCA, hostPrincipal, t.cfg.Now())
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("connect to sandbox agent: %w", err)
+	}
+	client := gossh.NewClient(agentConn, chans, reqs)
+	defer func() { _ = client.Close() }()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("open session: %w", err)
+	}
+	defer func() { _ = session.Close() }()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	session.Stdout, session.Stderr = socket, socket
+	if err := session.RequestPty("xterm-256color", rows, cols, gossh.TerminalModes{}); err != nil {
+		return fmt.Errorf("request pty: %w", err)
+	}
+	if err := session.Shell(); err != nil {
+		return fmt.Errorf("start shell: %w", err)
+	}
+
+	// Keystrokes arrive as binary messages, resizes as text.
+	go func() {
+		defer func() { _ = session.Close() }()
+		for {
+			kind, data, err := socket.conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if kind == websocket.BinaryMessage {
+				if _, err := stdin.Write(data); err != nil {
+					return
+				}
+				continue
+			}
+			var size struct{ Cols, Rows int }
+			if json.Unmarshal(data, &size) == nil && size.Cols > 0 && size.Rows > 0 {
+				_ = session.WindowChange(size.Rows, size.Cols)
+			}
+		}
+	}()
+	// The shell exiting and the browser leaving both end the session.
+	_ = session.Wait()
+	return nil
+}
+
+// mintCert signs a certificate for principal on a key made for this one
+// terminal, and returns it with its serial.
+func (t *WebTerminal) mintCert(principal string) (gossh.Signer, string, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := gossh.NewSignerFromKey(priv)
+	if err != nil {
+		return nil, "", err
+	}
+	authorized, err := t.signer.Sign(gossh.MarshalAuthorizedKey(key.PublicKey()), principal)
+	if err != nil {
+		return nil, "", err
+	}
+	pub, err := sshca.ParsePublicKey(authorized)
+	if err != nil {
+		return nil, "", err
+	}
+	cert, ok := pub.(*gossh.Certificate)
+	if !ok {
+		return nil, "", fmt.Errorf("signer returned no certificate")
+	}
+	certSigner, err := gossh.NewCertSigner(cert, key)
+	if err != nil {
+		return nil, "", err
+	}
+	return certSigner, strconv.FormatUint(cert.Serial, 10), nil
+}
+
+// page serves the terminal page. Its script runs under a per-response
+// nonce, so nothing but it and the pinned xterm.js files can.
+func (t *WebTerminal) page(w http.ResponseWriter, target SSHTarget) {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	nonce := base64.StdEncoding.EncodeToString(b[:])
+	assets := map[string]terminalAsset{}
+	for _, asset := range TerminalAssets {
+		assets[path.Base(asset)] = terminalAsset{
+			URL:       t.cfg.AssetsURL + "/" + asset,
+			Integrity: t.cfg.AssetsIntegrity[path.Base(asset)],
+		}
+	}
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf(
+		"default-src 'none'; script-src 'nonce-%[1]s' %[2]s %[3]s; style-src 'nonce-%[1]s' %[4]s; "+
+			"connect-src 'self'; frame-ancestors 'none'",
+		nonce, assets["xterm.js"].URL, assets["addon-fit.js"].URL, assets["xterm.css"].URL))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	name := target.Sandbox + "." + target.Namespace
+	if target.Cluster != "" {
+		name += "." + target.Cluster
+	}
+	_ = terminalPage.Execute(w, struct {
+		Sandbox, Nonce string
+		Assets         map[string]terminalAsset
+	}{name, nonce, assets})
+}
+
+// terminalAsset is one xterm.js file of the terminal page.
+type terminalAsset struct {
+	URL, Integrity string
+}
+
+// queryInt reads a positive integer query parameter, else def.
+func queryInt(r *http.Request, name string, def int) int {
+	n, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || n <= 0 || n > 1000 {
+		return def
+	}
+	return n
+}
+
+// terminalSocket writes the shell's output to the browser as binary
+// messages; a WebSocket takes one writer at a time.
+type terminalSocket struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (s *terminalSocket) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// close tells the browser why the terminal ended.
+func (s *terminalSocket) close(code int, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A close frame's reason is capped at 123 bytes.
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	_ = s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
+
+// xterm.js versions the terminal page loads from AssetsURL.
+const (
+	xtermVersion    = "5.5.0"
+	xtermFitVersion = "0.10.0"
+)
+
+// TerminalAssets are the files, relative to AssetsURL, the terminal page
+// loads.
+var TerminalAssets = []string{
+	"@xterm/xterm@" + xtermVersion + "/css/xterm.css",
+	"@xterm/xterm@" + xtermVersion + "/lib/xterm.js",
+	"@xterm/addon-fit@" + xtermFitVersion + "/lib/addon-fit.js",
+}
+
+// terminalPage runs xterm.js against the WebSocket at its own URL.
+var terminalPage = template.Must(template.New("terminal").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Sandbox}}</title>
+{{with index .Assets "xterm.css"}}<link rel="stylesheet" href="{{.URL}}" integrity="{{.Integrity}}" crossorigin="anonymous">{{end}}
+<style nonce="{{.Nonce}}">
+html, body, #terminal { height: 100%; margin: 0; background: #000; }
+</style>
+{{with index .Assets "xterm.js"}}<script src="{{.URL}}" integrity="{{.Integrity}}" crossorigin="anonymous"></script>{{end}}
+{{with index .Assets "addon-fit.js"}}<script src="{{.URL}}" integrity="{{.Integrity}}" crossorigin="anonymous"></script>{{end}}
+</head>
+<body>
+<div id="terminal"></div>
+<script nonce="{{.Nonce}}">
+const term = new Terminal({cursorBlink: true});
+const fit = new FitAddon.FitAddon();
+term.loadAddon(fit);
+term.open(document.getElementById("terminal"));
+fit.fit();
+term.focus();
+
+const url = new URL(location.href);
+url.protocol = url.protocol === "https:" ? "wss:" : "ws:";
+url.search = new URLSearchParams({cols: term.cols, rows: term.rows}).toString();
+const ws = new WebSocket(url);
+ws.binaryType = "arraybuffer";
+const encoder = new TextEncoder();
+const open = () => ws.readyState === WebSocket.OPEN;
+
+ws.onmessage = (e) => term.write(new Uint8Array(e.data));
+ws.onclose = (e) => term.write("\r\n[" + (e.reason || "disconnected") + "]\r\n");
+term.onData((data) => open() && ws.send(encoder.encode(data)));
+term.onResize((size) => open() && ws.send(JSON.stringify({cols: size.cols, rows: size.rows})));
+window.addEventListener("resize", () => fit.fit());
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,242 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/gateway"
+)
+
+const terminalHost = "kubepark.example.com"
+
+// terminalIntegrity pins the page's assets; the hashes are never checked
+// here.
+var terminalIntegrity = map[string]string{
+	"xterm.css":    "sha384-css",
+	"xterm.js":     "sha384-xterm",
+	"addon-fit.js": "sha384-fit",
+}
+
+// terminalAuth authenticates every request as principal, by cookie or, with
+// token set, by bearer token.
+type terminalAuth struct {
+	principal string
+	token     bool
+}
+
+func (a terminalAuth) Identify(*http.Request) (gateway.Identity, bool) {
+	if a.principal == "" {
+		return gateway.Identity{}, false
+	}
+	return gateway.Identity{Principal: a.principal, FromAuthorization: a.token}, true
+}
+
+func (a terminalAuth) StartLogin(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+// startTerminal serves the web terminal on an alice-owned sandbox, whose
+// agent presents a host certificate for hostPrincipals (default the one the
+// terminal expects).
+func startTerminal(t *testing.T, auth gateway.Authenticator, hostPrincipals ...string) (*httptest.Server, *fakeStore) {
+	t.Helper()
+	if len(hostPrincipals) == 0 {
+		hostPrincipals = []string{"demo.alice"}
+	}
+	userCA := newCA(t, "user-ca")
+	hostCA := newCA(t, "host-ca")
+	agentAddr := startAgentAs(t, "alice@example.com", hostPrincipals, userCA, hostCA)
+	store := &fakeStore{sandboxes: map[string]*kubeparkv1alpha1.Sandbox{
+		testSandboxKey: sandbox("alice", "demo", "alice@example.com"),
+	}}
+	term, err := gateway.NewWebTerminal(gateway.WebTerminalConfig{
+		AuthHost:         terminalHost,
+		Auth:             auth,
+		UserCAPEM:        userCA.priv,
+		HostCAAuthorized: hostCA.pub,
+		AssetsIntegrity:  terminalIntegrity,
+		WakeTimeout:      5 * time.Second,
+		Store:            store,
+		Dialer:           fakeDialer{addr: agentAddr},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(gateway.NewHTTPProxy(gateway.HTTPProxyConfig{
+		BaseDomain: terminalHost,
+		Store:      store,
+		Auth:       auth,
+		Terminal:   term,
+	}))
+	t.Cleanup(srv.Close)
+	return srv, store
+}
+
+func terminalGet(t *testing.T, srv *httptest.Server, host, path string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = host
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	return resp
+}
+
+func dialTerminal(srv *httptest.Server, origin string) (*websocket.Conn, *http.Response, error) {
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/kubepark/terminal/alice/demo?cols=100&rows=30"
+	return websocket.DefaultDialer.Dial(u, http.Header{"Host": {terminalHost}, "Origin": {origin}})
+}
+
+// TestWebTerminal runs a command in the sandbox's shell from the browser's
+// side of the WebSocket, and finds the connection recorded as an SSH
+// session of the owner.
+func TestWebTerminal(t *testing.T) {
+	srv, store := startTerminal(t, terminalAuth{principal: "alice@example.com"})
+
+	resp := terminalGet(t, srv, terminalHost, "/kubepark/terminal/alice/demo")
+	csp := resp.Header.Get("Content-Security-Policy")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(csp, "'nonce-") {
+		t.Fatalf("page = %d, CSP %q", resp.StatusCode, csp)
+	}
+	// Only the pinned files, not the whole CDN.
+	if !strings.Contains(csp, gateway.DefaultTerminalAssets+"/@xterm/xterm@5.5.0/lib/xterm.js ") ||
+		strings.Contains(csp, gateway.DefaultTerminalAssets+"/ ") {
+		t.Errorf("unexpected CSP %q", csp)
+	}
+
+	ws, _, err := dialTerminal(srv, "https://"+terminalHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ws.Close() }()
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"cols":120,"rows":40}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.WriteMessage(websocket.BinaryMessage, []byte("echo kubepark-$((40+2))\n")); err != nil {
+		t.Fatal(err)
+	}
+	_ = ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var out strings.Builder
+	for !strings.Contains(out.String(), "kubepark-42") {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v; output so far %q", err, out.String())
+		}
+		out.Write(data)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.sessions) != 1 {
+		t.Fatalf("sessions = %d, want 1", len(store.sessions))
+	}
+	got := store.sessions[0]
+	if got.User != "alice@example.com" || got.Kind != kubeparkv1alpha1.SessionKindSSH || got.CertSerial == "" {
+		t.Errorf("session = %+v, want an ssh session of alice with the minted certificate's serial", got)
+	}
+	if len(store.upstreams) != 1 {
+		t.Errorf("upstreams = %v, want the agent connection recorded", store.upstreams)
+	}
+}
+
+// TestWebTerminalRejects covers everything refused before a shell opens.
+func TestWebTerminalRejects(t *testing.T) {
+	srv, store := startTerminal(t, terminalAuth{principal: "alice@example.com"})
+	if resp := terminalGet(t, srv, "8888--demo--alice."+terminalHost, "/kubepark/terminal/alice/demo"); resp.StatusCode == http.StatusOK {
+		t.Error("terminal served on a sandbox host")
+	}
+	if resp := terminalGet(t, srv, terminalHost, "/kubepark/terminal/alice/demo:8888"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("terminal with a port = %d, want 404", resp.StatusCode)
+	}
+	if _, resp, err := dialTerminal(srv, "https://evil.example.com"); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("cross-origin WebSocket = %v, want 403", err)
+	}
+
+	srv, _ = startTerminal(t, terminalAuth{})
+	if resp := terminalGet(t, srv, terminalHost, "/kubepark/terminal/alice/demo"); resp.StatusCode != http.StatusFound {
+		t.Errorf("unauthenticated = %d, want a login redirect", resp.StatusCode)
+	}
+	srv, _ = startTerminal(t, terminalAuth{principal: "bob@example.com"})
+	if resp := terminalGet(t, srv, terminalHost, "/kubepark/terminal/alice/demo"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("not the owner = %d, want 403", resp.StatusCode)
+	}
+	srv, _ = startTerminal(t, terminalAuth{principal: "alice@example.com", token: true})
+	if resp := terminalGet(t, srv, terminalHost, "/kubepark/terminal/alice/demo"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("token = %d, want 403", resp.StatusCode)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.opened != 0 {
+		t.Errorf("sessions opened = %d, want none", store.opened)
+	}
+}
+
+// TestWebTerminalChecksHostCertificate refuses an agent whose host
+// certificate is for the same-named sandbox of a member cluster.
+func TestWebTerminalChecksHostCertificate(t *testing.T) {
+	srv, _ := startTerminal(t, terminalAuth{principal: "alice@example.com"}, "demo.alice.osaka")
+	ws, _, err := dialTerminal(srv, "https://"+terminalHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ws.Close() }()
+	_ = ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		_, _, err := ws.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseInternalServerErr) {
+			t.Fatalf("terminal ended with %v, want the agent refused", err)
+		}
+		return
+	}
+}
+
+// TestWebTerminalRequiresIntegrity refuses a terminal whose xterm.js is not
+// pinned.
+func TestWebTerminalRequiresIntegrity(t *testing.T) {
+	userCA := newCA(t, "user-ca")
+	hostCA := newCA(t, "host-ca")
+	_, err := gateway.NewWebTerminal(gateway.WebTerminalConfig{
+		AuthHost:         terminalHost,
+		Auth:             terminalAuth{principal: "alice@example.com"},
+		UserCAPEM:        userCA.priv,
+		HostCAAuthorized: hostCA.pub,
+		AssetsIntegrity:  map[string]string{"xterm.js": "sha384-xterm"},
+		Store:            &fakeStore{},
+		Dialer:           fakeDialer{},
+	})
+	if err == nil || !strings.Contains(err.Error(), "xterm.css") {
+		t.Fatalf("expected the missing hash to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,275 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// TLSConfig configures TLS termination on the gateway's HTTP listener.
+type TLSConfig struct {
+	// Client reads the certificate Secrets. A cached client keeps them
+	// watched, so a renewed certificate is served from the next handshake.
+	Client client.Reader
+	// Namespace holds the certificate Secrets.
+	Namespace string
+	// Secrets names kubernetes.io/tls Secrets. A handshake gets the first
+	// whose certificate covers its server name, wildcards included.
+	Secrets []string
+	// ACME, when set, obtains certificates for server names no Secret
+	// covers.
+	ACME *autocert.Manager
+}
+
+// NewTLSConfig builds the listener's tls.Config, choosing a certificate
+// per handshake by SNI.
+func NewTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	if len(cfg.Secrets) == 0 && cfg.ACME == nil {
+		return nil, errors.New("TLS needs a certificate Secret or ACME")
+	}
+	certs := &secretCertificates{c: cfg.Client, namespace: cfg.Namespace, names: cfg.Secrets, parsed: map[string]parsedCertificate{}}
+	protos := []string{"h2", "http/1.1"}
+	if cfg.ACME != nil {
+		protos = append(protos, acme.ALPNProto)
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: protos,
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			// TLS-ALPN-01 challenges are answered by the ACME client alone.
+			if cfg.ACME != nil && slices.Contains(hello.SupportedProtos, acme.ALPNProto) {
+				return cfg.ACME.GetCertificate(hello)
+			}
+			loaded := certs.load(hello.Context())
+			for _, cert := range loaded {
+				if hello.SupportsCertificate(cert) == nil {
+					return cert, nil
+				}
+			}
+			if cfg.ACME != nil && hello.ServerName != "" {
+				return cfg.ACME.GetCertificate(hello)
+			}
+			// Without a match, the first certificate beats failing the
+			// handshake: clients without SNI still get an answer.
+			if len(loaded) > 0 {
+				return loaded[0], nil
+			}
+			return nil, fmt.Errorf("no certificate for %q", hello.ServerName)
+		},
+	}, nil
+}
+
+// parsedCertificate is a Secret's certificate, parsed at resourceVersion.
+type parsedCertificate struct {
+	resourceVersion string
+	cert            *tls.Certificate
+}
+
+// secretCertificates loads certificates from Secrets, parsing each only
+// when its resourceVersion changes.
+type secretCertificates struct {
+	c         client.Reader
+	namespace string
+	names     []string
+
+	mu     sync.Mutex
+	parsed map[string]parsedCertificate
+}
+
+// load returns the certificates of the Secrets, in order, skipping those
+// missing or invalid.
+func (s *secretCertificates) load(ctx context.Context) []*tls.Certificate {
+	logger := log.FromContext(ctx)
+	var out []*tls.Certificate
+	for _, name := range s.names {
+		var secret corev1.Secret
+		if err := s.c.Get(ctx, types.NamespacedName{Namespace: s.namespace, Name: name}, &secret); err != nil {
+			logger.V(1).Info("certificate secret unavailable", "secret", name, "err", err.Error())
+			continue
+		}
+		s.mu.Lock()
+		p, ok := s.parsed[name]
+		s.mu.Unlock()
+		if !ok || p.resourceVersion != secret.ResourceVersion {
+			cert, err := parseTLSSecret(&secret)
+			if err != nil {
+				logger.Error(err, "invalid certificate secret", "secret", name)
+				continue
+			}
+			p = parsedCertificate{resourceVersion: secret.ResourceVersion, cert: cert}
+			s.mu.Lock()
+			s.parsed[name] = p
+			s.mu.Unlock()
+		}
+		out = append(out, p.cert)
+	}
+	return out
+}
+
+// parseTLSSecret parses a kubernetes.io/tls Secret, with its leaf
+// certificate for SNI matching.
+func parseTLSSecret(secret *corev1.Secret) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	return &cert, nil
+}
+
+// ACMEConfig configures the ACME client.
+type ACMEConfig struct {
+	// DirectoryURL is the ACME directory, e.g. Let's Encrypt's or a local
+	// Pebble's.
+	DirectoryURL string
+	// Email is the account contact.
+	Email string
+	// RootCAs, when set, is trusted for the directory's own TLS, as a
+	// local ACME server is not publicly trusted.
+	RootCAs *x509.CertPool
+	// BaseDomain and Store limit certificates to the gateway's host name
+	// and routing hosts of exposed ports, so random SNI names cannot spend
+	// the CA's rate limits.
+	BaseDomain string
+	Store      Store
+	// AuthHost, when it is not the base domain, is admitted as well.
+	AuthHost string
+	// Cache keeps the account key and certificates.
+	Cache autocert.Cache
+}
+
+// NewACMEManager builds the ACME client. Challenges are answered over
+// TLS-ALPN-01 on the HTTPS listener, which must be reachable on port 443.
+func NewACMEManager(cfg ACMEConfig) *autocert.Manager {
+	httpClient := http.DefaultClient
+	if cfg.RootCAs != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: cfg.RootCAs, MinVersion: tls.VersionTLS12}
+		httpClient = &http.Client{Transport: transport}
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      cfg.Cache,
+		Email:      cfg.Email,
+		HostPolicy: routeHostPolicy(cfg.BaseDomain, cfg.AuthHost, cfg.Store),
+		Client:     &acme.Client{DirectoryURL: cfg.DirectoryURL, HTTPClient: httpClient},
+	}
+}
+
+// routeHostPolicy admits the base domain, the auth host and the routing
+// hosts of exposed ports that exist.
+func routeHostPolicy(baseDomain, authHost string, store Store) autocert.HostPolicy {
+	return func(ctx context.Context, host string) error {
+		if strings.EqualFold(host, baseDomain) || (authHost != "" && strings.EqualFold(host, authHost)) {
+			return nil
+		}
+		target, err := ParseHTTPHost(host, baseDomain)
+		if err != nil {
+			return err
+		}
+		sb, err := store.GetSandbox(WithCluster(ctx, target.Cluster), target.Namespace, target.Sandbox)
+		if err != nil {
+			return fmt.Errorf("host %q: %w", host, err)
+		}
+		if findExposedPort(sb, target.Port) == nil {
+			return fmt.Errorf("host %q: port not exposed", host)
+		}
+		return nil
+	}
+}
+
+// acmeCacheLabel marks the Secrets of the ACME cache.
+const acmeCacheLabel = "kubepark.dev/acme-cache"
+
+// SecretCache is an autocert.Cache in Secrets, one per entry, so gateway
+// replicas share an account and certificates and a restart does not
+// re-issue them.
+type SecretCache struct {
+	Client    client.Client
+	Namespace string
+}
+
+var _ autocert.Cache = &SecretCache{}
+
+// secretName derives a Secret name from a cache key, which may hold
+// characters a name cannot.
+func (c *SecretCache) secretName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "kubepark-acme-" + hex.EncodeToString(sum[:])[:20]
+}
+
+func (c *SecretCache) Get(ctx context.Context, key string) ([]byte, error) {
+	var secret corev1.Secret
+	err := c.Client.Get(ctx, types.NamespacedName{Namespace: c.Namespace, Name: c.secretName(key)}, &secret)
+	if apierrors.IsNotFound(err) {
+		return nil, autocert.ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	return secret.Data["data"], nil
+}
+
+func (c *SecretCache) Put(ctx context.Context, key string, data []byte) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   c.Namespace,
+			Name:        c.secretName(key),
+			Labels:      map[string]string{acmeCacheLabel: "true"},
+			Annotations: map[string]string{acmeCacheLabel: key},
+		},
+		Data: map[string][]byte{"data": data},
+	}
+	err := c.Client.Create(ctx, secret)
+	if apierrors.IsAlreadyExists(err) {
+		var existing corev1.Secret
+		if err := c.Client.Get(ctx, client.ObjectKeyFromObject(secret), &existing); err != nil {
+			return err
+		}
+		existing.Data = secret.Data
+		return c.Client.Update(ctx, &existing)
+	}
+	return err
+}
+
+func (c *SecretCache) Delete(ctx context.Context, key string) error {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: c.Namespace, Name: c.secretName(key)}}
+	return client.IgnoreNotFound(c.Client.Delete(ctx, secret))
+}
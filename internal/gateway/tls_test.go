@@ -0,0 +1,180 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const gatewayNS = "kubepark-system"
+
+// tlsSecret returns a kubernetes.io/tls Secret with a self-signed
+// certificate for names.
+func tlsSecret(t *testing.T, name string, names ...string) *corev1.Secret {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: gatewayNS, Name: name},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			corev1.TLSPrivateKeyKey: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		},
+	}
+}
+
+func fakeClient(objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+// servedName handshakes with serverName and returns the first DNS name of
+// the certificate served.
+func servedName(t *testing.T, cfg *tls.Config, serverName string) string {
+	t.Helper()
+	c, s := net.Pipe()
+	defer func() { _ = c.Close() }()
+	go func() {
+		defer func() { _ = s.Close() }()
+		_ = tls.Server(s, cfg).Handshake()
+	}()
+	conn := tls.Client(c, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if err := conn.Handshake(); err != nil {
+		t.Fatalf("handshake for %q: %v", serverName, err)
+	}
+	return conn.ConnectionState().PeerCertificates[0].DNSNames[0]
+}
+
+func TestTLSConfigSNI(t *testing.T) {
+	ctx := context.Background()
+	c := fakeClient(
+		tlsSecret(t, "wildcard", "*.kubepark.example.com", "kubepark.example.com"),
+		tlsSecret(t, "other", "other.example.com"),
+	)
+	cfg, err := NewTLSConfig(TLSConfig{Client: c, Namespace: gatewayNS, Secrets: []string{"wildcard", "other"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := servedName(t, cfg, "jupyter--demo--alice.kubepark.example.com"); got != "*.kubepark.example.com" {
+		t.Errorf("routing host served %q", got)
+	}
+	if got := servedName(t, cfg, "other.example.com"); got != "other.example.com" {
+		t.Errorf("other host served %q", got)
+	}
+	// An unknown name gets the first certificate.
+	if got := servedName(t, cfg, "unknown.example.org"); got != "*.kubepark.example.com" {
+		t.Errorf("unknown host served %q", got)
+	}
+
+	// A renewed certificate is served from the next handshake.
+	var secret corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: gatewayNS, Name: "other"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	secret.Data = tlsSecret(t, "other", "renewed.example.com", "other.example.com").Data
+	if err := c.Update(ctx, &secret); err != nil {
+		t.Fatal(err)
+	}
+	if got := servedName(t, cfg, "other.example.com"); got != "renewed.example.com" {
+		t.Errorf("after renewal served %q", got)
+	}
+}
+
+func TestRouteHostPolicy(t *testing.T) {
+	policy := routeHostPolicy("kubepark.example.com", "auth.kubepark.example.com", newSessionStore(testSandbox("")))
+	ctx := context.Background()
+	for host, ok := range map[string]bool{
+		"kubepark.example.com":                      true,
+		"auth.kubepark.example.com":                 true,
+		"jupyter--demo--alice.kubepark.example.com": true,
+		"missing--demo--alice.kubepark.example.com": false, // port not exposed
+		"random.kubepark.example.com":               false,
+		"jupyter--demo--alice.example.org":          false,
+	} {
+		if err := policy(ctx, host); (err == nil) != ok {
+			t.Errorf("policy(%q) = %v, want allowed=%v", host, err, ok)
+		}
+	}
+}
+
+func TestSecretCache(t *testing.T) {
+	ctx := context.Background()
+	cache := &SecretCache{Client: fakeClient(), Namespace: gatewayNS}
+	const key = "acme_account+key"
+
+	if _, err := cache.Get(ctx, key); !errors.Is(err, autocert.ErrCacheMiss) {
+		t.Fatalf("Get before Put = %v, want ErrCacheMiss", err)
+	}
+	for _, data := range []string{"first", "second"} {
+		if err := cache.Put(ctx, key, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := cache.Get(ctx, key)
+		if err != nil || string(got) != data {
+			t.Fatalf("Get = %q, %v, want %q", got, err, data)
+		}
+	}
+	if err := cache.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get(ctx, key); !errors.Is(err, autocert.ErrCacheMiss) {
+		t.Fatalf("Get after Delete = %v, want ErrCacheMiss", err)
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// tokenPrefix marks a personal access token, telling it apart from an ID
+// token in an Authorization header.
+const tokenPrefix = "kpat_"
+
+// TokenScope limits a personal access token to one sandbox, and to one of
+// its exposed ports when Port is set. Cluster names a member cluster's
+// sandbox; a scope without one covers only the gateway's own cluster.
+type TokenScope struct {
+	Namespace string `json:"namespace"`
+	Sandbox   string `json:"sandbox"`
+	Port      string `json:"port,omitempty"`
+	Cluster   string `json:"cluster,omitempty"`
+}
+
+// ParseTokenScope parses "<namespace>[.<cluster>]/<sandbox>[:<port>]".
+func ParseTokenScope(s string) (TokenScope, error) {
+	ref, port, hasPort := strings.Cut(s, ":")
+	namespace, sandbox, ok := strings.Cut(ref, "/")
+	namespace, cluster, hasCluster := strings.Cut(namespace, ".")
+	scope := TokenScope{Namespace: namespace, Sandbox: sandbox, Port: port, Cluster: cluster}
+	if !ok || (hasPort && port == "") || (hasCluster && cluster == "") || scope.validate() != nil {
+		return TokenScope{}, fmt.Errorf("invalid token scope %q (want <namespace>[.<cluster>]/<sandbox>[:<port>])", s)
+	}
+	return scope, nil
+}
+
+func (s TokenScope) validate() error {
+	if !dnsLabel.MatchString(s.Namespace) || !dnsLabel.MatchString(s.Sandbox) ||
+		(s.Port != "" && !dnsLabel.MatchString(s.Port)) || (s.Cluster != "" && !dnsLabel.MatchString(s.Cluster)) {
+		return fmt.Errorf("invalid token scope %+v", s)
+	}
+	return nil
+}
+
+// allows reports whether the scope covers a port of a sandbox.
+func (s TokenScope) allows(cluster, namespace, sandbox, port string) bool {
+	return s.Cluster == cluster && s.Namespace == namespace && s.Sandbox == sandbox && (s.Port == "" || s.Port == port)
+}
+
+// tokenClaims are the claims of a personal access token. Groups are those
+// of the login that minted it.
+type tokenClaims struct {
+	Principal string       `json:"p"`
+	Groups    []string     `json:"g,omitempty"`
+	ID        string       `json:"i"`
+	Expiry    int64        `json:"e"`
+	Scopes    []TokenScope `json:"s"`
+}
+
+// Tokens issues and verifies personal access tokens: signed, scoped to
+// sandboxes, expiring and revocable. They hold no state of their own; a
+// revoked token's ID is kept in Revocations until it expires.
+type Tokens struct {
+	key         []byte
+	revocations Revocations
+	maxTTL      time.Duration
+	// Now is injected for tests.
+	Now func() time.Time
+}
+
+// NewTokens builds the token issuer. key should be stable across gateway
+// replicas; maxTTL caps the lifetime a token may be issued for.
+func NewTokens(key []byte, revocations Revocations, maxTTL time.Duration) *Tokens {
+	return &Tokens{key: key, revocations: revocations, maxTTL: maxTTL, Now: time.Now}
+}
+
+// IssuedToken is a newly minted token.
+type IssuedToken struct {
+	Token     string    `json:"token"`
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Issue mints a token for principal limited to scopes.
+func (t *Tokens) Issue(principal string, groups []string, scopes []TokenScope, ttl time.Duration) (IssuedToken, error) {
+	if len(scopes) == 0 {
+		return IssuedToken{}, errors.New("a token needs at least one scope")
+	}
+	for _, s := range scopes {
+		if err := s.validate(); err != nil {
+			return IssuedToken{}, err
+		}
+	}
+	if ttl <= 0 || ttl > t.maxTTL {
+		return IssuedToken{}, fmt.Errorf("token lifetime must be positive and at most %s", t.maxTTL)
+	}
+	expiry := t.Now().Add(ttl)
+	claims := tokenClaims{
+		Principal: principal, Groups: groups, ID: randomString(), Expiry: expiry.Unix(), Scopes: scopes,
+	}
+	return IssuedToken{
+		Token:     tokenPrefix + signValue(t.key, purposeToken, claims),
+		ID:        claims.ID,
+		ExpiresAt: time.Unix(claims.Expiry, 0).UTC(),
+	}, nil
+}
+
+// errInvalidToken is returned for a token that is malformed, forged or
+// expired.
+var errInvalidToken = errors.New("invalid or expired token")
+
+// Verify checks a token's signature, expiry and revocation.
+func (t *Tokens) Verify(ctx context.Context, raw string) (tokenClaims, error) {
+	claims, err := t.parse(raw)
+	if err != nil {
+		return tokenClaims{}, err
+	}
+	if t.Now().Unix() > claims.Expiry {
+		return tokenClaims{}, errInvalidToken
+	}
+	if t.revocations != nil {
+		revoked, err := t.revocations.Revoked(ctx, claims.ID)
+		if err != nil {
+			return tokenClaims{}, err
+		}
+		if revoked {
+			return tokenClaims{}, errInvalidToken
+		}
+	}
+	return claims, nil
+}
+
+// Revoke revokes a token, which only its holder can present.
+func (t *Tokens) Revoke(ctx context.Context, raw string) error {
+	claims, err := t.parse(raw)
+	if err != nil {
+		return err
+	}
+	if t.revocations == nil {
+		return errors.New("token revocation is not configured")
+	}
+	return t.revocations.Revoke(ctx, claims.ID, time.Unix(claims.Expiry, 0))
+}
+
+func (t *Tokens) parse(raw string) (tokenClaims, error) {
+	value, ok := strings.CutPrefix(raw, tokenPrefix)
+	var claims tokenClaims
+	if !ok || !verifyValue(t.key, purposeToken, value, &claims) {
+		return tokenClaims{}, errInvalidToken
+	}
+	return claims, nil
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// isPersonalToken reports whether a bearer token is a personal access
+// token rather than an ID token.
+func isPersonalToken(token string) bool {
+	return strings.HasPrefix(token, tokenPrefix)
+}
+
+// scopesAllow reports whether scopes, nil meaning unrestricted, cover a
+// port of a sandbox.
+func scopesAllow(scopes []TokenScope, cluster, namespace, sandbox, port string) bool {
+	return scopes == nil || slices.ContainsFunc(scopes, func(s TokenScope) bool {
+		return s.allows(cluster, namespace, sandbox, port)
+	})
+}
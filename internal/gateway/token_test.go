@@ -0,0 +1,219 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+)
+
+func TestParseTokenScope(t *testing.T) {
+	for in, want := range map[string]TokenScope{
+		"alice/demo":         {Namespace: "alice", Sandbox: "demo"},
+		"alice/demo:jupyter": {Namespace: "alice", Sandbox: "demo", Port: "jupyter"},
+		"alice.tokyo/demo":   {Namespace: "alice", Sandbox: "demo", Cluster: "tokyo"},
+	} {
+		if got, err := ParseTokenScope(in); err != nil || got != want {
+			t.Errorf("ParseTokenScope(%q) = %+v, %v", in, got, err)
+		}
+	}
+	for _, in := range []string{"demo", "alice/", "alice/demo:", "Alice/demo", "alice/demo/x", "alice./demo"} {
+		if _, err := ParseTokenScope(in); err == nil {
+			t.Errorf("ParseTokenScope(%q) must fail", in)
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	revocations := memRevocations{}
+	tokens := NewTokens([]byte("test-hmac-key"), revocations, 24*time.Hour)
+	tokens.Now = func() time.Time { return now }
+	scopes := []TokenScope{{Namespace: nsAlice, Sandbox: sbName, Port: "jupyter"}}
+
+	if _, err := tokens.Issue("alice@example.com", nil, nil, time.Hour); err == nil {
+		t.Error("an unscoped token must be refused")
+	}
+	if _, err := tokens.Issue("alice@example.com", nil, scopes, 48*time.Hour); err == nil {
+		t.Error("a lifetime over the maximum must be refused")
+	}
+	issued, err := tokens.Issue("alice@example.com", []string{"team-a"}, scopes, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := tokens.Verify(ctx, issued.Token)
+	if err != nil || claims.Principal != "alice@example.com" || len(claims.Scopes) != 1 {
+		t.Fatalf("Verify = %+v, %v", claims, err)
+	}
+
+	// The signature covers the scopes, and a session cookie is no token.
+	if _, err := tokens.Verify(ctx, issued.Token+"x"); err == nil {
+		t.Error("a tampered token must be refused")
+	}
+	cookie := tokenPrefix + signValue([]byte("test-hmac-key"), purposeSession, claims)
+	if _, err := tokens.Verify(ctx, cookie); err == nil {
+		t.Error("a value signed for another purpose must be refused")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := tokens.Verify(ctx, issued.Token); err == nil {
+		t.Error("an expired token must be refused")
+	}
+	now = now.Add(-2 * time.Hour)
+
+	if err := tokens.Revoke(ctx, issued.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.Verify(ctx, issued.Token); err == nil {
+		t.Error("a revoked token must be refused")
+	}
+}
+
+// idTokenIssuer signs ID tokens for a static verifier.
+type idTokenIssuer struct {
+	signer   jose.Signer
+	verifier *oidc.IDTokenVerifier
+}
+
+func newIDTokenIssuer(t *testing.T) *idTokenIssuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{key.Public()}}
+	return &idTokenIssuer{
+		signer: signer,
+		verifier: oidc.NewVerifier("https://idp.example.com", keys, &oidc.Config{
+			ClientID: "kubepark", SupportedSigningAlgs: []string{oidc.ES256},
+		}),
+	}
+}
+
+func (i *idTokenIssuer) token(t *testing.T, audience, email string) string {
+	t.Helper()
+	claims := struct {
+		jwt.Claims
+		Email string `json:"email"`
+	}{
+		Claims: jwt.Claims{
+			Issuer:   "https://idp.example.com",
+			Audience: jwt.Audience{audience},
+			Subject:  email,
+			Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		Email: email,
+	}
+	raw, err := jwt.Signed(i.signer).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestHTTPProxyBearerTokens(t *testing.T) {
+	var seen http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	idp := newIDTokenIssuer(t)
+	auth, revocations := testCookieAuth()
+	auth.verifier = idp.verifier
+	auth.cfg.Tokens = NewTokens([]byte("test-hmac-key"), revocations, 24*time.Hour)
+
+	sb := testSandbox("10.0.0.1")
+	sb.Spec.ExposedPorts = append(sb.Spec.ExposedPorts,
+		kubeparkv1alpha1.ExposedPort{Name: "api", Port: 9000, Auth: kubeparkv1alpha1.AuthModeOIDC})
+	p := NewHTTPProxy(HTTPProxyConfig{
+		BaseDomain: "sb.example.com",
+		Store:      newSessionStore(sb),
+		Auth:       auth,
+		DialAddr:   func(*kubeparkv1alpha1.Sandbox, int32) string { return upstream.URL },
+	})
+	send := func(host, authorization string) *httptest.ResponseRecorder {
+		seen = nil
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+"/api", nil)
+		req.Header.Set("Authorization", authorization)
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// An ID token of the configured issuer and client is accepted, and not
+	// passed on to the sandbox.
+	if rec := send(jupyterHost, "Bearer "+idp.token(t, "kubepark", "alice@example.com")); rec.Code != http.StatusOK {
+		t.Fatalf("ID token: %d", rec.Code)
+	}
+	if seen.Get("Authorization") != "" || seen.Get(HeaderForwardedUser) != "alice@example.com" {
+		t.Errorf("ID token: upstream saw Authorization=%q user=%q", seen.Get("Authorization"), seen.Get(HeaderForwardedUser))
+	}
+	rec := send(jupyterHost, "Bearer "+idp.token(t, "other-client", "alice@example.com"))
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("ID token for another client: %d, want 401 with a challenge", rec.Code)
+	}
+
+	// A personal access token reaches the ports in its scope only.
+	issued, err := auth.cfg.Tokens.Issue("alice@example.com", nil,
+		[]TokenScope{{Namespace: nsAlice, Sandbox: sbName, Port: "jupyter"}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := send(jupyterHost, "Bearer "+issued.Token); rec.Code != http.StatusOK || seen.Get("Authorization") != "" {
+		t.Fatalf("token in scope: %d", rec.Code)
+	}
+	if rec := send("api--demo--alice.sb.example.com", "Bearer "+issued.Token); rec.Code != http.StatusForbidden {
+		t.Errorf("token out of scope: %d, want 403", rec.Code)
+	}
+
+	// A token held by someone the port does not admit is still refused.
+	mallory, err := auth.cfg.Tokens.Issue("mallory@example.com", nil,
+		[]TokenScope{{Namespace: nsAlice, Sandbox: sbName}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := send(jupyterHost, "Bearer "+mallory.Token); rec.Code != http.StatusForbidden {
+		t.Errorf("token of a stranger: %d, want 403", rec.Code)
+	}
+
+	if err := auth.cfg.Tokens.Revoke(context.Background(), issued.Token); err != nil {
+		t.Fatal(err)
+	}
+	if rec := send(jupyterHost, "Bearer "+issued.Token); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked token: %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,514 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/sshca"
+	"github.com/frauniki/kubepark/internal/tunnel"
+)
+
+// AnnotationTunnel on a Sandbox is the tunnel address of the gateway
+// replica holding its agent's reverse tunnel.
+const AnnotationTunnel = "kubepark.dev/tunnel"
+
+const (
+	defaultTunnelWait      = 10 * time.Second
+	tunnelPollInterval     = 250 * time.Millisecond
+	tunnelKeepalive        = 30 * time.Second
+	tunnelHandshakeTimeout = 10 * time.Second
+	// tunnelCertValidity matches the sandboxes' host certificates; the
+	// gateway signs a fresh one on every start.
+	tunnelCertValidity = 10 * 365 * 24 * time.Hour
+)
+
+// TunnelRegistry records which gateway replica holds each sandbox's
+// reverse tunnel, so any replica can route to it. The sandbox lives in the
+// cluster the context names.
+type TunnelRegistry interface {
+	// Claim records addr as the holder of the sandbox's tunnel.
+	Claim(ctx context.Context, namespace, name, addr string) error
+	// Release removes the claim if addr still holds it.
+	Release(ctx context.Context, namespace, name, addr string) error
+	// Lookup returns the holder of the sandbox's tunnel, or "".
+	Lookup(ctx context.Context, namespace, name string) (string, error)
+}
+
+// sandboxRegistry keeps the claim as the AnnotationTunnel annotation of
+// the Sandbox, where every replica's cache already sees it.
+type sandboxRegistry struct {
+	c        client.Client
+	clusters *Clusters
+}
+
+// NewSandboxTunnelRegistry returns a TunnelRegistry that annotates
+// Sandboxes, in the member clusters of clusters (which may be nil) too.
+func NewSandboxTunnelRegistry(c client.Client, clusters *Clusters) TunnelRegistry {
+	return &sandboxRegistry{c: c, clusters: clusters}
+}
+
+func (r *sandboxRegistry) Claim(ctx context.Context, namespace, name, addr string) error {
+	c, err := clusterClient(ctx, r.c, r.clusters)
+	if err != nil {
+		return err
+	}
+	var sb kubeparkv1alpha1.Sandbox
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &sb); err != nil {
+		return err
+	}
+	if sb.Annotations[AnnotationTunnel] == addr {
+		return nil
+	}
+	patch := client.MergeFrom(sb.DeepCopy())
+	if sb.Annotations == nil {
+		sb.Annotations = map[string]string{}
+	}
+	sb.Annotations[AnnotationTunnel] = addr
+	return c.Patch(ctx, &sb, patch)
+}
+
+func (r *sandboxRegistry) Release(ctx context.Context, namespace, name, addr string) error {
+	c, err := clusterClient(ctx, r.c, r.clusters)
+	if err != nil {
+		return err
+	}
+	var sb kubeparkv1alpha1.Sandbox
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &sb); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if sb.Annotations[AnnotationTunnel] != addr {
+		return nil
+	}
+	// Another replica may be claiming it meanwhile; its claim wins.
+	patch := client.MergeFromWithOptions(sb.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	delete(sb.Annotations, AnnotationTunnel)
+	if err := c.Patch(ctx, &sb, patch); err != nil && !apierrors.IsConflict(err) {
+		return client.IgnoreNotFound(err)
+	}
+	return nil
+}
+
+func (r *sandboxRegistry) Lookup(ctx context.Context, namespace, name string) (string, error) {
+	c, err := clusterClient(ctx, r.c, r.clusters)
+	if err != nil {
+		return "", err
+	}
+	var sb kubeparkv1alpha1.Sandbox
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &sb); err != nil {
+		return "", err
+	}
+	return sb.Annotations[AnnotationTunnel], nil
+}
+
+// TunnelConfig configures the gateway's reverse-tunnel listener.
+type TunnelConfig struct {
+	// Addr is the listen address agents and other replicas connect to.
+	Addr string
+	// AdvertiseAddr is how other replicas reach this one's listener,
+	// normally <pod IP>:<port>. It is what the registry records.
+	AdvertiseAddr string
+	// HostKeyPEM is the gateway's host key, shared by every replica.
+	HostKeyPEM []byte
+	// HostCAPEM is the host CA private key. It signs the gateway's tunnel
+	// certificate on start, and its public half verifies the host
+	// certificates agents connect with.
+	HostCAPEM []byte
+	// Registry records the replica holding each tunnel.
+	Registry TunnelRegistry
+	// Fallback dials sandboxes no replica holds a tunnel for. When nil, or
+	// when it cannot reach the sandbox's cluster, a dial waits up to Wait
+	// (default 10s) for the agent to connect.
+	Fallback Dialer
+	Wait     time.Duration
+	// Now is injected for tests.
+	Now func() time.Time
+}
+
+// Tunnels is the gateway end of the reverse tunnel: a listener agents keep
+// an SSH connection open to, and a Dialer that reaches a sandbox through
+// its agent's connection, on this replica or, via the registry, another.
+// Run Start to serve the listener.
+type Tunnels struct {
+	cfg    TunnelConfig
+	server *gossh.ServerConfig
+	peer   *gossh.ClientConfig
+	seq    atomic.Uint64
+
+	mu     sync.Mutex
+	agents map[tunnelKey]*gossh.ServerConn
+	peers  map[string]*gossh.Client
+}
+
+// tunnelKey names the sandbox an agent's tunnel serves.
+type tunnelKey struct {
+	cluster, namespace, name string
+}
+
+func (k tunnelKey) String() string {
+	return tunnel.User(k.cluster, k.namespace, k.name)
+}
+
+// context names the key's cluster, where the registry records its holder.
+func (k tunnelKey) context(ctx context.Context) context.Context {
+	return WithCluster(ctx, k.cluster)
+}
+
+// NewTunnels builds the tunnel listener and dialer.
+func NewTunnels(cfg TunnelConfig) (*Tunnels, error) {
+	if cfg.Registry == nil {
+		return nil, fmt.Errorf("tunnels require a registry")
+	}
+	if cfg.Wait == 0 {
+		cfg.Wait = defaultTunnelWait
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	hostCA, err := sshca.ParseSigner(cfg.HostCAPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parse host CA: %w", err)
+	}
+	hostKey, err := gossh.ParsePrivateKey(cfg.HostKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parse gateway host key: %w", err)
+	}
+	cert, err := sshca.SignHostCert(hostCA, hostKey.PublicKey(), []string{tunnel.GatewayPrincipal},
+		tunnelCertValidity, cfg.Now())
+	if err != nil {
+		return nil, err
+	}
+	signer, err := gossh.NewCertSigner(cert, hostKey)
+	if err != nil {
+		return nil, fmt.Errorf("build tunnel cert signer: %w", err)
+	}
+
+	t := &Tunnels{
+		cfg:    cfg,
+		agents: map[tunnelKey]*gossh.ServerConn{},
+		peers:  map[string]*gossh.Client{},
+	}
+	caPub := hostCA.PublicKey()
+	// Agents prove the sandbox they serve with its host certificate;
+	// replicas with the gateway's.
+	t.server = &gossh.ServerConfig{
+		PublicKeyCallback: func(meta gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+			cert, ok := key.(*gossh.Certificate)
+			if !ok {
+				return nil, errors.New("a host certificate is required")
+			}
+			principal := tunnel.GatewayPrincipal
+			if meta.User() != tunnel.GatewayPrincipal {
+				cluster, namespace, name, err := tunnel.ParseUser(meta.User())
+				if err != nil {
+					return nil, err
+				}
+				principal = tunnel.Principal(cluster, namespace, name)
+			}
+			if err := sshca.CheckHostCert(cert, caPub, principal, t.cfg.Now()); err != nil {
+				return nil, err
+			}
+			return &gossh.Permissions{}, nil
+		},
+	}
+	t.server.AddHostKey(signer)
+	t.peer = &gossh.ClientConfig{
+		User:              tunnel.GatewayPrincipal,
+		Auth:              []gossh.AuthMethod{gossh.PublicKeys(signer)},
+		HostKeyCallback:   checkGatewayHostKey(caPub, cfg.Now),
+		HostKeyAlgorithms: []string{cert.Type()},
+		Timeout:           tunnelHandshakeTimeout,
+	}
+	return t, nil
+}
+
+// checkGatewayHostKey accepts a host certificate for the gateway principal
+// signed by the host CA.
+func checkGatewayHostKey(caPub gossh.PublicKey, now func() time.Time) gossh.HostKeyCallback {
+	return func(_ string, _ net.Addr, key gossh.PublicKey) error {
+		cert, ok := key.(*gossh.Certificate)
+		if !ok {
+			return errors.New("gateway presented no host certificate")
+		}
+		return sshca.CheckHostCert(cert, caPub, tunnel.GatewayPrincipal, now())
+	}
+}
+
+// Start serves the tunnel listener until ctx is done, then closes every
+// tunnel. It implements manager.Runnable.
+func (t *Tunnels) Start(ctx context.Context) error {
+	var lc net.ListenConfig
+	l, err := lc.Listen(ctx, "tcp", t.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	return t.Serve(ctx, l)
+}
+
+// Serve accepts tunnel connections on l until ctx is done.
+func (t *Tunnels) Serve(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for _, conn := range t.agents {
+			_ = conn.Close()
+		}
+		for _, client := range t.peers {
+			_ = client.Close()
+		}
+	}()
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go t.serveConn(ctx, nc)
+	}
+}
+
+// serveConn runs one connection: an agent's, registered for the lifetime
+// of the connection, or another replica's, which only opens PeerChannels.
+func (t *Tunnels) serveConn(ctx context.Context, nc net.Conn) {
+	logger := log.FromContext(ctx)
+	_ = nc.SetDeadline(time.Now().Add(tunnelHandshakeTimeout))
+	conn, chans, reqs, err := gossh.NewServerConn(nc, t.server)
+	if err != nil {
+		logger.V(1).Info("tunnel handshake failed", "remote", nc.RemoteAddr().String(), "err", err.Error())
+		_ = nc.Close()
+		return
+	}
+	_ = nc.SetDeadline(time.Time{})
+	go gossh.DiscardRequests(reqs)
+
+	if conn.User() == tunnel.GatewayPrincipal {
+		for newChan := range chans {
+			go t.handlePeer(ctx, newChan)
+		}
+		return
+	}
+
+	// The user was checked against the certificate during the handshake.
+	cluster, namespace, name, _ := tunnel.ParseUser(conn.User())
+	key := tunnelKey{cluster: cluster, namespace: namespace, name: name}
+	go func() {
+		for newChan := range chans {
+			_ = newChan.Reject(gossh.Prohibited, "agents open no channels")
+		}
+	}()
+	go tunnel.Keepalive(conn, tunnelKeepalive)
+
+	t.mu.Lock()
+	previous := t.agents[key]
+	t.agents[key] = conn
+	t.mu.Unlock()
+	if previous != nil {
+		_ = previous.Close()
+	}
+	if err := t.cfg.Registry.Claim(key.context(ctx), namespace, name, t.cfg.AdvertiseAddr); err != nil {
+		logger.Info("failed to claim tunnel", "sandbox", key.String(), "err", err.Error())
+	}
+	logger.V(1).Info("agent tunnel up", "sandbox", key.String(), "remote", nc.RemoteAddr().String())
+
+	_ = conn.Wait()
+
+	t.mu.Lock()
+	current := t.agents[key] == conn
+	if current {
+		delete(t.agents, key)
+	}
+	t.mu.Unlock()
+	if current {
+		// ctx may be done already; the release must still go through.
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tunnelHandshakeTimeout)
+		defer cancel()
+		if err := t.cfg.Registry.Release(key.context(releaseCtx), namespace, name, t.cfg.AdvertiseAddr); err != nil {
+			logger.Info("failed to release tunnel", "sandbox", key.String(), "err", err.Error())
+		}
+	}
+	logger.V(1).Info("agent tunnel down", "sandbox", key.String())
+}
+
+// handlePeer serves another replica's dial of a sandbox whose tunnel this
+// replica holds.
+func (t *Tunnels) handlePeer(ctx context.Context, newChan gossh.NewChannel) {
+	if newChan.ChannelType() != tunnel.PeerChannel {
+		_ = newChan.Reject(gossh.UnknownChannelType, "unsupported channel type")
+		return
+	}
+	var req tunnel.PeerRequest
+	if err := gossh.Unmarshal(newChan.ExtraData(), &req); err != nil {
+		_ = newChan.Reject(gossh.ConnectionFailed, "invalid peer-dial payload")
+		return
+	}
+	key := tunnelKey{cluster: req.Cluster, namespace: req.Namespace, name: req.Name}
+	agent := t.agent(key)
+	if agent == nil {
+		_ = newChan.Reject(gossh.ConnectionFailed, "no tunnel for this sandbox")
+		return
+	}
+	upstream, err := dialAgent(agent, req.Port, req.Origin)
+	if err != nil {
+		log.FromContext(ctx).V(1).Info("peer dial failed", "sandbox", key.String(), "err", err.Error())
+		_ = newChan.Reject(gossh.ConnectionFailed, "cannot reach sandbox")
+		return
+	}
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		_ = upstream.Close()
+		return
+	}
+	go gossh.DiscardRequests(reqs)
+	bridge(ch, upstream)
+}
+
+// DialSandbox reaches a port of the sandbox through its agent's tunnel:
+// directly when this replica holds it, else through the replica the
+// registry names. Without a tunnel it uses the fallback Dialer, or waits
+// for the agent to connect, as it does when the fallback cannot reach the
+// sandbox's cluster. The sandbox lives in the cluster ctx names.
+func (t *Tunnels) DialSandbox(ctx context.Context, sb *kubeparkv1alpha1.Sandbox, port int32) (net.Conn, error) {
+	key := tunnelKey{cluster: ClusterFromContext(ctx), namespace: sb.Namespace, name: sb.Name}
+	origin := fmt.Sprintf("%s/%d", t.cfg.AdvertiseAddr, t.seq.Add(1))
+	deadline := time.Now().Add(t.cfg.Wait)
+	for {
+		if agent := t.agent(key); agent != nil {
+			return dialAgent(agent, uint32(port), origin)
+		}
+		if conn, ok := t.dialPeer(ctx, key, uint32(port), origin); ok {
+			return conn, nil
+		}
+		if t.cfg.Fallback != nil {
+			// A fallback that cannot reach the cluster leaves the tunnel
+			// to wait for.
+			conn, err := t.cfg.Fallback.DialSandbox(ctx, sb, port)
+			var noRoute ErrNoRoute
+			if !errors.As(err, &noRoute) || noRoute.Cluster == "" {
+				return conn, err
+			}
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrNoRoute{Reason: "sandbox agent has no tunnel"}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(tunnelPollInterval):
+		}
+	}
+}
+
+func (t *Tunnels) agent(key tunnelKey) *gossh.ServerConn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.agents[key]
+}
+
+// dialAgent opens a DialChannel on an agent's connection.
+func dialAgent(agent *gossh.ServerConn, port uint32, origin string) (net.Conn, error) {
+	ch, reqs, err := agent.OpenChannel(tunnel.DialChannel, gossh.Marshal(tunnel.DialRequest{Port: port, Origin: origin}))
+	if err != nil {
+		return nil, fmt.Errorf("dial sandbox port %d through tunnel: %w", port, err)
+	}
+	go gossh.DiscardRequests(reqs)
+	return &tunnel.Conn{Channel: ch, Local: tunnel.Addr(origin), Remote: agent.RemoteAddr()}, nil
+}
+
+// dialPeer reaches the sandbox through the replica holding its tunnel. It
+// reports false when the registry names none, or the holder cannot reach
+// it (its claim may be stale).
+func (t *Tunnels) dialPeer(ctx context.Context, key tunnelKey, port uint32, origin string) (net.Conn, bool) {
+	logger := log.FromContext(ctx)
+	holder, err := t.cfg.Registry.Lookup(key.context(ctx), key.namespace, key.name)
+	if err != nil || holder == "" || holder == t.cfg.AdvertiseAddr {
+		return nil, false
+	}
+	client, err := t.peerClient(ctx, holder)
+	if err != nil {
+		logger.V(1).Info("cannot reach tunnel holder", "sandbox", key.String(), "holder", holder, "err", err.Error())
+		return nil, false
+	}
+	payload := gossh.Marshal(tunnel.PeerRequest{
+		Namespace: key.namespace, Name: key.name, Port: port, Origin: origin, Cluster: key.cluster,
+	})
+	ch, reqs, err := client.OpenChannel(tunnel.PeerChannel, payload)
+	if err != nil {
+		logger.V(1).Info("tunnel holder refused", "sandbox", key.String(), "holder", holder, "err", err.Error())
+		return nil, false
+	}
+	go gossh.DiscardRequests(reqs)
+	return &tunnel.Conn{Channel: ch, Local: tunnel.Addr(origin), Remote: client.RemoteAddr()}, true
+}
+
+// peerClient returns a connection to another replica, dialing it once and
+// sharing it among dials until it fails.
+func (t *Tunnels) peerClient(ctx context.Context, addr string) (*gossh.Client, error) {
+	t.mu.Lock()
+	client := t.peers[addr]
+	t.mu.Unlock()
+	if client != nil {
+		return client, nil
+	}
+
+	d := net.Dialer{Timeout: tunnelHandshakeTimeout}
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, chans, reqs, err := gossh.NewClientConn(nc, addr, t.peer)
+	if err != nil {
+		_ = nc.Close()
+		return nil, err
+	}
+	client = gossh.NewClient(conn, chans, reqs)
+
+	t.mu.Lock()
+	if existing := t.peers[addr]; existing != nil {
+		t.mu.Unlock()
+		_ = client.Close()
+		return existing, nil
+	}
+	t.peers[addr] = client
+	t.mu.Unlock()
+	go tunnel.Keepalive(client, tunnelKeepalive)
+	go func() {
+		_ = client.Wait()
+		t.mu.Lock()
+		if t.peers[addr] == client {
+			delete(t.peers, addr)
+		}
+		t.mu.Unlock()
+	}()
+	return client, nil
+}
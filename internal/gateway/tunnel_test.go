@@ -0,0 +1,485 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	kubeparkv1alpha1 "github.com/frauniki/kubepark/api/v1alpha1"
+	"github.com/frauniki/kubepark/internal/agent"
+	"github.com/frauniki/kubepark/internal/controller/podspec"
+	"github.com/frauniki/kubepark/internal/gateway"
+	"github.com/frauniki/kubepark/internal/sshca"
+	"github.com/frauniki/kubepark/internal/tunnel"
+)
+
+// memRegistry is a TunnelRegistry shared by the replicas of a test. A
+// member cluster's sandboxes are keyed <cluster>/<ns>/<name>.
+type memRegistry struct {
+	mu      sync.Mutex
+	holders map[string]string
+}
+
+func registryKey(ctx context.Context, ns, name string) string {
+	return tunnel.User(gateway.ClusterFromContext(ctx), ns, name)
+}
+
+func (r *memRegistry) Claim(ctx context.Context, ns, name, addr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.holders[registryKey(ctx, ns, name)] = addr
+	return nil
+}
+
+func (r *memRegistry) Release(ctx context.Context, ns, name, addr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if key := registryKey(ctx, ns, name); r.holders[key] == addr {
+		delete(r.holders, key)
+	}
+	return nil
+}
+
+func (r *memRegistry) Lookup(ctx context.Context, ns, name string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.holders[registryKey(ctx, ns, name)], nil
+}
+
+// clusterStores is a Store over one fakeStore per cluster, chosen by the
+// cluster the context names.
+type clusterStores map[string]*fakeStore
+
+func (s clusterStores) of(ctx context.Context) *fakeStore { return s[gateway.ClusterFromContext(ctx)] }
+
+func (s clusterStores) GetSandbox(ctx context.Context, ns, name string) (*kubeparkv1alpha1.Sandbox, error) {
+	if s.of(ctx) == nil {
+		return nil, gateway.ErrNoRoute{Reason: "unknown cluster"}
+	}
+	return s.of(ctx).GetSandbox(ctx, ns, name)
+}
+
+func (s clusterStores) SetDesiredRunning(ctx context.Context, sb *kubeparkv1alpha1.Sandbox) error {
+	return s.of(ctx).SetDesiredRunning(ctx, sb)
+}
+
+func (s clusterStores) CreateSession(ctx context.Context, session *kubeparkv1alpha1.SandboxSession) error {
+	return s.of(ctx).CreateSession(ctx, session)
+}
+
+func (s clusterStores) Heartbeat(ctx context.Context, ns, name string) error {
+	return s.of(ctx).Heartbeat(ctx, ns, name)
+}
+
+func (s clusterStores) SetSessionUpstream(ctx context.Context, ns, name, addr string) error {
+	return s.of(ctx).SetSessionUpstream(ctx, ns, name, addr)
+}
+
+func (s clusterStores) CloseSession(ctx context.Context, ns, name, reason string) error {
+	return s.of(ctx).CloseSession(ctx, ns, name, reason)
+}
+
+func (s clusterStores) GetUserProfile(ctx context.Context, principal string) (*kubeparkv1alpha1.UserProfile, error) {
+	return s[""].GetUserProfile(ctx, principal)
+}
+
+func (s clusterStores) PrincipalForKey(ctx context.Context, key gossh.PublicKey) (string, error) {
+	return s[""].PrincipalForKey(ctx, key)
+}
+
+func (s clusterStores) EnsureUserProfile(ctx context.Context, principal string) error {
+	return s[""].EnsureUserProfile(ctx, principal)
+}
+
+func (s clusterStores) GetAccessTarget(ctx context.Context, name string) (*kubeparkv1alpha1.AccessTarget, error) {
+	return s[""].GetAccessTarget(ctx, name)
+}
+
+func (r *memRegistry) holder(key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.holders[key]
+}
+
+// startTunnels runs a gateway replica's tunnel listener and returns it
+// with its address.
+func startTunnels(t *testing.T, hostCA []byte, gwHost []byte, registry gateway.TunnelRegistry) (*gateway.Tunnels, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tunnels, err := gateway.NewTunnels(gateway.TunnelConfig{
+		AdvertiseAddr: ln.Addr().String(),
+		HostKeyPEM:    gwHost,
+		HostCAPEM:     hostCA,
+		Registry:      registry,
+		Wait:          200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = tunnels.Serve(ctx, ln) }()
+	return tunnels, ln.Addr().String()
+}
+
+// startTunnelAgent runs an agent for alice/demo in cluster that serves
+// only through its reverse tunnel to tunnelAddr, presenting a host
+// certificate for principal.
+func startTunnelAgent(t *testing.T, userCA testCA, hostCA testCA, cluster string, principals []string, tunnelAddr string) {
+	t.Helper()
+	hostKP, err := sshca.GenerateKeyPair("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostPub, err := sshca.ParsePublicKey(hostKP.PublicAuthorized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostCert, err := sshca.SignHostCert(hostCA.signer, hostPub, principals, time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := agent.NewServer(agent.Config{
+		Addr:               ":2222",
+		Owner:              "alice@example.com",
+		HostKeyPEM:         hostKP.PrivatePEM,
+		HostCertAuthorized: gossh.MarshalAuthorizedKey(hostCert),
+		UserCAAuthorized:   userCA.pub,
+		HostCAAuthorized:   hostCA.pub,
+		TunnelAddr:         tunnelAddr,
+		Sandbox:            "demo",
+		Namespace:          "alice",
+		Cluster:            cluster,
+		HomeDir:            t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.ServeTunnel() }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	})
+}
+
+// hostCertSigner returns a fresh host key presenting a certificate for
+// principals.
+func hostCertSigner(t *testing.T, hostCA testCA, principals []string) gossh.Signer {
+	t.Helper()
+	kp, err := sshca.GenerateKeyPair("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := sshca.ParseSigner(kp.PrivatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := sshca.SignHostCert(hostCA.signer, key.PublicKey(), principals, time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewCertSigner(cert, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// hostCAPEM generates a host CA and returns it with its private key PEM.
+func hostCAPEM(t *testing.T) (testCA, []byte) {
+	t.Helper()
+	kp, err := sshca.GenerateKeyPair("host-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := sshca.ParseSigner(kp.PrivatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCA{signer: signer, pub: kp.PublicAuthorized}, kp.PrivatePEM
+}
+
+// TestTunnelAcrossReplicas proves a client on one gateway replica reaches
+// the agent and an exposed port through a reverse tunnel the agent holds
+// to another replica, with no route to the pod.
+func TestTunnelAcrossReplicas(t *testing.T) {
+	userCA := newCA(t, "user-ca")
+	hostCA, hostCAKey := hostCAPEM(t)
+	gwHost, err := sshca.GenerateKeyPair("gw-host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := &memRegistry{holders: map[string]string{}}
+	replicaA, _ := startTunnels(t, hostCAKey, gwHost.PrivatePEM, registry)
+	_, addrB := startTunnels(t, hostCAKey, gwHost.PrivatePEM, registry)
+	startTunnelAgent(t, userCA, hostCA, "", []string{"demo.alice"}, addrB)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for registry.holder(testSandboxKey) != addrB {
+		if time.Now().After(deadline) {
+			t.Fatal("the agent's tunnel was not registered")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	_, echoPort, _ := net.SplitHostPort(startEcho(t))
+	port, _ := strconv.Atoi(echoPort)
+	sb := sandbox("alice", "demo", "alice@example.com")
+	sb.Status.PodIP = "192.0.2.1" // unroutable: only the tunnel reaches it
+	sb.Spec.ExposedPorts = []kubeparkv1alpha1.ExposedPort{
+		{Name: "db", Port: int32(port), Kind: kubeparkv1alpha1.ExposedPortTCP},
+	}
+	store := &fakeStore{sandboxes: map[string]*kubeparkv1alpha1.Sandbox{testSandboxKey: sb}}
+	gwAddr := startGateway(t, userCA, store, replicaA)
+	cert := userCert(t, userCA, "alice@example.com")
+
+	conn, jump, err := dialGatewayJump(t, gwAddr, cert, testTarget)
+	if err != nil {
+		t.Fatalf("jump dial failed: %v", err)
+	}
+	defer func() { _ = jump.Close() }()
+	agentConn, chans, reqs, err := gossh.NewClientConn(conn, testTarget, &gossh.ClientConfig{
+		User:            "sandbox",
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(cert)},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("agent handshake through the tunnel failed: %v", err)
+	}
+	agentClient := gossh.NewClient(agentConn, chans, reqs)
+	defer func() { _ = agentClient.Close() }()
+	sess, err := agentClient.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := sess.Output("echo kubepark-ok")
+	if err != nil || string(out) != "kubepark-ok\n" {
+		t.Fatalf("exec through the tunnel: %q, %v", out, err)
+	}
+
+	echo, jump2, err := dialGatewayJump(t, gwAddr, cert, net.JoinHostPort("demo.alice", echoPort))
+	if err != nil {
+		t.Fatalf("exposed port through the tunnel: %v", err)
+	}
+	defer func() { _ = jump2.Close() }()
+	expectEcho(t, echo)
+}
+
+// TestTunnelRejectsForeignCertificate proves an agent cannot claim another
+// sandbox's tunnel, and that a dial without a tunnel fails.
+func TestTunnelRejectsForeignCertificate(t *testing.T) {
+	userCA := newCA(t, "user-ca")
+	hostCA, hostCAKey := hostCAPEM(t)
+	gwHost, err := sshca.GenerateKeyPair("gw-host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := &memRegistry{holders: map[string]string{}}
+	tunnels, addr := startTunnels(t, hostCAKey, gwHost.PrivatePEM, registry)
+	// A host certificate for another sandbox, claiming alice/demo.
+	startTunnelAgent(t, userCA, hostCA, "", []string{"other.alice"}, addr)
+
+	time.Sleep(300 * time.Millisecond)
+	if h := registry.holder(testSandboxKey); h != "" {
+		t.Fatalf("a foreign certificate claimed the tunnel (holder %q)", h)
+	}
+	_, err = tunnels.DialSandbox(context.Background(), sandbox("alice", "demo", "alice@example.com"), 2222)
+	var noRoute gateway.ErrNoRoute
+	if !errors.As(err, &noRoute) {
+		t.Fatalf("dial without a tunnel = %v, want ErrNoRoute", err)
+	}
+}
+
+// TestTunnelMemberNoDirectFallback proves a member cluster's sandbox
+// without a tunnel waits for one rather than falling back to its pod IP,
+// which on the gateway's network may be another pod.
+func TestTunnelMemberNoDirectFallback(t *testing.T) {
+	_, hostCAKey := hostCAPEM(t)
+	gwHost, err := sshca.GenerateKeyPair("gw-host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	accepted := make(chan struct{}, 1)
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			accepted <- struct{}{}
+			_ = conn.Close()
+		}
+	}()
+	tunnels, err := gateway.NewTunnels(gateway.TunnelConfig{
+		AdvertiseAddr: "127.0.0.1:0",
+		HostKeyPEM:    gwHost.PrivatePEM,
+		HostCAPEM:     hostCAKey,
+		Registry:      &memRegistry{holders: map[string]string{}},
+		Fallback:      gateway.NewDirectDialer(),
+		Wait:          200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The member's pod IP is an address the gateway could dial.
+	sb := sandbox("alice", "demo", "alice@example.com")
+	sb.Status.PodIP = "127.0.0.1"
+	port := int32(ln.Addr().(*net.TCPAddr).Port)
+
+	start := time.Now()
+	_, err = tunnels.DialSandbox(gateway.WithCluster(context.Background(), "tokyo"), sb, port)
+	var noRoute gateway.ErrNoRoute
+	if !errors.As(err, &noRoute) || time.Since(start) < 200*time.Millisecond {
+		t.Fatalf("member dial = %v after %v, want ErrNoRoute once the tunnel wait ends", err, time.Since(start))
+	}
+	select {
+	case <-accepted:
+		t.Fatal("the member's pod IP was dialed directly")
+	default:
+	}
+
+	// The gateway's own sandbox still falls back to it.
+	conn, err := tunnels.DialSandbox(context.Background(), sb, port)
+	if err != nil {
+		t.Fatalf("own cluster dial = %v, want the direct fallback", err)
+	}
+	_ = conn.Close()
+}
+
+// TestTunnelMemberCluster proves a client reaches a member cluster's
+// sandbox as <sandbox>.<namespace>.<cluster> through the tunnel its agent
+// holds, that its session is recorded in that cluster, and that the agent
+// cannot claim the same-named sandbox of the gateway's own cluster.
+func TestTunnelMemberCluster(t *testing.T) {
+	userCA := newCA(t, "user-ca")
+	hostCA, hostCAKey := hostCAPEM(t)
+	gwHost, err := sshca.GenerateKeyPair("gw-host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := &memRegistry{holders: map[string]string{}}
+	tunnels, addr := startTunnels(t, hostCAKey, gwHost.PrivatePEM, registry)
+	// Host certificates as each member's operator signs them.
+	sb := sandbox("alice", "demo", "alice@example.com")
+	startTunnelAgent(t, userCA, hostCA, "tokyo", podspec.FQDNPrincipals(sb, "tokyo"), addr)
+	// Another member's certificate, whose owner can read it, claims only
+	// that member's sandbox: not the gateway's own same-named one, nor
+	// tokyo's.
+	osaka := hostCertSigner(t, hostCA, podspec.FQDNPrincipals(sb, "osaka"))
+	for user, ok := range map[string]bool{
+		tunnel.User("osaka", "alice", "demo"): true,
+		tunnel.User("", "alice", "demo"):      false,
+		tunnel.User("tokyo", "alice", "demo"): false,
+	} {
+		conn, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+			User:            user,
+			Auth:            []gossh.AuthMethod{gossh.PublicKeys(osaka)},
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+			Timeout:         5 * time.Second,
+		})
+		if (err == nil) != ok {
+			t.Errorf("osaka's certificate as tunnel user %q: err = %v, want accepted %v", user, err, ok)
+		}
+		if err == nil {
+			_ = conn.Close()
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for registry.holder("tokyo/"+testSandboxKey) != addr {
+		if time.Now().After(deadline) {
+			t.Fatal("the member agent's tunnel was not registered")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if h := registry.holder(testSandboxKey); h != "" {
+		t.Fatalf("a member's certificate claimed the gateway's own sandbox (holder %q)", h)
+	}
+	if _, err := tunnels.DialSandbox(context.Background(), sandbox("alice", "demo", "bob@example.com"), 2222); err == nil {
+		t.Fatal("the member agent's tunnel served the gateway's own cluster")
+	}
+
+	member := sandbox("alice", "demo", "alice@example.com")
+	member.Status.PodIP = "192.0.2.1"
+	stores := clusterStores{
+		// The gateway's own cluster has a same-named sandbox of someone else.
+		"":      {sandboxes: map[string]*kubeparkv1alpha1.Sandbox{testSandboxKey: sandbox("alice", "demo", "bob@example.com")}},
+		"tokyo": {sandboxes: map[string]*kubeparkv1alpha1.Sandbox{testSandboxKey: member}},
+	}
+	gwAddr := startGateway(t, userCA, stores, tunnels)
+	cert := userCert(t, userCA, "alice@example.com")
+
+	if _, _, err := dialGatewayJump(t, gwAddr, cert, testTarget); err == nil {
+		t.Fatal("the gateway's own same-named sandbox was routed to alice")
+	}
+	conn, jump, err := dialGatewayJump(t, gwAddr, cert, "demo.alice.tokyo:22")
+	if err != nil {
+		t.Fatalf("jump dial to the member cluster failed: %v", err)
+	}
+	defer func() { _ = jump.Close() }()
+	agentConn, chans, reqs, err := gossh.NewClientConn(conn, "demo.alice.tokyo", &gossh.ClientConfig{
+		User:            "sandbox",
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(cert)},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("agent handshake through the member tunnel failed: %v", err)
+	}
+	agentClient := gossh.NewClient(agentConn, chans, reqs)
+	sess, err := agentClient.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := sess.Output("echo kubepark-ok"); err != nil || string(out) != "kubepark-ok\n" {
+		t.Fatalf("exec through the member tunnel: %q, %v", out, err)
+	}
+	_ = agentClient.Close()
+	_ = jump.Close()
+
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		stores["tokyo"].mu.Lock()
+		opened, closed := stores["tokyo"].opened, stores["tokyo"].closed
+		stores["tokyo"].mu.Unlock()
+		if opened == 1 && closed == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("member sessions opened %d, closed %d; want 1 and 1", opened, closed)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if stores[""].opened != 0 {
+		t.Fatal("a session was recorded in the gateway's own cluster")
+	}
+}
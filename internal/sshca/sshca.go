@@ -176,6 +176,32 @@ func CheckUserCert(cert *ssh.Certificate, caPub ssh.PublicKey, principal string,
 	return nil
 }
 
+// CheckHostCert validates that cert is a host certificate signed by caPub,
+// currently valid, and issued for principal. On the reverse tunnel the
+// agent and the gateway present host certificates to each other, the
+// agent as the client.
+func CheckHostCert(cert *ssh.Certificate, caPub ssh.PublicKey, principal string, now time.Time) error {
+	if cert == nil {
+		return errors.New("no certificate presented")
+	}
+	if cert.CertType != ssh.HostCert {
+		return fmt.Errorf("certificate is not a host certificate (type %d)", cert.CertType)
+	}
+	if !keysEqual(cert.SignatureKey, caPub) {
+		return errors.New("certificate not signed by the expected CA")
+	}
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, _ string) bool {
+			return keysEqual(auth, caPub)
+		},
+		Clock: func() time.Time { return now },
+	}
+	if err := checker.CheckCert(principal, cert); err != nil {
+		return fmt.Errorf("certificate check failed: %w", err)
+	}
+	return nil
+}
+
 // keysEqual compares two public keys by wire encoding in constant time.
 func keysEqual(a, b ssh.PublicKey) bool {
 	if a == nil || b == nil {
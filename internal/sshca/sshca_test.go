@@ -121,3 +121,26 @@ func TestCheckUserCert_Nil(t *testing.T) {
 		t.Fatal("expected nil cert to be rejected")
 	}
 }
+
+func TestCheckHostCert(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	caSigner, caPub := signerAndPub(t)
+	cert, err := SignHostCert(caSigner, userPub(t), []string{"demo.alice"}, time.Hour, now)
+	if err != nil {
+		t.Fatalf("SignHostCert: %v", err)
+	}
+	if err := CheckHostCert(cert, caPub, "demo.alice", now.Add(time.Minute)); err != nil {
+		t.Fatalf("expected valid host cert to pass, got: %v", err)
+	}
+	if err := CheckHostCert(cert, caPub, "other.alice", now.Add(time.Minute)); err == nil {
+		t.Error("expected principal mismatch to be rejected")
+	}
+	_, otherPub := signerAndPub(t)
+	if err := CheckHostCert(cert, otherPub, "demo.alice", now.Add(time.Minute)); err == nil {
+		t.Error("expected cert signed by a different CA to be rejected")
+	}
+	userCert, _ := SignUserCert(caSigner, userPub(t), "demo.alice", time.Hour, now)
+	if err := CheckHostCert(userCert, caPub, "demo.alice", now.Add(time.Minute)); err == nil {
+		t.Error("expected user cert to be rejected as a host cert")
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tunnel is the wire protocol of the reverse tunnel. A sandbox
+// agent keeps an SSH connection open to the gateway, authenticating as a
+// client with its host certificate, and the gateway opens channels over it
+// to reach ports of the pod. Gateway replicas use the same listener to
+// reach a tunnel another replica holds.
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// GatewayPrincipal is the host-certificate principal of the gateway's
+	// tunnel listener, and the user a replica connects to another as.
+	GatewayPrincipal = "kubepark-gateway"
+	// DialChannel is opened by the gateway on an agent's connection to
+	// reach a port of its pod. The payload is a DialRequest.
+	DialChannel = "dial@kubepark.dev"
+	// PeerChannel is opened by one gateway replica on another to reach a
+	// sandbox whose tunnel the other holds. The payload is a PeerRequest.
+	PeerChannel = "peer-dial@kubepark.dev"
+	// KeepaliveRequest is the global request each end sends to notice a
+	// dead peer.
+	KeepaliveRequest = "keepalive@openssh.com"
+)
+
+// DialRequest asks the agent to connect a channel to a port of its pod.
+type DialRequest struct {
+	Port uint32
+	// Origin names the gateway end of the connection. The agent reports
+	// it as the peer address, which joins its log to the session.
+	Origin string
+}
+
+// OriginPrefix starts the line a gateway sends ahead of the SSH version on
+// a port-forward to the agent, naming its origin as DialRequest.Origin does
+// on a tunnel: the agent otherwise sees the kubelet's loopback connection.
+// SSH servers skip lines before the version, so an agent that does not
+// know the line is unaffected.
+const OriginPrefix = "kubepark-origin "
+
+// PeerRequest asks a gateway replica to dial a sandbox through the tunnel
+// it holds.
+type PeerRequest struct {
+	Namespace string
+	Name      string
+	Port      uint32
+	Origin    string
+	// Cluster is the member cluster of the sandbox, "" for the gateway's
+	// own.
+	Cluster string
+}
+
+// User is the SSH user an agent connects as: the sandbox it serves,
+// prefixed with its cluster when that is a member cluster.
+func User(cluster, namespace, name string) string {
+	if cluster != "" {
+		return cluster + "/" + namespace + "/" + name
+	}
+	return namespace + "/" + name
+}
+
+// ParseUser splits an agent's SSH user into the sandbox's cluster,
+// namespace and name.
+func ParseUser(user string) (cluster, namespace, name string, err error) {
+	parts := strings.Split(user, "/")
+	if len(parts) == 3 {
+		cluster = parts[0]
+		parts = parts[1:]
+	}
+	if len(parts) != 2 || slices.Contains(parts, "") || strings.HasPrefix(user, "/") {
+		return "", "", "", fmt.Errorf("tunnel user %q is not [<cluster>/]<namespace>/<sandbox>", user)
+	}
+	return cluster, parts[0], parts[1], nil
+}
+
+// Principal is the host-certificate principal an agent must present for
+// the sandbox it claims to serve (see podspec.FQDNPrincipals). A member
+// cluster's agent presents the cluster-qualified name.
+func Principal(cluster, namespace, name string) string {
+	if cluster != "" {
+		return name + "." + namespace + "." + cluster
+	}
+	return name + "." + namespace
+}
+
+// Addr is an end of a tunneled connection, named by its origin.
+type Addr string
+
+func (a Addr) Network() string { return "kubepark-tunnel" }
+func (a Addr) String() string  { return string(a) }
+
+// Conn adapts an SSH channel to a net.Conn. Deadlines are not supported
+// and setting one is a no-op; either end closing the tunnel unblocks it.
+type Conn struct {
+	ssh.Channel
+	Local, Remote net.Addr
+}
+
+func (c *Conn) LocalAddr() net.Addr              { return c.Local }
+func (c *Conn) RemoteAddr() net.Addr             { return c.Remote }
+func (c *Conn) SetDeadline(time.Time) error      { return nil }
+func (c *Conn) SetReadDeadline(time.Time) error  { return nil }
+func (c *Conn) SetWriteDeadline(time.Time) error { return nil }
+
+// Keepalive sends a keepalive request on conn every interval and closes it
+// when one is not answered within an interval. It returns once conn is
+// closed.
+func Keepalive(conn ssh.Conn, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := conn.SendRequest(KeepaliveRequest, true, nil)
+			reply <- err
+		}()
+		select {
+		case err := <-reply:
+			if err != nil {
+				return
+			}
+		case <-time.After(interval):
+			_ = conn.Close()
+			return
+		}
+	}
+}
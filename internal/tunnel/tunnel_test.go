@@ -0,0 +1,37 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import "testing"
+
+func TestParseUser(t *testing.T) {
+	for _, tc := range []struct{ cluster, namespace, name string }{
+		{"", "alice", "demo"},
+		{"tokyo", "alice", "demo"},
+	} {
+		user := User(tc.cluster, tc.namespace, tc.name)
+		cluster, namespace, name, err := ParseUser(user)
+		if err != nil || cluster != tc.cluster || namespace != tc.namespace || name != tc.name {
+			t.Errorf("ParseUser(%q) = %q, %q, %q, %v", user, cluster, namespace, name, err)
+		}
+	}
+	for _, user := range []string{"demo", "alice/", "/demo", "/alice/demo", "tokyo//demo", "a/b/c/d"} {
+		if _, _, _, err := ParseUser(user); err == nil {
+			t.Errorf("ParseUser(%q) must fail", user)
+		}
+	}
+}